@@ -0,0 +1,143 @@
+// Package ai talks to the LLM behind usage analyses through a Provider:
+// OpenRouter, any OpenAI-compatible API, a local Ollama server, or a
+// deterministic Fake for development and tests. Providers built by New are
+// instrumented: every call is bounded by the configured timeout and
+// recorded in metrics, traces and logs with its tokens and cost.
+package ai
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/metrics"
+	"ET-SensorAPI/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+type Message struct {
+	Role    string
+	Content string
+}
+
+type Request struct {
+	Messages []Message
+}
+
+// Usage is what a call consumed. Cost is in USD; providers that do not
+// report it leave it 0.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+}
+
+// Response is the reply of the model that answered.
+type Response struct {
+	Content string
+	Model   string
+	Usage   Usage
+}
+
+// Provider completes chats. Complete must give up when ctx is done.
+type Provider interface {
+	// Name labels the provider in metrics, traces and logs.
+	Name() string
+	Complete(ctx context.Context, req Request) (*Response, error)
+}
+
+// Default chat endpoints of the providers.
+var defaultURLs = map[string]string{
+	config.AIProviderOpenRouter: "https://openrouter.ai/api/v1/chat/completions",
+	config.AIProviderOpenAI:     "https://api.openai.com/v1/chat/completions",
+	config.AIProviderOllama:     "http://localhost:11434/api/chat",
+}
+
+// New builds the instrumented Provider selected by cfg.Provider.
+func New(cfg config.AIConfig) (Provider, error) {
+	if cfg.URL == "" {
+		cfg.URL = defaultURLs[cfg.Provider]
+	}
+
+	var p Provider
+	switch cfg.Provider {
+	case config.AIProviderOpenRouter:
+		p = NewOpenRouter(cfg)
+	case config.AIProviderOpenAI:
+		p = NewOpenAI(cfg)
+	case config.AIProviderOllama:
+		p = NewOllama(cfg)
+	case config.AIProviderFake:
+		p = NewFake(FakeReply)
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q", cfg.Provider)
+	}
+	return Instrument(cfg, p), nil
+}
+
+// Instrument bounds every call of p by cfg.Timeout and records it in
+// metrics, traces and logs. The cost of calls that p does not report is
+// estimated from cfg's prices.
+func Instrument(cfg config.AIConfig, p Provider) Provider {
+	return &instrumented{Provider: p, cfg: cfg}
+}
+
+type instrumented struct {
+	Provider
+	cfg config.AIConfig
+}
+
+func (p *instrumented) Complete(ctx context.Context, req Request) (res *Response, err error) {
+	name := p.Name()
+	if p.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.Timeout)
+		defer cancel()
+	}
+
+	ctx, span := tracing.Start(ctx, "llm.complete", trace.WithAttributes(
+		attribute.String("llm.provider", name),
+		attribute.String("llm.model", p.cfg.Model),
+	))
+	start := time.Now()
+	defer func() {
+		metrics.ObserveLLM(name, start, err)
+		tracing.End(span, err)
+	}()
+
+	res, err = p.Provider.Complete(ctx, req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%s did not answer within %s: %w", name, p.cfg.Timeout, err)
+		}
+		return nil, err
+	}
+	if res.Model == "" {
+		res.Model = p.cfg.Model
+	}
+	if res.Usage.Cost == 0 {
+		res.Usage.Cost = (float64(res.Usage.InputTokens)*p.cfg.InputPrice + float64(res.Usage.OutputTokens)*p.cfg.OutputPrice) / 1e6
+	}
+
+	metrics.ObserveLLMUsage(name, res.Model, res.Usage.InputTokens, res.Usage.OutputTokens, res.Usage.Cost)
+	span.SetAttributes(
+		attribute.String("llm.response_model", res.Model),
+		attribute.Int("llm.input_tokens", res.Usage.InputTokens),
+		attribute.Int("llm.output_tokens", res.Usage.OutputTokens),
+		attribute.Float64("llm.cost_usd", res.Usage.Cost),
+	)
+	slog.InfoContext(ctx, "llm call completed", "provider", name, "model", res.Model,
+		"input_tokens", res.Usage.InputTokens, "output_tokens", res.Usage.OutputTokens,
+		"cost_usd", res.Usage.Cost, "duration", time.Since(start))
+	return res, nil
+}
@@ -0,0 +1,155 @@
+package ai
+
+import (
+	"ET-SensorAPI/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var prompt = Request{Messages: []Message{{Role: RoleUser, Content: "How much water did I use?"}}}
+
+// serve answers every request with reply after checking it with inspect.
+func serve(t *testing.T, inspect func(r *http.Request, body map[string]any), reply any) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		inspect(r, body)
+		json.NewEncoder(w).Encode(reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestOpenRouter(t *testing.T) {
+	url := serve(t, func(r *http.Request, body map[string]any) {
+		if r.Header.Get("Authorization") != "Bearer key" || body["model"] != "deepseek" {
+			t.Errorf("unexpected request %v %v", r.Header, body)
+		}
+		if usage, _ := body["usage"].(map[string]any); usage["include"] != true {
+			t.Errorf("the cost should be requested, got %v", body)
+		}
+	}, map[string]any{
+		"model":   "deepseek-v3",
+		"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": "Normal."}}},
+		"usage":   map[string]any{"prompt_tokens": 12, "completion_tokens": 3, "cost": 0.002},
+	})
+
+	cfg := config.AIConfig{Provider: config.AIProviderOpenRouter, URL: url, APIKey: "key", Model: "deepseek"}
+	res, err := NewOpenRouter(cfg).Complete(context.Background(), prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Response{Content: "Normal.", Model: "deepseek-v3", Usage: Usage{InputTokens: 12, OutputTokens: 3, Cost: 0.002}}
+	if *res != want {
+		t.Fatalf("got %+v, want %+v", *res, want)
+	}
+
+	cfg.APIKey = ""
+	if _, err := NewOpenRouter(cfg).Complete(context.Background(), prompt); err == nil || !strings.Contains(err.Error(), "AI_API_KEY") {
+		t.Fatalf("expected a missing key error, got %v", err)
+	}
+}
+
+func TestOpenAICompatibleWithoutKey(t *testing.T) {
+	url := serve(t, func(r *http.Request, body map[string]any) {
+		if r.Header.Get("Authorization") != "" || body["usage"] != nil {
+			t.Errorf("unexpected request %v %v", r.Header, body)
+		}
+	}, map[string]any{"choices": []any{}})
+
+	_, err := NewOpenAI(config.AIConfig{URL: url, Model: "local"}).Complete(context.Background(), prompt)
+	if err == nil || !strings.Contains(err.Error(), "no choices") {
+		t.Fatalf("expected an empty reply to fail, got %v", err)
+	}
+}
+
+func TestOllama(t *testing.T) {
+	url := serve(t, func(r *http.Request, body map[string]any) {
+		messages, _ := body["messages"].([]any)
+		if body["model"] != "llama3.1" || body["stream"] != false || len(messages) != 1 {
+			t.Errorf("unexpected request %v", body)
+		}
+	}, map[string]any{
+		"model":             "llama3.1",
+		"message":           map[string]any{"role": "assistant", "content": "Hemat."},
+		"prompt_eval_count": 20,
+		"eval_count":        4,
+	})
+
+	res, err := NewOllama(config.AIConfig{URL: url, Model: "llama3.1"}).Complete(context.Background(), prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "Hemat." || res.Usage.InputTokens != 20 || res.Usage.OutputTokens != 4 {
+		t.Fatalf("unexpected response %+v", res)
+	}
+}
+
+func TestInstrumentEstimatesCost(t *testing.T) {
+	fake := NewFake("one two three")
+	p := Instrument(config.AIConfig{Model: "fake", InputPrice: 1, OutputPrice: 2}, fake)
+
+	res, err := p.Complete(context.Background(), prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Usage.InputTokens != 6 || res.Usage.OutputTokens != 3 || res.Usage.Cost != 12e-6 {
+		t.Fatalf("unexpected usage %+v", res.Usage)
+	}
+	if got := fake.Prompts(); len(got) != 1 || got[0] != prompt.Messages[0].Content {
+		t.Fatalf("unexpected prompts %v", got)
+	}
+
+	fake.Fail(errors.New("boom"))
+	if _, err := p.Complete(context.Background(), prompt); err == nil {
+		t.Fatal("expected the failure to surface")
+	}
+}
+
+func TestInstrumentTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	cfg := config.AIConfig{Provider: config.AIProviderOllama, URL: srv.URL, Model: "slow", Timeout: 50 * time.Millisecond}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = p.Complete(context.Background(), prompt)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "did not answer within") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("the call should have been abandoned at the timeout")
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	p, err := New(config.AIConfig{Provider: config.AIProviderFake})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := p.Complete(context.Background(), prompt); err != nil || res.Content != FakeReply {
+		t.Fatalf("unexpected fake reply %+v, %v", res, err)
+	}
+	if _, err := New(config.AIConfig{Provider: "skynet"}); err == nil {
+		t.Fatal("expected an unknown provider to be rejected")
+	}
+}
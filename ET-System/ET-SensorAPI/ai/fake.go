@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"ET-SensorAPI/config"
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeReply is what the fake provider answers until told otherwise.
+const FakeReply = "Water usage looks normal."
+
+// Fake is a deterministic Provider: it answers every request with the same
+// reply, or fails with the same error, and records the prompts it was sent.
+// Tokens are counted as words.
+type Fake struct {
+	mu      sync.Mutex
+	reply   string
+	err     error
+	prompts []string
+}
+
+func NewFake(reply string) *Fake {
+	return &Fake{reply: reply}
+}
+
+func (f *Fake) Name() string { return config.AIProviderFake }
+
+// Reply sets the answer of later calls, which succeed again.
+func (f *Fake) Reply(content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reply, f.err = content, nil
+}
+
+// Fail makes later calls return err.
+func (f *Fake) Fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Prompts returns the user messages received so far.
+func (f *Fake) Prompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.prompts...)
+}
+
+func (f *Fake) Complete(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var input int
+	for _, m := range req.Messages {
+		if m.Role == RoleUser {
+			f.prompts = append(f.prompts, m.Content)
+		}
+		input += len(strings.Fields(m.Content))
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &Response{
+		Content: f.reply,
+		Model:   config.AIProviderFake,
+		Usage:   Usage{InputTokens: input, OutputTokens: len(strings.Fields(f.reply))},
+	}, nil
+}
@@ -0,0 +1,47 @@
+package ai
+
+import (
+	"ET-SensorAPI/config"
+	"context"
+	"fmt"
+)
+
+// NewOllama returns a Provider for the chat API of an Ollama server.
+func NewOllama(cfg config.AIConfig) Provider {
+	return &ollama{cfg: cfg}
+}
+
+type ollama struct {
+	cfg config.AIConfig
+}
+
+type ollamaRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+}
+
+type ollamaResponse struct {
+	Model           string      `json:"model"`
+	Message         chatMessage `json:"message"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+	EvalCount       int         `json:"eval_count"`
+}
+
+func (p *ollama) Name() string { return config.AIProviderOllama }
+
+func (p *ollama) Complete(ctx context.Context, req Request) (*Response, error) {
+	var out ollamaResponse
+	body := ollamaRequest{Model: p.cfg.Model, Messages: chatMessages(req)}
+	if err := postJSON(ctx, p.Name(), p.cfg.URL, nil, body, &out); err != nil {
+		return nil, err
+	}
+	if out.Message.Content == "" {
+		return nil, fmt.Errorf("%s returned an empty message", p.Name())
+	}
+	return &Response{
+		Content: out.Message.Content,
+		Model:   out.Model,
+		Usage:   Usage{InputTokens: out.PromptEvalCount, OutputTokens: out.EvalCount},
+	}, nil
+}
@@ -0,0 +1,150 @@
+package ai
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxErrorBody bounds how much of a failed response ends up in the error.
+const maxErrorBody = 512
+
+// NewOpenRouter returns a Provider for OpenRouter, which requires an API
+// key and reports the cost of every call.
+func NewOpenRouter(cfg config.AIConfig) Provider {
+	return &chatCompletions{
+		name:       config.AIProviderOpenRouter,
+		cfg:        cfg,
+		requireKey: true,
+		headers: map[string]string{
+			"HTTP-Referer": "https://api.interphaselabs.com",
+			"X-Title":      "Water Usage Analyzer",
+		},
+	}
+}
+
+// NewOpenAI returns a Provider for an OpenAI-compatible chat completions
+// API. Local servers often need no API key, so it is sent only when set.
+func NewOpenAI(cfg config.AIConfig) Provider {
+	return &chatCompletions{name: config.AIProviderOpenAI, cfg: cfg}
+}
+
+type chatCompletions struct {
+	name       string
+	cfg        config.AIConfig
+	requireKey bool
+	headers    map[string]string
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	// Usage asks OpenRouter to include the cost; other APIs ignore it.
+	Usage *struct {
+		Include bool `json:"include"`
+	} `json:"usage,omitempty"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int     `json:"prompt_tokens"`
+		CompletionTokens int     `json:"completion_tokens"`
+		Cost             float64 `json:"cost"`
+	} `json:"usage"`
+}
+
+func (p *chatCompletions) Name() string { return p.name }
+
+func (p *chatCompletions) Complete(ctx context.Context, req Request) (*Response, error) {
+	if p.requireKey && p.cfg.APIKey == "" {
+		return nil, fmt.Errorf("%s requires AI_API_KEY", p.name)
+	}
+
+	body := chatRequest{Model: p.cfg.Model, Messages: chatMessages(req)}
+	if p.name == config.AIProviderOpenRouter {
+		body.Usage = &struct {
+			Include bool `json:"include"`
+		}{Include: true}
+	}
+	var out chatResponse
+	if err := postJSON(ctx, p.name, p.cfg.URL, p.requestHeaders(), body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("%s returned no choices", p.name)
+	}
+	return &Response{
+		Content: out.Choices[0].Message.Content,
+		Model:   out.Model,
+		Usage: Usage{
+			InputTokens:  out.Usage.PromptTokens,
+			OutputTokens: out.Usage.CompletionTokens,
+			Cost:         out.Usage.Cost,
+		},
+	}, nil
+}
+
+func (p *chatCompletions) requestHeaders() map[string]string {
+	headers := map[string]string{}
+	for k, v := range p.headers {
+		headers[k] = v
+	}
+	if p.cfg.APIKey != "" {
+		headers["Authorization"] = "Bearer " + p.cfg.APIKey
+	}
+	return headers
+}
+
+func chatMessages(req Request) []chatMessage {
+	messages := make([]chatMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = chatMessage{Role: m.Role, Content: m.Content}
+	}
+	return messages
+}
+
+// postJSON posts body to url as JSON and decodes a 200 response into out.
+func postJSON(ctx context.Context, provider, url string, headers map[string]string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", provider, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := tracing.HTTPClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("%s API error [%d]: %s", provider, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid %s response: %w", provider, err)
+	}
+	return nil
+}
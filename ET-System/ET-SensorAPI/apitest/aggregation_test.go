@@ -0,0 +1,159 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func itoa(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func TestUsageSeriesBucketsInGroupTimezone(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, jakarta)
+
+	h.AddReadings(house.Kitchen,
+		apitest.Reading{At: start.Add(10 * time.Minute), FlowRate: 2, TotalUsage: 1},
+		apitest.Reading{At: start.Add(40 * time.Minute).UTC(), FlowRate: 4, TotalUsage: 2},
+		apitest.Reading{At: start.Add(135 * time.Minute), FlowRate: 6, TotalUsage: 5},
+	)
+	h.AddReadings(house.Garden, apitest.Reading{At: start.Add(20 * time.Minute), FlowRate: 9, TotalUsage: 3})
+
+	var out struct {
+		UsageSeries struct {
+			Timezone string
+			Points   []struct {
+				BucketStart time.Time
+				TotalUsage  float64
+				MaxFlow     float64
+				Samples     int
+			}
+		}
+	}
+	h.MustGraphQL(`query($group: Int!, $from: Time!, $to: Time!) {
+		usageSeries(groupId: $group, from: $from, to: $to, bucket: HOUR) {
+			timezone points { bucketStart totalUsage maxFlow samples }
+		}
+	}`, map[string]interface{}{
+		"group": house.Group.ID,
+		"from":  start.Format(time.RFC3339),
+		"to":    start.Add(3 * time.Hour).Format(time.RFC3339),
+	}, &out)
+
+	series := out.UsageSeries
+	if series.Timezone != "Asia/Jakarta" || len(series.Points) != 3 {
+		t.Fatalf("unexpected series: %+v", series)
+	}
+	wantTotals := []float64{6, 0, 5}
+	wantSamples := []int{3, 0, 1}
+	for i, p := range series.Points {
+		if !p.BucketStart.Equal(start.Add(time.Duration(i) * time.Hour)) {
+			t.Errorf("point %d starts at %v", i, p.BucketStart)
+		}
+		if p.TotalUsage != wantTotals[i] || p.Samples != wantSamples[i] {
+			t.Errorf("point %d: got total %v samples %d, want %v and %d", i, p.TotalUsage, p.Samples, wantTotals[i], wantSamples[i])
+		}
+	}
+	if series.Points[0].MaxFlow != 9 {
+		t.Errorf("expected max flow 9, got %v", series.Points[0].MaxFlow)
+	}
+}
+
+func TestCompareUsageAgainstPreviousDay(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	now := time.Now()
+	h.AddReadings(house.Kitchen,
+		apitest.Reading{At: now, FlowRate: 2, TotalUsage: 6},
+		apitest.Reading{At: now.AddDate(0, 0, -1), FlowRate: 2, TotalUsage: 4},
+	)
+
+	var out struct {
+		CompareUsage struct {
+			Current  struct{ TotalUsage float64 }
+			Previous struct{ TotalUsage float64 }
+			Change   float64
+		}
+	}
+	h.MustGraphQL(`query($device: String!) {
+		compareUsage(scope: DEVICE, deviceId: $device, period: DAY) {
+			current { totalUsage } previous { totalUsage } change
+		}
+	}`, map[string]interface{}{"device": house.Kitchen.ID}, &out)
+
+	c := out.CompareUsage
+	if c.Current.TotalUsage != 6 || c.Previous.TotalUsage != 4 || c.Change != 2 {
+		t.Fatalf("unexpected comparison: %+v", c)
+	}
+}
+
+func TestDeviceUsageShares(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	now := time.Now()
+	h.AddReadings(house.Kitchen, apitest.Reading{At: now, FlowRate: 1, TotalUsage: 3})
+	h.AddReadings(house.Garden, apitest.Reading{At: now, FlowRate: 1, TotalUsage: 1})
+
+	var out struct {
+		DeviceUsage []struct {
+			ID    string
+			Usage float64
+		}
+	}
+	h.MustGraphQL(`query($group: Int!) { deviceUsage(groupId: $group) { id Usage } }`,
+		map[string]interface{}{"group": house.Group.ID}, &out)
+
+	shares := map[string]float64{}
+	for _, d := range out.DeviceUsage {
+		shares[d.ID] = d.Usage
+	}
+	if math.Abs(shares[house.Kitchen.ID]-75) > 1e-9 || math.Abs(shares[house.Garden.ID]-25) > 1e-9 {
+		t.Fatalf("unexpected shares: %v", shares)
+	}
+}
+
+func TestUsageAnalysisUsesLLM(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.AddReadings(house.Kitchen, apitest.Reading{At: time.Now().Add(-time.Hour), FlowRate: 2, TotalUsage: 7})
+	h.LLM.Reply("Pemakaian stabil.")
+
+	res := h.Get("/deepseek/analysis")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", res.Code, res.Body)
+	}
+	var body struct{ Analysis string }
+	res.JSON(t, &body)
+	if body.Analysis != "Pemakaian stabil." {
+		t.Fatalf("unexpected analysis %q", body.Analysis)
+	}
+
+	var out struct {
+		GroupAiAnalysis struct{ Analysis string }
+	}
+	member := h.Login(house.Member.Email, "")
+	h.MustGraphQLAs(member.Token, `query($group: Int!) { groupAiAnalysis(groupID: $group) { analysis } }`,
+		map[string]interface{}{"group": house.Group.ID}, &out)
+	if out.GroupAiAnalysis.Analysis != "Pemakaian stabil." {
+		t.Fatalf("unexpected group analysis %q", out.GroupAiAnalysis.Analysis)
+	}
+
+	prompts := h.LLM.Prompts()
+	if len(prompts) != 2 || !strings.Contains(prompts[1], house.Kitchen.ID) {
+		t.Fatalf("prompt should include the readings: %v", prompts)
+	}
+
+	h.LLM.Fail(errors.New("upstream unavailable"))
+	if res := h.Get("/deepseek/analysis"); res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected LLM failure to surface, got %d", res.Code)
+	}
+}
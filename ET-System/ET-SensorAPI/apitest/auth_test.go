@@ -0,0 +1,189 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/routes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGraphQLRegisterVerifyAndLogin(t *testing.T) {
+	h := apitest.New(t)
+	const email = "new@ecotrack.test"
+
+	h.MustGraphQL(`mutation($email: String!) {
+		register(displayName: "New", email: $email, password: "password123")
+	}`, map[string]interface{}{"email": email}, nil)
+
+	mail := h.LastMailTo(email)
+	if !strings.Contains(mail.Subject, "Email Verification") {
+		t.Fatalf("unexpected subject %q", mail.Subject)
+	}
+	code := mail.Code()
+	if code == "" {
+		t.Fatal("verification mail has no code")
+	}
+
+	verify := `mutation($email: String!, $token: String!) { verifyEmail(email: $email, token: $token) }`
+	if res := h.GraphQL(verify, map[string]interface{}{"email": email, "token": "wrong"}); len(res.Errors) == 0 {
+		t.Fatal("expected an error for a wrong token")
+	}
+	h.MustGraphQL(verify, map[string]interface{}{"email": email, "token": code}, nil)
+
+	var login struct {
+		Login struct {
+			Challenge struct {
+				ChallengeID string
+				Methods     []string
+			}
+			Auth *struct{ Token string }
+		}
+	}
+	h.MustGraphQL(`mutation($email: String!) {
+		login(email: $email, password: "password123") { challenge { challengeId methods } auth { token } }
+	}`, map[string]interface{}{"email": email}, &login)
+
+	if login.Login.Auth != nil || len(login.Login.Challenge.Methods) != 1 || login.Login.Challenge.Methods[0] != "EMAIL" {
+		t.Fatalf("a login should wait for the emailed code: %+v", login.Login)
+	}
+	mail = h.LastMailTo(email)
+	if !strings.Contains(mail.Subject, "Login Approval Code") {
+		t.Fatalf("expected a login code mail, got %q", mail.Subject)
+	}
+
+	complete := `mutation($id: String!, $code: String!) {
+		completeLogin(challengeId: $id, code: $code) { token refreshToken user { email verified } }
+	}`
+	vars := map[string]interface{}{"id": login.Login.Challenge.ChallengeID, "code": "wrong!"}
+	if res := h.GraphQL(complete, vars); len(res.Errors) == 0 || res.Errors[0].Message != "invalid or expired code" {
+		t.Fatalf("expected a wrong code to be rejected, got %+v", res.Errors)
+	}
+	var completed struct {
+		CompleteLogin struct {
+			Token string
+			User  struct{ Verified bool }
+		}
+	}
+	vars["code"] = mail.Code()
+	h.MustGraphQL(complete, vars, &completed)
+	if completed.CompleteLogin.Token == "" || !completed.CompleteLogin.User.Verified {
+		t.Fatalf("unexpected login payload: %+v", completed.CompleteLogin)
+	}
+	if res := h.GraphQL(complete, vars); len(res.Errors) == 0 {
+		t.Fatal("a challenge should only be completed once")
+	}
+}
+
+func TestGraphQLLoginRejectsWrongPassword(t *testing.T) {
+	h := apitest.New(t)
+	h.CreateUser("user@ecotrack.test", "User", true)
+
+	res := h.GraphQL(`mutation { login(email: "user@ecotrack.test", password: "nope") { token } }`, nil)
+	if len(res.Errors) == 0 {
+		t.Fatal("expected login to fail")
+	}
+	if len(h.Mail.Messages()) != 0 {
+		t.Fatal("no mail should be sent for a failed login")
+	}
+}
+
+func TestRESTRegisterVerifyAndLogin(t *testing.T) {
+	h := apitest.New(t)
+	body := map[string]string{"email": "rest@ecotrack.test", "password": "password123"}
+
+	if res := h.Post("/api/v1/auth/register", body); res.Code != http.StatusCreated {
+		t.Fatalf("register: got %d: %s", res.Code, res.Body)
+	}
+	if res := h.Post("/api/v1/auth/register", body); res.Code != http.StatusConflict {
+		t.Fatalf("duplicate register: got %d", res.Code)
+	}
+
+	code := h.LastMailTo("rest@ecotrack.test").Code()
+	res := h.Post("/api/v1/auth/verify", map[string]string{"email": "rest@ecotrack.test", "token": code})
+	if res.Code != http.StatusOK {
+		t.Fatalf("verify: got %d: %s", res.Code, res.Body)
+	}
+
+	res = h.Post("/api/v1/auth/login", body)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("login: got %d: %s", res.Code, res.Body)
+	}
+	var challenge struct {
+		ChallengeID string `json:"challenge_id"`
+	}
+	res.JSON(t, &challenge)
+	res = h.Post("/api/v1/auth/login/complete", map[string]string{
+		"challenge_id": challenge.ChallengeID,
+		"code":         h.LastMailTo("rest@ecotrack.test").Code(),
+	})
+	if res.Code != http.StatusOK {
+		t.Fatalf("complete login: got %d: %s", res.Code, res.Body)
+	}
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	res.JSON(t, &tokens)
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("missing tokens: %s", res.Body)
+	}
+
+	res = h.Post("/api/v1/auth/login", map[string]string{"email": "rest@ecotrack.test", "password": "wrong"})
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: got %d", res.Code)
+	}
+}
+
+func TestDevMailShowsCapturedMails(t *testing.T) {
+	h := apitest.New(t)
+	body := map[string]string{"email": "dev@ecotrack.test", "password": "password123"}
+	if res := h.Post("/api/v1/auth/register", body); res.Code != http.StatusCreated {
+		t.Fatalf("register: got %d: %s", res.Code, res.Body)
+	}
+
+	var list struct {
+		Mails []struct {
+			Subject string   `json:"subject"`
+			To      []string `json:"to"`
+			URL     string   `json:"url"`
+		} `json:"mails"`
+	}
+	h.Get("/dev/mail?to=dev@ecotrack.test").JSON(t, &list)
+	if len(list.Mails) != 1 || !strings.Contains(list.Mails[0].Subject, "Email Verification") {
+		t.Fatalf("unexpected mail list: %+v", list.Mails)
+	}
+
+	res := h.Get(list.Mails[0].URL)
+	code := h.LastMailTo("dev@ecotrack.test").Code()
+	if res.Code != http.StatusOK || code == "" || !strings.Contains(res.Body.String(), code) {
+		t.Fatalf("mail page: got %d without code %q", res.Code, code)
+	}
+	if res := h.Post("/api/v1/auth/verify", map[string]string{"email": "dev@ecotrack.test", "token": code}); res.Code != http.StatusOK {
+		t.Fatalf("verify: got %d: %s", res.Code, res.Body)
+	}
+
+	if res := h.Do(http.MethodDelete, "/dev/mail", nil); res.Code != http.StatusNoContent {
+		t.Fatalf("clear: got %d", res.Code)
+	}
+	if res := h.Get(list.Mails[0].URL); res.Code != http.StatusNotFound {
+		t.Fatalf("cleared mail: got %d", res.Code)
+	}
+}
+
+func TestDevMailNeedsDevRoutes(t *testing.T) {
+	h := apitest.New(t)
+	cfg := *h.Config
+	cfg.DevRoutes = false
+	r := gin.New()
+	routes.SetupDevRoutes(r, &cfg, h.Mail)
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/dev/mail", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected /dev/mail to stay unmounted with the capture transport alone, got %d", res.Code)
+	}
+}
@@ -0,0 +1,152 @@
+package apitest
+
+import (
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/utils"
+	"context"
+	"time"
+	_ "time/tzdata"
+)
+
+// FixturePassword is the password of every user created by the fixtures.
+const FixturePassword = "password123"
+
+// CreateUser inserts a user with FixturePassword.
+func (h *Harness) CreateUser(email, displayName string, verified bool) *models.User {
+	h.T.Helper()
+	hashed, err := utils.HashPassword(FixturePassword)
+	if err != nil {
+		h.T.Fatalf("failed to hash password: %v", err)
+	}
+	user := &models.User{Email: email, DisplayName: displayName, Password: hashed, Verified: verified}
+	if err := h.Repos.Users.Create(context.Background(), user); err != nil {
+		h.T.Fatalf("failed to create user %s: %v", email, err)
+	}
+	return user
+}
+
+// Tokens are the access and refresh token of a session.
+type Tokens struct {
+	Token        string
+	RefreshToken string
+}
+
+// Login signs email in on deviceName with FixturePassword, completing the
+// login challenge with the mailed code.
+func (h *Harness) Login(email, deviceName string) Tokens {
+	h.T.Helper()
+	var login struct {
+		Login struct {
+			Challenge struct{ ChallengeID string }
+		}
+	}
+	h.MustGraphQL(`mutation($email: String!, $password: String!, $device: String) {
+		login(email: $email, password: $password, deviceName: $device) { challenge { challengeId } }
+	}`, map[string]interface{}{"email": email, "password": FixturePassword, "device": deviceName}, &login)
+
+	var complete struct{ CompleteLogin Tokens }
+	h.MustGraphQL(`mutation($id: String!, $code: String!) {
+		completeLogin(challengeId: $id, code: $code) { token refreshToken }
+	}`, map[string]interface{}{"id": login.Login.Challenge.ChallengeID, "code": h.LastMailTo(email).Code()}, &complete)
+	return complete.CompleteLogin
+}
+
+// CreateGroup inserts a group with admin as its admin and the other users as
+// plain members.
+func (h *Harness) CreateGroup(name, timezone string, admin *models.User, members ...*models.User) *models.UserGroup {
+	h.T.Helper()
+	ctx := context.Background()
+	group := &models.UserGroup{Name: name, Timezone: timezone, Location: models.JSONArray{}}
+	if err := h.Repos.Groups.Create(ctx, group); err != nil {
+		h.T.Fatalf("failed to create group %s: %v", name, err)
+	}
+
+	add := func(user *models.User, isAdmin bool) {
+		member := &models.UserGroupMember{UserID: user.ID, UserGroupID: group.ID, IsAdmin: isAdmin}
+		if err := h.Repos.Groups.AddMember(ctx, member); err != nil {
+			h.T.Fatalf("failed to add %s to %s: %v", user.Email, name, err)
+		}
+	}
+	if admin != nil {
+		add(admin, true)
+	}
+	for _, m := range members {
+		add(m, false)
+	}
+	return group
+}
+
+// CreateDevice inserts a device at location, registering the location on
+// the group like addDeviceToUserGroup does.
+func (h *Harness) CreateDevice(group *models.UserGroup, id, name, location string) *models.Device {
+	h.T.Helper()
+	ctx := context.Background()
+	device := &models.Device{ID: id, UserGroupID: group.ID, Name: name, Location: location}
+	if err := h.Repos.Devices.Create(ctx, device); err != nil {
+		h.T.Fatalf("failed to create device %s: %v", id, err)
+	}
+	if location != "" {
+		if err := h.Repos.Groups.AddLocation(ctx, group.ID, location); err != nil {
+			h.T.Fatalf("failed to add location %s: %v", location, err)
+		}
+		group.Location = append(group.Location, location)
+	}
+	device.UserGroup = *group
+	return device
+}
+
+// Reading is one fixture reading.
+type Reading struct {
+	At         time.Time
+	FlowRate   float64
+	TotalUsage float64
+}
+
+// AddReadings stores readings for device and folds them into the rollups,
+// the same way ingestion does.
+func (h *Harness) AddReadings(device *models.Device, readings ...Reading) {
+	h.T.Helper()
+	ctx := context.Background()
+	loc := utils.ResolveLocation(nil, &device.UserGroup)
+	for _, r := range readings {
+		usage := models.WaterUsage{
+			DeviceID:   device.ID,
+			FlowRate:   r.FlowRate,
+			TotalUsage: r.TotalUsage,
+			RecordedAt: r.At,
+			Resolution: models.ResolutionRaw,
+			Samples:    1,
+		}
+		if err := h.Repos.Usage.Create(ctx, &usage); err != nil {
+			h.T.Fatalf("failed to add reading: %v", err)
+		}
+		if err := h.Repos.Usage.AddToRollups(ctx, usage, loc); err != nil {
+			h.T.Fatalf("failed to roll up reading: %v", err)
+		}
+	}
+}
+
+// Household is the default fixture: one group with an admin, a member and
+// two devices in different locations.
+type Household struct {
+	Admin   *models.User
+	Member  *models.User
+	Group   *models.UserGroup
+	Kitchen *models.Device
+	Garden  *models.Device
+}
+
+// SeedHousehold loads the default fixture without readings.
+func (h *Harness) SeedHousehold() *Household {
+	h.T.Helper()
+	admin := h.CreateUser("admin@ecotrack.test", "Admin", true)
+	member := h.CreateUser("member@ecotrack.test", "Member", true)
+	group := h.CreateGroup("Household", "Asia/Jakarta", admin, member)
+	return &Household{
+		Admin:   admin,
+		Member:  member,
+		Group:   group,
+		Kitchen: h.CreateDevice(group, "ET-0001", "Kitchen Tap", "Kitchen"),
+		Garden:  h.CreateDevice(group, "ET-0002", "Garden Hose", "Garden"),
+	}
+}
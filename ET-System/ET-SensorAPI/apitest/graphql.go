@@ -0,0 +1,67 @@
+package apitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path"`
+	Extensions map[string]interface{} `json:"extensions"`
+}
+
+type GraphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []GraphQLError  `json:"errors"`
+}
+
+// Error joins the error messages, or returns "" when there were none.
+func (r *GraphQLResponse) Error() string {
+	messages := make([]string, len(r.Errors))
+	for i, e := range r.Errors {
+		messages[i] = e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// GraphQL runs an operation against /graphql/query and returns the raw
+// response, errors included.
+func (h *Harness) GraphQL(query string, variables map[string]interface{}) *GraphQLResponse {
+	h.T.Helper()
+	return h.GraphQLAs("", query, variables)
+}
+
+// GraphQLAs runs an operation as the holder of the access token.
+func (h *Harness) GraphQLAs(token, query string, variables map[string]interface{}) *GraphQLResponse {
+	h.T.Helper()
+	res := h.DoAs(token, http.MethodPost, "/graphql/query", map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	var out GraphQLResponse
+	res.JSON(h.T, &out)
+	return &out
+}
+
+// MustGraphQL runs an operation, fails the test on any GraphQL error and
+// decodes the data into out when it is not nil.
+func (h *Harness) MustGraphQL(query string, variables map[string]interface{}, out interface{}) {
+	h.T.Helper()
+	h.MustGraphQLAs("", query, variables, out)
+}
+
+// MustGraphQLAs is MustGraphQL as the holder of the access token.
+func (h *Harness) MustGraphQLAs(token, query string, variables map[string]interface{}, out interface{}) {
+	h.T.Helper()
+	res := h.GraphQLAs(token, query, variables)
+	if len(res.Errors) > 0 {
+		h.T.Fatalf("GraphQL errors: %s", res.Error())
+	}
+	if out != nil {
+		if err := json.Unmarshal(res.Data, out); err != nil {
+			h.T.Fatalf("failed to decode GraphQL data: %v\n%s", err, res.Data)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCreateGroupAndAddDevices(t *testing.T) {
+	h := apitest.New(t)
+	owner := h.CreateUser("owner@ecotrack.test", "Owner", true)
+
+	var created struct {
+		CreateUserGroup struct {
+			ID    string
+			Users []struct{ IsAdmin bool }
+		}
+	}
+	h.MustGraphQL(`mutation($userID: Int!) {
+		createUserGroup(userID: $userID, groupName: "Villa") { id users { isAdmin } }
+	}`, map[string]interface{}{"userID": owner.ID}, &created)
+
+	if len(created.CreateUserGroup.Users) != 1 || !created.CreateUserGroup.Users[0].IsAdmin {
+		t.Fatalf("creator should be the only admin: %+v", created.CreateUserGroup.Users)
+	}
+
+	addDevice := `mutation($id: String!, $group: Int!) {
+		addDeviceToUserGroup(deviceId: $id, deviceName: "Sink", userGroupID: $group, location: "Kitchen") {
+			devices { id location }
+		}
+	}`
+	var groupID int
+	fmt.Sscan(created.CreateUserGroup.ID, &groupID)
+
+	var added struct {
+		AddDeviceToUserGroup struct {
+			Devices []struct{ ID, Location string }
+		}
+	}
+	h.MustGraphQL(addDevice, map[string]interface{}{"id": "ET-ab12", "group": groupID}, &added)
+	if devices := added.AddDeviceToUserGroup.Devices; len(devices) != 1 || devices[0].ID != "ET-ab12" {
+		t.Fatalf("unexpected devices: %+v", devices)
+	}
+
+	if res := h.GraphQL(addDevice, map[string]interface{}{"id": "ET-ab12", "group": groupID}); len(res.Errors) == 0 {
+		t.Fatal("expected duplicate device to be rejected")
+	}
+	if res := h.GraphQL(addDevice, map[string]interface{}{"id": "XX-1", "group": groupID}); len(res.Errors) == 0 {
+		t.Fatal("expected invalid device ID to be rejected")
+	}
+}
+
+func TestAssignUserToGroupSendsInvitation(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	guest := h.CreateUser("guest@ecotrack.test", "Guest", true)
+
+	h.MustGraphQL(`mutation($group: Int!) {
+		assignUserToGroup(senderEmail: "admin@ecotrack.test", userGroupID: $group, receiverEmail: "guest@ecotrack.test")
+	}`, map[string]interface{}{"group": house.Group.ID}, nil)
+
+	mail := h.LastMailTo(guest.Email)
+	if !strings.Contains(mail.Subject, "Invited") || !strings.Contains(mail.HTML, house.Group.Name) {
+		t.Fatalf("unexpected invitation: %q", mail.Subject)
+	}
+
+	count, err := h.Repos.Groups.CountMembers(context.Background(), house.Group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 members, got %d", count)
+	}
+}
+
+func TestGroupMemberLimit(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	for i := 0; i < 3; i++ {
+		h.CreateUser(fmt.Sprintf("guest%d@ecotrack.test", i), "Guest", true)
+	}
+
+	assign := `mutation($group: Int!, $email: String!) {
+		assignUserToGroup(senderEmail: "admin@ecotrack.test", userGroupID: $group, receiverEmail: $email)
+	}`
+	for i := 0; i < 2; i++ {
+		h.MustGraphQL(assign, map[string]interface{}{
+			"group": house.Group.ID, "email": fmt.Sprintf("guest%d@ecotrack.test", i),
+		}, nil)
+	}
+
+	res := h.GraphQL(assign, map[string]interface{}{"group": house.Group.ID, "email": "guest2@ecotrack.test"})
+	if len(res.Errors) == 0 {
+		t.Fatal("expected the fifth member to be rejected")
+	}
+	if mails := h.MailsTo("guest2@ecotrack.test"); len(mails) != 0 {
+		t.Fatal("rejected member should not be invited")
+	}
+}
+
+func TestUserGroupsListsDevicesAndLocations(t *testing.T) {
+	h := apitest.New(t)
+	h.SeedHousehold()
+
+	var out struct {
+		UserGroups []struct {
+			Name     string
+			Location []string
+			Devices  []struct{ ID string }
+		}
+	}
+	h.MustGraphQL(`{ userGroups { name location devices { id } } }`, nil, &out)
+
+	if len(out.UserGroups) != 1 {
+		t.Fatalf("expected one group, got %d", len(out.UserGroups))
+	}
+	g := out.UserGroups[0]
+	if len(g.Devices) != 2 || strings.Join(g.Location, ",") != "Kitchen,Garden" {
+		t.Fatalf("unexpected group: %+v", g)
+	}
+}
@@ -0,0 +1,175 @@
+// Package apitest boots the whole API in-process for end-to-end tests: the
+// gin engine with every route, a fresh in-memory SQLite database, captured
+// mail and a fake LLM.
+package apitest
+
+import (
+	"ET-SensorAPI/ai"
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/health"
+	"ET-SensorAPI/i18n"
+	"ET-SensorAPI/logging"
+	"ET-SensorAPI/mail"
+	"ET-SensorAPI/metrics"
+	"ET-SensorAPI/migrations"
+	"ET-SensorAPI/queue"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/routes"
+	"ET-SensorAPI/scheduler"
+	"ET-SensorAPI/services"
+	"ET-SensorAPI/tracing"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type Harness struct {
+	T      testing.TB
+	Config *config.Config
+	DB     *gorm.DB
+	Repos  *repository.Repositories
+	Router *gin.Engine
+	// Jobs is never started; tests run jobs with Trigger.
+	Jobs *scheduler.Scheduler
+	// Queue is never started either; Do drains it after every request.
+	Queue *queue.Pool
+	Mail  *mail.Capture
+	LLM   *ai.Fake
+}
+
+// New starts a harness whose database and fakes are torn down with t.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Path = ":memory:"
+	cfg.Auth.JWTSecret = "apitest-secret"
+	cfg.DefaultLanguage = i18n.English
+	// Tests resend codes back to back; the throttle test turns this on.
+	cfg.OTP.ResendInterval = 0
+	// Likewise for rate limits; the rate limit tests turn them on.
+	cfg.RateLimit.Enabled = false
+	cfg.Mail = config.MailConfig{Transport: mail.TransportCapture, From: "EcoTrack <noreply@ecotrack.test>"}
+	cfg.DevRoutes = true
+	cfg.AI = config.AIConfig{Provider: config.AIProviderFake, Model: config.AIProviderFake, Timeout: 10 * time.Second}
+
+	db, err := config.ConnectDB(cfg.Database)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	db.Logger = logger.Discard
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	repos := repository.NewGorm(db, cfg.DefaultTimezone)
+	jobs, err := services.NewScheduler(cfg, repos, sqlDB)
+	if err != nil {
+		t.Fatalf("failed to set up jobs: %v", err)
+	}
+	t.Cleanup(func() { jobs.Stop(context.Background()) })
+	mailer := mail.NewCapture(cfg.Mail.From)
+	llm := ai.NewFake("Pemakaian air normal.")
+	provider := ai.Instrument(cfg.AI, llm)
+	pool := services.NewQueue(cfg, repos, mailer, provider)
+
+	r := gin.New()
+	r.Use(tracing.Middleware(cfg.Tracing.ServiceName))
+	r.Use(logging.RequestIDMiddleware(), logging.Recovery(), metrics.HTTP())
+	limiter := services.NewRateLimiter(cfg, repos)
+	routes.SetupRouter(r, cfg, repos, limiter)
+	routes.SetupGraphQLRoutes(r, cfg, repos, jobs, provider, limiter)
+	routes.SetupDeepSeekRoutes(r, cfg, repos, provider)
+	routes.SetupMetricsRoutes(r, cfg, sqlDB, repos)
+
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", sqlDB.PingContext)
+	checker.Add("migrations", func(ctx context.Context) error {
+		return migrations.EnsureCurrent(db.WithContext(ctx))
+	})
+	routes.SetupHealthRoutes(r, checker)
+	routes.SetupDevRoutes(r, cfg, mailer)
+
+	return &Harness{T: t, Config: cfg, DB: db, Repos: repos, Router: r, Jobs: jobs, Queue: pool, Mail: mailer, LLM: llm}
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	*httptest.ResponseRecorder
+}
+
+// JSON decodes the response body into v, failing the test on bad JSON.
+func (r Response) JSON(t testing.TB, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON response (%d): %v\n%s", r.Code, err, r.Body.String())
+	}
+}
+
+// Do sends a request to the router. A non-nil body is encoded as JSON.
+func (h *Harness) Do(method, path string, body interface{}) Response {
+	h.T.Helper()
+	return h.DoAs("", method, path, body)
+}
+
+// DoAs sends a request with token as its bearer access token, or none when
+// token is empty.
+func (h *Harness) DoAs(token, method, path string, body interface{}) Response {
+	h.T.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			h.T.Fatalf("failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.Router.ServeHTTP(rec, req)
+	if method != http.MethodGet {
+		h.DrainQueue()
+	}
+	return Response{rec}
+}
+
+// DrainQueue runs the queue jobs that are due, as the workers of a running
+// server would. Do calls it after every request but GETs, which enqueue
+// nothing.
+func (h *Harness) DrainQueue() {
+	h.T.Helper()
+	if _, err := h.Queue.Drain(context.Background()); err != nil {
+		h.T.Fatalf("failed to drain queue: %v", err)
+	}
+}
+
+func (h *Harness) Get(path string) Response {
+	h.T.Helper()
+	return h.Do(http.MethodGet, path, nil)
+}
+
+func (h *Harness) Post(path string, body interface{}) Response {
+	h.T.Helper()
+	return h.Do(http.MethodPost, path, body)
+}
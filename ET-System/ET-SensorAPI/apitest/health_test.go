@@ -0,0 +1,54 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"net/http"
+	"testing"
+)
+
+func TestHealthAndReadiness(t *testing.T) {
+	h := apitest.New(t)
+
+	if res := h.Get("/healthz"); res.Code != http.StatusOK {
+		t.Fatalf("healthz: got %d", res.Code)
+	}
+
+	var ready struct {
+		Status string
+		Checks map[string]string
+	}
+	res := h.Get("/readyz")
+	res.JSON(t, &ready)
+	if res.Code != http.StatusOK || ready.Checks["database"] != "ok" || ready.Checks["migrations"] != "ok" {
+		t.Fatalf("readyz: got %d %+v", res.Code, ready)
+	}
+
+	sqlDB, _ := h.DB.DB()
+	sqlDB.Close()
+
+	res = h.Get("/readyz")
+	res.JSON(t, &ready)
+	if res.Code != http.StatusServiceUnavailable || ready.Checks["database"] != "failing" {
+		t.Fatalf("readyz with the database gone: got %d %+v", res.Code, ready)
+	}
+	if res := h.Get("/healthz"); res.Code != http.StatusOK {
+		t.Fatalf("liveness should not depend on the database, got %d", res.Code)
+	}
+}
+
+func TestReadinessDoesNotMigrate(t *testing.T) {
+	h := apitest.New(t)
+	if err := h.DB.Migrator().DropTable("schema_migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	var ready struct{ Checks map[string]string }
+	res := h.Get("/readyz")
+	res.JSON(t, &ready)
+	if res.Code != http.StatusServiceUnavailable || ready.Checks["migrations"] != "failing" {
+		t.Fatalf("readyz without schema_migrations: got %d %+v", res.Code, ready)
+	}
+	if h.DB.Migrator().HasTable("schema_migrations") {
+		t.Fatal("the readiness check created schema_migrations")
+	}
+}
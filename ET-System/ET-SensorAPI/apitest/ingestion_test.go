@@ -0,0 +1,87 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIngestReadingUpdatesRollups(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+
+	for _, usage := range []float64{1.5, 2.5} {
+		res := h.Post("/api/v1/water-usage/", map[string]interface{}{
+			"device_id": house.Kitchen.ID, "flow_rate": 3.2, "total_usage": usage,
+		})
+		if res.Code != http.StatusCreated {
+			t.Fatalf("ingest: got %d: %s", res.Code, res.Body)
+		}
+	}
+
+	var total struct {
+		TotalUsage float64 `json:"total_usage"`
+	}
+	h.Get("/api/v1/water-usage/device/" + house.Kitchen.ID).JSON(t, &total)
+	if total.TotalUsage != 4 {
+		t.Fatalf("expected total 4, got %v", total.TotalUsage)
+	}
+
+	now := time.Now()
+	hourly, err := h.Repos.Usage.Hourly(context.Background(), house.Kitchen.ID, now.Add(-2*time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples int64
+	for _, row := range hourly {
+		samples += row.Samples
+	}
+	if samples != 2 {
+		t.Fatalf("expected 2 samples in the hourly rollups, got %d", samples)
+	}
+}
+
+func TestIngestRejectsInvalidReadings(t *testing.T) {
+	h := apitest.New(t)
+	h.SeedHousehold()
+
+	cases := []struct {
+		name string
+		body map[string]interface{}
+		want int
+	}{
+		{"non-positive usage", map[string]interface{}{"device_id": "ET-0001", "flow_rate": 1, "total_usage": 0}, http.StatusBadRequest},
+		{"bad device ID", map[string]interface{}{"device_id": "sensor-1", "flow_rate": 1, "total_usage": 1}, http.StatusBadRequest},
+		{"unknown device", map[string]interface{}{"device_id": "ET-ffff", "flow_rate": 1, "total_usage": 1}, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := h.Post("/api/v1/water-usage/", tc.body); res.Code != tc.want {
+				t.Fatalf("got %d, want %d: %s", res.Code, tc.want, res.Body)
+			}
+		})
+	}
+}
+
+func TestDeviceLogsOfGroup(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	now := time.Now()
+	h.AddReadings(house.Kitchen, apitest.Reading{At: now.Add(-time.Hour), FlowRate: 2, TotalUsage: 1})
+	h.AddReadings(house.Garden, apitest.Reading{At: now, FlowRate: 5, TotalUsage: 3})
+
+	var logs []struct {
+		DeviceName string  `json:"device_name"`
+		FlowRate   float64 `json:"flow_rate"`
+	}
+	res := h.Get("/api/v1/device-logs/group/" + itoa(house.Group.ID))
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", res.Code, res.Body)
+	}
+	res.JSON(t, &logs)
+	if len(logs) != 2 || logs[0].DeviceName != "Garden Hose" {
+		t.Fatalf("expected newest first, got %+v", logs)
+	}
+}
@@ -0,0 +1,101 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"testing"
+	"time"
+)
+
+type jobRun struct {
+	ID      string
+	Job     string
+	Trigger string
+	Status  string
+	Error   *string
+}
+
+func TestTriggerJobRecordsRun(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.Config.Auth.AdminEmails = []string{house.Admin.Email}
+	ops := h.Login(house.Admin.Email, "")
+
+	var triggered struct{ TriggerJob jobRun }
+	h.MustGraphQLAs(ops.Token, `mutation { triggerJob(name: "retention") { id job trigger status } }`, nil, &triggered)
+	if triggered.TriggerJob.Job != "retention" || triggered.TriggerJob.Trigger != "manual" {
+		t.Fatalf("unexpected run: %+v", triggered.TriggerJob)
+	}
+
+	var history struct{ JobRuns []jobRun }
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.MustGraphQLAs(ops.Token, `{ jobRuns(name: "retention") { id job trigger status error } }`, nil, &history)
+		if len(history.JobRuns) == 1 && history.JobRuns[0].Status != "running" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run did not finish: %+v", history.JobRuns)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if run := history.JobRuns[0]; run.ID != triggered.TriggerJob.ID || run.Status != "succeeded" || run.Error != nil {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+
+	var listed struct {
+		Jobs []struct {
+			Name     string
+			Schedule string
+			Timezone string
+			NextRun  time.Time
+			LastRun  *jobRun
+		}
+	}
+	h.MustGraphQLAs(ops.Token, `{ jobs { name schedule timezone nextRun lastRun { id status } } }`, nil, &listed)
+	if len(listed.Jobs) != 2 {
+		t.Fatalf("expected two jobs, got %+v", listed.Jobs)
+	}
+	for _, job := range listed.Jobs {
+		if job.Timezone != h.Config.DefaultTimezone || !job.NextRun.After(time.Now()) {
+			t.Errorf("unexpected job: %+v", job)
+		}
+		switch job.Name {
+		case "retention":
+			if job.Schedule != "30 2 * * *" || job.LastRun == nil || job.LastRun.ID != triggered.TriggerJob.ID {
+				t.Errorf("unexpected retention job: %+v", job)
+			}
+		case "usage_notifications":
+			if job.LastRun != nil {
+				t.Errorf("usage_notifications never ran, got %+v", job.LastRun)
+			}
+		}
+	}
+
+	res := h.GraphQLAs(ops.Token, `mutation { triggerJob(name: "nope") { id } }`, nil)
+	if res.Error() != `unknown job "nope"` {
+		t.Fatalf("expected an unknown job error, got %q", res.Error())
+	}
+}
+
+func TestJobsAreForAdminsOnly(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.Config.Auth.AdminEmails = []string{house.Admin.Email}
+	member := h.Login(house.Member.Email, "")
+
+	for _, query := range []string{
+		`mutation { triggerJob(name: "retention") { id } }`,
+		`mutation { checkUsageNotifications }`,
+		`{ jobs { name } }`,
+		`{ jobRuns { id } }`,
+		`{ queueJobs { id } }`,
+		`mutation { retryQueueJob(id: "1") { id } }`,
+	} {
+		if res := h.GraphQL(query, nil); res.Error() != "authentication required" {
+			t.Errorf("%s: expected anonymous callers to be refused, got %q", query, res.Error())
+		}
+		if res := h.GraphQLAs(member.Token, query, nil); res.Error() != "not allowed" {
+			t.Errorf("%s: expected non-admins to be refused, got %q", query, res.Error())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMailsFollowUserLanguage(t *testing.T) {
+	h := apitest.New(t)
+	const email = "budi@ecotrack.test"
+
+	res := h.GraphQL(`mutation { register(displayName: "Budi", email: "x@ecotrack.test", password: "password123", language: "fr") }`, nil)
+	if len(res.Errors) == 0 {
+		t.Fatal("expected unsupported languages to be rejected")
+	}
+
+	h.MustGraphQL(`mutation($email: String!) {
+		register(displayName: "Budi", email: $email, password: "password123", language: "id")
+	}`, map[string]interface{}{"email": email}, nil)
+
+	mail := h.LastMailTo(email)
+	if mail.Subject != "ECOTRACK | Verifikasi Email" || !strings.Contains(mail.HTML, `lang="id"`) {
+		t.Fatalf("expected an Indonesian mail, got %q", mail.Subject)
+	}
+	if code := mail.Code(); code == "" || !strings.Contains(mail.Text, code) {
+		t.Fatalf("text part should carry the code %q:\n%s", code, mail.Text)
+	}
+
+	user, err := h.Repos.Users.GetByEmail(t.Context(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.MustGraphQL(`mutation($id: Int!) { setUserLanguage(userID: $id, language: null) }`,
+		map[string]interface{}{"id": user.ID}, nil)
+	h.MustGraphQL(`mutation($email: String!) { ResendVerificationEmail(email: $email) }`,
+		map[string]interface{}{"email": email}, nil)
+
+	if mail := h.LastMailTo(email); mail.Subject != "ECOTRACK | Email Verification" {
+		t.Fatalf("cleared preference should use the default language, got %q", mail.Subject)
+	}
+}
+
+func TestUsageAnalysisPromptFollowsLanguage(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+
+	h.MustGraphQL(`mutation($id: Int!) { setUserLanguage(userID: $id, language: "id") }`,
+		map[string]interface{}{"id": house.Admin.ID}, nil)
+	admin := h.Login(house.Admin.Email, "")
+	h.MustGraphQLAs(admin.Token, `mutation($id: Int!) { requestUsageAnalysis(userID: $id) { id } }`,
+		map[string]interface{}{"id": house.Admin.ID}, nil)
+	h.MustGraphQLAs(admin.Token, `mutation($id: Int!) { requestUsageAnalysis(groupID: $id, language: "en") { id } }`,
+		map[string]interface{}{"id": house.Group.ID}, nil)
+
+	prompts := h.LLM.Prompts()
+	if len(prompts) != 2 {
+		t.Fatalf("expected 2 prompts, got %d", len(prompts))
+	}
+	if !strings.HasPrefix(prompts[0], "Buat laporan") {
+		t.Fatalf("user analysis should be prompted in Indonesian: %.60s", prompts[0])
+	}
+	if !strings.HasPrefix(prompts[1], "Write a water usage report") {
+		t.Fatalf("group analysis should be prompted in English: %.60s", prompts[1])
+	}
+}
+
+func TestStoredNotificationsFollowReaderLanguage(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.CreateUser("outsider@ecotrack.test", "Outsider", true)
+	stored := &models.Notification{
+		DeviceID:   house.Kitchen.ID,
+		MessageKey: "notification.usage.increased_short",
+		Threshold:  50,
+		CreatedAt:  time.Now(),
+	}
+	if err := h.Repos.Notifications.Create(t.Context(), stored); err != nil {
+		t.Fatal(err)
+	}
+
+	h.MustGraphQL(`mutation($id: Int!) { setUserLanguage(userID: $id, language: "id") }`,
+		map[string]interface{}{"id": house.Member.ID}, nil)
+	member := h.Login(house.Member.Email, "")
+	query := `query($id: Int!) { notifications(userID: $id) { id message } }`
+	vars := map[string]interface{}{"id": house.Member.ID}
+
+	var out struct {
+		Notifications []struct{ ID, Message string }
+	}
+	h.MustGraphQLAs(member.Token, query, vars, &out)
+	if len(out.Notifications) != 1 || out.Notifications[0].Message != "Penggunaan air meningkat sebesar 50.00% dibandingkan kemarin" {
+		t.Fatalf("expected the stored notification in Indonesian, got %+v", out.Notifications)
+	}
+
+	outsider := h.Login("outsider@ecotrack.test", "")
+	if res := h.GraphQLAs(outsider.Token, query, vars); res.Error() != "not allowed" {
+		t.Fatalf("expected outsiders to be refused, got %q", res.Error())
+	}
+}
@@ -0,0 +1,42 @@
+package apitest
+
+import (
+	"ET-SensorAPI/mail"
+	"regexp"
+)
+
+// Mail is a message captured by the harness.
+type Mail struct {
+	mail.Captured
+}
+
+var codePattern = regexp.MustCompile(`letter-spacing: 5px[^>]*>\s*([A-Za-z0-9]+)\s*<`)
+
+// Code extracts the verification code from a verification or login mail.
+func (m Mail) Code() string {
+	match := codePattern.FindStringSubmatch(m.HTML)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// MailsTo returns the messages sent to recipient, oldest first.
+func (h *Harness) MailsTo(recipient string) []Mail {
+	var mails []Mail
+	for _, m := range h.Mail.To(recipient) {
+		mails = append(mails, Mail{m})
+	}
+	return mails
+}
+
+// LastMailTo returns the newest message sent to recipient, failing the test
+// when there is none.
+func (h *Harness) LastMailTo(recipient string) Mail {
+	h.T.Helper()
+	mails := h.MailsTo(recipient)
+	if len(mails) == 0 {
+		h.T.Fatalf("no mail sent to %s", recipient)
+	}
+	return mails[len(mails)-1]
+}
@@ -0,0 +1,37 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.AddReadings(house.Kitchen, apitest.Reading{At: time.Now(), FlowRate: 1, TotalUsage: 1})
+
+	h.Post("/api/v1/water-usage/", map[string]interface{}{"device_id": house.Garden.ID, "flow_rate": 1, "total_usage": 2})
+	h.Post("/api/v1/water-usage/", map[string]interface{}{"device_id": "nope", "flow_rate": 1, "total_usage": 2})
+	h.MustGraphQL(`query MetricsGroups { userGroups { name } }`, nil, nil)
+
+	res := h.Get("/metrics")
+	if res.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", res.Code, res.Body)
+	}
+	body := res.Body.String()
+	for _, want := range []string{
+		`etsensor_http_requests_total{method="POST",route="/api/v1/water-usage/",status="201"}`,
+		`etsensor_ingest_readings_total{device="` + house.Garden.ID + `",reason="",result="accepted"}`,
+		`etsensor_ingest_readings_total{device="invalid",reason="invalid_device_id",result="rejected"}`,
+		`etsensor_graphql_operations_total{operation="MetricsGroups",result="ok"}`,
+		`etsensor_active_devices{window="15m0s"} 2`,
+		`go_sql_open_connections{db_name="main"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+}
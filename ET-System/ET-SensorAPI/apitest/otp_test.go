@@ -0,0 +1,109 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/models"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const verifyWithPurpose = `mutation($email: String!, $token: String!, $purpose: CodePurpose) {
+	verifyEmail(email: $email, token: $token, purpose: $purpose)
+}`
+
+func TestVerificationCodeExpires(t *testing.T) {
+	h := apitest.New(t)
+	const email = "late@ecotrack.test"
+	h.MustGraphQL(`mutation($email: String!) { register(displayName: "Late", email: $email, password: "password123") }`,
+		map[string]interface{}{"email": email}, nil)
+	code := h.LastMailTo(email).Code()
+
+	if !strings.Contains(h.LastMailTo(email).Text, "15 minutes") {
+		t.Fatalf("the mail should state the code lifetime:\n%s", h.LastMailTo(email).Text)
+	}
+	h.DB.Model(&models.OneTimeCode{}).Where("purpose = ?", models.CodeSignup).
+		Update("expires_at", time.Now().Add(-time.Second))
+
+	res := h.GraphQL(verifyWithPurpose, map[string]interface{}{"email": email, "token": code})
+	if len(res.Errors) == 0 || res.Errors[0].Message != "invalid or expired code" {
+		t.Fatalf("expected an expired code error, got %+v", res.Errors)
+	}
+}
+
+func TestVerificationCodeLocksAfterWrongGuesses(t *testing.T) {
+	h := apitest.New(t)
+	body := map[string]string{"email": "guess@ecotrack.test", "password": "password123"}
+	if res := h.Post("/api/v1/auth/register", body); res.Code != http.StatusCreated {
+		t.Fatalf("register: got %d: %s", res.Code, res.Body)
+	}
+	code := h.LastMailTo("guess@ecotrack.test").Code()
+
+	var res apitest.Response
+	for i := 0; i < h.Config.OTP.MaxAttempts; i++ {
+		res = h.Post("/api/v1/auth/verify", map[string]string{"email": "guess@ecotrack.test", "token": "wrong!"})
+	}
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("last wrong guess: got %d: %s", res.Code, res.Body)
+	}
+	if res := h.Post("/api/v1/auth/verify", map[string]string{"email": "guess@ecotrack.test", "token": code}); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("a locked code should stay locked, got %d", res.Code)
+	}
+
+	h.MustGraphQL(`mutation { ResendVerificationEmail(email: "guess@ecotrack.test") }`, nil, nil)
+	code = h.LastMailTo("guess@ecotrack.test").Code()
+	if res := h.Post("/api/v1/auth/verify", map[string]string{"email": "guess@ecotrack.test", "token": code}); res.Code != http.StatusOK {
+		t.Fatalf("a new code should unlock verification, got %d: %s", res.Code, res.Body)
+	}
+}
+
+func TestCodesAreBoundToTheirPurpose(t *testing.T) {
+	h := apitest.New(t)
+	user := h.CreateUser("bound@ecotrack.test", "Bound", true)
+
+	h.MustGraphQL(`mutation { RequestForgotPassword(email: "bound@ecotrack.test") }`, nil, nil)
+	mail := h.LastMailTo(user.Email)
+	if !strings.Contains(mail.Subject, "Password Reset") {
+		t.Fatalf("expected a reset mail, got %q", mail.Subject)
+	}
+
+	vars := map[string]interface{}{"email": user.Email, "token": mail.Code(), "purpose": "LOGIN"}
+	if res := h.GraphQL(verifyWithPurpose, vars); len(res.Errors) == 0 {
+		t.Fatal("a reset code should not approve a login")
+	}
+	h.MustGraphQL(`mutation($email: String!, $code: String!) { verifyResetCode(email: $email, code: $code) { token } }`,
+		map[string]interface{}{"email": user.Email, "code": mail.Code()}, nil)
+}
+
+func TestResendIsThrottled(t *testing.T) {
+	h := apitest.New(t)
+	h.Config.OTP.ResendInterval = time.Minute
+	h.CreateUser("busy@ecotrack.test", "Busy", false)
+
+	resend := `mutation { ResendVerificationEmail(email: "busy@ecotrack.test") }`
+	h.MustGraphQL(resend, nil, nil)
+	res := h.GraphQL(resend, nil)
+	if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, "please wait") {
+		t.Fatalf("expected the resend to be throttled, got %+v", res.Errors)
+	}
+	if got := len(h.MailsTo("busy@ecotrack.test")); got != 1 {
+		t.Fatalf("expected one mail, got %d", got)
+	}
+
+	var login struct {
+		Login struct {
+			Challenge struct{ ChallengeID string }
+		}
+	}
+	h.MustGraphQL(`mutation { login(email: "busy@ecotrack.test", password: "password123") { challenge { challengeId } } }`, nil, &login)
+	h.MustGraphQL(`mutation { login(email: "busy@ecotrack.test", password: "password123") { challenge { challengeId } } }`, nil, &login)
+	if login.Login.Challenge.ChallengeID == "" {
+		t.Fatal("a throttled login code should not fail the login")
+	}
+	if got := len(h.MailsTo("busy@ecotrack.test")); got != 2 {
+		t.Fatalf("expected one login code mail, got %d mails", got-1)
+	}
+	h.MustGraphQL(`mutation($id: String!, $code: String!) { completeLogin(challengeId: $id, code: $code) { token } }`,
+		map[string]interface{}{"id": login.Login.Challenge.ChallengeID, "code": h.LastMailTo("busy@ecotrack.test").Code()}, nil)
+}
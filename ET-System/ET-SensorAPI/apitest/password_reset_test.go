@@ -0,0 +1,79 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	verifyResetCode = `mutation($email: String!, $code: String!) {
+		verifyResetCode(email: $email, code: $code) { token expiresAt }
+	}`
+	resetPassword = `mutation($token: String!, $password: String!) {
+		resetPassword(resetToken: $token, newPassword: $password)
+	}`
+)
+
+func TestPasswordResetFlow(t *testing.T) {
+	h := apitest.New(t)
+	user := h.CreateUser("forgot@ecotrack.test", "Forgot", true)
+	login := map[string]string{"email": user.Email, "password": apitest.FixturePassword}
+
+	tokens := h.Login(user.Email, "")
+
+	h.MustGraphQL(`mutation($email: String!) { RequestForgotPassword(email: $email) }`,
+		map[string]interface{}{"email": user.Email}, nil)
+	code := h.LastMailTo(user.Email).Code()
+
+	if res := h.GraphQL(verifyResetCode, map[string]interface{}{"email": user.Email, "code": "wrong!"}); len(res.Errors) == 0 {
+		t.Fatal("a wrong reset code should not give a token")
+	}
+	var verified struct {
+		VerifyResetCode struct{ Token string }
+	}
+	h.MustGraphQL(verifyResetCode, map[string]interface{}{"email": user.Email, "code": code}, &verified)
+	token := verified.VerifyResetCode.Token
+	if res := h.GraphQL(verifyResetCode, map[string]interface{}{"email": user.Email, "code": code}); len(res.Errors) == 0 {
+		t.Fatal("a reset code should only be exchanged once")
+	}
+
+	gql := h.GraphQL(resetPassword, map[string]interface{}{"token": token, "password": "short"})
+	if len(gql.Errors) == 0 || !strings.Contains(gql.Errors[0].Message, "between 8 and 72") {
+		t.Fatalf("expected the password policy to apply, got %+v", gql.Errors)
+	}
+	h.MustGraphQL(resetPassword, map[string]interface{}{"token": token, "password": "new-password-42"}, nil)
+	if res := h.GraphQL(resetPassword, map[string]interface{}{"token": token, "password": "other-password-42"}); len(res.Errors) == 0 {
+		t.Fatal("a reset token should only be used once")
+	}
+
+	if mail := h.LastMailTo(user.Email); !strings.Contains(mail.Subject, "Password Was Changed") {
+		t.Fatalf("expected a password changed mail, got %q", mail.Subject)
+	}
+	if res := h.Post("/api/v1/auth/refresh", map[string]string{"refresh_token": tokens.RefreshToken}); res.Code != http.StatusUnauthorized {
+		t.Fatalf("the reset should revoke existing sessions, got %d", res.Code)
+	}
+	if res := h.Post("/api/v1/auth/login", login); res.Code != http.StatusUnauthorized {
+		t.Fatalf("the old password should no longer work, got %d", res.Code)
+	}
+	login["password"] = "new-password-42"
+	if res := h.Post("/api/v1/auth/login", login); res.Code != http.StatusAccepted {
+		t.Fatalf("the new password should work, got %d", res.Code)
+	}
+}
+
+func TestResetPasswordRejectsForgedTokens(t *testing.T) {
+	h := apitest.New(t)
+	user := h.CreateUser("target@ecotrack.test", "Target", true)
+
+	for _, token := range []string{"", "garbage", "1.", "1.forged-token-value"} {
+		res := h.GraphQL(resetPassword, map[string]interface{}{"token": token, "password": "new-password-42"})
+		if len(res.Errors) == 0 || res.Errors[0].Message != "invalid or expired token" {
+			t.Fatalf("token %q: expected an invalid token error, got %+v", token, res.Errors)
+		}
+	}
+	if len(h.MailsTo(user.Email)) != 0 {
+		t.Fatal("nothing should be mailed for forged tokens")
+	}
+}
@@ -0,0 +1,136 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/services"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type usageAnalysis struct {
+	ID       string
+	Status   string
+	Analysis *string
+	Error    *string
+}
+
+func TestUsageAnalysisRunsOnQueue(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.AddReadings(house.Kitchen, apitest.Reading{At: time.Now().Add(-time.Hour), FlowRate: 2, TotalUsage: 7})
+	h.LLM.Reply("Pemakaian stabil.")
+	member := h.Login(house.Member.Email, "")
+
+	var requested struct{ RequestUsageAnalysis usageAnalysis }
+	h.MustGraphQLAs(member.Token, `mutation($group: Int) { requestUsageAnalysis(groupID: $group) { id status } }`,
+		map[string]interface{}{"group": house.Group.ID}, &requested)
+	if requested.RequestUsageAnalysis.Status != "pending" {
+		t.Fatalf("expected a pending analysis, got %+v", requested.RequestUsageAnalysis)
+	}
+
+	var polled struct{ UsageAnalysis usageAnalysis }
+	h.MustGraphQLAs(member.Token, `query($id: ID!) { usageAnalysis(id: $id) { id status analysis error } }`,
+		map[string]interface{}{"id": requested.RequestUsageAnalysis.ID}, &polled)
+	if a := polled.UsageAnalysis; a.Status != "succeeded" || a.Analysis == nil || *a.Analysis != "Pemakaian stabil." {
+		t.Fatalf("unexpected analysis %+v", a)
+	}
+
+	res := h.GraphQLAs(member.Token, `mutation { requestUsageAnalysis { id } }`, nil)
+	if res.Error() != "set exactly one of userID and groupID" {
+		t.Fatalf("expected a validation error, got %q", res.Error())
+	}
+}
+
+func TestUsageAnalysisIsLimitedToOwnUsage(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.CreateUser("outsider@ecotrack.test", "Outsider", true)
+	member := h.Login(house.Member.Email, "")
+	outsider := h.Login("outsider@ecotrack.test", "")
+
+	var requested struct{ RequestUsageAnalysis usageAnalysis }
+	h.MustGraphQLAs(member.Token, `mutation($id: Int) { requestUsageAnalysis(userID: $id) { id } }`,
+		map[string]interface{}{"id": house.Member.ID}, &requested)
+
+	for _, call := range []struct {
+		query string
+		vars  map[string]interface{}
+	}{
+		{`mutation($id: Int) { requestUsageAnalysis(userID: $id) { id } }`, map[string]interface{}{"id": house.Member.ID}},
+		{`mutation($id: Int) { requestUsageAnalysis(groupID: $id) { id } }`, map[string]interface{}{"id": house.Group.ID}},
+		{`query($id: ID!) { usageAnalysis(id: $id) { id } }`, map[string]interface{}{"id": requested.RequestUsageAnalysis.ID}},
+	} {
+		if res := h.GraphQL(call.query, call.vars); res.Error() != "authentication required" {
+			t.Errorf("%s: expected anonymous callers to be refused, got %q", call.query, res.Error())
+		}
+		if res := h.GraphQLAs(outsider.Token, call.query, call.vars); res.Error() != "not allowed" {
+			t.Errorf("%s: expected outsiders to be refused, got %q", call.query, res.Error())
+		}
+	}
+}
+
+func TestFailedQueueJobIsRetried(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.LLM.Fail(errors.New("upstream unavailable"))
+	h.Config.Auth.AdminEmails = []string{house.Admin.Email}
+	ops := h.Login(house.Admin.Email, "")
+
+	var requested struct{ RequestUsageAnalysis usageAnalysis }
+	h.MustGraphQLAs(ops.Token, `mutation($group: Int) { requestUsageAnalysis(groupID: $group) { id } }`,
+		map[string]interface{}{"group": house.Group.ID}, &requested)
+
+	var listed struct {
+		QueueJobs []struct {
+			ID        string
+			Kind      string
+			Status    string
+			Attempts  int
+			RunAt     time.Time
+			LastError *string
+		}
+	}
+	h.MustGraphQLAs(ops.Token, `{ queueJobs(queue: "ai") { id kind status attempts runAt lastError } }`, nil, &listed)
+	if len(listed.QueueJobs) != 1 {
+		t.Fatalf("expected one ai job, got %+v", listed.QueueJobs)
+	}
+	job := listed.QueueJobs[0]
+	if job.ID != requested.RequestUsageAnalysis.ID || job.Status != "pending" || job.Attempts != 1 ||
+		job.LastError == nil || !job.RunAt.After(time.Now()) {
+		t.Fatalf("expected a failed attempt scheduled for retry, got %+v", job)
+	}
+
+	var polled struct{ UsageAnalysis usageAnalysis }
+	h.MustGraphQLAs(ops.Token, `query($id: ID!) { usageAnalysis(id: $id) { status analysis } }`,
+		map[string]interface{}{"id": job.ID}, &polled)
+	if polled.UsageAnalysis.Status != "pending" || polled.UsageAnalysis.Analysis != nil {
+		t.Fatalf("unexpected analysis %+v", polled.UsageAnalysis)
+	}
+
+	res := h.GraphQLAs(ops.Token, `mutation($id: ID!) { retryQueueJob(id: $id) { id } }`, map[string]interface{}{"id": job.ID})
+	if res.Error() != "only dead jobs can be retried" {
+		t.Fatalf("expected retry of a pending job to be refused, got %q", res.Error())
+	}
+}
+
+func TestSentCodesAreScrubbedFromTheQueue(t *testing.T) {
+	h := apitest.New(t)
+	const email = "scrub@ecotrack.test"
+
+	h.MustGraphQL(`mutation($email: String!) {
+		register(displayName: "Scrub", email: $email, password: "password123")
+	}`, map[string]interface{}{"email": email}, nil)
+	code := h.LastMailTo(email).Code()
+
+	var jobs []models.QueueJob
+	h.DB.Where("kind = ?", services.TaskVerificationEmail).Find(&jobs)
+	if len(jobs) != 1 || jobs[0].Status != models.QueueSucceeded {
+		t.Fatalf("expected one sent verification mail, got %+v", jobs)
+	}
+	if code == "" || strings.Contains(jobs[0].Payload, code) {
+		t.Fatalf("the sent job still stores its code: %s", jobs[0].Payload)
+	}
+}
@@ -0,0 +1,85 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/config"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginIsRateLimitedPerAccount(t *testing.T) {
+	h := apitest.New(t)
+	h.Config.RateLimit.Enabled = true
+	h.Config.RateLimit.AuthPerAccount = config.Rate{Count: 2, Period: time.Hour}
+	user := h.CreateUser("guessed@ecotrack.test", "Guessed", true)
+
+	wrong := map[string]string{"email": user.Email, "password": "wrong-password"}
+	for i := 0; i < 2; i++ {
+		if res := h.Post("/api/v1/auth/login", wrong); res.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d: %s", i+1, res.Code, res.Body)
+		}
+	}
+	wrong["email"] = " GUESSED@ecotrack.test"
+	res := h.Post("/api/v1/auth/login", wrong)
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the third attempt to be limited, got %d: %s", res.Code, res.Body)
+	}
+	if retry := res.Header().Get("Retry-After"); retry == "" || retry == "0" {
+		t.Fatalf("expected a Retry-After header, got %q", retry)
+	}
+
+	res2 := h.GraphQL(`mutation { login(email: "guessed@ecotrack.test", password: "password123") { auth { token } } }`, nil)
+	if len(res2.Errors) == 0 || res2.Errors[0].Extensions["code"] != "RATE_LIMITED" {
+		t.Fatalf("GraphQL should share the account's bucket, got %+v", res2.Errors)
+	}
+	if retry, _ := res2.Errors[0].Extensions["retryAfter"].(float64); retry < 1 {
+		t.Fatalf("expected retryAfter in seconds, got %v", res2.Errors[0].Extensions)
+	}
+
+	h.CreateUser("bystander@ecotrack.test", "Bystander", true)
+	h.Login("bystander@ecotrack.test", "")
+}
+
+func TestAuthIsRateLimitedPerIP(t *testing.T) {
+	h := apitest.New(t)
+	h.Config.RateLimit.Enabled = true
+	h.Config.RateLimit.AuthPerIP = config.Rate{Count: 3, Period: time.Minute}
+
+	forgot := `mutation($email: String!) { RequestForgotPassword(email: $email) }`
+	for _, email := range []string{"a@ecotrack.test", "b@ecotrack.test", "c@ecotrack.test"} {
+		h.GraphQL(forgot, map[string]interface{}{"email": email})
+	}
+	res := h.GraphQL(forgot, map[string]interface{}{"email": "d@ecotrack.test"})
+	if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, "too many requests") {
+		t.Fatalf("expected the fourth request to be limited, got %+v", res.Errors)
+	}
+	if res := h.Post("/api/v1/auth/register", map[string]string{"email": "e@ecotrack.test"}); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("REST auth should share the IP's bucket, got %d", res.Code)
+	}
+
+	h.Config.RateLimit.Enabled = false
+	h.CreateUser("d@ecotrack.test", "D", true)
+	h.MustGraphQL(forgot, map[string]interface{}{"email": "d@ecotrack.test"}, nil)
+}
+
+func TestIngestionIsRateLimitedPerDevice(t *testing.T) {
+	h := apitest.New(t)
+	h.Config.RateLimit.Enabled = true
+	h.Config.RateLimit.IngestPerDevice = config.Rate{Count: 1, Period: time.Minute}
+	house := h.SeedHousehold()
+
+	reading := func(device string) apitest.Response {
+		return h.Post("/api/v1/water-usage/", map[string]interface{}{"device_id": device, "flow_rate": 1, "total_usage": 1})
+	}
+	if res := reading(house.Kitchen.ID); res.Code != http.StatusCreated {
+		t.Fatalf("ingest: got %d: %s", res.Code, res.Body)
+	}
+	if res := reading(house.Kitchen.ID); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the second reading to be limited, got %d: %s", res.Code, res.Body)
+	}
+	if res := reading(house.Garden.ID); res.Code != http.StatusCreated {
+		t.Fatalf("other devices should not be limited, got %d: %s", res.Code, res.Body)
+	}
+}
@@ -0,0 +1,112 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/services"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDownsamplingKeepsPeakFlow(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	now := time.Now().UTC()
+	hour := now.AddDate(0, 0, -5).Truncate(time.Hour)
+	h.AddReadings(house.Kitchen,
+		apitest.Reading{At: hour.Add(5 * time.Minute), FlowRate: 2, TotalUsage: 1},
+		apitest.Reading{At: hour.Add(5*time.Minute + 20*time.Second), FlowRate: 8, TotalUsage: 1},
+		apitest.Reading{At: hour.Add(40 * time.Minute), FlowRate: 2, TotalUsage: 1},
+	)
+
+	retention := services.NewRetentionService(h.Repos.Devices, h.Repos.Groups, h.Repos.Usage,
+		services.RetentionSettings{RawDays: 1, MinuteDays: 3})
+	if _, err := retention.ApplyRetention(context.Background(), now, 0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var out struct {
+		UsageSeries struct {
+			Points []struct {
+				TotalUsage float64
+				MaxFlow    float64
+				Samples    int
+			}
+		}
+	}
+	h.MustGraphQL(`query($group: Int!, $from: Time!, $to: Time!) {
+		usageSeries(groupId: $group, from: $from, to: $to, bucket: HOUR) {
+			points { totalUsage maxFlow samples }
+		}
+	}`, map[string]interface{}{
+		"group": house.Group.ID,
+		"from":  hour.Format(time.RFC3339),
+		"to":    hour.Add(time.Hour).Format(time.RFC3339),
+	}, &out)
+
+	points := out.UsageSeries.Points
+	if len(points) != 1 || points[0].TotalUsage != 3 || points[0].Samples != 3 {
+		t.Fatalf("unexpected series: %+v", points)
+	}
+	if points[0].MaxFlow != 8 {
+		t.Fatalf("expected the peak of 8 to survive downsampling, got %v", points[0].MaxFlow)
+	}
+}
+
+func TestSetRetentionPolicyKeepsOmittedOverrides(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	admin := h.Login(house.Admin.Email, "")
+
+	type policy struct{ RawDays, MinuteDays, MaxAgeDays int }
+	set := func(args string) policy {
+		var out struct{ SetRetentionPolicy policy }
+		h.MustGraphQLAs(admin.Token, `mutation($id: Int!) { setRetentionPolicy(groupId: $id, `+args+`) { rawDays minuteDays maxAgeDays } }`,
+			map[string]interface{}{"id": house.Group.ID}, &out)
+		return out.SetRetentionPolicy
+	}
+
+	set("rawDays: 5, minuteDays: 20, maxAgeDays: 400")
+	if got := set("rawDays: 10"); got != (policy{10, 20, 400}) {
+		t.Fatalf("expected only rawDays to change, got %+v", got)
+	}
+
+	defaults := h.Config.Retention
+	if got := set("maxAgeDays: null"); got != (policy{10, 20, defaults.MaxAgeDays}) {
+		t.Fatalf("expected null to restore the default max age, got %+v", got)
+	}
+}
+
+func TestRetentionNeedsGroupAccess(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.CreateUser("outsider@ecotrack.test", "Outsider", true)
+	member := h.Login(house.Member.Email, "")
+	outsider := h.Login("outsider@ecotrack.test", "")
+	vars := map[string]interface{}{"id": house.Group.ID}
+
+	for _, call := range []struct {
+		query  string
+		vars   map[string]interface{}
+		member bool
+	}{
+		{`mutation($id: Int!) { setRetentionPolicy(groupId: $id, rawDays: 1) { rawDays } }`, vars, false},
+		{`query($id: Int) { retentionReport(groupId: $id) { devices { deviceId } } }`, vars, false},
+		{`{ retentionReport { devices { deviceId } } }`, nil, false},
+		{`query($id: Int!) { retentionPolicy(groupId: $id) { rawDays } }`, vars, true},
+	} {
+		if res := h.GraphQL(call.query, call.vars); res.Error() != "authentication required" {
+			t.Errorf("%s: expected anonymous callers to be refused, got %q", call.query, res.Error())
+		}
+		if res := h.GraphQLAs(outsider.Token, call.query, call.vars); res.Error() != "not allowed" {
+			t.Errorf("%s: expected outsiders to be refused, got %q", call.query, res.Error())
+		}
+		res := h.GraphQLAs(member.Token, call.query, call.vars)
+		if call.member && res.Error() != "" {
+			t.Errorf("%s: expected members to be allowed, got %q", call.query, res.Error())
+		}
+		if !call.member && res.Error() != "not allowed" {
+			t.Errorf("%s: expected members who are not admins to be refused, got %q", call.query, res.Error())
+		}
+	}
+}
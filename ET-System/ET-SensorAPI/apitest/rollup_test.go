@@ -0,0 +1,87 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/services"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRebuildKeepsNotifiedDays(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	ctx := context.Background()
+	at := time.Date(2026, 3, 10, 3, 0, 0, 0, time.UTC)
+	h.AddReadings(house.Kitchen, apitest.Reading{At: at, FlowRate: 2, TotalUsage: 5})
+
+	date := repository.RollupDate(at, time.FixedZone("WIB", 7*3600))
+	daily, err := h.Repos.Usage.GetDaily(ctx, house.Kitchen.ID, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Repos.Usage.MarkNotified(ctx, daily); err != nil {
+		t.Fatal(err)
+	}
+
+	rollups := services.NewRollupService(h.Repos.Devices, h.Repos.Usage)
+	if err := rollups.RebuildRollups(ctx, house.Kitchen.ID, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	daily, err = h.Repos.Usage.GetDaily(ctx, house.Kitchen.ID, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !daily.Notified || daily.TotalUsage != 5 {
+		t.Fatalf("expected the rebuilt day to stay notified, got %+v", daily)
+	}
+}
+
+func TestGroupTimezoneChangeRebuildsDailyRollups(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	ctx := context.Background()
+	// 20:00 UTC is already the next day in Jakarta.
+	at := time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+	h.AddReadings(house.Kitchen, apitest.Reading{At: at, FlowRate: 2, TotalUsage: 5})
+
+	query := `mutation($id: Int!) { setGroupTimezone(groupId: $id, timezone: "UTC") }`
+	vars := map[string]interface{}{"id": house.Group.ID}
+	member := h.Login(house.Member.Email, "")
+	if res := h.GraphQLAs(member.Token, query, vars); res.Error() != "not allowed" {
+		t.Fatalf("expected members who are not admins to be refused, got %q", res.Error())
+	}
+	admin := h.Login(house.Admin.Email, "")
+	h.MustGraphQLAs(admin.Token, query, vars, nil)
+
+	daily, err := h.Repos.Usage.GetDaily(ctx, house.Kitchen.ID, repository.RollupDate(at, time.UTC))
+	if err != nil || daily.TotalUsage != 5 {
+		t.Fatalf("expected the reading on its UTC day, got %+v, %v", daily, err)
+	}
+	if _, err := h.Repos.Usage.GetDaily(ctx, house.Kitchen.ID, repository.RollupDate(at.Add(24*time.Hour), time.UTC)); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("expected the Jakarta day to be gone, got %v", err)
+	}
+}
+
+func TestSumUsageFollowsHalfHourOffsets(t *testing.T) {
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.AddReadings(house.Kitchen,
+		apitest.Reading{At: time.Date(2026, 3, 10, 18, 15, 0, 0, time.UTC), FlowRate: 1, TotalUsage: 1},
+		apitest.Reading{At: time.Date(2026, 3, 10, 18, 45, 0, 0, time.UTC), FlowRate: 1, TotalUsage: 2},
+		apitest.Reading{At: time.Date(2026, 3, 11, 6, 0, 0, 0, time.UTC), FlowRate: 1, TotalUsage: 4},
+	)
+
+	// March 11 in Kolkata starts at 18:30 UTC on March 10.
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	start := time.Date(2026, 3, 11, 0, 0, 0, 0, kolkata)
+	total, err := h.Repos.Usage.SumUsage(context.Background(), house.Kitchen.ID, start, start.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 6 {
+		t.Fatalf("expected 6 for the Kolkata day, got %v", total)
+	}
+}
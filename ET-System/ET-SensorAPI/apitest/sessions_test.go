@@ -0,0 +1,130 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/models"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const (
+	refreshSession = `mutation($token: String!) {
+		refreshToken(refreshToken: $token) { token refreshToken user { email } }
+	}`
+	listSessions = `{ sessions { id deviceName current } }`
+)
+
+type sessionList struct {
+	Sessions []struct {
+		ID         string
+		DeviceName *string
+		Current    bool
+	}
+}
+
+func TestSessionsPerDevice(t *testing.T) {
+	h := apitest.New(t)
+	user := h.CreateUser("devices@ecotrack.test", "Devices", true)
+	phone := h.Login(user.Email, "Phone")
+	laptop := h.Login(user.Email, "Laptop")
+
+	var list sessionList
+	h.MustGraphQLAs(phone.Token, listSessions, nil, &list)
+	if len(list.Sessions) != 2 {
+		t.Fatalf("expected two sessions, got %+v", list.Sessions)
+	}
+	var laptopID string
+	for _, s := range list.Sessions {
+		if *s.DeviceName == "Phone" != s.Current {
+			t.Fatalf("only the phone session should be current: %+v", list.Sessions)
+		}
+		if *s.DeviceName == "Laptop" {
+			laptopID = s.ID
+		}
+	}
+
+	h.MustGraphQLAs(phone.Token, `mutation($id: ID!) { revokeSession(id: $id) }`, map[string]interface{}{"id": laptopID}, nil)
+	if res := h.GraphQLAs(laptop.Token, listSessions, nil); len(res.Errors) == 0 || res.Errors[0].Message != "authentication required" {
+		t.Fatalf("a revoked session's access token should be rejected, got %+v", res.Errors)
+	}
+	if res := h.GraphQL(refreshSession, map[string]interface{}{"token": laptop.RefreshToken}); len(res.Errors) == 0 {
+		t.Fatal("a revoked session should not refresh")
+	}
+
+	other := h.CreateUser("other@ecotrack.test", "Other", true)
+	otherSession := h.Login(other.Email, "")
+	h.MustGraphQLAs(otherSession.Token, listSessions, nil, &list)
+	if res := h.GraphQLAs(phone.Token, `mutation($id: ID!) { revokeSession(id: $id) }`, map[string]interface{}{"id": list.Sessions[0].ID}); len(res.Errors) == 0 {
+		t.Fatal("another user's session should not be revocable")
+	}
+
+	h.MustGraphQLAs(phone.Token, `mutation { logout }`, nil, nil)
+	if res := h.GraphQLAs(phone.Token, listSessions, nil); len(res.Errors) == 0 {
+		t.Fatal("logout should end the current session")
+	}
+	h.MustGraphQLAs(otherSession.Token, listSessions, nil, nil)
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	h := apitest.New(t)
+	user := h.CreateUser("rotate@ecotrack.test", "Rotate", true)
+	first := h.Login(user.Email, "Tablet")
+
+	var refreshed struct{ RefreshToken apitest.Tokens }
+	h.MustGraphQL(refreshSession, map[string]interface{}{"token": first.RefreshToken}, &refreshed)
+	second := refreshed.RefreshToken
+	if second.RefreshToken == first.RefreshToken || second.Token == "" {
+		t.Fatal("refreshing should rotate the refresh token")
+	}
+	if res := h.GraphQL(refreshSession, map[string]interface{}{"token": first.Token}); len(res.Errors) == 0 {
+		t.Fatal("an access token should not be accepted as a refresh token")
+	}
+
+	res := h.GraphQL(refreshSession, map[string]interface{}{"token": first.RefreshToken})
+	if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, "already used") {
+		t.Fatalf("expected reuse to be detected, got %+v", res.Errors)
+	}
+	if res := h.GraphQL(refreshSession, map[string]interface{}{"token": second.RefreshToken}); len(res.Errors) == 0 {
+		t.Fatal("reuse should revoke the whole session")
+	}
+	var session models.Session
+	h.DB.First(&session)
+	if session.RevokeReason != models.RevokedReuse {
+		t.Fatalf("expected the session to be revoked for reuse, got %q", session.RevokeReason)
+	}
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	h := apitest.New(t)
+	user := h.CreateUser("everywhere@ecotrack.test", "Everywhere", true)
+	web := h.Login(user.Email, "Web")
+	res := h.Post("/api/v1/auth/login", map[string]string{"email": user.Email, "password": apitest.FixturePassword, "device_name": "CLI"})
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("login: got %d", res.Code)
+	}
+	var challenge struct {
+		ChallengeID string `json:"challenge_id"`
+	}
+	res.JSON(t, &challenge)
+	res = h.Post("/api/v1/auth/login/complete", map[string]string{"challenge_id": challenge.ChallengeID, "code": h.LastMailTo(user.Email).Code()})
+	if res.Code != http.StatusOK {
+		t.Fatalf("complete login: got %d: %s", res.Code, res.Body)
+	}
+	var cli struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	res.JSON(t, &cli)
+
+	if res := h.GraphQL(`mutation { logoutEverywhere }`, nil); len(res.Errors) == 0 || res.Errors[0].Message != "authentication required" {
+		t.Fatalf("logoutEverywhere should need a session, got %+v", res.Errors)
+	}
+	var out struct{ LogoutEverywhere string }
+	h.MustGraphQLAs(web.Token, `mutation { logoutEverywhere }`, nil, &out)
+	if out.LogoutEverywhere != "Logged out of 2 sessions" {
+		t.Fatalf("unexpected result %q", out.LogoutEverywhere)
+	}
+	if res := h.Post("/api/v1/auth/refresh", map[string]string{"refresh_token": cli.RefreshToken}); res.Code != http.StatusUnauthorized {
+		t.Fatalf("the CLI session should be revoked, got %d", res.Code)
+	}
+}
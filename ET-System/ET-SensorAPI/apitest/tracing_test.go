@@ -0,0 +1,41 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"testing"
+	"time"
+)
+
+func TestRequestIsTracedEndToEnd(t *testing.T) {
+	spans := apitest.RecordSpans(t)
+	h := apitest.New(t)
+	house := h.SeedHousehold()
+	h.AddReadings(house.Kitchen, apitest.Reading{At: time.Now().Add(-time.Hour), FlowRate: 2, TotalUsage: 7})
+	h.LLM.Reply("Hemat.")
+	member := h.Login(house.Member.Email, "")
+	spans.Reset()
+
+	h.MustGraphQLAs(member.Token, `query Analysis($group: Int!) { groupAiAnalysis(groupID: $group) { analysis } }`,
+		map[string]interface{}{"group": house.Group.ID}, nil)
+
+	byName := map[string]string{}
+	for _, s := range spans.GetSpans() {
+		byName[s.Name] = s.SpanContext.TraceID().String()
+	}
+	server, ok := byName["/graphql/query"]
+	if !ok {
+		t.Fatalf("no server span among %v", byName)
+	}
+	for _, name := range []string{
+		"graphql.query Analysis",
+		"graphql.resolve Query.groupAiAnalysis",
+		"gorm.query",
+		"llm.complete",
+	} {
+		if trace, ok := byName[name]; !ok {
+			t.Errorf("missing span %q among %v", name, byName)
+		} else if trace != server {
+			t.Errorf("span %q is not part of the request trace", name)
+		}
+	}
+}
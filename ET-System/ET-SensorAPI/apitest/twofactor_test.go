@@ -0,0 +1,177 @@
+package apitest_test
+
+import (
+	"ET-SensorAPI/apitest"
+	"ET-SensorAPI/otp"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	loginWithDevice = `mutation($email: String!, $trusted: String) {
+		login(email: $email, password: "password123", trustedDeviceToken: $trusted) {
+			challenge { challengeId methods }
+			auth { token }
+		}
+	}`
+	completeLogin = `mutation($id: String!, $code: String!, $remember: Boolean) {
+		completeLogin(challengeId: $id, code: $code, rememberDevice: $remember) { token trustedDeviceToken }
+	}`
+	twoFactorStatus = `{ twoFactor { totpEnabled recoveryCodesLeft } }`
+)
+
+type loginResult struct {
+	Login struct {
+		Challenge *struct {
+			ChallengeID string
+			Methods     []string
+		}
+		Auth *struct{ Token string }
+	}
+}
+
+func beginLogin(h *apitest.Harness, email, trusted string) loginResult {
+	h.T.Helper()
+	var out loginResult
+	vars := map[string]interface{}{"email": email}
+	if trusted != "" {
+		vars["trusted"] = trusted
+	}
+	h.MustGraphQL(loginWithDevice, vars, &out)
+	return out
+}
+
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := otp.GenerateTOTP(secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestAuthenticatorAppLogin(t *testing.T) {
+	h := apitest.New(t)
+	user := h.CreateUser("totp@ecotrack.test", "Totp", true)
+	session := h.Login(user.Email, "Phone")
+
+	if res := h.GraphQLAs(session.Token, `mutation { enableTotp(code: "123456") }`, nil); len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, "set up") {
+		t.Fatalf("enabling should need a setup first, got %+v", res.Errors)
+	}
+	var setup struct {
+		SetupTotp struct{ Secret, URI string }
+	}
+	h.MustGraphQLAs(session.Token, `mutation { setupTotp { secret uri } }`, nil, &setup)
+	secret := setup.SetupTotp.Secret
+	if !strings.HasPrefix(setup.SetupTotp.URI, "otpauth://totp/EcoTrack:totp@ecotrack.test?") {
+		t.Fatalf("unexpected URI %s", setup.SetupTotp.URI)
+	}
+
+	enable := `mutation($code: String!) { enableTotp(code: $code) }`
+	if res := h.GraphQLAs(session.Token, enable, map[string]interface{}{"code": totpAt(t, secret, time.Now().Add(-time.Hour))}); len(res.Errors) == 0 {
+		t.Fatal("a stale code should not enable the app")
+	}
+	var enabled struct{ EnableTotp []string }
+	h.MustGraphQLAs(session.Token, enable, map[string]interface{}{"code": totpAt(t, secret, time.Now())}, &enabled)
+	recovery := enabled.EnableTotp
+	if len(recovery) != h.Config.TwoFactor.RecoveryCodes {
+		t.Fatalf("expected %d recovery codes, got %v", h.Config.TwoFactor.RecoveryCodes, recovery)
+	}
+
+	mails := len(h.MailsTo(user.Email))
+	login := beginLogin(h, user.Email, "")
+	if login.Login.Challenge == nil || strings.Join(login.Login.Challenge.Methods, ",") != "TOTP,RECOVERY_CODE" {
+		t.Fatalf("expected an authenticator challenge, got %+v", login.Login)
+	}
+	if len(h.MailsTo(user.Email)) != mails {
+		t.Fatal("no login code should be mailed to authenticator users")
+	}
+	next := totpAt(t, secret, time.Now().Add(30*time.Second))
+	var completed struct {
+		CompleteLogin struct {
+			Token              string
+			TrustedDeviceToken *string
+		}
+	}
+	h.MustGraphQL(completeLogin, map[string]interface{}{"id": login.Login.Challenge.ChallengeID, "code": next, "remember": true}, &completed)
+	trusted := completed.CompleteLogin.TrustedDeviceToken
+	if completed.CompleteLogin.Token == "" || trusted == nil {
+		t.Fatalf("expected a session and a trusted device token, got %+v", completed.CompleteLogin)
+	}
+
+	if login := beginLogin(h, user.Email, *trusted); login.Login.Auth == nil || login.Login.Auth.Token == "" {
+		t.Fatalf("a trusted device should skip the second step, got %+v", login.Login)
+	}
+
+	login = beginLogin(h, user.Email, "")
+	vars := map[string]interface{}{"id": login.Login.Challenge.ChallengeID, "code": next}
+	if res := h.GraphQL(completeLogin, vars); len(res.Errors) == 0 {
+		t.Fatal("an authenticator code should not be accepted twice")
+	}
+	vars["code"] = strings.ToUpper(recovery[0])
+	h.MustGraphQL(completeLogin, vars, nil)
+	login = beginLogin(h, user.Email, "")
+	vars = map[string]interface{}{"id": login.Login.Challenge.ChallengeID, "code": recovery[0]}
+	if res := h.GraphQL(completeLogin, vars); len(res.Errors) == 0 {
+		t.Fatal("a recovery code should only work once")
+	}
+
+	var status struct {
+		TwoFactor struct {
+			TotpEnabled       bool
+			RecoveryCodesLeft int
+		}
+	}
+	h.MustGraphQLAs(session.Token, twoFactorStatus, nil, &status)
+	if !status.TwoFactor.TotpEnabled || status.TwoFactor.RecoveryCodesLeft != len(recovery)-1 {
+		t.Fatalf("unexpected status %+v", status.TwoFactor)
+	}
+
+	var devices struct {
+		TrustedDevices []struct{ ID string }
+	}
+	h.MustGraphQLAs(session.Token, `{ trustedDevices { id } }`, nil, &devices)
+	if len(devices.TrustedDevices) != 1 {
+		t.Fatalf("expected one trusted device, got %+v", devices.TrustedDevices)
+	}
+	h.MustGraphQLAs(session.Token, `mutation($id: ID!) { forgetTrustedDevice(id: $id) }`,
+		map[string]interface{}{"id": devices.TrustedDevices[0].ID}, nil)
+	if login := beginLogin(h, user.Email, *trusted); login.Login.Challenge == nil {
+		t.Fatal("a forgotten device should get a challenge again")
+	}
+
+	h.MustGraphQLAs(session.Token, `mutation($code: String!) { disableTotp(code: $code) }`,
+		map[string]interface{}{"code": recovery[1]}, nil)
+	if login := beginLogin(h, user.Email, ""); strings.Join(login.Login.Challenge.Methods, ",") != "EMAIL" {
+		t.Fatalf("disabling the app should bring back email codes, got %+v", login.Login.Challenge)
+	}
+}
+
+func TestLoginChallengeLocksAfterWrongCodes(t *testing.T) {
+	h := apitest.New(t)
+	user := h.CreateUser("locked@ecotrack.test", "Locked", true)
+	login := beginLogin(h, user.Email, "")
+	id := login.Login.Challenge.ChallengeID
+
+	res := h.GraphQL(`mutation($id: String!) { completeLogin(challengeId: $id, code: "123456", method: TOTP) { token } }`,
+		map[string]interface{}{"id": id})
+	if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, "not available") {
+		t.Fatalf("email users should not be able to use an authenticator code, got %+v", res.Errors)
+	}
+	if res := h.GraphQL(completeLogin, map[string]interface{}{"id": "1.forged", "code": h.LastMailTo(user.Email).Code()}); len(res.Errors) == 0 {
+		t.Fatal("a forged challenge should be rejected")
+	}
+
+	for i := 0; i < h.Config.OTP.MaxAttempts; i++ {
+		res = h.GraphQL(completeLogin, map[string]interface{}{"id": id, "code": "wrong!"})
+	}
+	if len(res.Errors) == 0 || !strings.Contains(res.Errors[0].Message, "log in again") {
+		t.Fatalf("expected the challenge to be used up, got %+v", res.Errors)
+	}
+	body := map[string]string{"challenge_id": id, "code": h.LastMailTo(user.Email).Code()}
+	if res := h.Post("/api/v1/auth/login/complete", body); res.Code != http.StatusUnauthorized {
+		t.Fatalf("a used up challenge should stay closed, got %d: %s", res.Code, res.Body)
+	}
+}
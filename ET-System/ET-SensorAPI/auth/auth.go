@@ -0,0 +1,70 @@
+// Package auth carries the caller of a request through its context: the
+// claims of a valid bearer access token, when there is one, and the client
+// the request came from.
+package auth
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/utils"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrUnauthenticated is returned for requests without a valid access token
+// of an active session.
+var ErrUnauthenticated = errors.New("authentication required")
+
+// ErrForbidden is returned to signed-in callers acting on something that is
+// not theirs.
+var ErrForbidden = errors.New("not allowed")
+
+// Client describes where a request came from.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type (
+	claimsKey struct{}
+	clientKey struct{}
+)
+
+// Middleware stores the client of every request and, when the request has
+// an "Authorization: Bearer" access token that validates, its claims.
+// Invalid tokens are ignored here; operations that need a caller reject the
+// request later.
+func Middleware(cfg config.AuthConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := WithClient(c.Request.Context(), Client{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+		if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			if claims, err := utils.ValidateToken(cfg, strings.TrimSpace(token), utils.TokenAccess); err == nil {
+				ctx = WithClaims(ctx, claims)
+			}
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func WithClaims(ctx context.Context, claims *utils.Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// Claims returns the claims stored by WithClaims, or nil.
+func Claims(ctx context.Context) *utils.Claims {
+	claims, _ := ctx.Value(claimsKey{}).(*utils.Claims)
+	return claims
+}
+
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientOf returns the client stored by WithClient.
+func ClientOf(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/migrations"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/services"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// runCommand handles one-off maintenance subcommands such as
+// `server rollup rebuild -device ET-1 -from 2025-01-01 -to 2025-02-01`.
+func runCommand(cfg *config.Config, repos *repository.Repositories, args []string) error {
+	switch args[0] {
+	case "rollup":
+		return runRollupCommand(repos, args[1:])
+	case "retention":
+		return runRetentionCommand(cfg, repos, args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+func runMigrateCommand(cfg *config.Config, db *gorm.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down [-steps N]|status|timescale")
+	}
+
+	switch args[0] {
+	case "up":
+		ran, err := migrations.Up(db)
+		for _, m := range ran {
+			fmt.Printf("✅ Applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(ran) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+		return nil
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		reverted, err := migrations.Down(db, *steps)
+		for _, m := range reverted {
+			fmt.Printf("↩️  Reverted %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrations.GetStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", st.Migration.Version, st.Migration.Name, state)
+		}
+		return nil
+	case "timescale":
+		if err := migrations.EnableTimescale(db, timescaleOptions(cfg)); err != nil {
+			return err
+		}
+		fmt.Println("✅ TimescaleDB storage enabled")
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
+
+func runRollupCommand(repos *repository.Repositories, args []string) error {
+	if len(args) == 0 || args[0] != "rebuild" {
+		return errors.New("usage: rollup rebuild [-device ID] [-from YYYY-MM-DD] [-to YYYY-MM-DD]")
+	}
+
+	fs := flag.NewFlagSet("rollup rebuild", flag.ContinueOnError)
+	deviceID := fs.String("device", "", "only rebuild this device")
+	fromFlag := fs.String("from", "", "first day to rebuild (default: first reading)")
+	toFlag := fs.String("to", "", "day after the last day to rebuild (default: last reading)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	from, err := parseDateFlag(*fromFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	to, err := parseDateFlag(*toFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	start := time.Now()
+	rollups := services.NewRollupService(repos.Devices, repos.Usage)
+	if err := rollups.RebuildRollups(context.Background(), *deviceID, from, to); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Rollups rebuilt in %s\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func runRetentionCommand(cfg *config.Config, repos *repository.Repositories, args []string) error {
+	fs := flag.NewFlagSet("retention", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "only report what would be downsampled or purged")
+	groupID := fs.Uint("group", 0, "only apply to this group")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	retention := services.NewRetentionService(repos.Devices, repos.Groups, repos.Usage,
+		services.DefaultRetentionSettings(cfg.Retention))
+	reports, err := retention.ApplyRetention(context.Background(), time.Now(), *groupID, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "Applied"
+	if *dryRun {
+		verb = "Would apply"
+	}
+	fmt.Printf("%-40s %8s %12s %10s %10s\n", "DEVICE", "GROUP", "TO MINUTE", "TO HOUR", "PURGED")
+	for _, r := range reports {
+		fmt.Printf("%-40s %8d %12d %10d %10d\n", r.DeviceID, r.UserGroupID, r.ToMinute, r.ToHour, r.Purged)
+	}
+	fmt.Printf("%s retention to %d devices\n", verb, len(reports))
+	return nil
+}
+
+func timescaleOptions(cfg *config.Config) migrations.TimescaleOptions {
+	return migrations.TimescaleOptions{
+		ChunkInterval:     cfg.Timescale.ChunkInterval,
+		CompressAfterDays: cfg.CompressAfterDays(),
+		Timezone:          cfg.DefaultTimezone,
+	}
+}
+
+func parseDateFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
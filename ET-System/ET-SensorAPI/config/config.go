@@ -0,0 +1,659 @@
+package config
+
+import (
+	"ET-SensorAPI/i18n"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the API. It is loaded once at startup and
+// handed to the components that need it.
+type Config struct {
+	Port            int             `yaml:"port"`
+	DefaultTimezone string          `yaml:"default_timezone"`
+	DefaultLanguage string          `yaml:"default_language"`
+	HTTP            HTTPConfig      `yaml:"http"`
+	Log             LogConfig       `yaml:"log"`
+	Database        DatabaseConfig  `yaml:"database"`
+	Timescale       TimescaleConfig `yaml:"timescale"`
+	Auth            AuthConfig      `yaml:"auth"`
+	OTP             OTPConfig       `yaml:"otp"`
+	TwoFactor       TwoFactorConfig `yaml:"two_factor"`
+	RateLimit       RateLimitConfig `yaml:"rate_limit"`
+	SMTP            SMTPConfig      `yaml:"smtp"`
+	Mail            MailConfig      `yaml:"mail"`
+	AI              AIConfig        `yaml:"ai"`
+	Retention       RetentionConfig `yaml:"retention"`
+	Metrics         MetricsConfig   `yaml:"metrics"`
+	Tracing         TracingConfig   `yaml:"tracing"`
+	Jobs            JobsConfig      `yaml:"jobs"`
+	Queue           QueueConfig     `yaml:"queue"`
+	// DevRoutes mounts the /dev endpoints, which list captured emails with
+	// their codes. It is for local development only and needs the capture
+	// mail transport.
+	DevRoutes bool `yaml:"dev_routes"`
+}
+
+// HTTPConfig bounds how long the server waits on clients, and how long
+// shutdown waits for in-flight requests and jobs.
+type HTTPConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	// WriteTimeout also covers AI analysis, which waits on the LLM.
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For header names the client. With none, the client is the
+	// peer address, so clients cannot pick the IP they are limited by.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level"`
+	// Format is "json" or "text".
+	Format string `yaml:"format"`
+}
+
+type DatabaseConfig struct {
+	// Driver is "postgres" or "sqlite".
+	Driver   string `yaml:"driver"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	// Path is the SQLite file, or ":memory:".
+	Path           string `yaml:"path"`
+	MigrateOnStart bool   `yaml:"migrate_on_start"`
+	// SlowQueryMS logs queries slower than this as warnings; 0 disables it.
+	SlowQueryMS int `yaml:"slow_query_ms"`
+}
+
+type TimescaleConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ChunkInterval string `yaml:"chunk_interval"`
+	// CompressAfterDays of -1 derives the delay from the retention settings.
+	CompressAfterDays int `yaml:"compress_after_days"`
+}
+
+// AuthConfig signs access tokens that live for AccessTokenTTL and refresh
+// tokens that keep a session alive while it is used within RefreshTokenTTL.
+type AuthConfig struct {
+	JWTSecret       string        `yaml:"jwt_secret"`
+	GoogleClientID  string        `yaml:"google_client_id"`
+	AppleClientID   string        `yaml:"apple_client_id"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+	// AdminEmails are the operators allowed to run jobs and manage the
+	// queue. With none, nobody is.
+	AdminEmails []string `yaml:"admin_emails"`
+}
+
+// IsAdmin reports whether email belongs to one of AdminEmails.
+func (c AuthConfig) IsAdmin(email string) bool {
+	for _, admin := range c.AdminEmails {
+		if strings.EqualFold(strings.TrimSpace(admin), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// OTPConfig bounds the one-time codes mailed for signup, login, password
+// reset and email changes. A code is locked after MaxAttempts wrong guesses;
+// a new one can be sent after ResendInterval (0 disables the wait) and at
+// most MaxSendsPerHour times an hour. A verified reset code is exchanged for
+// a reset token that is valid for ResetTokenTTL.
+type OTPConfig struct {
+	TTL             time.Duration `yaml:"ttl"`
+	MaxAttempts     int           `yaml:"max_attempts"`
+	ResendInterval  time.Duration `yaml:"resend_interval"`
+	MaxSendsPerHour int           `yaml:"max_sends_per_hour"`
+	ResetTokenTTL   time.Duration `yaml:"reset_token_ttl"`
+}
+
+// TwoFactorConfig governs the second login step. A login challenge must be
+// completed within ChallengeTTL and OTP.MaxAttempts guesses; a device the
+// user chose to remember skips the step for TrustedDeviceTTL, where 0 turns
+// remembering devices off. Authenticator apps show TOTPIssuer, and enabling
+// one hands out RecoveryCodes codes.
+type TwoFactorConfig struct {
+	ChallengeTTL     time.Duration `yaml:"challenge_ttl"`
+	TrustedDeviceTTL time.Duration `yaml:"trusted_device_ttl"`
+	TOTPIssuer       string        `yaml:"totp_issuer"`
+	RecoveryCodes    int           `yaml:"recovery_codes"`
+}
+
+// RateLimitConfig throttles auth operations and ingestion with token
+// buckets, per client IP and per account or device. Store is "memory" (each
+// replica counts on its own) or "database" (replicas share the buckets). A
+// rate of 0 turns that limit off.
+type RateLimitConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Store           string `yaml:"store"`
+	AuthPerIP       Rate   `yaml:"auth_per_ip"`
+	AuthPerAccount  Rate   `yaml:"auth_per_account"`
+	IngestPerDevice Rate   `yaml:"ingest_per_device"`
+	IngestPerIP     Rate   `yaml:"ingest_per_ip"`
+}
+
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStoreDatabase = "database"
+)
+
+// Rate allows bursts of Count events that refill evenly over Period. It is
+// written as "<count>/<period>", e.g. "5/1m"; "0" is no limit.
+type Rate struct {
+	Count  int
+	Period time.Duration
+}
+
+// ParseRate parses the "<count>/<period>" form of a Rate.
+func ParseRate(s string) (Rate, error) {
+	if s == "0" {
+		return Rate{}, nil
+	}
+	count, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, errors.New("must be a rate such as 5/1m")
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return Rate{}, errors.New("must be a rate such as 5/1m")
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Rate{}, errors.New("must be a rate such as 5/1m")
+	}
+	return Rate{Count: n, Period: d}, nil
+}
+
+// Limited reports whether r limits anything.
+func (r Rate) Limited() bool {
+	return r.Count > 0
+}
+
+func (r Rate) String() string {
+	if !r.Limited() {
+		return "0"
+	}
+	return fmt.Sprintf("%d/%s", r.Count, r.Period)
+}
+
+func (r *Rate) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	v, err := ParseRate(s)
+	if err != nil {
+		return fmt.Errorf("line %d: %w, got %q", value.Line, err, s)
+	}
+	*r = v
+	return nil
+}
+
+const (
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+	SMTPTLSNone     = "none"
+)
+
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// TLS is "starttls", "tls" (implicit TLS, usually port 465) or "none"
+	// for local relays.
+	TLS      string `yaml:"tls"`
+	Email    string `yaml:"email"`
+	Password string `yaml:"password"`
+}
+
+type MailConfig struct {
+	// Transport is "smtp", "outbox" (a Maildir at OutboxDir) or "capture"
+	// (kept in memory and, with DEV_ROUTES, listed at /dev/mail).
+	Transport string `yaml:"transport"`
+	// From defaults to the SMTP account.
+	From      string `yaml:"from"`
+	OutboxDir string `yaml:"outbox_dir"`
+}
+
+// AIConfig selects the LLM that writes usage analyses. Provider is
+// "openrouter", "openai" (any OpenAI-compatible chat completions API),
+// "ollama" (a local Ollama server) or "fake" (a canned reply, for
+// development). URL is the chat endpoint; empty uses the provider's default.
+// A call is abandoned after Timeout. InputPrice and OutputPrice, in USD per
+// million tokens, estimate the cost of calls for providers that do not
+// report it.
+type AIConfig struct {
+	Provider    string        `yaml:"provider"`
+	URL         string        `yaml:"url"`
+	APIKey      string        `yaml:"api_key"`
+	Model       string        `yaml:"model"`
+	Timeout     time.Duration `yaml:"timeout"`
+	InputPrice  float64       `yaml:"input_price"`
+	OutputPrice float64       `yaml:"output_price"`
+}
+
+const (
+	AIProviderOpenRouter = "openrouter"
+	AIProviderOpenAI     = "openai"
+	AIProviderOllama     = "ollama"
+	AIProviderFake       = "fake"
+)
+
+// RetentionConfig is the server-wide retention policy in days; 0 disables a
+// stage.
+type RetentionConfig struct {
+	RawDays    int `yaml:"raw_days"`
+	MinuteDays int `yaml:"minute_days"`
+	MaxAgeDays int `yaml:"max_age_days"`
+}
+
+type MetricsConfig struct {
+	// ActiveDeviceMinutes is the window of the active devices gauge.
+	ActiveDeviceMinutes int `yaml:"active_device_minutes"`
+}
+
+type TracingConfig struct {
+	// Exporter is "none" (tracing off) or "otlp" (OTLP over HTTP).
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type JobsConfig struct {
+	UsageNotifications JobConfig `yaml:"usage_notifications"`
+	Retention          JobConfig `yaml:"retention"`
+}
+
+// JobConfig schedules a background job with a five-field cron expression or
+// a descriptor such as "@daily". An empty Timezone uses DefaultTimezone.
+type JobConfig struct {
+	Schedule string `yaml:"schedule"`
+	Timezone string `yaml:"timezone"`
+}
+
+// JobTimezone resolves the timezone job is scheduled in.
+func (c *Config) JobTimezone(job JobConfig) string {
+	if job.Timezone != "" {
+		return job.Timezone
+	}
+	return c.DefaultTimezone
+}
+
+// Language resolves the language to address someone preferring preferred
+// in; unset or unsupported preferences get DefaultLanguage.
+func (c *Config) Language(preferred string) string {
+	return i18n.Match(preferred, c.DefaultLanguage)
+}
+
+// QueueConfig tunes the background job queue. Failed jobs are retried after
+// RetryBase, doubling per attempt up to RetryMax, until MaxAttempts.
+type QueueConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	RetryBase    time.Duration `yaml:"retry_base"`
+	RetryMax     time.Duration `yaml:"retry_max"`
+	// LockTimeout bounds one attempt; stuck jobs are picked up again after it.
+	LockTimeout time.Duration `yaml:"lock_timeout"`
+	// Workers per queue.
+	EmailConcurrency         int `yaml:"email_concurrency"`
+	AIConcurrency            int `yaml:"ai_concurrency"`
+	NotificationsConcurrency int `yaml:"notifications_concurrency"`
+	RollupsConcurrency       int `yaml:"rollups_concurrency"`
+	// Retention is how long succeeded and dead jobs are kept before the
+	// retention job deletes them; 0 keeps them forever.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func Default() *Config {
+	return &Config{
+		Port:            8080,
+		DefaultTimezone: "Asia/Jakarta",
+		DefaultLanguage: i18n.Indonesian,
+		HTTP: HTTPConfig{
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      2 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Database: DatabaseConfig{
+			Driver:      "postgres",
+			Port:        5432,
+			Path:        "et-sensor.db",
+			SlowQueryMS: 200,
+		},
+		Timescale: TimescaleConfig{
+			ChunkInterval:     "7 days",
+			CompressAfterDays: -1,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		OTP: OTPConfig{
+			TTL:             15 * time.Minute,
+			MaxAttempts:     5,
+			ResendInterval:  time.Minute,
+			MaxSendsPerHour: 5,
+			ResetTokenTTL:   10 * time.Minute,
+		},
+		TwoFactor: TwoFactorConfig{
+			ChallengeTTL:     10 * time.Minute,
+			TrustedDeviceTTL: 30 * 24 * time.Hour,
+			TOTPIssuer:       "EcoTrack",
+			RecoveryCodes:    10,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:         true,
+			Store:           RateLimitStoreMemory,
+			AuthPerIP:       Rate{Count: 30, Period: time.Minute},
+			AuthPerAccount:  Rate{Count: 10, Period: 15 * time.Minute},
+			IngestPerDevice: Rate{Count: 60, Period: time.Minute},
+			IngestPerIP:     Rate{Count: 600, Period: time.Minute},
+		},
+		SMTP: SMTPConfig{
+			Host: "smtp.gmail.com",
+			Port: 587,
+			TLS:  SMTPTLSStartTLS,
+		},
+		Mail: MailConfig{
+			Transport: "smtp",
+			OutboxDir: "mail-outbox",
+		},
+		AI: AIConfig{
+			Provider: AIProviderOpenRouter,
+			Model:    "deepseek/deepseek-chat-v3-0324:free",
+			Timeout:  90 * time.Second,
+		},
+		Retention: RetentionConfig{
+			RawDays:    30,
+			MinuteDays: 180,
+		},
+		Metrics: MetricsConfig{
+			ActiveDeviceMinutes: 15,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			ServiceName: "et-sensor-api",
+			SampleRatio: 1,
+		},
+		Jobs: JobsConfig{
+			UsageNotifications: JobConfig{Schedule: "0 20 * * *"},
+			Retention:          JobConfig{Schedule: "30 2 * * *"},
+		},
+		Queue: QueueConfig{
+			PollInterval:             time.Second,
+			MaxAttempts:              8,
+			RetryBase:                10 * time.Second,
+			RetryMax:                 time.Hour,
+			LockTimeout:              10 * time.Minute,
+			EmailConcurrency:         2,
+			AIConcurrency:            1,
+			NotificationsConcurrency: 2,
+			RollupsConcurrency:       1,
+			Retention:                7 * 24 * time.Hour,
+		},
+	}
+}
+
+// ValidationError lists every problem found while loading the config.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Load builds the config from the defaults, the YAML file named by
+// CONFIG_FILE (config.yaml when present), .env and the environment, each
+// overriding the previous one, and validates the result.
+func Load() (*Config, error) {
+	cfg := Default()
+	var problems []string
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		problems = append(problems, fmt.Sprintf(".env: %v", err))
+	}
+
+	file, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		file = "config.yaml"
+	}
+	if err := cfg.loadFile(file); err != nil && (explicit || !errors.Is(err, fs.ErrNotExist)) {
+		problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+	}
+
+	problems = append(problems, cfg.applyEnv(os.LookupEnv)...)
+	problems = append(problems, cfg.Validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+type envVar struct {
+	name string
+	set  func(string) error
+}
+
+func (c *Config) envVars() []envVar {
+	return []envVar{
+		{"PORT", intVar(&c.Port)},
+		{"DEFAULT_TIMEZONE", stringVar(&c.DefaultTimezone)},
+		{"DEFAULT_LANGUAGE", stringVar(&c.DefaultLanguage)},
+		{"HTTP_READ_HEADER_TIMEOUT", durationVar(&c.HTTP.ReadHeaderTimeout)},
+		{"HTTP_READ_TIMEOUT", durationVar(&c.HTTP.ReadTimeout)},
+		{"HTTP_WRITE_TIMEOUT", durationVar(&c.HTTP.WriteTimeout)},
+		{"HTTP_IDLE_TIMEOUT", durationVar(&c.HTTP.IdleTimeout)},
+		{"SHUTDOWN_TIMEOUT", durationVar(&c.HTTP.ShutdownTimeout)},
+		{"TRUSTED_PROXIES", listVar(&c.HTTP.TrustedProxies)},
+		{"LOG_LEVEL", stringVar(&c.Log.Level)},
+		{"LOG_FORMAT", stringVar(&c.Log.Format)},
+		{"DB_DRIVER", stringVar(&c.Database.Driver)},
+		{"DB_HOST", stringVar(&c.Database.Host)},
+		{"DB_PORT", intVar(&c.Database.Port)},
+		{"DB_USER", stringVar(&c.Database.User)},
+		{"DB_PASSWORD", stringVar(&c.Database.Password)},
+		{"DB_NAME", stringVar(&c.Database.Name)},
+		{"DB_PATH", stringVar(&c.Database.Path)},
+		{"MIGRATE_ON_START", boolVar(&c.Database.MigrateOnStart)},
+		{"DB_SLOW_QUERY_MS", intVar(&c.Database.SlowQueryMS)},
+		{"DB_TIMESCALE", boolVar(&c.Timescale.Enabled)},
+		{"TIMESCALE_CHUNK_INTERVAL", stringVar(&c.Timescale.ChunkInterval)},
+		{"TIMESCALE_COMPRESS_AFTER_DAYS", intVar(&c.Timescale.CompressAfterDays)},
+		{"JWT_SECRET", stringVar(&c.Auth.JWTSecret)},
+		{"GOOGLE_CLIENT_ID", stringVar(&c.Auth.GoogleClientID)},
+		{"ADMIN_EMAILS", listVar(&c.Auth.AdminEmails)},
+		{"APPLE_CLIENT_ID", stringVar(&c.Auth.AppleClientID)},
+		{"ACCESS_TOKEN_TTL", durationVar(&c.Auth.AccessTokenTTL)},
+		{"REFRESH_TOKEN_TTL", durationVar(&c.Auth.RefreshTokenTTL)},
+		{"OTP_TTL", durationVar(&c.OTP.TTL)},
+		{"OTP_MAX_ATTEMPTS", intVar(&c.OTP.MaxAttempts)},
+		{"OTP_RESEND_INTERVAL", durationVar(&c.OTP.ResendInterval)},
+		{"OTP_MAX_SENDS_PER_HOUR", intVar(&c.OTP.MaxSendsPerHour)},
+		{"OTP_RESET_TOKEN_TTL", durationVar(&c.OTP.ResetTokenTTL)},
+		{"TWO_FACTOR_CHALLENGE_TTL", durationVar(&c.TwoFactor.ChallengeTTL)},
+		{"TWO_FACTOR_TRUSTED_DEVICE_TTL", durationVar(&c.TwoFactor.TrustedDeviceTTL)},
+		{"TWO_FACTOR_TOTP_ISSUER", stringVar(&c.TwoFactor.TOTPIssuer)},
+		{"TWO_FACTOR_RECOVERY_CODES", intVar(&c.TwoFactor.RecoveryCodes)},
+		{"RATE_LIMIT_ENABLED", boolVar(&c.RateLimit.Enabled)},
+		{"RATE_LIMIT_STORE", stringVar(&c.RateLimit.Store)},
+		{"RATE_LIMIT_AUTH_PER_IP", rateVar(&c.RateLimit.AuthPerIP)},
+		{"RATE_LIMIT_AUTH_PER_ACCOUNT", rateVar(&c.RateLimit.AuthPerAccount)},
+		{"RATE_LIMIT_INGEST_PER_DEVICE", rateVar(&c.RateLimit.IngestPerDevice)},
+		{"RATE_LIMIT_INGEST_PER_IP", rateVar(&c.RateLimit.IngestPerIP)},
+		{"SMTP_HOST", stringVar(&c.SMTP.Host)},
+		{"SMTP_PORT", intVar(&c.SMTP.Port)},
+		{"SMTP_TLS", stringVar(&c.SMTP.TLS)},
+		{"SMTP_EMAIL", stringVar(&c.SMTP.Email)},
+		{"SMTP_PASSWORD", stringVar(&c.SMTP.Password)},
+		{"MAIL_TRANSPORT", stringVar(&c.Mail.Transport)},
+		{"MAIL_FROM", stringVar(&c.Mail.From)},
+		{"MAIL_OUTBOX_DIR", stringVar(&c.Mail.OutboxDir)},
+		{"DEV_ROUTES", boolVar(&c.DevRoutes)},
+		// The OPENROUTER_* names predate AI_PROVIDER; the AI_* ones win.
+		{"OPENROUTER_URL", stringVar(&c.AI.URL)},
+		{"OPENROUTER_SECRET", stringVar(&c.AI.APIKey)},
+		{"OPENROUTER_MODEL", stringVar(&c.AI.Model)},
+		{"AI_PROVIDER", stringVar(&c.AI.Provider)},
+		{"AI_URL", stringVar(&c.AI.URL)},
+		{"AI_API_KEY", stringVar(&c.AI.APIKey)},
+		{"AI_MODEL", stringVar(&c.AI.Model)},
+		{"AI_TIMEOUT", durationVar(&c.AI.Timeout)},
+		{"AI_INPUT_PRICE", floatVar(&c.AI.InputPrice)},
+		{"AI_OUTPUT_PRICE", floatVar(&c.AI.OutputPrice)},
+		{"RETENTION_RAW_DAYS", intVar(&c.Retention.RawDays)},
+		{"RETENTION_MINUTE_DAYS", intVar(&c.Retention.MinuteDays)},
+		{"RETENTION_MAX_AGE_DAYS", intVar(&c.Retention.MaxAgeDays)},
+		{"METRICS_ACTIVE_DEVICE_MINUTES", intVar(&c.Metrics.ActiveDeviceMinutes)},
+		{"TRACING_EXPORTER", stringVar(&c.Tracing.Exporter)},
+		{"TRACING_ENDPOINT", stringVar(&c.Tracing.Endpoint)},
+		{"TRACING_INSECURE", boolVar(&c.Tracing.Insecure)},
+		{"TRACING_SERVICE_NAME", stringVar(&c.Tracing.ServiceName)},
+		{"TRACING_SAMPLE_RATIO", floatVar(&c.Tracing.SampleRatio)},
+		{"JOB_USAGE_NOTIFICATIONS_SCHEDULE", stringVar(&c.Jobs.UsageNotifications.Schedule)},
+		{"JOB_USAGE_NOTIFICATIONS_TIMEZONE", stringVar(&c.Jobs.UsageNotifications.Timezone)},
+		{"JOB_RETENTION_SCHEDULE", stringVar(&c.Jobs.Retention.Schedule)},
+		{"JOB_RETENTION_TIMEZONE", stringVar(&c.Jobs.Retention.Timezone)},
+		{"QUEUE_POLL_INTERVAL", durationVar(&c.Queue.PollInterval)},
+		{"QUEUE_MAX_ATTEMPTS", intVar(&c.Queue.MaxAttempts)},
+		{"QUEUE_RETRY_BASE", durationVar(&c.Queue.RetryBase)},
+		{"QUEUE_RETRY_MAX", durationVar(&c.Queue.RetryMax)},
+		{"QUEUE_LOCK_TIMEOUT", durationVar(&c.Queue.LockTimeout)},
+		{"QUEUE_EMAIL_CONCURRENCY", intVar(&c.Queue.EmailConcurrency)},
+		{"QUEUE_AI_CONCURRENCY", intVar(&c.Queue.AIConcurrency)},
+		{"QUEUE_NOTIFICATIONS_CONCURRENCY", intVar(&c.Queue.NotificationsConcurrency)},
+		{"QUEUE_ROLLUPS_CONCURRENCY", intVar(&c.Queue.RollupsConcurrency)},
+		{"QUEUE_RETENTION", durationVar(&c.Queue.Retention)},
+	}
+}
+
+// applyEnv overrides settings from non-empty environment variables and
+// returns the ones that could not be parsed.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) []string {
+	var problems []string
+	for _, v := range c.envVars() {
+		value, ok := lookup(v.name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := v.set(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v, got %q", v.name, err, value))
+		}
+	}
+	return problems
+}
+
+func stringVar(p *string) func(string) error {
+	return func(s string) error {
+		*p = s
+		return nil
+	}
+}
+
+func intVar(p *int) func(string) error {
+	return func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		*p = v
+		return nil
+	}
+}
+
+func floatVar(p *float64) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		*p = v
+		return nil
+	}
+}
+
+func durationVar(p *time.Duration) func(string) error {
+	return func(s string) error {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.New("must be a duration such as 30s")
+		}
+		*p = v
+		return nil
+	}
+}
+
+func boolVar(p *bool) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		*p = v
+		return nil
+	}
+}
+
+// listVar splits a comma-separated list, dropping empty entries.
+func listVar(p *[]string) func(string) error {
+	return func(s string) error {
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*p = items
+		return nil
+	}
+}
+
+func rateVar(p *Rate) func(string) error {
+	return func(s string) error {
+		v, err := ParseRate(s)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadListsEveryProblem(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("CONFIG_FILE", "")
+	os.Unsetenv("CONFIG_FILE")
+	for _, key := range []string{"DB_HOST", "DB_USER", "DB_NAME", "JWT_SECRET", "DB_DRIVER"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("PORT", "eighty")
+	t.Setenv("SMTP_EMAIL", "noreply@ecotrack.test")
+	t.Setenv("JOB_RETENTION_SCHEDULE", "every night")
+	t.Setenv("DEV_ROUTES", "true")
+
+	_, err := Load()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	msg := err.Error()
+	for _, want := range []string{"PORT", "DB_HOST", "DB_USER", "DB_NAME", "JWT_SECRET", "SMTP_PASSWORD", "JOB_RETENTION_SCHEDULE", "DEV_ROUTES"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("missing %s in:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	file := filepath.Join(dir, "settings.yaml")
+	os.WriteFile(file, []byte("port: 9000\ndatabase:\n  driver: sqlite\n  path: file.db\nauth:\n  jwt_secret: from-file\n"), 0o600)
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("DB_DRIVER", "")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("PORT", "9100")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 9100 || cfg.Database.Driver != "sqlite" || cfg.Auth.JWTSecret != "from-file" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+	if cfg.SMTP.Host != "smtp.gmail.com" {
+		t.Fatalf("defaults should survive, got SMTP host %q", cfg.SMTP.Host)
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.WriteFile("config.yaml", []byte("databse:\n  driver: sqlite\n"), 0o600)
+	t.Setenv("CONFIG_FILE", "")
+	os.Unsetenv("CONFIG_FILE")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "config.yaml") {
+		t.Fatalf("expected the typo to be reported, got %v", err)
+	}
+}
+
+func TestLoadRates(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	os.WriteFile("config.yaml", []byte("database:\n  driver: sqlite\nauth:\n  jwt_secret: s\nrate_limit:\n  auth_per_ip: 3/10s\n  ingest_per_ip: \"0\"\n"), 0o600)
+	t.Setenv("CONFIG_FILE", "")
+	os.Unsetenv("CONFIG_FILE")
+	t.Setenv("RATE_LIMIT_AUTH_PER_ACCOUNT", "2/1h")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 127.0.0.1")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl := cfg.RateLimit
+	if rl.AuthPerIP.String() != "3/10s" || rl.AuthPerAccount.String() != "2/1h0m0s" || rl.IngestPerIP.Limited() {
+		t.Fatalf("unexpected rates: %+v", rl)
+	}
+	if strings.Join(cfg.HTTP.TrustedProxies, " ") != "10.0.0.0/8 127.0.0.1" {
+		t.Fatalf("unexpected proxies %q", cfg.HTTP.TrustedProxies)
+	}
+
+	t.Setenv("RATE_LIMIT_INGEST_PER_DEVICE", "fast")
+	t.Setenv("TRUSTED_PROXIES", "proxy")
+	_, err = Load()
+	if err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_INGEST_PER_DEVICE") || !strings.Contains(err.Error(), "TRUSTED_PROXIES") {
+		t.Fatalf("expected both settings to be reported, got %v", err)
+	}
+}
+
+func TestLoadAIKeepsOpenRouterNames(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("CONFIG_FILE", "")
+	os.Unsetenv("CONFIG_FILE")
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("JWT_SECRET", "s")
+	t.Setenv("OPENROUTER_SECRET", "legacy-key")
+	t.Setenv("OPENROUTER_MODEL", "legacy-model")
+	t.Setenv("AI_MODEL", "llama3.1")
+	t.Setenv("AI_PROVIDER", "ollama")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AI.Provider != AIProviderOllama || cfg.AI.APIKey != "legacy-key" || cfg.AI.Model != "llama3.1" {
+		t.Fatalf("unexpected AI config %+v", cfg.AI)
+	}
+
+	t.Setenv("AI_TIMEOUT", "1h")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "AI_TIMEOUT") {
+		t.Fatalf("a timeout beyond the queue lock should be rejected, got %v", err)
+	}
+}
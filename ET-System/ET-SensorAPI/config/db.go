@@ -1,34 +1,39 @@
 package config
 
 import (
-	"ET-SensorAPI/models"
+	"ET-SensorAPI/logging"
+	"ET-SensorAPI/tracing"
 	"fmt"
-	"log"
-	"os"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
-
-func ConnectDB() {
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-	)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		log.Fatal("Failed to connect to the database:", err)
+// ConnectDB opens the database selected by cfg.Driver: Postgres at
+// cfg.Host, or the SQLite file cfg.Path (":memory:" for a throwaway
+// in-memory database). Queries are logged through slog and traced.
+func ConnectDB(cfg DatabaseConfig) (*gorm.DB, error) {
+	var db *gorm.DB
+	var err error
+	switch cfg.Driver {
+	case "postgres":
+		dsn := fmt.Sprintf(
+			"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+			cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name,
+		)
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	case "sqlite":
+		db, err = OpenSQLite(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
 	}
-
-	err = db.AutoMigrate(&models.User{}, &models.Device{}, &models.WaterUsage{})
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return nil, err
 	}
-
-	DB = db
-	fmt.Println("Database connected!")
+	db.Logger = logging.NewGormLogger(time.Duration(cfg.SlowQueryMS) * time.Millisecond)
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+	return db, nil
 }
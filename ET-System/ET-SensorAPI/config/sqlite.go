@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// OpenSQLite opens the SQLite database at path, or a private in-memory one
+// for ":memory:". Foreign keys are enforced like on Postgres.
+func OpenSQLite(path string) (*gorm.DB, error) {
+	dsn := path
+	if path == ":memory:" {
+		dsn = "file::memory:"
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	dsn += sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+
+	sqlDB, err := sql.Open(sqlite.DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite serialises writers anyway, and an in-memory database only lives
+	// as long as its single connection.
+	sqlDB.SetMaxOpenConns(1)
+
+	return gorm.Open(sqlite.Dialector{Conn: &utcConnPool{sqlDB}}, &gorm.Config{})
+}
+
+// utcConnPool converts time arguments to UTC before they reach SQLite.
+// Times are stored as text including their offset, so comparisons between
+// values written in different zones would otherwise go wrong.
+type utcConnPool struct {
+	db *sql.DB
+}
+
+func (p *utcConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.PrepareContext(ctx, query)
+}
+
+func (p *utcConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.db.ExecContext(ctx, query, toUTC(args)...)
+}
+
+func (p *utcConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.db.QueryContext(ctx, query, toUTC(args)...)
+}
+
+func (p *utcConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.db.QueryRowContext(ctx, query, toUTC(args)...)
+}
+
+func (p *utcConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := p.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &utcTx{tx}, nil
+}
+
+func (p *utcConnPool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+type utcTx struct {
+	tx *sql.Tx
+}
+
+func (t *utcTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.tx.PrepareContext(ctx, query)
+}
+
+func (t *utcTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, query, toUTC(args)...)
+}
+
+func (t *utcTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, query, toUTC(args)...)
+}
+
+func (t *utcTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRowContext(ctx, query, toUTC(args)...)
+}
+
+func (t *utcTx) Commit() error   { return t.tx.Commit() }
+func (t *utcTx) Rollback() error { return t.tx.Rollback() }
+
+func toUTC(args []interface{}) []interface{} {
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			args[i] = v.UTC()
+		case *time.Time:
+			if v != nil {
+				args[i] = v.UTC()
+			}
+		}
+	}
+	return args
+}
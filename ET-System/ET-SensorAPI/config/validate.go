@@ -0,0 +1,277 @@
+package config
+
+import (
+	"ET-SensorAPI/i18n"
+	"ET-SensorAPI/logging"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Validate returns every missing or malformed setting.
+func (c *Config) Validate() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		add("PORT: must be between 1 and 65535, got %d", c.Port)
+	}
+	if _, err := time.LoadLocation(c.DefaultTimezone); err != nil || c.DefaultTimezone == "" {
+		add("DEFAULT_TIMEZONE: unknown timezone %q", c.DefaultTimezone)
+	}
+	if !i18n.Supported(c.DefaultLanguage) {
+		add("DEFAULT_LANGUAGE: must be one of %s, got %q", strings.Join(i18n.Languages(), ", "), c.DefaultLanguage)
+	}
+
+	for _, v := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"HTTP_READ_HEADER_TIMEOUT", c.HTTP.ReadHeaderTimeout},
+		{"HTTP_READ_TIMEOUT", c.HTTP.ReadTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.HTTP.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.HTTP.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.HTTP.ShutdownTimeout},
+		{"QUEUE_POLL_INTERVAL", c.Queue.PollInterval},
+		{"QUEUE_RETRY_BASE", c.Queue.RetryBase},
+		{"QUEUE_LOCK_TIMEOUT", c.Queue.LockTimeout},
+	} {
+		if v.value <= 0 {
+			add("%s: must be positive, got %s", v.name, v.value)
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		add("LOG_LEVEL: must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("LOG_FORMAT: must be json or text, got %q", c.Log.Format)
+	}
+
+	switch c.Database.Driver {
+	case "postgres":
+		for _, v := range []struct{ name, value string }{
+			{"DB_HOST", c.Database.Host},
+			{"DB_USER", c.Database.User},
+			{"DB_NAME", c.Database.Name},
+		} {
+			if v.value == "" {
+				add("%s: required for the postgres driver", v.name)
+			}
+		}
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			add("DB_PORT: must be between 1 and 65535, got %d", c.Database.Port)
+		}
+	case "sqlite":
+		if c.Database.Path == "" {
+			add("DB_PATH: required for the sqlite driver")
+		}
+		if c.Timescale.Enabled {
+			add("DB_TIMESCALE: requires the postgres driver")
+		}
+	default:
+		add("DB_DRIVER: must be postgres or sqlite, got %q", c.Database.Driver)
+	}
+
+	if c.Database.SlowQueryMS < 0 {
+		add("DB_SLOW_QUERY_MS: must not be negative, got %d", c.Database.SlowQueryMS)
+	}
+
+	if c.Timescale.Enabled && c.Timescale.ChunkInterval == "" {
+		add("TIMESCALE_CHUNK_INTERVAL: required when DB_TIMESCALE is set")
+	}
+	if c.Timescale.CompressAfterDays < -1 {
+		add("TIMESCALE_COMPRESS_AFTER_DAYS: must be -1 (derived), 0 (off) or positive, got %d", c.Timescale.CompressAfterDays)
+	}
+
+	if c.Auth.JWTSecret == "" {
+		add("JWT_SECRET: required")
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		add("ACCESS_TOKEN_TTL: must be positive, got %s", c.Auth.AccessTokenTTL)
+	}
+	if c.Auth.RefreshTokenTTL < c.Auth.AccessTokenTTL {
+		add("REFRESH_TOKEN_TTL: must not be shorter than ACCESS_TOKEN_TTL")
+	}
+	if c.OTP.TTL <= 0 {
+		add("OTP_TTL: must be positive, got %s", c.OTP.TTL)
+	}
+	if c.OTP.ResetTokenTTL <= 0 {
+		add("OTP_RESET_TOKEN_TTL: must be positive, got %s", c.OTP.ResetTokenTTL)
+	}
+	if c.OTP.MaxAttempts < 1 {
+		add("OTP_MAX_ATTEMPTS: must be positive, got %d", c.OTP.MaxAttempts)
+	}
+	if c.OTP.ResendInterval < 0 {
+		add("OTP_RESEND_INTERVAL: must not be negative, got %s", c.OTP.ResendInterval)
+	}
+	if c.OTP.MaxSendsPerHour < 1 {
+		add("OTP_MAX_SENDS_PER_HOUR: must be positive, got %d", c.OTP.MaxSendsPerHour)
+	}
+	if c.TwoFactor.ChallengeTTL <= 0 {
+		add("TWO_FACTOR_CHALLENGE_TTL: must be positive, got %s", c.TwoFactor.ChallengeTTL)
+	}
+	if c.TwoFactor.TrustedDeviceTTL < 0 {
+		add("TWO_FACTOR_TRUSTED_DEVICE_TTL: must not be negative, got %s", c.TwoFactor.TrustedDeviceTTL)
+	}
+	if c.TwoFactor.TOTPIssuer == "" || strings.Contains(c.TwoFactor.TOTPIssuer, ":") {
+		add("TWO_FACTOR_TOTP_ISSUER: required and must not contain \":\"")
+	}
+	if c.TwoFactor.RecoveryCodes < 1 {
+		add("TWO_FACTOR_RECOVERY_CODES: must be positive, got %d", c.TwoFactor.RecoveryCodes)
+	}
+
+	switch c.RateLimit.Store {
+	case RateLimitStoreMemory, RateLimitStoreDatabase:
+	default:
+		add("RATE_LIMIT_STORE: must be memory or database, got %q", c.RateLimit.Store)
+	}
+	for _, proxy := range c.HTTP.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				add("TRUSTED_PROXIES: %q is neither an IP address nor a CIDR", proxy)
+			}
+		}
+	}
+
+	switch c.Mail.Transport {
+	case "smtp":
+		if c.SMTP.Host == "" {
+			add("SMTP_HOST: required")
+		}
+		if c.SMTP.Port < 1 || c.SMTP.Port > 65535 {
+			add("SMTP_PORT: must be between 1 and 65535, got %d", c.SMTP.Port)
+		}
+		switch c.SMTP.TLS {
+		case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+		default:
+			add("SMTP_TLS: must be starttls, tls or none, got %q", c.SMTP.TLS)
+		}
+		if (c.SMTP.Email == "") != (c.SMTP.Password == "") {
+			add("SMTP_EMAIL and SMTP_PASSWORD: set both or neither")
+		}
+	case "outbox":
+		if c.Mail.OutboxDir == "" {
+			add("MAIL_OUTBOX_DIR: required when MAIL_TRANSPORT is outbox")
+		}
+	case "capture":
+	default:
+		add("MAIL_TRANSPORT: must be smtp, outbox or capture, got %q", c.Mail.Transport)
+	}
+	if c.DevRoutes && c.Mail.Transport != "capture" {
+		add("DEV_ROUTES: requires MAIL_TRANSPORT=capture")
+	}
+
+	switch c.AI.Provider {
+	case AIProviderOpenRouter, AIProviderOpenAI, AIProviderOllama:
+		if c.AI.Model == "" {
+			add("AI_MODEL: required for the %s provider", c.AI.Provider)
+		}
+	case AIProviderFake:
+	default:
+		add("AI_PROVIDER: must be openrouter, openai, ollama or fake, got %q", c.AI.Provider)
+	}
+	if c.AI.URL != "" {
+		if u, err := url.Parse(c.AI.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			add("AI_URL: must be an absolute URL, got %q", c.AI.URL)
+		}
+	}
+	if c.AI.Timeout <= 0 || c.AI.Timeout > c.Queue.LockTimeout {
+		add("AI_TIMEOUT: must be positive and not longer than QUEUE_LOCK_TIMEOUT, got %s", c.AI.Timeout)
+	}
+	if c.AI.InputPrice < 0 || c.AI.OutputPrice < 0 {
+		add("AI_INPUT_PRICE and AI_OUTPUT_PRICE: must not be negative")
+	}
+
+	r := c.Retention
+	if r.RawDays < 0 || r.MinuteDays < 0 || r.MaxAgeDays < 0 {
+		add("RETENTION_*_DAYS: must not be negative")
+	} else {
+		if r.RawDays > 0 && r.MinuteDays > 0 && r.MinuteDays < r.RawDays {
+			add("RETENTION_MINUTE_DAYS: must not be shorter than RETENTION_RAW_DAYS")
+		}
+		if r.MaxAgeDays > 0 && r.MaxAgeDays < max(r.RawDays, r.MinuteDays) {
+			add("RETENTION_MAX_AGE_DAYS: must not be shorter than raw or minute retention")
+		}
+	}
+
+	if c.Metrics.ActiveDeviceMinutes < 1 {
+		add("METRICS_ACTIVE_DEVICE_MINUTES: must be positive, got %d", c.Metrics.ActiveDeviceMinutes)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none":
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			add("TRACING_ENDPOINT: required for the otlp exporter")
+		}
+		if c.Tracing.ServiceName == "" {
+			add("TRACING_SERVICE_NAME: required when tracing is on")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			add("TRACING_SAMPLE_RATIO: must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+		}
+	default:
+		add("TRACING_EXPORTER: must be none or otlp, got %q", c.Tracing.Exporter)
+	}
+
+	for _, v := range []struct {
+		name string
+		job  JobConfig
+	}{
+		{"JOB_USAGE_NOTIFICATIONS", c.Jobs.UsageNotifications},
+		{"JOB_RETENTION", c.Jobs.Retention},
+	} {
+		if _, err := cron.ParseStandard(v.job.Schedule); err != nil {
+			add("%s_SCHEDULE: invalid cron expression %q: %v", v.name, v.job.Schedule, err)
+		}
+		if v.job.Timezone != "" {
+			if _, err := time.LoadLocation(v.job.Timezone); err != nil {
+				add("%s_TIMEZONE: unknown timezone %q", v.name, v.job.Timezone)
+			}
+		}
+	}
+
+	if c.Queue.MaxAttempts < 1 {
+		add("QUEUE_MAX_ATTEMPTS: must be positive, got %d", c.Queue.MaxAttempts)
+	}
+	if c.Queue.RetryMax < c.Queue.RetryBase {
+		add("QUEUE_RETRY_MAX: must not be shorter than QUEUE_RETRY_BASE")
+	}
+	if c.Queue.LockTimeout < c.HTTP.WriteTimeout {
+		add("QUEUE_LOCK_TIMEOUT: must not be shorter than HTTP_WRITE_TIMEOUT, which bounds AI analysis")
+	}
+	if c.Queue.Retention < 0 {
+		add("QUEUE_RETENTION: must not be negative, got %s", c.Queue.Retention)
+	}
+	for _, v := range []struct {
+		name  string
+		value int
+	}{
+		{"QUEUE_EMAIL_CONCURRENCY", c.Queue.EmailConcurrency},
+		{"QUEUE_AI_CONCURRENCY", c.Queue.AIConcurrency},
+		{"QUEUE_NOTIFICATIONS_CONCURRENCY", c.Queue.NotificationsConcurrency},
+		{"QUEUE_ROLLUPS_CONCURRENCY", c.Queue.RollupsConcurrency},
+	} {
+		if v.value < 0 {
+			add("%s: must not be negative, got %d", v.name, v.value)
+		}
+	}
+
+	return problems
+}
+
+// CompressAfterDays resolves TIMESCALE_COMPRESS_AFTER_DAYS. By default only
+// chunks the retention job has finished downsampling are compressed.
+func (c *Config) CompressAfterDays() int {
+	if c.Timescale.CompressAfterDays >= 0 {
+		return c.Timescale.CompressAfterDays
+	}
+	return max(c.Retention.RawDays, c.Retention.MinuteDays) + 7
+}
@@ -3,57 +3,77 @@ package controllers
 import (
 	"ET-SensorAPI/config"
 	"ET-SensorAPI/models"
+	"ET-SensorAPI/otp"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/services"
 	"ET-SensorAPI/utils"
-	"fmt"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
-func Register(c *gin.Context) {
+type AuthController struct {
+	cfg   *config.Config
+	repos *repository.Repositories
+	users repository.UserRepo
+}
+
+func NewAuthController(cfg *config.Config, repos *repository.Repositories) *AuthController {
+	return &AuthController{cfg: cfg, repos: repos, users: repos.Users}
+}
+
+func (ac *AuthController) Register(c *gin.Context) {
 	var input struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password" binding:"required,min=6"`
+		Language string `json:"language"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	var existingUser models.User
-	if err := config.DB.Where("email = ?", input.Email).First(&existingUser).Error; err != nil {
-		if err != gorm.ErrRecordNotFound {
-			fmt.Println("❌ Database Lookup Error:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-			return
-		}
+	if err := utils.ValidateLanguage(input.Language); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if existingUser.ID != 0 {
+	_, err := ac.users.GetByEmail(c.Request.Context(), input.Email)
+	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
 		return
 	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		internalError(c, "Database error", err)
+		return
+	}
 
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
-	otpToken, _ := utils.GenerateOTP()
 
 	user := models.User{
-		Email:       input.Email,
-		Password:    string(hashedPassword),
-		Verified:    false,
-		VerifyToken: otpToken,
+		Email:    input.Email,
+		Password: string(hashedPassword),
+		Verified: false,
+		Language: input.Language,
+	}
+	ctx := c.Request.Context()
+	err = ac.repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Users.Create(ctx, &user); err != nil {
+			return err
+		}
+		return services.SendCode(ctx, ac.cfg, tx, &user, models.CodeSignup)
+	})
+	if err != nil {
+		internalError(c, "Failed to register user", err)
+		return
 	}
-	config.DB.Create(&user)
-
-	utils.SendVerificationEmail(input.Email, otpToken)
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Registration successful. Please verify your email."})
 }
 
-func VerifyEmail(c *gin.Context) {
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
 	var input struct {
 		Email string `json:"email" binding:"required,email"`
 		Token string `json:"token" binding:"required"`
@@ -64,23 +84,47 @@ func VerifyEmail(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("email = ? AND verify_token = ?", input.Email, input.Token).First(&user).Error; err != nil {
+	ctx := c.Request.Context()
+	user, err := ac.users.GetByEmail(ctx, input.Email)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or verification code"})
 		return
 	}
 
-	user.Verified = true
-	user.VerifyToken = ""
-	config.DB.Save(&user)
+	_, err = otp.Verify(ctx, ac.cfg, ac.repos.OneTimeCodes, user.ID, input.Token, services.EmailCodePurposes()...)
+	switch {
+	case errors.Is(err, otp.ErrLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, otp.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or verification code"})
+		return
+	case err != nil:
+		internalError(c, "Failed to verify email", err)
+		return
+	}
+
+	err = ac.repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		user.Verified = true
+		if err := tx.Users.Save(ctx, user); err != nil {
+			return err
+		}
+		return tx.OneTimeCodes.Delete(ctx, user.ID, models.CodeSignup, models.CodeEmailChange)
+	})
+	if err != nil {
+		internalError(c, "Failed to verify email", err)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
 }
 
-func Login(c *gin.Context) {
+func (ac *AuthController) Login(c *gin.Context) {
 	var input struct {
-		Email    string `json:"email" binding:"required"`
-		Password string `json:"password" binding:"required"`
+		Email              string `json:"email" binding:"required"`
+		Password           string `json:"password" binding:"required"`
+		DeviceName         string `json:"device_name"`
+		TrustedDeviceToken string `json:"trusted_device_token"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -88,8 +132,8 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+	user, err := ac.users.GetByEmail(c.Request.Context(), input.Email)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
@@ -99,16 +143,29 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	accessToken, refreshToken, _ := utils.GenerateToken(user.ID)
-	user.RefreshToken = refreshToken
-	config.DB.Save(&user)
+	result, err := services.BeginLogin(c.Request.Context(), ac.cfg, ac.repos, user, input.DeviceName, input.TrustedDeviceToken)
+	if err != nil {
+		internalError(c, "Failed to log in", err)
+		return
+	}
+	if result.Tokens != nil {
+		c.JSON(http.StatusOK, gin.H{"access_token": result.Tokens.AccessToken, "refresh_token": result.Tokens.RefreshToken})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"access_token": accessToken, "refresh_token": refreshToken})
+	c.JSON(http.StatusAccepted, gin.H{
+		"challenge_id": result.Challenge.ID,
+		"methods":      result.Challenge.Methods,
+		"expires_at":   result.Challenge.ExpiresAt,
+	})
 }
 
-func RefreshToken(c *gin.Context) {
+func (ac *AuthController) CompleteLogin(c *gin.Context) {
 	var input struct {
-		RefreshToken string `json:"refresh_token" binding:"required"`
+		ChallengeID    string `json:"challenge_id" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+		Method         string `json:"method"`
+		RememberDevice bool   `json:"remember_device"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -116,21 +173,44 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	claims, err := utils.ValidateToken(input.RefreshToken)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+	tokens, trustedDevice, err := services.CompleteLogin(c.Request.Context(), ac.cfg, ac.repos, input.ChallengeID, input.Method, input.Code, input.RememberDevice)
+	switch {
+	case errors.Is(err, otp.ErrLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	case services.IsCodeError(err):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		internalError(c, "Failed to complete login", err)
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("id = ? AND refresh_token = ?", claims.UserID, input.RefreshToken).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+	response := gin.H{"access_token": tokens.AccessToken, "refresh_token": tokens.RefreshToken}
+	if trustedDevice != "" {
+		response["trusted_device_token"] = trustedDevice
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (ac *AuthController) RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	accessToken, newRefreshToken, _ := utils.GenerateToken(user.ID)
-	user.RefreshToken = newRefreshToken
-	config.DB.Save(&user)
+	tokens, err := services.RefreshSession(c.Request.Context(), ac.cfg, ac.repos.Sessions, input.RefreshToken)
+	if services.IsSessionError(err) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		internalError(c, "Failed to refresh session", err)
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"access_token": accessToken, "refresh_token": newRefreshToken})
+	c.JSON(http.StatusOK, gin.H{"access_token": tokens.AccessToken, "refresh_token": tokens.RefreshToken})
 }
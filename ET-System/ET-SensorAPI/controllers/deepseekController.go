@@ -1,20 +1,31 @@
 package controllers
 
 import (
-	"ET-SensorAPI/models"
-	"ET-SensorAPI/utils"
+	"ET-SensorAPI/ai"
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/services"
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
-
-	"gorm.io/gorm"
 )
 
-func GetUsageAnalysis(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
-	var usage []models.WaterUsage
+type DeepSeekController struct {
+	cfg   *config.Config
+	usage repository.UsageRepo
+	llm   ai.Provider
+}
+
+func NewDeepSeekController(cfg *config.Config, usage repository.UsageRepo, llm ai.Provider) *DeepSeekController {
+	return &DeepSeekController{cfg: cfg, usage: usage, llm: llm}
+}
+
+// GetUsageAnalysis summarizes the last three months of usage, in the
+// language query parameter when given.
+func (dc *DeepSeekController) GetUsageAnalysis(w http.ResponseWriter, r *http.Request) {
 	startDate := time.Now().AddDate(0, -3, 0)
-	db.Where("recorded_at >= ?", startDate).Find(&usage)
+	usage, _ := dc.usage.ListSince(r.Context(), startDate, nil)
 
 	if len(usage) == 0 {
 		http.Error(w, "No usage data found", http.StatusNotFound)
@@ -22,9 +33,10 @@ func GetUsageAnalysis(db *gorm.DB, w http.ResponseWriter, r *http.Request) {
 	}
 
 	usageData, _ := json.Marshal(usage)
-	deepSeekOutput, err := utils.AnalyzeUsageData(string(usageData))
+	deepSeekOutput, err := services.AnalyzeUsageData(r.Context(), dc.llm, dc.cfg.Language(r.URL.Query().Get("language")), string(usageData))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Ollama error: %v", err), http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "usage analysis failed", "error", err)
+		http.Error(w, "Failed to analyze usage", http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"ET-SensorAPI/mail"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DevMailController shows the emails kept by the capture mail transport, so
+// the register and login flows can be completed without a mail server.
+type DevMailController struct {
+	capture *mail.Capture
+}
+
+func NewDevMailController(capture *mail.Capture) *DevMailController {
+	return &DevMailController{capture: capture}
+}
+
+type capturedMail struct {
+	ID      int      `json:"id"`
+	SentAt  string   `json:"sent_at"`
+	Kind    string   `json:"kind"`
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	URL     string   `json:"url"`
+}
+
+// ListMails returns the captured emails, newest first, optionally only those
+// sent to the "to" query parameter.
+func (dc *DevMailController) ListMails(c *gin.Context) {
+	messages := dc.capture.Messages()
+	if to := c.Query("to"); to != "" {
+		messages = dc.capture.To(to)
+	}
+
+	mails := make([]capturedMail, 0, len(messages))
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		mails = append(mails, capturedMail{
+			ID:      m.ID,
+			SentAt:  m.SentAt.UTC().Format("2006-01-02T15:04:05Z"),
+			Kind:    m.Kind,
+			From:    m.From,
+			To:      m.To,
+			Subject: m.Subject,
+			URL:     "/dev/mail/" + strconv.Itoa(m.ID),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"mails": mails})
+}
+
+// ShowMail renders the HTML body of one captured email.
+func (dc *DevMailController) ShowMail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mail ID"})
+		return
+	}
+	m, ok := dc.capture.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mail not found"})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(m.HTML))
+}
+
+func (dc *DevMailController) ClearMails(c *gin.Context) {
+	dc.capture.Reset()
+	c.Status(http.StatusNoContent)
+}
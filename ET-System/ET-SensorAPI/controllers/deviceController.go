@@ -1,16 +1,24 @@
 package controllers
 
 import (
-	"ET-SensorAPI/config"
 	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func CreateDevice(c *gin.Context) {
+type DeviceController struct {
+	devices repository.DeviceRepo
+	usage   repository.UsageRepo
+}
+
+func NewDeviceController(devices repository.DeviceRepo, usage repository.UsageRepo) *DeviceController {
+	return &DeviceController{devices: devices, usage: usage}
+}
+
+func (dc *DeviceController) CreateDevice(c *gin.Context) {
 	var request map[string]interface{}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -45,61 +53,54 @@ func CreateDevice(c *gin.Context) {
 		Location:    location,
 	}
 
-	if err := config.DB.Create(&device).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create device"})
+	if err := dc.devices.Create(c.Request.Context(), &device); err != nil {
+		internalError(c, "Failed to create device", err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, device)
 }
 
-func GetDevices(c *gin.Context) {
-	var devices []models.Device
-	config.DB.Find(&devices)
+func (dc *DeviceController) GetDevices(c *gin.Context) {
+	devices, _ := dc.devices.List(c.Request.Context())
 	c.JSON(http.StatusOK, devices)
 }
 
-func GetDevicesByGroup(c *gin.Context) {
-	groupID := c.Param("group_id")
+func (dc *DeviceController) GetDevicesByGroup(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("group_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_id format"})
+		return
+	}
 
-	var devices []models.Device
-	if err := config.DB.
-		Preload("WaterUsages").
-		Where("user_group_id = ?", groupID).
-		Find(&devices).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
+	devices, err := dc.devices.ListByGroup(c.Request.Context(), uint(groupID))
+	if err != nil {
+		internalError(c, "Failed to fetch devices", err)
 		return
 	}
 
+	totalByDevice, err := dc.usage.GroupDeviceTotals(c.Request.Context(), uint(groupID))
+	if err != nil {
+		internalError(c, "Failed to fetch devices", err)
+		return
+	}
 	for i := range devices {
-		var totalUsage float64
-		config.DB.Table("water_usages").
-			Where("device_id = ?", devices[i].ID).
-			Select("SUM(total_usage)").
-			Scan(&totalUsage)
-		devices[i].WaterUsages = []models.WaterUsage{{TotalUsage: totalUsage}}
+		devices[i].WaterUsages = []models.WaterUsage{{TotalUsage: totalByDevice[devices[i].ID]}}
 	}
 
 	c.JSON(http.StatusOK, devices)
 }
 
-type WaterUsageLog struct {
-	DeviceName string    `json:"device_name"`
-	FlowRate   float64   `json:"flow_rate"`
-	RecordedAt time.Time `json:"recorded_at"`
-}
+func (dc *DeviceController) GetDeviceLogs(c *gin.Context) {
+	groupID, err := strconv.ParseUint(c.Param("group_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group_id format"})
+		return
+	}
 
-func GetDeviceLogs(c *gin.Context) {
-	groupID := c.Param("group_id")
-
-	var logs []WaterUsageLog
-	if err := config.DB.Table("water_usages").
-		Joins("JOIN devices ON devices.id = water_usages.device_id").
-		Where("devices.user_group_id = ?", groupID).
-		Order("water_usages.recorded_at DESC").
-		Select("devices.name AS device_name, water_usages.flow_rate, water_usages.recorded_at").
-		Scan(&logs).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage logs"})
+	logs, err := dc.usage.GroupLogs(c.Request.Context(), uint(groupID))
+	if err != nil {
+		internalError(c, "Failed to fetch usage logs", err)
 		return
 	}
 
@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// internalError logs err against the request and answers 500 with msg only,
+// so database details never reach the client.
+func internalError(c *gin.Context, msg string, err error) {
+	slog.ErrorContext(c.Request.Context(), msg, "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+}
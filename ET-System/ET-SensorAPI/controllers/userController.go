@@ -1,69 +1,75 @@
 package controllers
 
 import (
-	"ET-SensorAPI/config"
 	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-func CreateUser(c *gin.Context) {
+type UserController struct {
+	users  repository.UserRepo
+	groups repository.GroupRepo
+}
+
+func NewUserController(users repository.UserRepo, groups repository.GroupRepo) *UserController {
+	return &UserController{users: users, groups: groups}
+}
+
+func (uc *UserController) CreateUser(c *gin.Context) {
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	if err := uc.users.Create(c.Request.Context(), &user); err != nil {
+		internalError(c, "Failed to create user", err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, user)
 }
 
-func GetUsers(c *gin.Context) {
-	var users []models.User
-	config.DB.Find(&users)
+func (uc *UserController) GetUsers(c *gin.Context) {
+	users, _ := uc.users.List(c.Request.Context())
 	c.JSON(http.StatusOK, users)
 }
 
-func AssignUserToGroup(c *gin.Context) {
+func (uc *UserController) AssignUserToGroup(c *gin.Context) {
 	var userGroupMember models.UserGroupMember
 	if err := c.ShouldBindJSON(&userGroupMember); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	ctx := c.Request.Context()
 
-	var user models.User
-	if err := config.DB.First(&user, userGroupMember.UserID).Error; err != nil {
+	if _, err := uc.users.GetByID(ctx, userGroupMember.UserID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	var group models.UserGroup
-	if err := config.DB.First(&group, userGroupMember.UserGroupID).Error; err != nil {
+	if _, err := uc.groups.GetByID(ctx, userGroupMember.UserGroupID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User group not found"})
 		return
 	}
 
-	var count int64
-	config.DB.Model(&models.UserGroupMember{}).Where("user_group_id = ?", userGroupMember.UserGroupID).Count(&count)
+	count, _ := uc.groups.CountMembers(ctx, userGroupMember.UserGroupID)
 	if count >= 4 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User group cannot have more than 4 users"})
 		return
 	}
 
-	if err := config.DB.Create(&userGroupMember).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign user to group"})
+	if err := uc.groups.AddMember(ctx, &userGroupMember); err != nil {
+		internalError(c, "Failed to assign user to group", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User assigned to group successfully", "user_group_member": userGroupMember})
 }
 
-func GetUserData(c *gin.Context) {
+func (uc *UserController) GetUserData(c *gin.Context) {
 	var request struct {
 		Email string `json:"email" binding:"required"`
 	}
@@ -73,8 +79,8 @@ func GetUserData(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("email = ?", request.Email).First(&user).Error; err != nil {
+	user, err := uc.users.GetByEmail(c.Request.Context(), request.Email)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -1,15 +1,23 @@
 package controllers
 
 import (
-	"ET-SensorAPI/config"
 	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-func CreateUserGroup(c *gin.Context) {
+type UserGroupController struct {
+	groups repository.GroupRepo
+}
+
+func NewUserGroupController(groups repository.GroupRepo) *UserGroupController {
+	return &UserGroupController{groups: groups}
+}
+
+func (gc *UserGroupController) CreateUserGroup(c *gin.Context) {
 	var request map[string]interface{}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -39,14 +47,14 @@ func CreateUserGroup(c *gin.Context) {
 	}
 
 	group := models.UserGroup{Name: name}
-	if err := config.DB.Create(&group).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user group"})
+	if err := gc.groups.Create(c.Request.Context(), &group); err != nil {
+		internalError(c, "Failed to create user group", err)
 		return
 	}
 
 	member := models.UserGroupMember{UserID: userID, UserGroupID: group.ID}
-	if err := config.DB.Create(&member).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add user to group"})
+	if err := gc.groups.AddMember(c.Request.Context(), &member); err != nil {
+		internalError(c, "Failed to add user to group", err)
 		return
 	}
 
@@ -57,16 +65,16 @@ func CreateUserGroup(c *gin.Context) {
 	})
 }
 
-func GetDeviceGroups(c *gin.Context) {
-	var groups []models.UserGroup
-	if err := config.DB.Preload("Devices").Find(&groups).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user groups"})
+func (gc *UserGroupController) GetDeviceGroups(c *gin.Context) {
+	groups, err := gc.groups.ListWithDevices(c.Request.Context())
+	if err != nil {
+		internalError(c, "Failed to retrieve user groups", err)
 		return
 	}
 	c.JSON(http.StatusOK, groups)
 }
 
-func AddUserToGroup(c *gin.Context) {
+func (gc *UserGroupController) AddUserToGroup(c *gin.Context) {
 	var userGroupMember models.UserGroupMember
 
 	if err := c.ShouldBindJSON(&userGroupMember); err != nil {
@@ -74,53 +82,45 @@ func AddUserToGroup(c *gin.Context) {
 		return
 	}
 
-	var count int64
-	config.DB.Model(&models.UserGroupMember{}).
-		Where("user_group_id = ?", userGroupMember.UserGroupID).
-		Count(&count)
-
+	count, _ := gc.groups.CountMembers(c.Request.Context(), userGroupMember.UserGroupID)
 	if count >= 4 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User group cannot have more than 4 users"})
 		return
 	}
 
-	if err := config.DB.Create(&userGroupMember).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add user to group"})
+	if err := gc.groups.AddMember(c.Request.Context(), &userGroupMember); err != nil {
+		internalError(c, "Failed to add user to group", err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "User added to group successfully", "userGroupMember": userGroupMember})
 }
 
-func GetUserGroupMembers(c *gin.Context) {
-	var members []models.UserGroupMember
-
-	if err := config.DB.Preload("User").Find(&members).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user group members"})
+func (gc *UserGroupController) GetUserGroupMembers(c *gin.Context) {
+	members, err := gc.groups.ListMembers(c.Request.Context())
+	if err != nil {
+		internalError(c, "Failed to retrieve user group members", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, members)
 }
 
-func GetUserGroupsByUserID(c *gin.Context) {
+func (gc *UserGroupController) GetUserGroupsByUserID(c *gin.Context) {
 	uid := c.Param("uid")
 	if uid == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required"})
 		return
 	}
+	userID, err := strconv.ParseUint(uid, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
+		return
+	}
 
-	var groups []models.UserGroup
-
-	err := config.DB.
-		Table("user_group_members").
-		Select("user_groups.id, user_groups.name, user_groups.created_at").
-		Joins("join user_groups on user_group_members.user_group_id = user_groups.id").
-		Where("user_group_members.user_id = ?", uid).
-		Scan(&groups).Error
-
+	groups, err := gc.groups.ListByUser(c.Request.Context(), uint(userID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user groups"})
+		internalError(c, "Failed to retrieve user groups", err)
 		return
 	}
 
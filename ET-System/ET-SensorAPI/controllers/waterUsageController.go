@@ -1,9 +1,12 @@
 package controllers
 
 import (
-	"ET-SensorAPI/config"
+	"ET-SensorAPI/metrics"
 	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/utils"
 	"bytes"
+	"errors"
 	"io"
 	"net/http"
 	"regexp"
@@ -14,7 +17,15 @@ import (
 
 var etUUIDRegex = regexp.MustCompile(`^ET-[a-f0-9A-F\-]+$`)
 
-func CreateWaterUsage(c *gin.Context) {
+type WaterUsageController struct {
+	repos *repository.Repositories
+}
+
+func NewWaterUsageController(repos *repository.Repositories) *WaterUsageController {
+	return &WaterUsageController{repos: repos}
+}
+
+func (wc *WaterUsageController) CreateWaterUsage(c *gin.Context) {
 	var waterUsage models.WaterUsage
 
 	body, err := io.ReadAll(c.Request.Body)
@@ -25,39 +36,46 @@ func CreateWaterUsage(c *gin.Context) {
 	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
 
 	if err := c.ShouldBindJSON(&waterUsage); err != nil {
+		metrics.ReadingRejected("invalid_json", "invalid")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format: " + err.Error()})
 		return
 	}
 
-	if waterUsage.TotalUsage <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "total_usage must be positive"})
-		return
-	}
-
 	if !etUUIDRegex.MatchString(waterUsage.DeviceID) {
+		metrics.ReadingRejected("invalid_device_id", "invalid")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Device ID format (expected ET-XXX)"})
 		return
 	}
 
-	tx := config.DB.Begin()
-	defer tx.Rollback()
-
-	var device models.Device
-	if err := tx.Where("id = ?", waterUsage.DeviceID).First(&device).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+	if waterUsage.TotalUsage <= 0 {
+		metrics.ReadingRejected("non_positive_usage", "unverified")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "total_usage must be positive"})
 		return
 	}
 
-	waterUsage.RecordedAt = time.Now()
-	if err := tx.Create(&waterUsage).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record water usage"})
+	err = wc.repos.Transaction(c.Request.Context(), func(tx *repository.Repositories) error {
+		device, err := tx.Devices.GetByID(c.Request.Context(), waterUsage.DeviceID)
+		if err != nil {
+			return err
+		}
+
+		waterUsage.RecordedAt = time.Now()
+		if err := tx.Usage.Create(c.Request.Context(), &waterUsage); err != nil {
+			return err
+		}
+		return tx.Usage.AddToRollups(c.Request.Context(), waterUsage, utils.ResolveLocation(nil, &device.UserGroup))
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		metrics.ReadingRejected("unknown_device", "unknown")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
 		return
 	}
-
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+	if err != nil {
+		metrics.ReadingRejected("store_failed", waterUsage.DeviceID)
+		internalError(c, "Failed to record water usage", err)
 		return
 	}
+	metrics.ReadingAccepted(waterUsage.DeviceID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Water usage recorded",
@@ -70,21 +88,21 @@ func CreateWaterUsage(c *gin.Context) {
 	})
 }
 
-func GetWaterUsage(c *gin.Context) {
-	var waterUsages []models.WaterUsage
-	if err := config.DB.Preload("Device").Find(&waterUsages).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch water usage records"})
+func (wc *WaterUsageController) GetWaterUsage(c *gin.Context) {
+	waterUsages, err := wc.repos.Usage.List(c.Request.Context())
+	if err != nil {
+		internalError(c, "Failed to fetch water usage records", err)
 		return
 	}
 	c.JSON(http.StatusOK, waterUsages)
 }
 
-func GetDeviceWaterUsage(c *gin.Context) {
+func (wc *WaterUsageController) GetDeviceWaterUsage(c *gin.Context) {
 	deviceID := c.Param("device_id")
 
-	var totalUsage float64
-	if err := config.DB.Table("water_usages").Where("device_id = ?", deviceID).Select("SUM(usage)").Scan(&totalUsage).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch usage"})
+	totalUsage, err := wc.repos.Usage.DeviceTotal(c.Request.Context(), deviceID)
+	if err != nil {
+		internalError(c, "Failed to fetch usage", err)
 		return
 	}
 
@@ -14,9 +14,13 @@ type WaterData interface {
 	IsWaterData()
 }
 
+// token is a short-lived access token, sent as "Authorization: Bearer <token>"; refreshToken renews it once.
 type AuthPayload struct {
-	User  *User  `json:"user"`
-	Token string `json:"token"`
+	User         *User  `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	// Set by completeLogin(rememberDevice: true); pass it to login to skip the second step on this device.
+	TrustedDeviceToken *string `json:"trustedDeviceToken,omitempty"`
 }
 
 type DailyData struct {
@@ -45,12 +49,61 @@ type Device struct {
 	WaterUsages []*WaterUsage `json:"waterUsages"`
 }
 
+type DeviceRetentionReport struct {
+	DeviceID string `json:"deviceId"`
+	GroupID  int32  `json:"groupId"`
+	ToMinute int32  `json:"toMinute"`
+	ToHour   int32  `json:"toHour"`
+	Purged   int32  `json:"purged"`
+}
+
 type DeviceUsageData struct {
 	ID       string  `json:"id"`
 	Location string  `json:"Location"`
 	Usage    float64 `json:"Usage"`
 }
 
+type DeviceUsageDelta struct {
+	Device        *Device  `json:"device"`
+	CurrentUsage  float64  `json:"currentUsage"`
+	PreviousUsage float64  `json:"previousUsage"`
+	Change        float64  `json:"change"`
+	ChangePercent *float64 `json:"changePercent,omitempty"`
+}
+
+type Job struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Timezone string    `json:"timezone"`
+	NextRun  time.Time `json:"nextRun"`
+	LastRun  *JobRun   `json:"lastRun,omitempty"`
+}
+
+type JobRun struct {
+	ID          string     `json:"id"`
+	Job         string     `json:"job"`
+	Trigger     string     `json:"trigger"`
+	Status      string     `json:"status"`
+	ScheduledAt *time.Time `json:"scheduledAt,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	Error       *string    `json:"error,omitempty"`
+	Instance    string     `json:"instance"`
+}
+
+// A password login waiting for its second step; the first method is the default.
+type LoginChallenge struct {
+	ChallengeID string            `json:"challengeId"`
+	Methods     []TwoFactorMethod `json:"methods"`
+	ExpiresAt   time.Time         `json:"expiresAt"`
+}
+
+// Exactly one is set: auth when the device is trusted, challenge otherwise.
+type LoginResult struct {
+	Challenge *LoginChallenge `json:"challenge,omitempty"`
+	Auth      *AuthPayload    `json:"auth,omitempty"`
+}
+
 type MonthlyData struct {
 	Month      string       `json:"month"`
 	Days       []*DailyData `json:"days"`
@@ -60,11 +113,6 @@ type MonthlyData struct {
 
 func (MonthlyData) IsWaterData() {}
 
-type MonthlyWaterUsage struct {
-	TotalUsage float64       `json:"totalUsage"`
-	Usages     []*WaterUsage `json:"usages"`
-}
-
 type Mutation struct {
 }
 
@@ -76,15 +124,127 @@ type Notification struct {
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+type PeriodUsage struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	TotalUsage float64   `json:"totalUsage"`
+}
+
 type Query struct {
 }
 
+type QueueJob struct {
+	ID         string     `json:"id"`
+	Queue      string     `json:"queue"`
+	Kind       string     `json:"kind"`
+	Status     string     `json:"status"`
+	Attempts   int32      `json:"attempts"`
+	RunAt      time.Time  `json:"runAt"`
+	LastError  *string    `json:"lastError,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// A single-use token for resetPassword, handed out for a verified reset code.
+type ResetToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type RetentionPolicy struct {
+	GroupID    int32 `json:"groupId"`
+	RawDays    int32 `json:"rawDays"`
+	MinuteDays int32 `json:"minuteDays"`
+	MaxAgeDays int32 `json:"maxAgeDays"`
+}
+
+type RetentionReport struct {
+	DryRun      bool                     `json:"dryRun"`
+	GeneratedAt time.Time                `json:"generatedAt"`
+	Devices     []*DeviceRetentionReport `json:"devices"`
+}
+
+// A signed-in device. current marks the session of the request.
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName *string   `json:"deviceName,omitempty"`
+	IP         *string   `json:"ip,omitempty"`
+	UserAgent  *string   `json:"userAgent,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// A pending authenticator app: scan uri, or enter secret, then confirm with enableTotp.
+type TotpSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TrustedDevice struct {
+	ID         string    `json:"id"`
+	DeviceName *string   `json:"deviceName,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type TwoFactorStatus struct {
+	TotpEnabled       bool  `json:"totpEnabled"`
+	RecoveryCodesLeft int32 `json:"recoveryCodesLeft"`
+}
+
+// An AI usage analysis running on the job queue. status is pending, running,
+// succeeded or failed; analysis is set once it succeeded.
+type UsageAnalysis struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Analysis   *string    `json:"analysis,omitempty"`
+	Error      *string    `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+type UsageComparison struct {
+	Scope                     UsageScope          `json:"scope"`
+	Period                    ComparisonPeriod    `json:"period"`
+	Timezone                  string              `json:"timezone"`
+	Current                   *PeriodUsage        `json:"current"`
+	Previous                  *PeriodUsage        `json:"previous"`
+	LastYear                  *PeriodUsage        `json:"lastYear"`
+	Change                    float64             `json:"change"`
+	ChangePercent             *float64            `json:"changePercent,omitempty"`
+	YearOverYearChange        float64             `json:"yearOverYearChange"`
+	YearOverYearChangePercent *float64            `json:"yearOverYearChangePercent,omitempty"`
+	Devices                   []*DeviceUsageDelta `json:"devices"`
+}
+
+type UsageSeries struct {
+	Bucket   UsageBucket         `json:"bucket"`
+	Timezone string              `json:"timezone"`
+	From     time.Time           `json:"from"`
+	To       time.Time           `json:"to"`
+	Points   []*UsageSeriesPoint `json:"points"`
+}
+
+type UsageSeriesPoint struct {
+	BucketStart time.Time `json:"bucketStart"`
+	TotalUsage  float64   `json:"totalUsage"`
+	AvgFlow     float64   `json:"avgFlow"`
+	MaxFlow     float64   `json:"maxFlow"`
+	Samples     int32     `json:"samples"`
+}
+
 type User struct {
-	ID          string             `json:"id"`
-	Email       string             `json:"email"`
-	DisplayName *string            `json:"displayName,omitempty"`
-	Verified    bool               `json:"verified"`
-	CreatedAt   time.Time          `json:"createdAt"`
+	ID          string    `json:"id"`
+	Email       string    `json:"email"`
+	DisplayName *string   `json:"displayName,omitempty"`
+	Verified    bool      `json:"verified"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Timezone    *string   `json:"timezone,omitempty"`
+	// Preferred language of emails, notifications and analyses; null uses the server default.
+	Language    *string            `json:"language,omitempty"`
 	Memberships []*UserGroupMember `json:"memberships"`
 }
 
@@ -95,6 +255,7 @@ type UserGroup struct {
 	Devices   []*Device          `json:"devices"`
 	Users     []*UserGroupMember `json:"users"`
 	Location  []string           `json:"location"`
+	Timezone  string             `json:"timezone"`
 }
 
 type UserGroupMember struct {
@@ -112,11 +273,6 @@ type WaterUsage struct {
 	RecordedAt time.Time `json:"recordedAt"`
 }
 
-type WaterUsageComparison struct {
-	CurrentMonth  *MonthlyWaterUsage `json:"currentMonth"`
-	PreviousMonth *MonthlyWaterUsage `json:"previousMonth"`
-}
-
 type WaterUsageList struct {
 	Data []*WaterUsage `json:"data"`
 }
@@ -132,6 +288,125 @@ type YearlyData struct {
 
 func (YearlyData) IsWaterData() {}
 
+// What a one-time code was mailed for; a code only verifies for its own purpose.
+type CodePurpose string
+
+const (
+	CodePurposeSignup      CodePurpose = "SIGNUP"
+	CodePurposeLogin       CodePurpose = "LOGIN"
+	CodePurposeReset       CodePurpose = "RESET"
+	CodePurposeEmailChange CodePurpose = "EMAIL_CHANGE"
+)
+
+var AllCodePurpose = []CodePurpose{
+	CodePurposeSignup,
+	CodePurposeLogin,
+	CodePurposeReset,
+	CodePurposeEmailChange,
+}
+
+func (e CodePurpose) IsValid() bool {
+	switch e {
+	case CodePurposeSignup, CodePurposeLogin, CodePurposeReset, CodePurposeEmailChange:
+		return true
+	}
+	return false
+}
+
+func (e CodePurpose) String() string {
+	return string(e)
+}
+
+func (e *CodePurpose) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CodePurpose(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CodePurpose", str)
+	}
+	return nil
+}
+
+func (e CodePurpose) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *CodePurpose) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e CodePurpose) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type ComparisonPeriod string
+
+const (
+	ComparisonPeriodDay   ComparisonPeriod = "DAY"
+	ComparisonPeriodWeek  ComparisonPeriod = "WEEK"
+	ComparisonPeriodMonth ComparisonPeriod = "MONTH"
+	ComparisonPeriodYear  ComparisonPeriod = "YEAR"
+)
+
+var AllComparisonPeriod = []ComparisonPeriod{
+	ComparisonPeriodDay,
+	ComparisonPeriodWeek,
+	ComparisonPeriodMonth,
+	ComparisonPeriodYear,
+}
+
+func (e ComparisonPeriod) IsValid() bool {
+	switch e {
+	case ComparisonPeriodDay, ComparisonPeriodWeek, ComparisonPeriodMonth, ComparisonPeriodYear:
+		return true
+	}
+	return false
+}
+
+func (e ComparisonPeriod) String() string {
+	return string(e)
+}
+
+func (e *ComparisonPeriod) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ComparisonPeriod(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ComparisonPeriod", str)
+	}
+	return nil
+}
+
+func (e ComparisonPeriod) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ComparisonPeriod) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ComparisonPeriod) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
 type OAuthProvider string
 
 const (
@@ -186,3 +461,178 @@ func (e OAuthProvider) MarshalJSON() ([]byte, error) {
 	e.MarshalGQL(&buf)
 	return buf.Bytes(), nil
 }
+
+type TwoFactorMethod string
+
+const (
+	TwoFactorMethodEmail        TwoFactorMethod = "EMAIL"
+	TwoFactorMethodTotp         TwoFactorMethod = "TOTP"
+	TwoFactorMethodRecoveryCode TwoFactorMethod = "RECOVERY_CODE"
+)
+
+var AllTwoFactorMethod = []TwoFactorMethod{
+	TwoFactorMethodEmail,
+	TwoFactorMethodTotp,
+	TwoFactorMethodRecoveryCode,
+}
+
+func (e TwoFactorMethod) IsValid() bool {
+	switch e {
+	case TwoFactorMethodEmail, TwoFactorMethodTotp, TwoFactorMethodRecoveryCode:
+		return true
+	}
+	return false
+}
+
+func (e TwoFactorMethod) String() string {
+	return string(e)
+}
+
+func (e *TwoFactorMethod) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TwoFactorMethod(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TwoFactorMethod", str)
+	}
+	return nil
+}
+
+func (e TwoFactorMethod) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *TwoFactorMethod) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e TwoFactorMethod) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type UsageBucket string
+
+const (
+	UsageBucketMinute UsageBucket = "MINUTE"
+	UsageBucketHour   UsageBucket = "HOUR"
+	UsageBucketDay    UsageBucket = "DAY"
+	UsageBucketWeek   UsageBucket = "WEEK"
+	UsageBucketMonth  UsageBucket = "MONTH"
+)
+
+var AllUsageBucket = []UsageBucket{
+	UsageBucketMinute,
+	UsageBucketHour,
+	UsageBucketDay,
+	UsageBucketWeek,
+	UsageBucketMonth,
+}
+
+func (e UsageBucket) IsValid() bool {
+	switch e {
+	case UsageBucketMinute, UsageBucketHour, UsageBucketDay, UsageBucketWeek, UsageBucketMonth:
+		return true
+	}
+	return false
+}
+
+func (e UsageBucket) String() string {
+	return string(e)
+}
+
+func (e *UsageBucket) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UsageBucket(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UsageBucket", str)
+	}
+	return nil
+}
+
+func (e UsageBucket) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *UsageBucket) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e UsageBucket) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type UsageScope string
+
+const (
+	UsageScopeDevice   UsageScope = "DEVICE"
+	UsageScopeGroup    UsageScope = "GROUP"
+	UsageScopeLocation UsageScope = "LOCATION"
+)
+
+var AllUsageScope = []UsageScope{
+	UsageScopeDevice,
+	UsageScopeGroup,
+	UsageScopeLocation,
+}
+
+func (e UsageScope) IsValid() bool {
+	switch e {
+	case UsageScopeDevice, UsageScopeGroup, UsageScopeLocation:
+		return true
+	}
+	return false
+}
+
+func (e UsageScope) String() string {
+	return string(e)
+}
+
+func (e *UsageScope) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UsageScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UsageScope", str)
+	}
+	return nil
+}
+
+func (e UsageScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *UsageScope) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e UsageScope) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
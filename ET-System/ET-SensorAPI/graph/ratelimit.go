@@ -0,0 +1,60 @@
+package graph
+
+import (
+	"ET-SensorAPI/auth"
+	"ET-SensorAPI/ratelimit"
+	"ET-SensorAPI/services"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// RateLimitDirective implements @rateLimit with limiter. Operations share
+// their buckets with the REST auth routes, so switching APIs does not earn
+// a client more attempts.
+func RateLimitDirective(limiter *ratelimit.Limiter) func(ctx context.Context, obj any, next graphql.Resolver, account *string) (any, error) {
+	return func(ctx context.Context, obj any, next graphql.Resolver, account *string) (any, error) {
+		cfg := limiter.Config()
+		err := limiter.Check(ctx,
+			ratelimit.Check{Rule: services.RuleAuthIP, Rate: cfg.AuthPerIP, Key: auth.ClientOf(ctx).IP},
+			ratelimit.Check{Rule: services.RuleAuthAccount, Rate: cfg.AuthPerAccount, Key: accountKey(ctx, account)},
+		)
+		var limited *ratelimit.LimitedError
+		if errors.As(err, &limited) {
+			return nil, &gqlerror.Error{
+				Message: limited.Error(),
+				Extensions: map[string]any{
+					"code":       "RATE_LIMITED",
+					"retryAfter": ratelimit.RetryAfterSeconds(limited.RetryAfter),
+				},
+			}
+		}
+		return next(ctx)
+	}
+}
+
+// accountKey is the lowercased value of the argument named account, or the
+// signed-in user when there is no such argument.
+func accountKey(ctx context.Context, account *string) string {
+	if account != nil {
+		if fc := graphql.GetFieldContext(ctx); fc != nil {
+			switch v := fc.Args[*account].(type) {
+			case string:
+				return strings.ToLower(strings.TrimSpace(v))
+			case *string:
+				if v != nil {
+					return strings.ToLower(strings.TrimSpace(*v))
+				}
+			}
+		}
+		return ""
+	}
+	if claims := auth.Claims(ctx); claims != nil {
+		return fmt.Sprintf("user:%d", claims.UserID)
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package graph
+
+import (
+	"ET-SensorAPI/ai"
+	"ET-SensorAPI/auth"
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/graph/model"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/scheduler"
+	"ET-SensorAPI/services"
+	"ET-SensorAPI/utils"
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// storedNotificationLimit bounds the stored notifications listed with the
+// live usage comparison.
+const storedNotificationLimit = 50
+
+func NewResolver(cfg *config.Config, repos *repository.Repositories, jobs *scheduler.Scheduler, llm ai.Provider) *Resolver {
+	return &Resolver{
+		Config:    cfg,
+		Repos:     repos,
+		Scheduler: jobs,
+		AI:        llm,
+		Retention: services.NewRetentionService(repos.Devices, repos.Groups, repos.Usage,
+			services.DefaultRetentionSettings(cfg.Retention)),
+	}
+}
+
+// internalError logs err against the current request and returns msg alone,
+// so database and upstream details never reach the client.
+func internalError(ctx context.Context, msg string, err error) error {
+	attrs := []any{"error", err}
+	if fc := graphql.GetFieldContext(ctx); fc != nil {
+		attrs = append(attrs, "field", fc.Path().String())
+	}
+	slog.ErrorContext(ctx, msg, attrs...)
+	return errors.New(msg)
+}
+
+// argumentGiven reports whether the current field was called with the
+// argument name, which tells an omitted argument apart from an explicit null.
+func argumentGiven(ctx context.Context, name string) bool {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Field.Field == nil {
+		return false
+	}
+	arg := fc.Field.Arguments.ForName(name)
+	if arg == nil {
+		return false
+	}
+	if arg.Value.Kind == ast.Variable {
+		_, ok := graphql.GetOperationContext(ctx).Variables[arg.Value.Raw]
+		return ok
+	}
+	return true
+}
+
+// codeError returns one-time code errors as they are and hides anything
+// else behind msg.
+func codeError(ctx context.Context, msg string, err error) error {
+	if services.IsCodeError(err) {
+		return err
+	}
+	return internalError(ctx, msg, err)
+}
+
+// sessionError returns authentication and refresh token errors as they are
+// and hides anything else behind msg.
+func sessionError(ctx context.Context, msg string, err error) error {
+	if services.IsSessionError(err) {
+		return err
+	}
+	return internalError(ctx, msg, err)
+}
+
+// authPayload returns user, with memberships, signed in with tokens.
+func (r *Resolver) authPayload(ctx context.Context, user *models.User, tokens *services.Tokens) (*model.AuthPayload, error) {
+	memberships, err := r.Repos.Groups.MembershipsOfUser(ctx, user.ID)
+	if err != nil {
+		return nil, internalError(ctx, "failed to load memberships", err)
+	}
+	return &model.AuthPayload{
+		User:         utils.ConvertAuthedUserToGQL(*user, memberships),
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+// currentUser returns the user of the caller's session.
+func (r *Resolver) currentUser(ctx context.Context) (*models.User, error) {
+	session, err := services.Authenticate(ctx, r.Repos.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	return r.Repos.Users.GetByID(ctx, session.UserID)
+}
+
+// requireAdmin returns the caller when they are one of the configured
+// admins.
+func (r *Resolver) requireAdmin(ctx context.Context) (*models.User, error) {
+	user, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to fetch user", err)
+	}
+	if !r.Config.Auth.IsAdmin(user.Email) {
+		return nil, auth.ErrForbidden
+	}
+	return user, nil
+}
+
+// requireGroupAdmin returns the caller when they are an admin of groupID or
+// one of the configured admins.
+func (r *Resolver) requireGroupAdmin(ctx context.Context, groupID uint) (*models.User, error) {
+	user, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to fetch user", err)
+	}
+	if r.Config.Auth.IsAdmin(user.Email) {
+		return user, nil
+	}
+	member, err := r.Repos.Groups.GetMember(ctx, groupID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, auth.ErrForbidden
+	}
+	if err != nil {
+		return nil, internalError(ctx, "failed to check membership", err)
+	}
+	if !member.IsAdmin {
+		return nil, auth.ErrForbidden
+	}
+	return user, nil
+}
+
+// authorizeUsage checks that the caller may see the usage of userID or,
+// when it is zero, of groupID: their own, that of a group they belong to,
+// or anyone's for admins.
+func (r *Resolver) authorizeUsage(ctx context.Context, userID, groupID uint) error {
+	user, err := r.currentUser(ctx)
+	if err != nil {
+		return sessionError(ctx, "failed to fetch user", err)
+	}
+	if r.Config.Auth.IsAdmin(user.Email) {
+		return nil
+	}
+	if userID != 0 {
+		if userID != user.ID {
+			return auth.ErrForbidden
+		}
+		return nil
+	}
+	_, err = r.Repos.Groups.GetMember(ctx, groupID, user.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return auth.ErrForbidden
+	}
+	if err != nil {
+		return internalError(ctx, "failed to check membership", err)
+	}
+	return nil
+}
@@ -3,9 +3,15 @@ package graph
 // THIS CODE WILL BE UPDATED WITH SCHEMA CHANGES. PREVIOUS IMPLEMENTATION FOR SCHEMA CHANGES WILL BE KEPT IN THE COMMENT SECTION. IMPLEMENTATION FOR UNCHANGED SCHEMA WILL BE KEPT.
 
 import (
+	"ET-SensorAPI/ai"
 	"ET-SensorAPI/config"
 	"ET-SensorAPI/graph/model"
+	"ET-SensorAPI/i18n"
 	"ET-SensorAPI/models"
+	"ET-SensorAPI/otp"
+	"ET-SensorAPI/queue"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/scheduler"
 	"ET-SensorAPI/services"
 	"ET-SensorAPI/utils"
 	"context"
@@ -13,85 +19,133 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/auth/credentials/idtoken"
-	"gorm.io/gorm"
 )
 
 type Resolver struct {
-	DB *gorm.DB
+	Config    *config.Config
+	Repos     *repository.Repositories
+	Retention *services.RetentionService
+	Scheduler *scheduler.Scheduler
+	AI        ai.Provider
 }
 
 // Login is the resolver for the login field.
-func (r *mutationResolver) Login(ctx context.Context, email string, password string) (*model.AuthPayload, error) {
-	user, err := utils.AuthenticateUser(email, password)
+func (r *mutationResolver) Login(ctx context.Context, email string, password string, deviceName *string, trustedDeviceToken *string) (*model.LoginResult, error) {
+	user, err := utils.AuthenticateUser(ctx, r.Repos.Users, email, password)
 	if err != nil {
 		return nil, err
 	}
 
-	code, _ := utils.GenerateOTP()
-	token, _, err := utils.GenerateToken(user.ID)
+	result, err := services.BeginLogin(ctx, r.Config, r.Repos, user, utils.StringValue(deviceName), utils.StringValue(trustedDeviceToken))
 	if err != nil {
-		return nil, errors.New("failed to generate verification token")
+		return nil, internalError(ctx, "failed to log in", err)
 	}
 
-	if err := utils.SendVerificationEmail(email, code); err != nil {
-		return nil, errors.New("failed to send verification email")
+	if result.Tokens != nil {
+		payload, err := r.authPayload(ctx, user, result.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		return &model.LoginResult{Auth: payload}, nil
 	}
 
-	user.VerifyToken = code
-	user.RefreshToken = token
+	methods := make([]model.TwoFactorMethod, len(result.Challenge.Methods))
+	for i, m := range result.Challenge.Methods {
+		methods[i] = model.TwoFactorMethod(strings.ToUpper(m))
+	}
+	return &model.LoginResult{Challenge: &model.LoginChallenge{
+		ChallengeID: result.Challenge.ID,
+		Methods:     methods,
+		ExpiresAt:   result.Challenge.ExpiresAt,
+	}}, nil
+}
 
-	if err := config.DB.Save(&user).Error; err != nil {
-		return nil, errors.New("failed to save user")
+// CompleteLogin is the resolver for the completeLogin field.
+func (r *mutationResolver) CompleteLogin(ctx context.Context, challengeID string, code string, method *model.TwoFactorMethod, rememberDevice *bool) (*model.AuthPayload, error) {
+	methodName := ""
+	if method != nil {
+		methodName = strings.ToLower(method.String())
 	}
+	remember := rememberDevice != nil && *rememberDevice
 
-	var memberships []models.UserGroupMember
-	if err := config.DB.
-		Preload("User").
-		Preload("UserGroup").
-		Where("user_id = ?", user.ID).
-		Find(&memberships).Error; err != nil {
-		return nil, errors.New("failed to load memberships")
+	// Outside of a transaction: wrong guesses must count even though they fail.
+	tokens, trustedDevice, err := services.CompleteLogin(ctx, r.Config, r.Repos, challengeID, methodName, code, remember)
+	if err != nil {
+		return nil, codeError(ctx, "failed to complete login", err)
 	}
 
-	authUser := utils.ConvertAuthedUserToGQL(*user, memberships)
-	return &model.AuthPayload{
-		User:  authUser,
-		Token: token,
-	}, nil
+	user, err := r.Repos.Users.GetByID(ctx, tokens.Session.UserID)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch user", err)
+	}
+	payload, err := r.authPayload(ctx, user, tokens)
+	if err != nil {
+		return nil, err
+	}
+	if trustedDevice != "" {
+		payload.TrustedDeviceToken = &trustedDevice
+	}
+	return payload, nil
+}
+
+// RefreshToken is the resolver for the refreshToken field.
+func (r *mutationResolver) RefreshToken(ctx context.Context, refreshToken string) (*model.AuthPayload, error) {
+	tokens, err := services.RefreshSession(ctx, r.Config, r.Repos.Sessions, refreshToken)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to refresh session", err)
+	}
+
+	user, err := r.Repos.Users.GetByID(ctx, tokens.Session.UserID)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch user", err)
+	}
+	return r.authPayload(ctx, user, tokens)
 }
 
 // Register is the resolver for the register field.
-func (r *mutationResolver) Register(ctx context.Context, displayName string, email string, password string) (*string, error) {
-	var exists models.User
-	if err := config.DB.Where("email = ?", email).First(&exists).Error; err == nil {
+func (r *mutationResolver) Register(ctx context.Context, displayName string, email string, password string, language *string) (*string, error) {
+	lang := ""
+	if language != nil {
+		if err := utils.ValidateLanguage(*language); err != nil {
+			return nil, err
+		}
+		lang = *language
+	}
+
+	if _, err := r.Repos.Users.GetByEmail(ctx, email); err == nil {
 		return nil, errors.New("email already registered")
 	}
 
 	hashed, err := utils.HashPassword(password)
 	if err != nil {
-		return nil, errors.New("failed to hash password")
+		return nil, internalError(ctx, "failed to hash password", err)
 	}
 
-	token, _ := utils.GenerateOTP()
 	newUser := models.User{
 		Email:       email,
 		DisplayName: displayName,
 		Password:    hashed,
 		Verified:    false,
-		VerifyToken: token,
-	}
-
-	if err := config.DB.Create(&newUser).Error; err != nil {
-		return nil, errors.New("failed to create user")
+		Language:    lang,
 	}
 
-	if err := utils.SendVerificationEmail(email, token); err != nil {
-		return nil, errors.New("failed to send verification email")
+	err = r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Users.Create(ctx, &newUser); err != nil {
+			return internalError(ctx, "failed to create user", err)
+		}
+		if err := services.SendCode(ctx, r.Config, tx, &newUser, models.CodeSignup); err != nil {
+			return internalError(ctx, "failed to send verification email", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	successMessage := "Registration successful. Please check your email for verification."
@@ -100,53 +154,44 @@ func (r *mutationResolver) Register(ctx context.Context, displayName string, ema
 
 // AssignUserToGroup is the resolver for the assignUserToGroup field.
 func (r *mutationResolver) AssignUserToGroup(ctx context.Context, senderEmail string, userGroupID int32, receiverEmail string) (*string, error) {
+	err := r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		user, err := tx.Users.GetByEmail(ctx, receiverEmail)
+		if err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
 
-	tx := config.DB.Begin()
-	if tx.Error != nil {
-		return nil, fmt.Errorf("failed to start transaction: %w", tx.Error)
-	}
-
-	var user models.User
-	if err := tx.Where("email = ?", receiverEmail).First(&user).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("user not found: %w", err)
-	}
-
-	var group models.UserGroup
-	if err := tx.First(&group, userGroupID).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("group not found: %w", err)
-	}
-
-	var count int64
-	if err := tx.Model(&models.UserGroupMember{}).
-		Where("user_group_id = ?", group.ID).
-		Count(&count).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to check member count: %w", err)
-	}
-	if count >= 4 {
-		tx.Rollback()
-		return nil, errors.New("user group cannot have more than 4 users")
-	}
+		group, err := tx.Groups.GetByID(ctx, uint(userGroupID))
+		if err != nil {
+			return fmt.Errorf("group not found: %w", err)
+		}
 
-	membership := models.UserGroupMember{
-		UserID:      user.ID,
-		UserGroupID: group.ID,
-		IsAdmin:     false,
-	}
-	if err := tx.Create(&membership).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to assign user to group: %w", err)
-	}
+		count, err := tx.Groups.CountMembers(ctx, group.ID)
+		if err != nil {
+			return internalError(ctx, "failed to check member count", err)
+		}
+		if count >= 4 {
+			return errors.New("user group cannot have more than 4 users")
+		}
 
-	if err := utils.SendInvitationEmail(senderEmail, receiverEmail, group.Name); err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to send invitation email: %w", err)
-	}
+		membership := models.UserGroupMember{
+			UserID:      user.ID,
+			UserGroupID: group.ID,
+			IsAdmin:     false,
+		}
+		if err := tx.Groups.AddMember(ctx, &membership); err != nil {
+			return internalError(ctx, "failed to assign user to group", err)
+		}
 
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		if _, err := tx.Users.GetByEmail(ctx, senderEmail); err != nil {
+			return internalError(ctx, "failed to send invitation email", err)
+		}
+		if err := services.EnqueueInvitationEmail(ctx, tx.Queue, senderEmail, user, group.Name); err != nil {
+			return internalError(ctx, "failed to send invitation email", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	successMessage := "User assigned to group successfully"
@@ -154,19 +199,42 @@ func (r *mutationResolver) AssignUserToGroup(ctx context.Context, senderEmail st
 }
 
 // VerifyEmail is the resolver for the verifyEmail field.
-func (r *mutationResolver) VerifyEmail(ctx context.Context, email string, token string) (*string, error) {
-	var user models.User
-	if err := config.DB.Where("email = ? AND verify_token = ?", email, token).First(&user).Error; err != nil {
-		return nil, errors.New("invalid or expired token")
+func (r *mutationResolver) VerifyEmail(ctx context.Context, email string, token string, purpose *model.CodePurpose) (*string, error) {
+	user, err := r.Repos.Users.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, otp.ErrInvalid
+	} else if err != nil {
+		return nil, internalError(ctx, "failed to verify email", err)
 	}
 
-	if !user.Verified {
-		user.Verified = true
+	purposes := services.EmailCodePurposes()
+	if purpose != nil {
+		if *purpose == model.CodePurposeReset {
+			return nil, errors.New("reset codes are verified with verifyResetCode")
+		}
+		if *purpose == model.CodePurposeLogin {
+			return nil, errors.New("login codes are entered with completeLogin")
+		}
+		purposes = []string{strings.ToLower(purpose.String())}
+	}
+
+	// Outside of a transaction: wrong guesses must count even though they fail.
+	used, err := otp.Verify(ctx, r.Config, r.Repos.OneTimeCodes, user.ID, token, purposes...)
+	if err != nil {
+		return nil, codeError(ctx, "failed to verify email", err)
 	}
-	user.VerifyToken = ""
 
-	if err := config.DB.Save(&user).Error; err != nil {
-		return nil, errors.New("failed to verify email")
+	if used == models.CodeSignup || used == models.CodeEmailChange {
+		err = r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+			user.Verified = true
+			if err := tx.Users.Save(ctx, user); err != nil {
+				return err
+			}
+			return tx.OneTimeCodes.Delete(ctx, user.ID, models.CodeSignup, models.CodeEmailChange)
+		})
+		if err != nil {
+			return nil, internalError(ctx, "failed to verify email", err)
+		}
 	}
 
 	successMessage := "Email verified successfully."
@@ -175,21 +243,23 @@ func (r *mutationResolver) VerifyEmail(ctx context.Context, email string, token
 
 // ResendVerificationEmail is the resolver for the ResendVerificationEmail field.
 func (r *mutationResolver) ResendVerificationEmail(ctx context.Context, email string) (*string, error) {
-	user, err := utils.GetUserByEmail(email)
+	user, err := r.Repos.Users.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
 
-	accessToken, _ := utils.GenerateOTP()
-	user.VerifyToken = accessToken
-
-
-	if err := config.DB.Save(&user).Error; err != nil {
-		return nil, errors.New("failed to save user")
+	purpose := models.CodeSignup
+	if user.Verified {
+		if user.TOTPEnabledAt != nil {
+			return nil, services.ErrTwoFactorMethod
+		}
+		purpose = models.CodeLogin
 	}
-
-	if err := utils.SendVerificationEmail(user.Email, accessToken); err != nil {
-		return nil, errors.New("failed to send verification email")
+	err = r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		return services.SendCode(ctx, r.Config, tx, user, purpose)
+	})
+	if err != nil {
+		return nil, codeError(ctx, "failed to send verification email", err)
 	}
 
 	successMessage := "Verification email sent successfully"
@@ -198,7 +268,7 @@ func (r *mutationResolver) ResendVerificationEmail(ctx context.Context, email st
 
 // RequestForgotPassword is the resolver for the RequestForgotPassword field.
 func (r *mutationResolver) RequestForgotPassword(ctx context.Context, email string) (*string, error) {
-	user, err := utils.GetUserByEmail(email)
+	user, err := r.Repos.Users.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
@@ -207,38 +277,76 @@ func (r *mutationResolver) RequestForgotPassword(ctx context.Context, email stri
 		return nil, errors.New("email not verified")
 	}
 
-	accessToken, _ := utils.GenerateOTP()
-	user.VerifyToken = accessToken
+	err = r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		return services.SendCode(ctx, r.Config, tx, user, models.CodeReset)
+	})
+	if err != nil {
+		return nil, codeError(ctx, "failed to send verification email", err)
+	}
 
+	successMessage := "Verification email sent successfully"
+	return &successMessage, nil
+}
 
-	if err := config.DB.Save(&user).Error; err != nil {
-		return nil, errors.New("failed to save user")
+// VerifyResetCode is the resolver for the verifyResetCode field.
+func (r *mutationResolver) VerifyResetCode(ctx context.Context, email string, code string) (*model.ResetToken, error) {
+	user, err := r.Repos.Users.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, otp.ErrInvalid
+	} else if err != nil {
+		return nil, internalError(ctx, "failed to verify reset code", err)
 	}
 
-	if err := utils.SendVerificationEmail(user.Email, accessToken); err != nil {
-		return nil, errors.New("failed to send verification email")
+	if _, err := otp.Verify(ctx, r.Config, r.Repos.OneTimeCodes, user.ID, code, models.CodeReset); err != nil {
+		return nil, codeError(ctx, "failed to verify reset code", err)
 	}
 
-	successMessage := "Verification email sent successfully"
-	return &successMessage, nil
+	token, expiresAt, err := otp.IssueToken(ctx, r.Config, r.Repos.OneTimeCodes, user.ID, models.CodeResetToken, r.Config.OTP.ResetTokenTTL)
+	if err != nil {
+		return nil, internalError(ctx, "failed to issue reset token", err)
+	}
+	return &model.ResetToken{Token: token, ExpiresAt: expiresAt}, nil
 }
 
-// ForgotPasswordHandler is the resolver for the ForgotPasswordHandler field.
-func (r *mutationResolver) ForgotPasswordHandler(ctx context.Context, email string, password string) (*string, error) {
-	user, err := utils.GetUserByEmail(email)
-	if err != nil {
-		return nil, errors.New("user not found")
+// ResetPassword is the resolver for the resetPassword field.
+func (r *mutationResolver) ResetPassword(ctx context.Context, resetToken string, newPassword string) (*string, error) {
+	// Checked first so a rejected password does not use up the token.
+	if err := utils.ValidatePassword(newPassword); err != nil {
+		return nil, err
 	}
 
-	hashed, err := utils.HashPassword(password)
+	userID, err := otp.VerifyToken(ctx, r.Config, r.Repos.OneTimeCodes, resetToken, models.CodeResetToken)
 	if err != nil {
-		return nil, errors.New("failed to hash password")
+		return nil, codeError(ctx, "failed to reset password", err)
 	}
 
-	user.Password = hashed
+	hashed, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return nil, internalError(ctx, "failed to hash password", err)
+	}
 
-	if err := config.DB.Save(&user).Error; err != nil {
-		return nil, errors.New("failed to update password")
+	err = r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		user, err := tx.Users.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		user.Password = hashed
+		if err := tx.Users.Save(ctx, user); err != nil {
+			return err
+		}
+		if _, err := tx.Sessions.RevokeAll(ctx, user.ID, models.RevokedPasswordReset, time.Now().UTC()); err != nil {
+			return err
+		}
+		if err := tx.TwoFactor.DeleteTrustedDevices(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.OneTimeCodes.Delete(ctx, user.ID, models.CodeLogin, models.CodeReset, models.CodeResetToken); err != nil {
+			return err
+		}
+		return services.EnqueuePasswordChanged(ctx, tx.Queue, user, time.Now().UTC())
+	})
+	if err != nil {
+		return nil, internalError(ctx, "failed to reset password", err)
 	}
 
 	successMessage := "Password reset successfully"
@@ -254,38 +362,40 @@ func (r *mutationResolver) ChangeEmail(ctx context.Context, email string, passwo
 		return nil, errors.New("new email must be different from current email")
 	}
 
-	user, err := utils.GetUserByEmail(email)
+	user, err := r.Repos.Users.GetByEmail(ctx, email)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
 
-	_, err = utils.AuthenticateUser(email, password)
+	_, err = utils.AuthenticateUser(ctx, r.Repos.Users, email, password)
 	if err != nil {
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
 
-	var existingUser models.User
-	if err := config.DB.Where("email = ?", newemail).First(&existingUser).Error; err == nil {
+	if _, err := r.Repos.Users.GetByEmail(ctx, newemail); err == nil {
 		return nil, errors.New("new email is already registered")
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("error checking email availability: %w", err)
-	}
-
-	verifyToken, err := utils.GenerateOTP()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate verification token: %w", err)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, internalError(ctx, "error checking email availability", err)
 	}
 
 	user.Email = newemail
 	user.Verified = false
-	user.VerifyToken = verifyToken
 
-	if err := config.DB.Save(&user).Error; err != nil {
-		return nil, fmt.Errorf("failed to update email: %w", err)
-	}
-
-	if err := utils.SendVerificationEmail(newemail, verifyToken); err != nil {
-		return nil, fmt.Errorf("failed to send verification email: %w", err)
+	err = r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Users.Save(ctx, user); err != nil {
+			return internalError(ctx, "failed to update email", err)
+		}
+		// Codes mailed to the old address must not confirm the new one.
+		if err := tx.OneTimeCodes.Delete(ctx, user.ID, models.CodeSignup); err != nil {
+			return internalError(ctx, "failed to update email", err)
+		}
+		if err := services.SendCode(ctx, r.Config, tx, user, models.CodeEmailChange); err != nil {
+			return codeError(ctx, "failed to send verification email", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	successMessage := "Email changed successfully. Please check your new email for verification."
@@ -294,42 +404,30 @@ func (r *mutationResolver) ChangeEmail(ctx context.Context, email string, passwo
 
 // CreateUserGroup is the resolver for the createUserGroup field.
 func (r *mutationResolver) CreateUserGroup(ctx context.Context, userID int32, groupName string) (*model.UserGroup, error) {
-	tx := config.DB.Begin()
-	if tx.Error != nil {
-		return nil, tx.Error
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
 	group := models.UserGroup{Name: groupName}
-	if err := tx.Create(&group).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to create group: %w", err)
-	}
-
-	member := models.UserGroupMember{
-		UserID:      uint(userID),
-		UserGroupID: group.ID,
-		IsAdmin:     true,
-	}
-	if err := tx.Create(&member).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to add creator to group: %w", err)
-	}
-
 	var members []models.UserGroupMember
-	if err := tx.Preload("User").Preload("UserGroup").
-		Where("user_group_id = ?", group.ID).
-		Find(&members).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to load group members: %w", err)
-	}
+	err := r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Groups.Create(ctx, &group); err != nil {
+			return internalError(ctx, "failed to create group", err)
+		}
+
+		member := models.UserGroupMember{
+			UserID:      uint(userID),
+			UserGroupID: group.ID,
+			IsAdmin:     true,
+		}
+		if err := tx.Groups.AddMember(ctx, &member); err != nil {
+			return internalError(ctx, "failed to add creator to group", err)
+		}
 
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		var err error
+		if members, err = tx.Groups.Members(ctx, group.ID); err != nil {
+			return internalError(ctx, "failed to load group members", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	users := make([]*model.UserGroupMember, len(members))
@@ -348,6 +446,7 @@ func (r *mutationResolver) CreateUserGroup(ctx context.Context, userID int32, gr
 				Name:      m.UserGroup.Name,
 				CreatedAt: m.UserGroup.CreatedAt,
 				Location:  m.UserGroup.Location,
+				Timezone:  utils.GroupTimezoneName(m.UserGroup),
 			},
 			IsAdmin:   m.IsAdmin,
 			CreatedAt: m.CreatedAt,
@@ -359,6 +458,7 @@ func (r *mutationResolver) CreateUserGroup(ctx context.Context, userID int32, gr
 		Name:      group.Name,
 		CreatedAt: group.CreatedAt,
 		Location:  group.Location,
+		Timezone:  utils.GroupTimezoneName(group),
 		Users:     users,
 		Devices:   []*model.Device{},
 	}, nil
@@ -374,50 +474,40 @@ func (r *mutationResolver) AddDeviceToUserGroup(ctx context.Context, deviceID st
 		return nil, errors.New("Device ID Tidak Valid")
 	}
 
-	tx := config.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil || tx.Error != nil {
-			tx.Rollback()
+	err := r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if _, err := tx.Groups.GetByID(ctx, uint(userGroupID)); err != nil {
+			return fmt.Errorf("user group not found: %w", err)
 		}
-	}()
-
-	var group models.UserGroup
-	if err := tx.Preload("Devices").First(&group, uint(userGroupID)).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("user group not found: %w", err)
-	}
-
-	var existingDevice models.Device
-	if err := tx.Where("id = ? AND user_group_id = ?", deviceID, uint(userGroupID)).First(&existingDevice).Error; err == nil {
-		tx.Rollback()
-		return nil, errors.New("device with this ID already exists in the group")
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		tx.Rollback()
-		return nil, fmt.Errorf("error checking existing device: %w", err)
-	}
 
-	device := models.Device{
-		ID:          deviceID,
-		Name:        deviceName,
-		Location:    location,
-		UserGroupID: uint(userGroupID),
-	}
-	if err := tx.Create(&device).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to add device to group: %w", err)
-	}
+		if _, err := tx.Devices.GetInGroup(ctx, uint(userGroupID), deviceID); err == nil {
+			return errors.New("device with this ID already exists in the group")
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return internalError(ctx, "error checking existing device", err)
+		}
 
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		device := models.Device{
+			ID:          deviceID,
+			Name:        deviceName,
+			Location:    location,
+			UserGroupID: uint(userGroupID),
+		}
+		if err := tx.Devices.Create(ctx, &device); err != nil {
+			return internalError(ctx, "failed to add device to group", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err := config.DB.Preload("Devices").First(&group, uint(userGroupID)).Error; err != nil {
-		return nil, fmt.Errorf("failed to reload user group: %w", err)
+	group, err := r.Repos.Groups.GetWithDevices(ctx, uint(userGroupID))
+	if err != nil {
+		return nil, internalError(ctx, "failed to reload user group", err)
 	}
 
-	var members []models.UserGroupMember
-	if err := config.DB.Preload("User").Where("user_group_id = ?", group.ID).Find(&members).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch group members: %w", err)
+	members, err := r.Repos.Groups.Members(ctx, group.ID)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch group members", err)
 	}
 
 	devices := make([]*model.Device, 0, len(group.Devices))
@@ -460,11 +550,12 @@ func (r *mutationResolver) AddDeviceToUserGroup(ctx context.Context, deviceID st
 		Devices:   devices,
 		Users:     graphqlMembers,
 		Location:  group.Location,
+		Timezone:  utils.GroupTimezoneName(*group),
 	}, nil
 }
 
 // OauthLogin is the resolver for the oauthLogin field.
-func (r *mutationResolver) OauthLogin(ctx context.Context, provider model.OAuthProvider, token string) (*model.AuthPayload, error) {
+func (r *mutationResolver) OauthLogin(ctx context.Context, provider model.OAuthProvider, token string, deviceName *string) (*model.AuthPayload, error) {
 	if token == "" {
 		return nil, errors.New("token is required")
 	}
@@ -480,7 +571,7 @@ func (r *mutationResolver) OauthLogin(ctx context.Context, provider model.OAuthP
 
 	switch provider {
 	case model.OAuthProviderGoogle:
-		clientID := config.GetEnv("GOOGLE_CLIENT_ID", "")
+		clientID := r.Config.Auth.GoogleClientID
 		if clientID == "" {
 			return nil, errors.New("Google client ID not configured")
 		}
@@ -502,7 +593,7 @@ func (r *mutationResolver) OauthLogin(ctx context.Context, provider model.OAuthP
 		displayName = nameClaim
 
 	case model.OAuthProviderApple:
-		claims, err := utils.ValidateAppleToken(token)
+		claims, err := utils.ValidateAppleToken(r.Config.Auth, token)
 		if err != nil {
 			return nil, fmt.Errorf("invalid Apple token: %w", err)
 		}
@@ -520,13 +611,13 @@ func (r *mutationResolver) OauthLogin(ctx context.Context, provider model.OAuthP
 		return nil, errors.New("unsupported OAuth provider")
 	}
 
-	err := config.DB.Where("provider = ? AND provider_id = ?", providerStr, providerID).First(&user).Error
+	existing, err := r.Repos.Users.GetByProvider(ctx, providerStr, providerID)
 
-	if errors.Is(err, gorm.ErrRecordNotFound) && email != "" {
-		err = config.DB.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, repository.ErrNotFound) && email != "" {
+		existing, err = r.Repos.Users.GetByEmail(ctx, email)
 	}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	if errors.Is(err, repository.ErrNotFound) {
 		user = models.User{
 			Email:       email,
 			DisplayName: displayName,
@@ -536,15 +627,15 @@ func (r *mutationResolver) OauthLogin(ctx context.Context, provider model.OAuthP
 			CreatedAt:   time.Now(),
 		}
 
-		if err := config.DB.Create(&user).Error; err != nil {
-			return nil, fmt.Errorf("failed to create user: %w", err)
+		if err := r.Repos.Users.Create(ctx, &user); err != nil {
+			return nil, internalError(ctx, "failed to create user", err)
 		}
 	} else if err != nil {
-		return nil, fmt.Errorf("failed to fetch user: %w", err)
+		return nil, internalError(ctx, "failed to fetch user", err)
 	} else {
+		user = *existing
 		if user.Email != email && email != "" {
-			var existingUser models.User
-			if err := config.DB.Where("email = ?", email).First(&existingUser).Error; err == nil && existingUser.ID != user.ID {
+			if existingUser, err := r.Repos.Users.GetByEmail(ctx, email); err == nil && existingUser.ID != user.ID {
 				return nil, errors.New("email already registered to another user")
 			}
 			user.Email = email
@@ -558,26 +649,24 @@ func (r *mutationResolver) OauthLogin(ctx context.Context, provider model.OAuthP
 		user.ProviderID = providerID
 		user.Verified = true
 
-		if err := config.DB.Save(&user).Error; err != nil {
-			return nil, fmt.Errorf("failed to update user: %w", err)
+		if err := r.Repos.Users.Save(ctx, &user); err != nil {
+			return nil, internalError(ctx, "failed to update user", err)
 		}
 	}
 
-	jwtToken, refreshToken, err := utils.GenerateToken(user.ID)
+	tokens, err := services.StartSession(ctx, r.Config, r.Repos.Sessions, user.ID, utils.StringValue(deviceName))
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate JWT: %w", err)
+		return nil, internalError(ctx, "failed to start session", err)
 	}
 
-	user.RefreshToken = refreshToken
-	if err := config.DB.Save(&user).Error; err != nil {
-		return nil, fmt.Errorf("failed to update refresh token: %w", err)
+	userMemberships, err := r.Repos.Groups.MembershipsOfUser(ctx, user.ID)
+	if err != nil {
+		return nil, internalError(ctx, "failed to load memberships", err)
 	}
-
-	groupIDs := utils.FetchUserGroupIDs(user.ID)
-	memberships := make([]*model.UserGroupMember, 0, len(groupIDs))
-	for _, id := range groupIDs {
+	memberships := make([]*model.UserGroupMember, 0, len(userMemberships))
+	for _, m := range userMemberships {
 		memberships = append(memberships, &model.UserGroupMember{
-			Group: &model.UserGroup{ID: strconv.Itoa(int(id))},
+			Group: &model.UserGroup{ID: strconv.Itoa(int(m.UserGroupID))},
 		})
 	}
 
@@ -591,94 +680,177 @@ func (r *mutationResolver) OauthLogin(ctx context.Context, provider model.OAuthP
 	}
 
 	return &model.AuthPayload{
-		User:  gqlUser,
-		Token: jwtToken,
+		User:         gqlUser,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
 // Logout is the resolver for the logout field.
-func (r *mutationResolver) Logout(ctx context.Context, email string) (*string, error) {
-	var user models.User
-	if err := config.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, err
+func (r *mutationResolver) Logout(ctx context.Context) (*string, error) {
+	session, err := services.Authenticate(ctx, r.Repos.Sessions)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to log out", err)
 	}
 
-	user.RefreshToken = ""
-	if err := config.DB.Save(&user).Error; err != nil {
-		return nil, err
+	if _, err := r.Repos.Sessions.Revoke(ctx, session.UserID, session.ID, models.RevokedLogout, time.Now().UTC()); err != nil {
+		return nil, internalError(ctx, "failed to log out", err)
 	}
 
 	successMessage := "Logged out successfully"
 	return &successMessage, nil
 }
 
-// AddLocation is the resolver for the addLocation field.
-func (r *mutationResolver) AddLocation(ctx context.Context, groupId int32, locationName string) (*string, error) {
-	var group models.UserGroup
+// RevokeSession is the resolver for the revokeSession field.
+func (r *mutationResolver) RevokeSession(ctx context.Context, id string) (*string, error) {
+	session, err := services.Authenticate(ctx, r.Repos.Sessions)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to revoke session", err)
+	}
 
-	tx := config.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+	sessionID, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return nil, errors.New("session not found")
+	}
+	revoked, err := r.Repos.Sessions.Revoke(ctx, session.UserID, uint(sessionID), models.RevokedByUser, time.Now().UTC())
+	if err != nil {
+		return nil, internalError(ctx, "failed to revoke session", err)
+	}
+	if !revoked {
+		return nil, errors.New("session not found")
+	}
+
+	successMessage := "Session revoked successfully"
+	return &successMessage, nil
+}
 
-	if err := tx.Set("gorm:query_option", "FOR UPDATE").
-		Where("id = ?", groupId).
-		First(&group).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("group not found: %w", err)
+// LogoutEverywhere is the resolver for the logoutEverywhere field.
+func (r *mutationResolver) LogoutEverywhere(ctx context.Context) (*string, error) {
+	session, err := services.Authenticate(ctx, r.Repos.Sessions)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to log out", err)
 	}
 
-	updatedLocations := append(group.Location, locationName)
+	count, err := r.Repos.Sessions.RevokeAll(ctx, session.UserID, models.RevokedEverywhere, time.Now().UTC())
+	if err != nil {
+		return nil, internalError(ctx, "failed to log out", err)
+	}
 
-	if err := tx.Model(&group).
-		Update("location", updatedLocations).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to update locations: %w", err)
+	successMessage := fmt.Sprintf("Logged out of %d sessions", count)
+	return &successMessage, nil
+}
+
+// SetupTotp is the resolver for the setupTotp field.
+func (r *mutationResolver) SetupTotp(ctx context.Context) (*model.TotpSetup, error) {
+	user, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to set up authenticator", err)
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("transaction failed: %w", err)
+	setup, err := services.SetupTOTP(ctx, r.Config, r.Repos.Users, user)
+	if err != nil {
+		return nil, codeError(ctx, "failed to set up authenticator", err)
 	}
+	return &model.TotpSetup{Secret: setup.Secret, URI: setup.URI}, nil
+}
 
-	successMessage := "Location added successfully"
+// EnableTotp is the resolver for the enableTotp field.
+func (r *mutationResolver) EnableTotp(ctx context.Context, code string) ([]string, error) {
+	user, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to enable authenticator", err)
+	}
+
+	recoveryCodes, err := services.EnableTOTP(ctx, r.Config, r.Repos, user, code)
+	if err != nil {
+		return nil, codeError(ctx, "failed to enable authenticator", err)
+	}
+	return recoveryCodes, nil
+}
+
+// DisableTotp is the resolver for the disableTotp field.
+func (r *mutationResolver) DisableTotp(ctx context.Context, code string) (*string, error) {
+	user, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to disable authenticator", err)
+	}
+
+	if err := services.DisableTOTP(ctx, r.Config, r.Repos, user, code); err != nil {
+		return nil, codeError(ctx, "failed to disable authenticator", err)
+	}
+
+	successMessage := "Authenticator app disabled, login codes will be emailed again"
 	return &successMessage, nil
 }
 
-// RemoveDevice is the resolver for the removeDevice field.
-func (r *mutationResolver) RemoveDevice(ctx context.Context, groupID int32, deviceID string) (*string, error) {
-	tx := config.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+// RegenerateRecoveryCodes is the resolver for the regenerateRecoveryCodes field.
+func (r *mutationResolver) RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error) {
+	user, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to regenerate recovery codes", err)
+	}
 
-	var group models.UserGroup
-	if err := tx.First(&group, groupID).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("user group not found")
+	recoveryCodes, err := services.RegenerateRecoveryCodes(ctx, r.Config, r.Repos, user, code)
+	if err != nil {
+		return nil, codeError(ctx, "failed to regenerate recovery codes", err)
 	}
+	return recoveryCodes, nil
+}
 
-	var device models.Device
-	if err := tx.Where("id = ? AND user_group_id = ?", deviceID, groupID).First(&device).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("device not found in specified group")
+// ForgetTrustedDevice is the resolver for the forgetTrustedDevice field.
+func (r *mutationResolver) ForgetTrustedDevice(ctx context.Context, id string) (*string, error) {
+	session, err := services.Authenticate(ctx, r.Repos.Sessions)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to forget device", err)
 	}
 
-	if err := tx.Where("device_id = ?", deviceID).Delete(&models.WaterUsage{}).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to delete device usage history: %w", err)
+	deviceID, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return nil, errors.New("trusted device not found")
 	}
+	deleted, err := r.Repos.TwoFactor.DeleteTrustedDevice(ctx, session.UserID, uint(deviceID))
+	if err != nil {
+		return nil, internalError(ctx, "failed to forget device", err)
+	}
+	if !deleted {
+		return nil, errors.New("trusted device not found")
+	}
+
+	successMessage := "Device forgotten successfully"
+	return &successMessage, nil
+}
 
-	if err := tx.Delete(&device).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to delete device: %w", err)
+// AddLocation is the resolver for the addLocation field.
+func (r *mutationResolver) AddLocation(ctx context.Context, groupId int32, locationName string) (*string, error) {
+	if err := r.Repos.Groups.AddLocation(ctx, uint(groupId), locationName); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("group not found: %w", err)
+		}
+		return nil, internalError(ctx, "failed to update locations", err)
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("transaction failed: %w", err)
+	successMessage := "Location added successfully"
+	return &successMessage, nil
+}
+
+// RemoveDevice is the resolver for the removeDevice field.
+func (r *mutationResolver) RemoveDevice(ctx context.Context, groupID int32, deviceID string) (*string, error) {
+	err := r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if _, err := tx.Groups.GetByID(ctx, uint(groupID)); err != nil {
+			return fmt.Errorf("user group not found")
+		}
+
+		if _, err := tx.Devices.GetInGroup(ctx, uint(groupID), deviceID); err != nil {
+			return fmt.Errorf("device not found in specified group")
+		}
+
+		if err := tx.Devices.Delete(ctx, deviceID); err != nil {
+			return internalError(ctx, "failed to delete device", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	successMessage := "Device removed successfully"
@@ -687,72 +859,266 @@ func (r *mutationResolver) RemoveDevice(ctx context.Context, groupID int32, devi
 
 // CheckUsageNotifications is the resolver for the checkUsageNotifications field.
 func (r *mutationResolver) CheckUsageNotifications(ctx context.Context) (bool, error) {
-	go services.CheckUsageNotifications()
+	if _, err := r.requireAdmin(ctx); err != nil {
+		return false, err
+	}
+
+	_, err := r.Scheduler.Trigger(ctx, "usage_notifications")
+	if err != nil && !errors.Is(err, scheduler.ErrJobBusy) {
+		return false, internalError(ctx, "failed to start usage notifications", err)
+	}
 	return true, nil
 }
 
 // EditMember is the resolver for the editMember field.
 func (r *mutationResolver) EditMember(ctx context.Context, groupID int32, changedUserID int32, action string) (*string, error) {
-	var group models.UserGroup
+	err := r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if _, err := tx.Groups.GetByID(ctx, uint(groupID)); err != nil {
+			return fmt.Errorf("group not found: %w", err)
+		}
 
-	tx := config.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+		membership, err := tx.Groups.GetMember(ctx, uint(groupID), uint(changedUserID))
+		if err != nil {
+			return fmt.Errorf("user not found in specified group")
 		}
-	}()
 
-	if err := tx.Set("gorm:query_option", "FOR UPDATE").
-		Where("id = ?", groupID).
-		First(&group).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("group not found: %w", err)
+		switch action {
+		case "REMOVE":
+			if err := tx.Groups.RemoveMember(ctx, membership); err != nil {
+				return internalError(ctx, "failed to remove user from group", err)
+			}
+		case "ADMIN_PERMS":
+			membership.IsAdmin = true
+			if err := tx.Groups.SaveMember(ctx, membership); err != nil {
+				return internalError(ctx, "failed to update user permission", err)
+			}
+		case "MEMBER_PERMS":
+			membership.IsAdmin = false
+			if err := tx.Groups.SaveMember(ctx, membership); err != nil {
+				return internalError(ctx, "failed to update user permission", err)
+			}
+		default:
+			return fmt.Errorf("invalid action: %s", action)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	var membership models.UserGroupMember
-	if err := tx.Debug().Where("user_id = ? AND user_group_id = ?", changedUserID, groupID).First(&membership).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("user not found in specified group")
+	successMessage := "User updated successfully"
+	return &successMessage, nil
+}
+
+// SetGroupTimezone is the resolver for the setGroupTimezone field.
+func (r *mutationResolver) SetGroupTimezone(ctx context.Context, groupID int32, timezone string) (*string, error) {
+	// Each change rebuilds the rollups of every device in the group.
+	if _, err := r.requireGroupAdmin(ctx, uint(groupID)); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateTimezone(timezone); err != nil {
+		return nil, err
+	}
+
+	group, err := r.Repos.Groups.GetByID(ctx, uint(groupID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errors.New("group not found")
+	}
+	if err != nil {
+		return nil, internalError(ctx, "failed to update timezone", err)
 	}
 
-	switch action {
-	case "REMOVE":
-		if err := tx.Delete(&membership).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to remove user from group: %w", err)
+	changed := group.Timezone != timezone
+	group.Timezone = timezone
+	err = r.Repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Groups.Save(ctx, group); err != nil {
+			return err
 		}
-	case "ADMIN_PERMS":
-		membership.IsAdmin = true
-		if err := tx.Save(&membership).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to update user permission: %w", err)
+		if !changed {
+			return nil
 		}
-	case "MEMBER_PERMS":
-		membership.IsAdmin = false
-		if err := tx.Save(&membership).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to update user permission: %w", err)
+		// Daily rollups follow the group's days, which have just moved.
+		return services.EnqueueRebuildRollups(ctx, tx.Queue, group.ID)
+	})
+	if err != nil {
+		return nil, internalError(ctx, "failed to update timezone", err)
+	}
+
+	successMessage := "Group timezone updated successfully"
+	return &successMessage, nil
+}
+
+// SetUserTimezone is the resolver for the setUserTimezone field.
+func (r *mutationResolver) SetUserTimezone(ctx context.Context, userID int32, timezone *string) (*string, error) {
+	value := ""
+	if timezone != nil && *timezone != "" {
+		if err := utils.ValidateTimezone(*timezone); err != nil {
+			return nil, err
 		}
-	default:
-		tx.Rollback()
-		return nil, fmt.Errorf("invalid action: %s", action)
+		value = *timezone
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("transaction failed: %w", err)
+	user, err := r.Repos.Users.GetByID(ctx, uint(userID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errors.New("user not found")
+	}
+	if err != nil {
+		return nil, internalError(ctx, "failed to update timezone", err)
 	}
 
-	successMessage := "User updated successfully"
+	user.Timezone = value
+	if err := r.Repos.Users.Save(ctx, user); err != nil {
+		return nil, internalError(ctx, "failed to update timezone", err)
+	}
+
+	successMessage := "User timezone updated successfully"
 	return &successMessage, nil
 }
 
+// SetUserLanguage is the resolver for the setUserLanguage field.
+func (r *mutationResolver) SetUserLanguage(ctx context.Context, userID int32, language *string) (*string, error) {
+	value := ""
+	if language != nil {
+		if err := utils.ValidateLanguage(*language); err != nil {
+			return nil, err
+		}
+		value = *language
+	}
+
+	user, err := r.Repos.Users.GetByID(ctx, uint(userID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, errors.New("user not found")
+	}
+	if err != nil {
+		return nil, internalError(ctx, "failed to update language", err)
+	}
+
+	user.Language = value
+	if err := r.Repos.Users.Save(ctx, user); err != nil {
+		return nil, internalError(ctx, "failed to update language", err)
+	}
+
+	successMessage := "User language updated successfully"
+	return &successMessage, nil
+}
+
+// SetRetentionPolicy is the resolver for the setRetentionPolicy field.
+func (r *mutationResolver) SetRetentionPolicy(ctx context.Context, groupID int32, rawDays *int32, minuteDays *int32, maxAgeDays *int32) (*model.RetentionPolicy, error) {
+	if _, err := r.requireGroupAdmin(ctx, uint(groupID)); err != nil {
+		return nil, err
+	}
+
+	group, err := r.Repos.Groups.GetByID(ctx, uint(groupID))
+	if err != nil {
+		return nil, errors.New("group not found")
+	}
+
+	policy, err := r.Repos.Groups.GetRetentionPolicy(ctx, group.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		policy = &models.RetentionPolicy{UserGroupID: group.ID}
+	} else if err != nil {
+		return nil, internalError(ctx, "failed to fetch retention policy", err)
+	}
+	// Omitted arguments keep their override; an explicit null clears it.
+	if argumentGiven(ctx, "rawDays") {
+		policy.RawDays = utils.IntPtr(rawDays)
+	}
+	if argumentGiven(ctx, "minuteDays") {
+		policy.MinuteDays = utils.IntPtr(minuteDays)
+	}
+	if argumentGiven(ctx, "maxAgeDays") {
+		policy.MaxAgeDays = utils.IntPtr(maxAgeDays)
+	}
+	settings := r.Retention.Defaults().Merge(policy)
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := r.Repos.Groups.SaveRetentionPolicy(ctx, policy); err != nil {
+		return nil, internalError(ctx, "failed to save retention policy", err)
+	}
+
+	return utils.ConvertToGQLRetentionPolicy(group.ID, settings.RawDays, settings.MinuteDays, settings.MaxAgeDays), nil
+}
+
+// TriggerJob is the resolver for the triggerJob field.
+func (r *mutationResolver) TriggerJob(ctx context.Context, name string) (*model.JobRun, error) {
+	if _, err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	run, err := r.Scheduler.Trigger(ctx, name)
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		return nil, fmt.Errorf("unknown job %q", name)
+	case errors.Is(err, scheduler.ErrJobBusy), errors.Is(err, scheduler.ErrStopped):
+		return nil, err
+	case err != nil:
+		return nil, internalError(ctx, "failed to start job", err)
+	}
+
+	return utils.ConvertToGQLJobRun(*run), nil
+}
+
+// RequestUsageAnalysis is the resolver for the requestUsageAnalysis field.
+func (r *mutationResolver) RequestUsageAnalysis(ctx context.Context, userID *int32, groupID *int32, language *string) (*model.UsageAnalysis, error) {
+	var task services.UsageAnalysisTask
+	if userID != nil {
+		task.UserID = uint(*userID)
+	}
+	if groupID != nil {
+		task.GroupID = uint(*groupID)
+	}
+	if (task.UserID == 0) == (task.GroupID == 0) {
+		return nil, errors.New("set exactly one of userID and groupID")
+	}
+	if err := r.authorizeUsage(ctx, task.UserID, task.GroupID); err != nil {
+		return nil, err
+	}
+	if language != nil {
+		if err := utils.ValidateLanguage(*language); err != nil {
+			return nil, err
+		}
+		task.Language = *language
+	}
+
+	job, err := services.EnqueueUsageAnalysis(ctx, r.Repos.Queue, task)
+	if err != nil {
+		return nil, internalError(ctx, "failed to queue usage analysis", err)
+	}
+
+	return utils.ConvertToGQLUsageAnalysis(*job), nil
+}
+
+// RetryQueueJob is the resolver for the retryQueueJob field.
+func (r *mutationResolver) RetryQueueJob(ctx context.Context, id string) (*model.QueueJob, error) {
+	if _, err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	jobID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid job id")
+	}
+
+	job, err := queue.Retry(ctx, r.Repos.Queue, uint(jobID))
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return nil, errors.New("queue job not found")
+	case errors.Is(err, queue.ErrNotDead):
+		return nil, err
+	case err != nil:
+		return nil, internalError(ctx, "failed to retry queue job", err)
+	}
+
+	return utils.ConvertToGQLQueueJob(*job), nil
+}
+
 // Users is the resolver for the users field.
 func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
-	var dbUsers []models.User
-	if err := config.DB.WithContext(ctx).
-		Preload("Memberships.UserGroup").
-		Find(&dbUsers).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	dbUsers, err := r.Repos.Users.ListWithMemberships(ctx)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch users", err)
 	}
 
 	result := make([]*model.User, len(dbUsers))
@@ -765,6 +1131,7 @@ func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
 					Name:      m.UserGroup.Name,
 					CreatedAt: m.UserGroup.CreatedAt,
 					Location:  m.UserGroup.Location,
+					Timezone:  utils.GroupTimezoneName(m.UserGroup),
 				},
 				User:      &model.User{ID: fmt.Sprintf("%d", u.ID)},
 				IsAdmin:   m.IsAdmin,
@@ -791,16 +1158,9 @@ func (r *queryResolver) Users(ctx context.Context) ([]*model.User, error) {
 
 // UserGroups is the resolver for the userGroups field.
 func (r *queryResolver) UserGroups(ctx context.Context) ([]*model.UserGroup, error) {
-	var dbGroups []models.UserGroup
-
-	// Optimized preloading with all necessary relationships
-	err := config.DB.
-		Preload("Members.User").
-		Preload("Devices.WaterUsages"). // Load devices with their water usages
-		Find(&dbGroups).Error
-
+	dbGroups, err := r.Repos.Groups.ListWithMembersAndUsage(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch groups: %w", err)
+		return nil, internalError(ctx, "failed to fetch groups", err)
 	}
 
 	result := make([]*model.UserGroup, len(dbGroups))
@@ -822,6 +1182,7 @@ func (r *queryResolver) UserGroups(ctx context.Context) ([]*model.UserGroup, err
 					Name:      g.UserGroup.Name,
 					CreatedAt: g.UserGroup.CreatedAt,
 					Location:  g.UserGroup.Location,
+					Timezone:  utils.GroupTimezoneName(g.UserGroup),
 				},
 				IsAdmin:   g.IsAdmin,
 				CreatedAt: g.CreatedAt,
@@ -854,6 +1215,7 @@ func (r *queryResolver) UserGroups(ctx context.Context) ([]*model.UserGroup, err
 			Name:      dbGroup.Name,
 			CreatedAt: dbGroup.CreatedAt,
 			Location:  dbGroup.Location,
+			Timezone:  utils.GroupTimezoneName(dbGroup),
 			Users:     members,
 			Devices:   devices,
 		}
@@ -864,9 +1226,9 @@ func (r *queryResolver) UserGroups(ctx context.Context) ([]*model.UserGroup, err
 
 // Devices is the resolver for the devices field.
 func (r *queryResolver) Devices(ctx context.Context) ([]*model.Device, error) {
-	var devices []models.Device
-	if err := config.DB.Preload("WaterUsages").Find(&devices).Error; err != nil {
-		return nil, err
+	devices, err := r.Repos.Devices.ListWithUsage(ctx)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch devices", err)
 	}
 
 	var result []*model.Device
@@ -880,11 +1242,7 @@ func (r *queryResolver) Devices(ctx context.Context) ([]*model.Device, error) {
 			})
 		}
 
-		var group models.UserGroup
-		if err := config.DB.First(&group, d.UserGroupID).Error; err != nil {
-			return nil, fmt.Errorf("failed to fetch user group for device %s: %w", d.ID, err)
-		}
-
+		group := d.UserGroup
 		result = append(result, &model.Device{
 			ID:          d.ID,
 			Name:        d.Name,
@@ -905,22 +1263,21 @@ func (r *queryResolver) Devices(ctx context.Context) ([]*model.Device, error) {
 
 // DeviceUsage is the resolver for the deviceUsage field.
 func (r *queryResolver) DeviceUsage(ctx context.Context, groupID int32) ([]*model.DeviceUsageData, error) {
-	var devices []models.Device
-	if err := config.DB.Preload("WaterUsages").Where("user_group_id = ?", groupID).Find(&devices).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch devices: %w", err)
+	devices, err := r.Repos.Devices.ListByGroup(ctx, uint(groupID))
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch devices", err)
+	}
+
+	totals, err := r.Repos.Usage.GroupDeviceTotals(ctx, uint(groupID))
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch device usage", err)
 	}
 
 	deviceMap := make(map[string]*model.DeviceUsageData, len(devices))
 	groupTotal := float64(0)
 
 	for _, device := range devices {
-		deviceTotal := float64(0)
-
-		if device.WaterUsages != nil {
-			for _, usage := range device.WaterUsages {
-				deviceTotal += usage.TotalUsage
-			}
-		}
+		deviceTotal := totals[device.ID]
 
 		deviceMap[device.ID] = &model.DeviceUsageData{
 			ID:       device.ID,
@@ -946,18 +1303,14 @@ func (r *queryResolver) DeviceUsage(ctx context.Context, groupID int32) ([]*mode
 
 // WaterUsages is the resolver for the waterUsages field.
 func (r *queryResolver) WaterUsages(ctx context.Context) ([]*model.WaterUsage, error) {
-	var usages []models.WaterUsage
-	if err := config.DB.Preload("Device").Find(&usages).Error; err != nil {
-		return nil, err
+	usages, err := r.Repos.Usage.List(ctx)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch water usages", err)
 	}
 
 	var result []*model.WaterUsage
 	for _, u := range usages {
-		var group models.UserGroup
-		if err := config.DB.First(&group, u.Device.UserGroupID).Error; err != nil {
-			return nil, fmt.Errorf("failed to fetch user group for device %s: %w", u.Device.ID, err)
-		}
-
+		group := u.Device.UserGroup
 		result = append(result, &model.WaterUsage{
 			FlowRate:   u.FlowRate,
 			TotalUsage: u.TotalUsage,
@@ -983,25 +1336,33 @@ func (r *queryResolver) WaterUsages(ctx context.Context) ([]*model.WaterUsage, e
 
 // WaterUsagesData is the resolver for the waterUsagesData field.
 func (r *queryResolver) WaterUsagesData(ctx context.Context, deviceID string, timeFilter string) (model.WaterData, error) {
-	start, end, err := utils.GetTimeRange(timeFilter, time.Now())
+	device, err := r.Repos.Devices.GetByID(ctx, deviceID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid time range: %w", err)
+		return nil, errors.New("device not found")
 	}
 
-	var dbResults []models.WaterUsage
-	err = config.DB.
-		Preload("Device.UserGroup").
-		Where("device_id = ? AND recorded_at BETWEEN ? AND ?", deviceID, start, end).
-		Order("recorded_at").
-		Find(&dbResults).Error
-
+	loc := utils.ResolveLocation(nil, &device.UserGroup)
+	start, end, err := utils.GetTimeRange(timeFilter, time.Now(), loc)
 	if err != nil {
-		return nil, fmt.Errorf("database error: %w", err)
+		return nil, fmt.Errorf("invalid time range: %w", err)
 	}
 
-	gqlData := make([]*model.WaterUsage, len(dbResults))
-	for i, wu := range dbResults {
-		gqlData[i] = utils.ConvertToGQLWaterUsage(wu)
+	hourly, err := r.Repos.Usage.Hourly(ctx, deviceID, start, end)
+	if err != nil {
+		return nil, internalError(ctx, "database error", err)
+	}
+
+	// Each hourly rollup is presented as one reading with the hour's average
+	// flow and total volume.
+	gqlData := make([]*model.WaterUsage, len(hourly))
+	for i, h := range hourly {
+		gqlData[i] = utils.ConvertToGQLWaterUsage(models.WaterUsage{
+			DeviceID:   h.DeviceID,
+			Device:     *device,
+			FlowRate:   h.AvgFlow(),
+			TotalUsage: h.TotalUsage,
+			RecordedAt: h.Hour.In(loc),
+		})
 	}
 
 	switch timeFilter {
@@ -1019,102 +1380,239 @@ func (r *queryResolver) WaterUsagesData(ctx context.Context, deviceID string, ti
 	}
 }
 
-// DeepSeekAnalysis is the resolver for the deepSeekAnalysis field.
-func (r *queryResolver) DeepSeekAnalysis(ctx context.Context, userID int32) (*model.DeepSeekResponse, error) {
-	water, err := utils.GetUserUsageData(uint(userID))
+// UsageSeries is the resolver for the usageSeries field.
+func (r *queryResolver) UsageSeries(ctx context.Context, deviceIds []string, groupID *int32, from time.Time, to time.Time, bucket model.UsageBucket, tz *string) (*model.UsageSeries, error) {
+	if (len(deviceIds) == 0) == (groupID == nil) {
+		return nil, errors.New("exactly one of deviceIds or groupId is required")
+	}
+
+	if groupID != nil {
+		devices, err := r.Repos.Devices.ListByGroup(ctx, uint(*groupID))
+		if err != nil {
+			return nil, internalError(ctx, "failed to fetch devices", err)
+		}
+		deviceIds = utils.DeviceIDs(devices)
+	}
+
+	var loc *time.Location
+	switch {
+	case tz != nil && *tz != "":
+		if err := utils.ValidateTimezone(*tz); err != nil {
+			return nil, err
+		}
+		loc, _ = time.LoadLocation(*tz)
+	case groupID != nil:
+		loc = utils.GroupLocation(ctx, r.Repos.Groups, uint(*groupID))
+	default:
+		loc = utils.DeviceLocation(ctx, r.Repos.Devices, deviceIds[0])
+	}
+
+	points, err := utils.GetUsageSeries(ctx, r.Repos.Usage, deviceIds, from, to, bucket, loc)
 	if err != nil {
 		return nil, err
 	}
 
-	usage := map[string]interface{}{
-		"waterUsage": water,
+	return &model.UsageSeries{
+		Bucket:   bucket,
+		Timezone: loc.String(),
+		From:     from,
+		To:       to,
+		Points:   points,
+	}, nil
+}
+
+// CompareUsage is the resolver for the compareUsage field.
+func (r *queryResolver) CompareUsage(ctx context.Context, scope model.UsageScope, deviceID *string, groupID *int32, location *string, period model.ComparisonPeriod, offset *int32) (*model.UsageComparison, error) {
+	var devices []models.Device
+	var err error
+	switch scope {
+	case model.UsageScopeDevice:
+		if deviceID == nil || *deviceID == "" {
+			return nil, errors.New("deviceId is required for DEVICE scope")
+		}
+		device, err := r.Repos.Devices.GetByID(ctx, *deviceID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("device not found")
+		}
+		if err != nil {
+			return nil, internalError(ctx, "failed to fetch devices", err)
+		}
+		devices = []models.Device{*device}
+	case model.UsageScopeGroup:
+		if groupID == nil {
+			return nil, errors.New("groupId is required for GROUP scope")
+		}
+		devices, err = r.Repos.Devices.ListByGroup(ctx, uint(*groupID))
+	case model.UsageScopeLocation:
+		if groupID == nil || location == nil || *location == "" {
+			return nil, errors.New("groupId and location are required for LOCATION scope")
+		}
+		devices, err = r.Repos.Devices.ListByLocation(ctx, uint(*groupID), *location)
+	default:
+		return nil, fmt.Errorf("unsupported scope: %s", scope)
 	}
-	jsonData, err := json.Marshal(usage)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch devices", err)
+	}
+
+	var loc *time.Location
+	if len(devices) > 0 {
+		loc = utils.ResolveLocation(nil, &devices[0].UserGroup)
+	} else {
+		loc = utils.GroupLocation(ctx, r.Repos.Groups, uint(*groupID))
+	}
+
+	periodsBack := 0
+	if offset != nil {
+		periodsBack = int(*offset)
+	}
+	current, previous, lastYear, err := utils.ComparisonWindows(period, time.Now(), periodsBack, loc)
 	if err != nil {
 		return nil, err
 	}
 
-	analysis, err := utils.AnalyzeUsageData(string(jsonData))
+	totals, err := utils.SumUsageByDevice(ctx, r.Repos.Usage, utils.DeviceIDs(devices), current, previous, lastYear)
 	if err != nil {
+		return nil, internalError(ctx, "failed to sum usage", err)
+	}
+
+	var currentTotal, previousTotal, lastYearTotal float64
+	deltas := make([]*model.DeviceUsageDelta, 0, len(devices))
+	for _, d := range devices {
+		t := totals[d.ID]
+		currentTotal += t.CurrentUsage
+		previousTotal += t.PreviousUsage
+		lastYearTotal += t.LastYearUsage
+
+		deltas = append(deltas, &model.DeviceUsageDelta{
+			Device:        utils.ConvertToGQLDevice(d),
+			CurrentUsage:  t.CurrentUsage,
+			PreviousUsage: t.PreviousUsage,
+			Change:        t.CurrentUsage - t.PreviousUsage,
+			ChangePercent: utils.PercentChange(t.CurrentUsage, t.PreviousUsage),
+		})
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return math.Abs(deltas[i].Change) > math.Abs(deltas[j].Change)
+	})
+
+	return &model.UsageComparison{
+		Scope:                     scope,
+		Period:                    period,
+		Timezone:                  loc.String(),
+		Current:                   &model.PeriodUsage{Start: current.Start, End: current.End, TotalUsage: currentTotal},
+		Previous:                  &model.PeriodUsage{Start: previous.Start, End: previous.End, TotalUsage: previousTotal},
+		LastYear:                  &model.PeriodUsage{Start: lastYear.Start, End: lastYear.End, TotalUsage: lastYearTotal},
+		Change:                    currentTotal - previousTotal,
+		ChangePercent:             utils.PercentChange(currentTotal, previousTotal),
+		YearOverYearChange:        currentTotal - lastYearTotal,
+		YearOverYearChangePercent: utils.PercentChange(currentTotal, lastYearTotal),
+		Devices:                   deltas,
+	}, nil
+}
+
+// DeepSeekAnalysis is the resolver for the deepSeekAnalysis field.
+func (r *queryResolver) DeepSeekAnalysis(ctx context.Context, userID int32) (*model.DeepSeekResponse, error) {
+	if err := r.authorizeUsage(ctx, uint(userID), 0); err != nil {
 		return nil, err
 	}
 
+	analysis, err := services.AnalyzeUsage(ctx, r.Config, r.Repos, r.AI, services.UsageAnalysisTask{UserID: uint(userID)})
+	if err != nil {
+		return nil, internalError(ctx, "failed to analyze usage", err)
+	}
+
 	return &model.DeepSeekResponse{Analysis: &analysis}, nil
 }
 
 func (r *queryResolver) GroupAiAnalysis(ctx context.Context, groupID int32) (*model.DeepSeekResponse, error) {
-	water, err := utils.GetGroupUsageData(uint(groupID))
-	if err != nil {
+	if err := r.authorizeUsage(ctx, 0, uint(groupID)); err != nil {
 		return nil, err
 	}
 
-	usage := map[string]interface{}{
-		"waterUsage": water,
+	analysis, err := services.AnalyzeUsage(ctx, r.Config, r.Repos, r.AI, services.UsageAnalysisTask{GroupID: uint(groupID)})
+	if err != nil {
+		return nil, internalError(ctx, "failed to analyze usage", err)
 	}
-	jsonData, err := json.Marshal(usage)
+
+	return &model.DeepSeekResponse{Analysis: &analysis}, nil
+}
+
+// UsageAnalysis is the resolver for the usageAnalysis field.
+func (r *queryResolver) UsageAnalysis(ctx context.Context, id string) (*model.UsageAnalysis, error) {
+	jobID, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("usage analysis not found")
 	}
 
-	analysis, err := utils.AnalyzeUsageData(string(jsonData))
+	job, err := r.Repos.Queue.GetByID(ctx, uint(jobID))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && job.Kind != services.TaskUsageAnalysis) {
+		return nil, errors.New("usage analysis not found")
+	}
 	if err != nil {
+		return nil, internalError(ctx, "failed to fetch usage analysis", err)
+	}
+	var task services.UsageAnalysisTask
+	if err := json.Unmarshal([]byte(job.Payload), &task); err != nil {
+		return nil, internalError(ctx, "failed to read usage analysis", err)
+	}
+	if err := r.authorizeUsage(ctx, task.UserID, task.GroupID); err != nil {
 		return nil, err
 	}
 
-	return &model.DeepSeekResponse{Analysis: &analysis}, nil
+	return utils.ConvertToGQLUsageAnalysis(*job), nil
 }
 
 // Notifications is the resolver for the notifications field.
 func (r *queryResolver) Notifications(ctx context.Context, userId int32) ([]*model.Notification, error) {
-
-	var userGroupIDs []uint
-	if err := config.DB.Model(&models.UserGroupMember{}).
-		Where("user_id = ?", uint(userId)).
-		Pluck("user_group_id", &userGroupIDs).Error; err != nil {
+	if err := r.authorizeUsage(ctx, uint(userId), 0); err != nil {
 		return nil, err
 	}
 
-	if len(userGroupIDs) == 0 {
+	memberships, err := r.Repos.Groups.MembershipsOfUser(ctx, uint(userId))
+	if err != nil {
+		return nil, internalError(ctx, "failed to load memberships", err)
+	}
+
+	if len(memberships) == 0 {
 		return []*model.Notification{}, nil
 	}
 
-	var devices []models.Device
-	if err := config.DB.
-		Preload("UserGroup").
-		Where("user_group_id IN ?", userGroupIDs).
-		Find(&devices).Error; err != nil {
-		return nil, err
+	userGroupIDs := make([]uint, len(memberships))
+	for i, m := range memberships {
+		userGroupIDs[i] = m.UserGroupID
+	}
+
+	devices, err := r.Repos.Devices.ListByGroups(ctx, userGroupIDs)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch devices", err)
+	}
+
+	user, err := r.Repos.Users.GetByID(ctx, uint(userId))
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch user", err)
 	}
 
 	now := time.Now()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-	yesterdayStart := todayStart.Add(-24 * time.Hour)
+	lang := r.Config.Language(user.Language)
 
 	var notifications []*model.Notification
 
 	for _, device := range devices {
-		var todayTotal float64
-		if err := config.DB.Model(&models.WaterUsage{}).
-			Select("COALESCE(SUM(total_usage), 0)").
-			Where("device_id = ? AND recorded_at >= ? AND recorded_at < ?",
-				device.ID,
-				todayStart,
-				todayStart.Add(24*time.Hour),
-			).
-			Scan(&todayTotal).Error; err != nil {
-			return nil, err
+		loc := utils.ResolveLocation(user, &device.UserGroup)
+		todayStart := utils.StartOfDay(now, loc)
+		yesterdayStart := todayStart.AddDate(0, 0, -1)
+
+		// The user's day may differ from the group's daily rollups, so the
+		// totals are summed from hourly rollups and readings instead.
+		todayTotal, err := r.Repos.Usage.SumUsage(ctx, device.ID, todayStart, todayStart.AddDate(0, 0, 1))
+		if err != nil {
+			return nil, internalError(ctx, "failed to sum usage", err)
 		}
 
-		var yesterdayTotal float64
-		if err := config.DB.Model(&models.WaterUsage{}).
-			Select("COALESCE(SUM(total_usage), 0)").
-			Where("device_id = ? AND recorded_at >= ? AND recorded_at < ?",
-				device.ID,
-				yesterdayStart,
-				todayStart,
-			).
-			Scan(&yesterdayTotal).Error; err != nil {
-			return nil, err
+		yesterdayTotal, err := r.Repos.Usage.SumUsage(ctx, device.ID, yesterdayStart, todayStart)
+		if err != nil {
+			return nil, internalError(ctx, "failed to sum usage", err)
 		}
 
 		if yesterdayTotal == 0 && todayTotal == 0 {
@@ -1143,21 +1641,11 @@ func (r *queryResolver) Notifications(ctx context.Context, userId int32) ([]*mod
 		}
 
 		if percentChange > 0 {
-			message = fmt.Sprintf(
-				"Penggunaan air meningkat sebesar %.2f%% (%.2fL → %.2fL) 👎. Coba periksa apakah ada keran yang lupa dimatikan atau penggunaan berlebih yang tidak biasa.",
-				percentChange,
-				yesterdayTotal,
-				todayTotal)
+			message = i18n.T(lang, "notification.usage.increased", percentChange, yesterdayTotal, todayTotal)
 		} else if percentChange < 0 {
-			message = fmt.Sprintf(
-				"Bagus! Penggunaan air menurun sebesar %.2f%% (%.2fL → %.2fL) 👍. Terus pertahankan kebiasaan hemat air!",
-				math.Abs(percentChange),
-				yesterdayTotal,
-				todayTotal)
+			message = i18n.T(lang, "notification.usage.decreased", math.Abs(percentChange), yesterdayTotal, todayTotal)
 		} else {
-			message = fmt.Sprintf(
-				"Penggunaan air tetap sama (%.2fL) seperti kemarin. Stabil, tapi bisa lebih hemat lagi jika memungkinkan.",
-				todayTotal)
+			message = i18n.T(lang, "notification.usage.unchanged", todayTotal)
 		}
 
 		notifications = append(notifications, &model.Notification{
@@ -1169,9 +1657,227 @@ func (r *queryResolver) Notifications(ctx context.Context, userId int32) ([]*mod
 		})
 	}
 
+	// Stored notifications follow the live comparison, rendered in the
+	// caller's language rather than the one of the job that wrote them.
+	deviceIDs := make([]string, len(devices))
+	byID := make(map[string]models.Device, len(devices))
+	for i, device := range devices {
+		deviceIDs[i] = device.ID
+		byID[device.ID] = device
+	}
+	stored, err := r.Repos.Notifications.Recent(ctx, deviceIDs, storedNotificationLimit)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch notifications", err)
+	}
+	for _, n := range stored {
+		device := byID[n.DeviceID]
+		notifications = append(notifications, &model.Notification{
+			ID:        fmt.Sprintf("notification-%d", n.ID),
+			Title:     fmt.Sprintf("%s | %s | %s", device.UserGroup.Name, device.Name, device.Location),
+			Message:   utils.NotificationMessage(n, lang),
+			CreatedAt: n.CreatedAt,
+			Device:    utils.ConvertToGQLDevice(device),
+		})
+	}
+
 	return notifications, nil
 }
 
+// RetentionPolicy is the resolver for the retentionPolicy field.
+func (r *queryResolver) RetentionPolicy(ctx context.Context, groupID int32) (*model.RetentionPolicy, error) {
+	if err := r.authorizeUsage(ctx, 0, uint(groupID)); err != nil {
+		return nil, err
+	}
+	settings, err := r.Retention.GroupRetentionSettings(ctx, uint(groupID))
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch retention policy", err)
+	}
+	return utils.ConvertToGQLRetentionPolicy(uint(groupID), settings.RawDays, settings.MinuteDays, settings.MaxAgeDays), nil
+}
+
+// RetentionReport is the resolver for the retentionReport field.
+func (r *queryResolver) RetentionReport(ctx context.Context, groupID *int32) (*model.RetentionReport, error) {
+	// A report across every group is for admins; one group's is also for
+	// that group's admins.
+	var group uint
+	if groupID != nil {
+		group = uint(*groupID)
+		if _, err := r.requireGroupAdmin(ctx, group); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	reports, err := r.Retention.ApplyRetention(ctx, now, group, true)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]*model.DeviceRetentionReport, len(reports))
+	for i, report := range reports {
+		devices[i] = &model.DeviceRetentionReport{
+			DeviceID: report.DeviceID,
+			GroupID:  int32(report.UserGroupID),
+			ToMinute: int32(report.ToMinute),
+			ToHour:   int32(report.ToHour),
+			Purged:   int32(report.Purged),
+		}
+	}
+
+	return &model.RetentionReport{
+		DryRun:      true,
+		GeneratedAt: now,
+		Devices:     devices,
+	}, nil
+}
+
+// Jobs is the resolver for the jobs field.
+func (r *queryResolver) Jobs(ctx context.Context) ([]*model.Job, error) {
+	if _, err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	latest, err := r.Repos.JobRuns.Latest(ctx)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch job runs", err)
+	}
+
+	infos := r.Scheduler.Jobs()
+	jobs := make([]*model.Job, len(infos))
+	for i, info := range infos {
+		jobs[i] = &model.Job{
+			Name:     info.Name,
+			Schedule: info.Schedule,
+			Timezone: info.Timezone,
+			NextRun:  info.NextRun,
+		}
+		if run, ok := latest[info.Name]; ok {
+			jobs[i].LastRun = utils.ConvertToGQLJobRun(run)
+		}
+	}
+	return jobs, nil
+}
+
+// JobRuns is the resolver for the jobRuns field.
+func (r *queryResolver) JobRuns(ctx context.Context, name *string, limit *int32) ([]*model.JobRun, error) {
+	if _, err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	n := 20
+	if limit != nil {
+		n = int(*limit)
+	}
+	if n < 1 || n > 200 {
+		return nil, errors.New("limit must be between 1 and 200")
+	}
+	var job string
+	if name != nil {
+		job = *name
+	}
+
+	runs, err := r.Repos.JobRuns.Recent(ctx, job, n)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch job runs", err)
+	}
+
+	result := make([]*model.JobRun, len(runs))
+	for i, run := range runs {
+		result[i] = utils.ConvertToGQLJobRun(run)
+	}
+	return result, nil
+}
+
+// QueueJobs is the resolver for the queueJobs field.
+func (r *queryResolver) QueueJobs(ctx context.Context, queue *string, status *string, limit *int32) ([]*model.QueueJob, error) {
+	if _, err := r.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	n := 50
+	if limit != nil {
+		n = int(*limit)
+	}
+	if n < 1 || n > 200 {
+		return nil, errors.New("limit must be between 1 and 200")
+	}
+	var queueName, statusName string
+	if queue != nil {
+		queueName = *queue
+	}
+	if status != nil {
+		statusName = *status
+	}
+
+	jobs, err := r.Repos.Queue.List(ctx, queueName, statusName, n)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch queue jobs", err)
+	}
+
+	result := make([]*model.QueueJob, len(jobs))
+	for i, job := range jobs {
+		result[i] = utils.ConvertToGQLQueueJob(job)
+	}
+	return result, nil
+}
+
+// Sessions is the resolver for the sessions field.
+func (r *queryResolver) Sessions(ctx context.Context) ([]*model.Session, error) {
+	current, err := services.Authenticate(ctx, r.Repos.Sessions)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to fetch sessions", err)
+	}
+
+	sessions, err := r.Repos.Sessions.ListActive(ctx, current.UserID, time.Now().UTC())
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch sessions", err)
+	}
+
+	result := make([]*model.Session, len(sessions))
+	for i, session := range sessions {
+		result[i] = utils.ConvertToGQLSession(session, current.ID)
+	}
+	return result, nil
+}
+
+// TwoFactor is the resolver for the twoFactor field.
+func (r *queryResolver) TwoFactor(ctx context.Context) (*model.TwoFactorStatus, error) {
+	user, err := r.currentUser(ctx)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to fetch two-factor status", err)
+	}
+
+	left, err := r.Repos.TwoFactor.CountRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch two-factor status", err)
+	}
+	return &model.TwoFactorStatus{
+		TotpEnabled:       user.TOTPEnabledAt != nil,
+		RecoveryCodesLeft: int32(left),
+	}, nil
+}
+
+// TrustedDevices is the resolver for the trustedDevices field.
+func (r *queryResolver) TrustedDevices(ctx context.Context) ([]*model.TrustedDevice, error) {
+	session, err := services.Authenticate(ctx, r.Repos.Sessions)
+	if err != nil {
+		return nil, sessionError(ctx, "failed to fetch trusted devices", err)
+	}
+
+	devices, err := r.Repos.TwoFactor.ListTrustedDevices(ctx, session.UserID, time.Now().UTC())
+	if err != nil {
+		return nil, internalError(ctx, "failed to fetch trusted devices", err)
+	}
+
+	result := make([]*model.TrustedDevice, len(devices))
+	for i, device := range devices {
+		result[i] = utils.ConvertToGQLTrustedDevice(device)
+	}
+	return result, nil
+}
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
@@ -0,0 +1,90 @@
+// Package health serves the liveness and readiness probes.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check returns nil when the dependency it probes is usable.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks. Once draining, it reports not ready so
+// load balancers stop routing new requests during shutdown.
+type Checker struct {
+	timeout  time.Duration
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	checks []namedCheck
+}
+
+// NewChecker returns a checker giving each check at most timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+func (hc *Checker) Add(name string, check Check) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.checks = append(hc.checks, namedCheck{name, check})
+}
+
+func (hc *Checker) SetDraining() {
+	hc.draining.Store(true)
+}
+
+// Live answers as long as the process can serve HTTP at all.
+func (hc *Checker) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready runs every check concurrently and answers 503 if any fails.
+// Failures are logged; the response only names the failing checks.
+func (hc *Checker) Ready(c *gin.Context) {
+	if hc.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	hc.mu.Lock()
+	checks := append([]namedCheck(nil), hc.checks...)
+	hc.mu.Unlock()
+
+	reqCtx, cancel := context.WithTimeout(c.Request.Context(), hc.timeout)
+	defer cancel()
+
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = nc.check(reqCtx)
+		}()
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	results := make(map[string]string, len(checks))
+	for i, nc := range checks {
+		results[nc.name] = "ok"
+		if errs[i] != nil {
+			slog.WarnContext(reqCtx, "readiness check failed", "check", nc.name, "error", errs[i])
+			results[nc.name] = "failing"
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": results})
+}
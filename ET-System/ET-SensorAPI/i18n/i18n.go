@@ -0,0 +1,87 @@
+// Package i18n holds the message catalogs of the API. Every user-facing
+// text, from email subjects to AI prompts, is looked up here by key in the
+// recipient's language.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	Indonesian = "id"
+	English    = "en"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+var catalogs = loadCatalogs()
+
+func loadCatalogs() map[string]map[string]string {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	catalogs := map[string]map[string]string{}
+	for _, f := range files {
+		data, err := locales.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", f.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(f.Name(), ".json")] = catalog
+	}
+	return catalogs
+}
+
+// Languages lists the supported language codes.
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Match returns the supported language of a preference such as "en" or
+// "en-US", or fallback when there is none.
+func Match(preferred, fallback string) string {
+	lang := strings.ToLower(strings.TrimSpace(preferred))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	if Supported(lang) {
+		return lang
+	}
+	return fallback
+}
+
+// T formats the message key of lang with args. Keys missing from lang fall
+// back to English, and to the key itself when English lacks them too.
+func T(lang, key string, args ...interface{}) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		msg, ok = catalogs[English][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
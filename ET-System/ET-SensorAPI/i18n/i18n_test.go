@@ -0,0 +1,54 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+var verbPattern = regexp.MustCompile(`%[-+# 0]*[0-9.]*[a-zA-Z%]`)
+
+// Every catalog must translate every key with the same format verbs, or a
+// language silently falls back to English or garbles its arguments.
+func TestCatalogsAgree(t *testing.T) {
+	reference := catalogs[English]
+	for _, lang := range Languages() {
+		catalog := catalogs[lang]
+		for key, msg := range reference {
+			translated, ok := catalog[key]
+			if !ok {
+				t.Errorf("%s: missing %s", lang, key)
+				continue
+			}
+			want, got := verbPattern.FindAllString(msg, -1), verbPattern.FindAllString(translated, -1)
+			if len(want) != len(got) {
+				t.Errorf("%s: %s has verbs %v, English has %v", lang, key, got, want)
+				continue
+			}
+			for i := range want {
+				if want[i] != got[i] {
+					t.Errorf("%s: %s has verbs %v, English has %v", lang, key, got, want)
+					break
+				}
+			}
+		}
+		for key := range catalog {
+			if _, ok := reference[key]; !ok {
+				t.Errorf("%s: %s is not in the English catalog", lang, key)
+			}
+		}
+	}
+}
+
+func TestMatchAndFallback(t *testing.T) {
+	for preferred, want := range map[string]string{"en": English, "EN-us": English, "id_ID": Indonesian, "fr": Indonesian, "": Indonesian} {
+		if got := Match(preferred, Indonesian); got != want {
+			t.Errorf("Match(%q) = %q, want %q", preferred, got, want)
+		}
+	}
+	if got := T(Indonesian, "no.such.key"); got != "no.such.key" {
+		t.Errorf("missing keys should render as the key, got %q", got)
+	}
+	if got := T(English, "notification.usage.unchanged", 12.5); got == "" || got == "notification.usage.unchanged" {
+		t.Errorf("unexpected message %q", got)
+	}
+}
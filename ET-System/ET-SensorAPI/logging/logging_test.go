@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var out []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var rec map[string]interface{}
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestRequestIDReachesLogsAndResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := captureLogs(t, slog.LevelInfo)
+
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), AccessLog())
+	r.GET("/ping", func(c *gin.Context) {
+		slog.InfoContext(c.Request.Context(), "handling")
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, tc := range []struct{ name, header string }{
+		{"propagated", "abc-123"},
+		{"generated", "not valid!"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			req.Header.Set(RequestIDHeader, tc.header)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if id == "" || (tc.name == "propagated") != (id == tc.header) {
+				t.Fatalf("unexpected response request ID %q", id)
+			}
+			recs := records(t, buf)
+			if len(recs) != 2 {
+				t.Fatalf("expected handler and access records, got %v", recs)
+			}
+			for _, rec := range recs {
+				if rec["request_id"] != id {
+					t.Errorf("record %v lacks request_id %q", rec["msg"], id)
+				}
+			}
+			if recs[1]["status"] != float64(http.StatusNoContent) || recs[1]["route"] != "/ping" {
+				t.Errorf("unexpected access record %v", recs[1])
+			}
+		})
+	}
+}
+
+func TestGormLoggerLevels(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+	l := NewGormLogger(50 * time.Millisecond)
+	ctx := WithRequestID(context.Background(), "req-1")
+	query := func() (string, int64) { return "SELECT 1", 1 }
+
+	l.Trace(ctx, time.Now(), query, nil)
+	l.Trace(ctx, time.Now().Add(-time.Second), query, nil)
+
+	recs := records(t, buf)
+	if len(recs) != 1 || recs[0]["msg"] != "slow query" || recs[0]["level"] != "WARN" {
+		t.Fatalf("expected only the slow query at warn level, got %v", recs)
+	}
+	if recs[0]["request_id"] != "req-1" || recs[0]["sql"] != "SELECT 1" {
+		t.Fatalf("unexpected record %v", recs[0])
+	}
+}
+
+func TestTraceIDsInLogs(t *testing.T) {
+	buf := captureLogs(t, slog.LevelInfo)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1, 2, 3},
+		SpanID:  trace.SpanID{4, 5, 6},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	slog.InfoContext(ctx, "traced")
+	slog.Info("untraced")
+
+	recs := records(t, buf)
+	if recs[0]["trace_id"] != sc.TraceID().String() || recs[0]["span_id"] != sc.SpanID().String() {
+		t.Fatalf("expected trace IDs, got %v", recs[0])
+	}
+	if _, ok := recs[1]["trace_id"]; ok {
+		t.Fatalf("untraced record should have no trace_id: %v", recs[1])
+	}
+}
@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// captureLimit bounds the memory a long-running capture can use.
+const captureLimit = 200
+
+// Captured is a message kept by Capture.
+type Captured struct {
+	ID     int
+	SentAt time.Time
+	Message
+}
+
+// Capture keeps the newest messages in memory instead of sending them. It
+// backs the /dev/mail endpoints and the API tests.
+type Capture struct {
+	from string
+
+	mu       sync.Mutex
+	messages []Captured
+	nextID   int
+}
+
+func NewCapture(from string) *Capture {
+	return &Capture{from: from, nextID: 1}
+}
+
+func (c *Capture) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = c.from
+	}
+	msg.To = append([]string(nil), msg.To...)
+	return observe(ctx, TransportCapture, msg, func(context.Context) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.messages = append(c.messages, Captured{ID: c.nextID, SentAt: time.Now(), Message: msg})
+		c.nextID++
+		if len(c.messages) > captureLimit {
+			c.messages = append([]Captured(nil), c.messages[len(c.messages)-captureLimit:]...)
+		}
+		return nil
+	})
+}
+
+// Messages returns the captured messages, oldest first.
+func (c *Capture) Messages() []Captured {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Captured(nil), c.messages...)
+}
+
+// To returns the captured messages addressed to recipient, oldest first.
+func (c *Capture) To(recipient string) []Captured {
+	var result []Captured
+	for _, m := range c.Messages() {
+		for _, to := range m.To {
+			if strings.EqualFold(to, recipient) {
+				result = append(result, m)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Get returns the captured message with id.
+func (c *Capture) Get(id int) (Captured, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range c.messages {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return Captured{}, false
+}
+
+// Reset forgets every captured message.
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = nil
+}
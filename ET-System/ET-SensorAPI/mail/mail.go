@@ -0,0 +1,147 @@
+// Package mail sends the emails of the API through a pluggable transport:
+// an SMTP server, a Maildir outbox on disk, or an in-memory capture for
+// development and tests.
+package mail
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/metrics"
+	"ET-SensorAPI/tracing"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TransportSMTP    = "smtp"
+	TransportOutbox  = "outbox"
+	TransportCapture = "capture"
+)
+
+// Message is an HTML email with an optional plain-text alternative. Kind
+// names the email for metrics and logs, such as "verification"; an empty
+// From is filled in by the Sender.
+type Message struct {
+	Kind    string
+	From    string
+	To      []string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New builds the Sender selected by cfg.Mail.Transport. Messages are sent
+// from cfg.Mail.From, falling back to the SMTP account.
+func New(cfg *config.Config) (Sender, error) {
+	from := cfg.Mail.From
+	if from == "" {
+		from = cfg.SMTP.Email
+	}
+
+	switch cfg.Mail.Transport {
+	case TransportSMTP:
+		return NewSMTP(cfg.SMTP, from), nil
+	case TransportOutbox:
+		return NewOutbox(cfg.Mail.OutboxDir, fallbackFrom(from))
+	case TransportCapture:
+		return NewCapture(fallbackFrom(from)), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Mail.Transport)
+	}
+}
+
+// fallbackFrom keeps local transports working without any mail settings.
+func fallbackFrom(from string) string {
+	if from == "" {
+		return "EcoTrack <noreply@ecotrack.local>"
+	}
+	return from
+}
+
+// Bytes renders msg as an RFC 5322 message with quoted-printable bodies,
+// as multipart/alternative when it has a text part.
+func (m Message) Bytes(date time.Time) []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", m.From)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageID(m.From))
+	header("MIME-Version", "1.0")
+
+	if m.Text == "" {
+		header("Content-Type", `text/html; charset="UTF-8"`)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		writeQuotedPrintable(&buf, m.HTML)
+		return buf.Bytes()
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()}))
+	buf.WriteString("\r\n")
+	// Clients show the last part they understand, so HTML goes last.
+	for _, part := range []struct{ contentType, body string }{
+		{`text/plain; charset="UTF-8"`, m.Text},
+		{`text/html; charset="UTF-8"`, m.HTML},
+	} {
+		w, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		writeQuotedPrintable(w, part.body)
+	}
+	parts.Close()
+	return buf.Bytes()
+}
+
+func writeQuotedPrintable(w io.Writer, body string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(body))
+	qp.Close()
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := netmail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
+
+// observe wraps one delivery attempt in a span and counts it.
+func observe(ctx context.Context, transport string, msg Message, send func(ctx context.Context) error) error {
+	ctx, span := tracing.Start(ctx, "mail.send", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("email.kind", msg.Kind),
+		attribute.String("email.transport", transport),
+	))
+	err := send(ctx)
+	metrics.ObserveEmail(msg.Kind, err)
+	tracing.End(span, err)
+	return err
+}
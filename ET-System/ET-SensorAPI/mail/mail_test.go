@@ -0,0 +1,134 @@
+package mail
+
+import (
+	"ET-SensorAPI/config"
+	"bytes"
+	"context"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutboxWritesMaildir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	cfg := config.Default()
+	cfg.Mail = config.MailConfig{Transport: TransportOutbox, OutboxDir: dir}
+
+	sender, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err := sender.Send(context.Background(), Message{To: []string{"user@ecotrack.test"}, Subject: "Grüße", HTML: "<p>hi</p>"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if tmp, _ := os.ReadDir(filepath.Join(dir, "tmp")); len(tmp) != 0 {
+		t.Fatalf("tmp should be empty, got %d files", len(tmp))
+	}
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(files))
+	}
+
+	f, err := os.Open(filepath.Join(dir, "new", files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	msg, err := netmail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Grüße" || msg.Header.Get("From") == "" || msg.Header.Get("Message-Id") == "" {
+		t.Fatalf("unexpected headers: %v", msg.Header)
+	}
+}
+
+func TestCaptureKeepsNewest(t *testing.T) {
+	c := NewCapture("noreply@ecotrack.test")
+	for i := 0; i < captureLimit+5; i++ {
+		to := "a@ecotrack.test"
+		if i%2 == 1 {
+			to = "B@ecotrack.test"
+		}
+		if err := c.Send(context.Background(), Message{To: []string{to}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := c.Messages()
+	if len(messages) != captureLimit || messages[0].ID != 6 {
+		t.Fatalf("expected the newest %d messages from ID 6, got %d from %d", captureLimit, len(messages), messages[0].ID)
+	}
+	if messages[0].From != "noreply@ecotrack.test" {
+		t.Fatalf("sender not filled in: %q", messages[0].From)
+	}
+	if got := len(c.To("b@ecotrack.test")); got != captureLimit/2 {
+		t.Fatalf("expected %d messages to b, got %d", captureLimit/2, got)
+	}
+	if _, ok := c.Get(1); ok {
+		t.Fatal("the oldest messages should be dropped")
+	}
+
+	c.Reset()
+	if len(c.Messages()) != 0 {
+		t.Fatal("Reset should forget every message")
+	}
+}
+
+func TestRenderAndMultipart(t *testing.T) {
+	data := struct {
+		Group  string
+		Sender string
+	}{"Rumah <Budi>", "admin@ecotrack.test"}
+
+	en, err := Render("en", "invitation", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := Render("id", "invitation", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if en.Subject == id.Subject || en.Kind != "invitation" {
+		t.Fatalf("subjects should be localized: %q, %q", en.Subject, id.Subject)
+	}
+	if !strings.Contains(id.HTML, "Rumah &lt;Budi&gt;") || !strings.Contains(id.Text, "Rumah <Budi>") {
+		t.Fatal("the group name should be escaped in HTML only")
+	}
+
+	en.From = "noreply@ecotrack.test"
+	en.To = []string{"user@ecotrack.test"}
+	msg, err := netmail.ReadMessage(bytes.NewReader(en.Bytes(time.Now())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q", msg.Header.Get("Content-Type"))
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		types = append(types, strings.Split(part.Header.Get("Content-Type"), ";")[0])
+	}
+	if strings.Join(types, ",") != "text/plain,text/html" {
+		t.Fatalf("unexpected parts %v", types)
+	}
+}
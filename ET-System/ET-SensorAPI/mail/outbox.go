@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Outbox writes every message into a Maildir (dir/new), where mail clients
+// such as mutt can read them. Nothing is delivered.
+type Outbox struct {
+	dir   string
+	from  string
+	host  string
+	count atomic.Int64
+}
+
+// NewOutbox creates the Maildir at dir when missing.
+func NewOutbox(dir, from string) (*Outbox, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	return &Outbox{dir: dir, from: from, host: host}, nil
+}
+
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = o.from
+	}
+	return observe(ctx, TransportOutbox, msg, func(context.Context) error {
+		now := time.Now()
+		// Maildir delivery: write under tmp, then move into new in one step
+		// so readers never see a partial message.
+		name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), o.count.Add(1), o.host)
+		tmp := filepath.Join(o.dir, "tmp", name)
+		if err := os.WriteFile(tmp, msg.Bytes(now), 0o644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, filepath.Join(o.dir, "new", name)); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	})
+}
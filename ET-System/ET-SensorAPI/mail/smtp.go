@@ -0,0 +1,102 @@
+package mail
+
+import (
+	"ET-SensorAPI/config"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTP delivers messages to an SMTP server. Depending on cfg.TLS the
+// connection is upgraded with STARTTLS, made over implicit TLS (port 465)
+// or left in plain text for local relays. It authenticates when cfg.Email
+// is set.
+type SMTP struct {
+	cfg  config.SMTPConfig
+	from string
+}
+
+func NewSMTP(cfg config.SMTPConfig, from string) *SMTP {
+	return &SMTP{cfg: cfg, from: from}
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	if msg.From == "" {
+		msg.From = s.from
+	}
+	return observe(ctx, TransportSMTP, msg, func(ctx context.Context) error {
+		if msg.From == "" {
+			return errors.New("mail sender is not set, configure MAIL_FROM or SMTP_EMAIL")
+		}
+		return s.deliver(ctx, msg)
+	})
+}
+
+func (s *SMTP) deliver(ctx context.Context, msg Message) error {
+	envelope, err := netmail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", msg.From, err)
+	}
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	if s.cfg.TLS == config.SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.cfg.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.cfg.TLS == config.SMTPTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Email != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Email, s.cfg.Password, s.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(envelope.Address); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes(time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
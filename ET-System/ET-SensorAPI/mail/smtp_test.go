@@ -0,0 +1,212 @@
+package mail
+
+import (
+	"ET-SensorAPI/config"
+	"bufio"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// received is one message accepted by fakeSMTP.
+type received struct {
+	From    string
+	To      []string
+	Authed  bool
+	Subject string
+	Body    string
+}
+
+// fakeSMTP is a minimal SMTP server on localhost that accepts every message
+// and keeps it in memory. It advertises AUTH but no STARTTLS, which
+// net/smtp allows for localhost only.
+type fakeSMTP struct {
+	Host string
+	Port int
+
+	listener net.Listener
+	mu       sync.Mutex
+	mails    []received
+}
+
+func newFakeSMTP(t testing.TB) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start fake SMTP server: %v", err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	s := &fakeSMTP{Host: host, listener: listener}
+	s.Port, _ = strconv.Atoi(port)
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeSMTP) Mails() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.mails...)
+}
+
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost fake SMTP")
+	var mail received
+	authed := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			authed = true
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			mail = received{From: addressOf(line), Authed: authed}
+			reply("250 OK")
+		case "RCPT":
+			mail.To = append(mail.To, addressOf(line))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" || l == ".\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			mail.Subject, mail.Body = splitMessage(data.String())
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func addressOf(line string) string {
+	start, end := strings.Index(line, "<"), strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+func splitMessage(data string) (subject, body string) {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	headers, body, _ := strings.Cut(data, "\n\n")
+	for _, h := range strings.Split(headers, "\n") {
+		if v, ok := strings.CutPrefix(h, "Subject: "); ok {
+			subject = v
+		}
+	}
+	decoded, _ := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	return subject, string(decoded)
+}
+
+func TestSMTPSendsWithAuth(t *testing.T) {
+	server := newFakeSMTP(t)
+	sender := NewSMTP(config.SMTPConfig{
+		Host:     server.Host,
+		Port:     server.Port,
+		TLS:      config.SMTPTLSNone,
+		Email:    "noreply@ecotrack.test",
+		Password: "secret",
+	}, "EcoTrack <noreply@ecotrack.test>")
+
+	long := strings.Repeat("<p style=\"color: #555;\">line</p>", 40)
+	err := sender.Send(context.Background(), Message{
+		Kind:    "verification",
+		To:      []string{"user@ecotrack.test"},
+		Subject: "ECOTRACK | Email Verification",
+		HTML:    long,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mails := server.Mails()
+	if len(mails) != 1 {
+		t.Fatalf("expected one mail, got %d", len(mails))
+	}
+	got := mails[0]
+	if !got.Authed || got.From != "noreply@ecotrack.test" || got.To[0] != "user@ecotrack.test" {
+		t.Fatalf("unexpected envelope: %+v", got)
+	}
+	if got.Subject != "ECOTRACK | Email Verification" {
+		t.Fatalf("unexpected subject %q", got.Subject)
+	}
+	if strings.TrimSpace(got.Body) != long {
+		t.Fatalf("body did not survive encoding:\n%s", got.Body)
+	}
+}
+
+func TestSMTPWithoutCredentialsSkipsAuth(t *testing.T) {
+	server := newFakeSMTP(t)
+	sender := NewSMTP(config.SMTPConfig{Host: server.Host, Port: server.Port, TLS: config.SMTPTLSNone}, "relay@ecotrack.test")
+
+	if err := sender.Send(context.Background(), Message{To: []string{"user@ecotrack.test"}, Subject: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if mails := server.Mails(); len(mails) != 1 || mails[0].Authed {
+		t.Fatalf("expected one unauthenticated mail, got %+v", mails)
+	}
+}
+
+func TestSMTPRequiresSender(t *testing.T) {
+	sender := NewSMTP(config.SMTPConfig{Host: "127.0.0.1", Port: 25, TLS: config.SMTPTLSNone}, "")
+	if err := sender.Send(context.Background(), Message{To: []string{"user@ecotrack.test"}}); err == nil {
+		t.Fatal("expected an error without a sender address")
+	}
+}
+
+func TestSMTPStartTLSRequired(t *testing.T) {
+	server := newFakeSMTP(t)
+	sender := NewSMTP(config.SMTPConfig{Host: server.Host, Port: server.Port, TLS: config.SMTPTLSStartTLS}, "relay@ecotrack.test")
+
+	err := sender.Send(context.Background(), Message{To: []string{"user@ecotrack.test"}})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected a STARTTLS error, got %v", err)
+	}
+	if len(server.Mails()) != 0 {
+		t.Fatal("nothing should be sent in plain text")
+	}
+}
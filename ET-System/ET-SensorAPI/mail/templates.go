@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"ET-SensorAPI/i18n"
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Every email has an HTML and a plain-text template in templates/. Both are
+// wrapped in the matching layout; the text template also defines the
+// subject. Texts come from the i18n catalogs through the t function.
+//
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	htmlTemplates = map[string]*htmltemplate.Template{}
+	textTemplates = map[string]*texttemplate.Template{}
+)
+
+// placeholderFuncs lets the templates parse; Render swaps in the functions
+// of the recipient's language.
+var placeholderFuncs = map[string]interface{}{
+	"t":    func(string, ...interface{}) string { return "" },
+	"lang": func() string { return "" },
+}
+
+func init() {
+	for _, name := range []string{"verification", "invitation", "password_changed"} {
+		htmlTemplates[name] = htmltemplate.Must(htmltemplate.New(name).Funcs(placeholderFuncs).
+			ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html"))
+		textTemplates[name] = texttemplate.Must(texttemplate.New(name).Funcs(placeholderFuncs).
+			ParseFS(templateFS, "templates/layout.txt", "templates/"+name+".txt"))
+	}
+}
+
+// Render builds the email name in lang from data. The caller sets To.
+func Render(lang, name string, data interface{}) (Message, error) {
+	htmlTmpl, ok := htmlTemplates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+	funcs := map[string]interface{}{
+		"t": func(key string, args ...interface{}) string {
+			return i18n.T(lang, key, args...)
+		},
+		"lang": func() string { return lang },
+	}
+
+	htmlTmpl, err := htmlTmpl.Clone()
+	if err != nil {
+		return Message{}, err
+	}
+	textTmpl, err := textTemplates[name].Clone()
+	if err != nil {
+		return Message{}, err
+	}
+	htmlTmpl.Funcs(funcs)
+	textTmpl.Funcs(funcs)
+
+	var subject, html, text bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTmpl.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTmpl.ExecuteTemplate(&text, "layout", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Kind:    name,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
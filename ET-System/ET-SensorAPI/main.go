@@ -1,78 +1,210 @@
 package main
 
 import (
+	"ET-SensorAPI/ai"
 	"ET-SensorAPI/config"
-	"ET-SensorAPI/models"
+	"ET-SensorAPI/health"
+	"ET-SensorAPI/logging"
+	"ET-SensorAPI/mail"
+	"ET-SensorAPI/metrics"
+	"ET-SensorAPI/migrations"
+	"ET-SensorAPI/repository"
 	"ET-SensorAPI/routes"
 	"ET-SensorAPI/services"
+	"ET-SensorAPI/tracing"
+	"ET-SensorAPI/utils"
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
-func startCronJobs() {
-	ticker := time.NewTicker(24 * time.Hour)
-	go func() {
-		for range ticker.C {
-			services.CheckUsageNotifications()
-		}
-	}()
-
-	services.CheckUsageNotifications()
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 func main() {
 
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("❌ ", err)
+	}
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, level)
+	if err != nil {
+		log.Fatal("❌ ", err)
 	}
+	slog.SetDefault(logger)
+	utils.SetDefaultTimezone(cfg.DefaultTimezone)
 
-	config.ConnectDB()
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
 
-	err := config.DB.AutoMigrate(
-		&models.User{},
-		&models.UserGroup{},
-		&models.UserGroupMember{},
-		&models.Device{},
-		&models.WaterUsage{},
-	)
+	db, err := config.ConnectDB(cfg.Database)
 	if err != nil {
-		fmt.Println("❌ Migration failed:", err)
-	} else {
-		fmt.Println("✅ Migration completed successfully!")
+		fatal("failed to connect to database", err)
+	}
+	slog.Info("database connected", "driver", cfg.Database.Driver)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(cfg, db, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if cfg.Database.MigrateOnStart {
+		if err := runMigrateCommand(cfg, db, []string{"up"}); err != nil {
+			fatal("migration failed", err)
+		}
+	}
+	if err := migrations.EnsureCurrent(db); err != nil {
+		fatal("schema is not current", err)
+	}
+	if cfg.Timescale.Enabled {
+		if err := migrations.EnableTimescale(db, timescaleOptions(cfg)); err != nil {
+			fatal("failed to enable TimescaleDB", err)
+		}
+	}
+
+	repos := repository.NewGorm(db, cfg.DefaultTimezone)
+
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, repos, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
 	dir, _ := os.Getwd()
-	fmt.Println("Running from:", dir)
-	startCronJobs()
+	slog.Info("starting", "dir", dir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	r := gin.Default()
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("failed to access database pool", err)
+	}
+
+	jobs, err := services.NewScheduler(cfg, repos, sqlDB)
+	if err != nil {
+		fatal("failed to set up background jobs", err)
+	}
+	jobs.Start(ctx)
+	mailer, err := mail.New(cfg)
+	if err != nil {
+		fatal("failed to set up mail", err)
+	}
+	if cfg.Mail.Transport != mail.TransportSMTP {
+		slog.Warn("emails are not delivered", "transport", cfg.Mail.Transport)
+	}
+	llm, err := ai.New(cfg.AI)
+	if err != nil {
+		fatal("failed to set up the AI provider", err)
+	}
+	if cfg.AI.Provider == config.AIProviderFake {
+		slog.Warn("usage analyses are canned", "provider", cfg.AI.Provider)
+	}
+	workers := services.NewQueue(cfg, repos, mailer, llm)
+	workers.Start(ctx)
+
+	checker := health.NewChecker(5 * time.Second)
+	checker.Add("database", sqlDB.PingContext)
+	checker.Add("migrations", func(ctx context.Context) error {
+		return migrations.EnsureCurrent(db.WithContext(ctx))
+	})
+	checker.Add("workers", func(context.Context) error {
+		return jobs.Alive()
+	})
+	checker.Add("queue", func(context.Context) error {
+		return workers.Alive()
+	})
+
+	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
+		fatal("invalid trusted proxies", err)
+	}
+	r.Use(tracing.Middleware(cfg.Tracing.ServiceName))
+	r.Use(logging.RequestIDMiddleware(), logging.AccessLog(), logging.Recovery(), metrics.HTTP())
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:  []string{"*"},
 		AllowMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders: []string{"Content-Length"},
+		AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Authorization", logging.RequestIDHeader},
+		ExposeHeaders: []string{"Content-Length", logging.RequestIDHeader},
 		// AllowCredentials: true,
 		// MaxAge:           12 * time.Hour,
 	}))
 
 	r.Static("/static", "./static")
-	routes.SetupRouter(r)
-	routes.SetupGraphQLRoutes(r)
-	routes.SetupDeepSeekRoutes(r)
+	limiter := services.NewRateLimiter(cfg, repos)
+	routes.SetupRouter(r, cfg, repos, limiter)
+	routes.SetupGraphQLRoutes(r, cfg, repos, jobs, llm, limiter)
+	routes.SetupDeepSeekRoutes(r, cfg, repos, llm)
+	routes.SetupMetricsRoutes(r, cfg, sqlDB, repos)
+	routes.SetupHealthRoutes(r, checker)
+	routes.SetupDevRoutes(r, cfg, mailer)
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           r,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("server running", "addr", fmt.Sprintf("http://localhost:%d/", cfg.Port))
+		serveErr <- srv.ListenAndServe()
+	}()
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	select {
+	case err := <-serveErr:
+		fatal("server stopped", err)
+	case <-ctx.Done():
 	}
+	stop()
 
-	fmt.Printf("Server running on http://localhost:%s/\n", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal(err)
+	// Fail readiness first so load balancers stop sending traffic, then drain
+	// requests, let running jobs finish and flush pending spans.
+	slog.Info("shutting down", "timeout", cfg.HTTP.ShutdownTimeout)
+	checker.SetDraining()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to drain requests", "error", err)
+	}
+	if err := jobs.Stop(shutdownCtx); err != nil {
+		slog.Error("failed to stop background jobs", "error", err)
+	}
+	if err := workers.Stop(shutdownCtx); err != nil {
+		slog.Error("failed to stop queue workers", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
 	}
+	slog.Info("shutdown complete")
 }
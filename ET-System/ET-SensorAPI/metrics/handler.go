@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ActiveDeviceCounter counts the devices that reported since a point in time.
+type ActiveDeviceCounter interface {
+	CountActiveDevices(ctx context.Context, since time.Time) (int64, error)
+}
+
+// NewHandler serves the package collectors together with the connection
+// pool stats of db and a gauge of devices seen within window.
+func NewHandler(db *sql.DB, devices ActiveDeviceCounter, window time.Duration) gin.HandlerFunc {
+	local := prometheus.NewRegistry()
+	local.MustRegister(
+		collectors.NewDBStatsCollector(db, "main"),
+		&activeDevices{devices: devices, window: window},
+	)
+
+	h := promhttp.HandlerFor(prometheus.Gatherers{Registry, local}, promhttp.HandlerOpts{})
+	return gin.WrapH(h)
+}
+
+var activeDevicesDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "active_devices"),
+	"Devices that sent a reading within the configured window.",
+	[]string{"window"}, nil,
+)
+
+// activeDevices queries the count at scrape time rather than tracking it in
+// memory, so it stays right across restarts and replicas.
+type activeDevices struct {
+	devices ActiveDeviceCounter
+	window  time.Duration
+}
+
+func (a *activeDevices) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeDevicesDesc
+}
+
+func (a *activeDevices) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := a.devices.CountActiveDevices(ctx, time.Now().Add(-a.window))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to count active devices", "error", err)
+		ch <- prometheus.NewInvalidMetric(activeDevicesDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(activeDevicesDesc, prometheus.GaugeValue, float64(count), a.window.String())
+}
@@ -0,0 +1,176 @@
+// Package metrics defines the Prometheus collectors of the API and the
+// middleware that feeds them. Counters live in a package registry so that
+// utils and services can record outcomes without extra plumbing; collectors
+// tied to a database are created per handler by NewHandler.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "etsensor"
+
+// Registry holds the process-wide collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	GraphQLOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "graphql_operations_total",
+		Help:      "GraphQL operations by operation name and result (ok or error).",
+	}, []string{"operation", "result"})
+
+	GraphQLDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "graphql_operation_duration_seconds",
+		Help:      "GraphQL operation latency by operation name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	IngestedReadings = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_readings_total",
+		Help:      "Sensor readings received, by result (accepted or rejected), rejection reason and device.",
+	}, []string{"result", "reason", "device"})
+
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Background job run time by job and result.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900},
+	}, []string{"job", "result"})
+
+	QueueJobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_jobs_total",
+		Help:      "Queue job attempts by queue, kind and outcome (succeeded, retried or dead).",
+	}, []string{"queue", "kind", "outcome"})
+
+	QueueDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_job_duration_seconds",
+		Help:      "Queue job attempt run time by kind.",
+		Buckets:   []float64{0.05, 0.1, 0.5, 1, 5, 15, 60, 300},
+	}, []string{"kind"})
+
+	EmailsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "emails_total",
+		Help:      "Emails handed to the mail transport, by kind and result.",
+	}, []string{"kind", "result"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by a rate limit, by rule.",
+	}, []string{"rule"})
+
+	LLMCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_calls_total",
+		Help:      "Calls to the LLM by provider and result.",
+	}, []string{"provider", "result"})
+
+	LLMDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_call_duration_seconds",
+		Help:      "Latency of calls to the LLM by provider.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"provider"})
+
+	LLMTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "Tokens used by LLM calls, by provider, model and direction (input or output).",
+	}, []string{"provider", "model", "direction"})
+
+	LLMCost = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_cost_usd_total",
+		Help:      "Reported or estimated cost of LLM calls in USD, by provider and model.",
+	}, []string{"provider", "model"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration,
+		GraphQLOperations, GraphQLDuration,
+		IngestedReadings,
+		JobDuration,
+		QueueJobs, QueueDuration,
+		EmailsSent,
+		RateLimited,
+		LLMCalls, LLMDuration, LLMTokens, LLMCost,
+	)
+}
+
+// Result maps err to the "ok"/"error" label used by the outcome counters.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// ObserveJob runs fn and records its duration under job.
+func ObserveJob(job string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	JobDuration.WithLabelValues(job, Result(err)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// ObserveQueueJob records one attempt of a queue job of kind that started
+// at start and ended with outcome.
+func ObserveQueueJob(queue, kind, outcome string, start time.Time) {
+	QueueJobs.WithLabelValues(queue, kind, outcome).Inc()
+	QueueDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+}
+
+// ObserveLLM records the outcome of a call to provider that started at
+// start.
+func ObserveLLM(provider string, start time.Time, err error) {
+	LLMCalls.WithLabelValues(provider, Result(err)).Inc()
+	LLMDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
+}
+
+// ObserveLLMUsage records the tokens and cost of a call to model.
+func ObserveLLMUsage(provider, model string, inputTokens, outputTokens int, cost float64) {
+	LLMTokens.WithLabelValues(provider, model, "input").Add(float64(inputTokens))
+	LLMTokens.WithLabelValues(provider, model, "output").Add(float64(outputTokens))
+	LLMCost.WithLabelValues(provider, model).Add(cost)
+}
+
+// ObserveEmail records the outcome of sending an email of kind.
+func ObserveEmail(kind string, err error) {
+	EmailsSent.WithLabelValues(kind, Result(err)).Inc()
+}
+
+// ReadingAccepted and ReadingRejected count ingested readings. Rejections of
+// malformed or unknown device IDs should pass a fixed device label so that
+// client input cannot grow the series count.
+func ReadingAccepted(device string) {
+	IngestedReadings.WithLabelValues("accepted", "", device).Inc()
+}
+
+func ReadingRejected(reason, device string) {
+	IngestedReadings.WithLabelValues("rejected", reason, device).Inc()
+}
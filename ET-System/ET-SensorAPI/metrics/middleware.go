@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gin-gonic/gin"
+)
+
+// HTTP records request counts and latencies per matched route. Requests
+// that match no route share the "unmatched" label.
+func HTTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// GraphQL is a gqlgen extension recording operations by name. Operations
+// without a name are labelled "anonymous".
+type GraphQL struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+} = GraphQL{}
+
+func (GraphQL) ExtensionName() string {
+	return "Metrics"
+}
+
+func (GraphQL) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (GraphQL) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	start := time.Now()
+	resp := next(ctx)
+
+	name := "anonymous"
+	if graphql.HasOperationContext(ctx) {
+		if op := graphql.GetOperationContext(ctx); op.OperationName != "" {
+			name = op.OperationName
+		} else if op.Operation != nil && op.Operation.Name != "" {
+			name = op.Operation.Name
+		}
+	}
+	result := "ok"
+	if resp == nil || len(resp.Errors) > 0 {
+		result = "error"
+	}
+	GraphQLOperations.WithLabelValues(name, result).Inc()
+	GraphQLDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	return resp
+}
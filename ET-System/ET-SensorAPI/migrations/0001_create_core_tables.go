@@ -0,0 +1,113 @@
+package migrations
+
+import (
+	"ET-SensorAPI/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Snapshots of the tables as they were first created. Later migrations must
+// not change these; they add their own snapshot types instead.
+
+type coreUser struct {
+	ID           uint   `gorm:"primaryKey"`
+	Email        string `gorm:"unique"`
+	Password     string
+	DisplayName  string
+	RefreshToken string
+	Verified     bool   `gorm:"default:false"`
+	VerifyToken  string `gorm:"default:null"`
+	Provider     string
+	ProviderID   string
+	CreatedAt    time.Time
+}
+
+func (coreUser) TableName() string { return "users" }
+
+type coreUserGroup struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"unique"`
+	CreatedAt time.Time
+	Location  models.JSONArray
+}
+
+func (coreUserGroup) TableName() string { return "user_groups" }
+
+type coreUserGroupMember struct {
+	UserID      uint `gorm:"primaryKey"`
+	UserGroupID uint `gorm:"primaryKey"`
+	IsAdmin     bool `gorm:"default:false"`
+	CreatedAt   time.Time
+	User        coreUser      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;references:ID"`
+	UserGroup   coreUserGroup `gorm:"foreignKey:UserGroupID;constraint:OnDelete:CASCADE;references:ID"`
+}
+
+func (coreUserGroupMember) TableName() string { return "user_group_members" }
+
+type coreDevice struct {
+	ID          string        `gorm:"primaryKey"`
+	UserGroupID uint          `gorm:"index"`
+	UserGroup   coreUserGroup `gorm:"foreignKey:UserGroupID;constraint:OnDelete:CASCADE;"`
+	Name        string
+	Location    string
+	CreatedAt   time.Time
+}
+
+func (coreDevice) TableName() string { return "devices" }
+
+type coreWaterUsage struct {
+	ID         uint       `gorm:"primaryKey"`
+	DeviceID   string     `gorm:"index"`
+	Device     coreDevice `gorm:"constraint:OnDelete:CASCADE;"`
+	FlowRate   float64
+	TotalUsage float64
+	RecordedAt time.Time `gorm:"index"`
+}
+
+func (coreWaterUsage) TableName() string { return "water_usages" }
+
+type coreNotification struct {
+	ID        uint       `gorm:"primaryKey"`
+	DeviceID  string     `gorm:"index"`
+	Device    coreDevice `gorm:"foreignKey:DeviceID;references:ID"`
+	Message   string
+	Threshold float64
+	CreatedAt time.Time
+}
+
+func (coreNotification) TableName() string { return "notifications" }
+
+// createCoreTables uses AutoMigrate so that databases set up by the old
+// startup AutoMigrate calls are adopted rather than recreated.
+var createCoreTables = Migration{
+	Version: 1,
+	Name:    "create_core_tables",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&coreUser{},
+			&coreUserGroup{},
+			&coreUserGroupMember{},
+			&coreDevice{},
+			&coreWaterUsage{},
+			&coreNotification{},
+		)
+	},
+	Down: func(tx *gorm.DB) error {
+		// One at a time, children first: SQLite cannot switch foreign keys
+		// off inside the migration's transaction.
+		for _, table := range []interface{}{
+			&coreNotification{},
+			&coreWaterUsage{},
+			&coreDevice{},
+			&coreUserGroupMember{},
+			&coreUserGroup{},
+			&coreUser{},
+		} {
+			if err := tx.Migrator().DropTable(table); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type timezoneUser struct {
+	ID       uint `gorm:"primaryKey"`
+	Timezone string
+}
+
+func (timezoneUser) TableName() string { return "users" }
+
+type timezoneUserGroup struct {
+	ID       uint `gorm:"primaryKey"`
+	Timezone string
+}
+
+func (timezoneUserGroup) TableName() string { return "user_groups" }
+
+var addTimezones = Migration{
+	Version: 2,
+	Name:    "add_timezones",
+	Up: func(tx *gorm.DB) error {
+		return addMissingColumns(tx, map[interface{}][]string{
+			&timezoneUser{}:      {"Timezone"},
+			&timezoneUserGroup{}: {"Timezone"},
+		})
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropExistingColumns(tx, map[interface{}][]string{
+			&timezoneUser{}:      {"Timezone"},
+			&timezoneUserGroup{}: {"Timezone"},
+		})
+	},
+}
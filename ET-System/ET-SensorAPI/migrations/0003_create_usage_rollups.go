@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type rollupHourlyUsage struct {
+	DeviceID   string     `gorm:"primaryKey"`
+	Device     coreDevice `gorm:"constraint:OnDelete:CASCADE;"`
+	Hour       time.Time  `gorm:"primaryKey"`
+	TotalUsage float64
+	FlowSum    float64
+	MaxFlow    float64
+	Samples    int64
+}
+
+func (rollupHourlyUsage) TableName() string { return "hourly_usages" }
+
+type rollupDailyUsage struct {
+	ID         uint       `gorm:"primaryKey"`
+	DeviceID   string     `gorm:"uniqueIndex:idx_daily_usages_device_date"`
+	Device     coreDevice `gorm:"constraint:OnDelete:CASCADE;"`
+	Date       time.Time  `gorm:"type:date;uniqueIndex:idx_daily_usages_device_date"`
+	TotalUsage float64
+	FlowSum    float64
+	MaxFlow    float64
+	Samples    int64
+	Notified   bool `gorm:"default:false"`
+}
+
+func (rollupDailyUsage) TableName() string { return "daily_usages" }
+
+var createUsageRollups = Migration{
+	Version: 3,
+	Name:    "create_usage_rollups",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&rollupHourlyUsage{}, &rollupDailyUsage{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&rollupDailyUsage{}, &rollupHourlyUsage{})
+	},
+}
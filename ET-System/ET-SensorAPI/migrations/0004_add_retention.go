@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type retentionWaterUsage struct {
+	ID         uint   `gorm:"primaryKey"`
+	Resolution string `gorm:"size:10;default:raw"`
+	Samples    int64  `gorm:"default:1"`
+}
+
+func (retentionWaterUsage) TableName() string { return "water_usages" }
+
+type retentionPolicy struct {
+	UserGroupID uint          `gorm:"primaryKey"`
+	UserGroup   coreUserGroup `gorm:"constraint:OnDelete:CASCADE;"`
+	RawDays     *int
+	MinuteDays  *int
+	MaxAgeDays  *int
+	UpdatedAt   time.Time
+}
+
+func (retentionPolicy) TableName() string { return "retention_policies" }
+
+var addRetention = Migration{
+	Version: 4,
+	Name:    "add_retention",
+	Up: func(tx *gorm.DB) error {
+		if err := addMissingColumns(tx, map[interface{}][]string{
+			&retentionWaterUsage{}: {"Resolution", "Samples"},
+		}); err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&retentionPolicy{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&retentionPolicy{}); err != nil {
+			return err
+		}
+		return dropExistingColumns(tx, map[interface{}][]string{
+			&retentionWaterUsage{}: {"Resolution", "Samples"},
+		})
+	},
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type jobRun struct {
+	ID          uint       `gorm:"primaryKey"`
+	Job         string     `gorm:"size:100;not null;uniqueIndex:idx_job_runs_tick,priority:1;index:idx_job_runs_job_started,priority:1"`
+	Trigger     string     `gorm:"size:20;not null"`
+	ScheduledAt *time.Time `gorm:"uniqueIndex:idx_job_runs_tick,priority:2"`
+	StartedAt   time.Time  `gorm:"not null;index:idx_job_runs_job_started,priority:2"`
+	FinishedAt  *time.Time
+	Status      string `gorm:"size:20;not null"`
+	Error       string `gorm:"type:text"`
+	Instance    string `gorm:"size:255"`
+}
+
+func (jobRun) TableName() string { return "job_runs" }
+
+var addJobRuns = Migration{
+	Version: 5,
+	Name:    "add_job_runs",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&jobRun{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&jobRun{})
+	},
+}
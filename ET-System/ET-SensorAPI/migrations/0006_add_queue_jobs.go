@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type queueJob struct {
+	ID         uint      `gorm:"primaryKey"`
+	Queue      string    `gorm:"size:50;not null;index:idx_queue_jobs_claim,priority:1"`
+	Kind       string    `gorm:"size:100;not null"`
+	Payload    string    `gorm:"type:text;not null"`
+	Status     string    `gorm:"size:20;not null;index:idx_queue_jobs_claim,priority:2"`
+	Attempts   int       `gorm:"not null;default:0"`
+	RunAt      time.Time `gorm:"not null;index:idx_queue_jobs_claim,priority:3"`
+	LockedAt   *time.Time
+	LockedBy   string `gorm:"size:255"`
+	LastError  string `gorm:"type:text"`
+	Result     string `gorm:"type:text"`
+	RequestID  string `gorm:"size:64"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+func (queueJob) TableName() string { return "queue_jobs" }
+
+var addQueueJobs = Migration{
+	Version: 6,
+	Name:    "add_queue_jobs",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&queueJob{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&queueJob{})
+	},
+}
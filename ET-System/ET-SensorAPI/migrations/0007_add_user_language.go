@@ -0,0 +1,25 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type languageUser struct {
+	ID       uint `gorm:"primaryKey"`
+	Language string
+}
+
+func (languageUser) TableName() string { return "users" }
+
+var addUserLanguage = Migration{
+	Version: 7,
+	Name:    "add_user_language",
+	Up: func(tx *gorm.DB) error {
+		return addMissingColumns(tx, map[interface{}][]string{
+			&languageUser{}: {"Language"},
+		})
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropExistingColumns(tx, map[interface{}][]string{
+			&languageUser{}: {"Language"},
+		})
+	},
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type session struct {
+	ID           uint     `gorm:"primaryKey"`
+	UserID       uint     `gorm:"not null;index"`
+	User         coreUser `gorm:"constraint:OnDelete:CASCADE;"`
+	DeviceName   string   `gorm:"size:100"`
+	IP           string   `gorm:"size:64"`
+	UserAgent    string   `gorm:"size:255"`
+	Generation   int      `gorm:"not null;default:0"`
+	CreatedAt    time.Time
+	LastUsedAt   time.Time `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null"`
+	RevokedAt    *time.Time
+	RevokeReason string `gorm:"size:30"`
+}
+
+func (session) TableName() string { return "sessions" }
+
+// The single refresh token per user is replaced by sessions; everyone has to
+// log in again once.
+var addSessions = Migration{
+	Version: 9,
+	Name:    "add_sessions",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&session{}); err != nil {
+			return err
+		}
+		return dropExistingColumns(tx, map[interface{}][]string{
+			&coreUser{}: {"RefreshToken"},
+		})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := addMissingColumns(tx, map[interface{}][]string{
+			&coreUser{}: {"RefreshToken"},
+		}); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&session{})
+	},
+}
@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type totpUser struct {
+	ID            uint `gorm:"primaryKey"`
+	TOTPSecret    string
+	TOTPEnabledAt *time.Time
+	TOTPLastStep  int64 `gorm:"not null;default:0"`
+}
+
+func (totpUser) TableName() string { return "users" }
+
+type loginChallenge struct {
+	ID          uint      `gorm:"primaryKey"`
+	UserID      uint      `gorm:"not null;index"`
+	User        coreUser  `gorm:"constraint:OnDelete:CASCADE;"`
+	SecretHash  string    `gorm:"size:64;not null"`
+	DeviceName  string    `gorm:"size:100"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	Attempts    int       `gorm:"not null;default:0"`
+	CompletedAt *time.Time
+	CreatedAt   time.Time
+}
+
+func (loginChallenge) TableName() string { return "login_challenges" }
+
+type trustedDevice struct {
+	ID         uint     `gorm:"primaryKey"`
+	UserID     uint     `gorm:"not null;index"`
+	User       coreUser `gorm:"constraint:OnDelete:CASCADE;"`
+	TokenHash  string   `gorm:"size:64;not null"`
+	DeviceName string   `gorm:"size:100"`
+	CreatedAt  time.Time
+	LastUsedAt time.Time `gorm:"not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+}
+
+func (trustedDevice) TableName() string { return "trusted_devices" }
+
+type recoveryCode struct {
+	ID        uint     `gorm:"primaryKey"`
+	UserID    uint     `gorm:"not null;index"`
+	User      coreUser `gorm:"constraint:OnDelete:CASCADE;"`
+	CodeHash  string   `gorm:"size:64;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (recoveryCode) TableName() string { return "recovery_codes" }
+
+var addTwoFactor = Migration{
+	Version: 10,
+	Name:    "add_two_factor",
+	Up: func(tx *gorm.DB) error {
+		if err := addMissingColumns(tx, map[interface{}][]string{
+			&totpUser{}: {"TOTPSecret", "TOTPEnabledAt", "TOTPLastStep"},
+		}); err != nil {
+			return err
+		}
+		return tx.AutoMigrate(&loginChallenge{}, &trustedDevice{}, &recoveryCode{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&recoveryCode{}, &trustedDevice{}, &loginChallenge{}); err != nil {
+			return err
+		}
+		return dropExistingColumns(tx, map[interface{}][]string{
+			&totpUser{}: {"TOTPSecret", "TOTPEnabledAt", "TOTPLastStep"},
+		})
+	},
+}
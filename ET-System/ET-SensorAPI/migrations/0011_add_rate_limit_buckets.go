@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type rateLimitBucket struct {
+	Key        string    `gorm:"primaryKey;size:300"`
+	Tokens     float64   `gorm:"not null"`
+	RefilledAt time.Time `gorm:"not null"`
+	FullAt     time.Time `gorm:"not null;index"`
+	Version    int       `gorm:"not null;default:0"`
+}
+
+func (rateLimitBucket) TableName() string { return "rate_limit_buckets" }
+
+var addRateLimitBuckets = Migration{
+	Version: 11,
+	Name:    "add_rate_limit_buckets",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&rateLimitBucket{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&rateLimitBucket{})
+	},
+}
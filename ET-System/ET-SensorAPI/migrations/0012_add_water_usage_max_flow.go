@@ -0,0 +1,28 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type maxFlowUsage struct {
+	ID      uint `gorm:"primaryKey"`
+	MaxFlow *float64
+}
+
+func (maxFlowUsage) TableName() string { return "water_usages" }
+
+// addWaterUsageMaxFlow keeps the peak flow of downsampled rows, which
+// otherwise only keep the average. Existing rows stay NULL and are read as
+// their flow rate.
+var addWaterUsageMaxFlow = Migration{
+	Version: 12,
+	Name:    "add_water_usage_max_flow",
+	Up: func(tx *gorm.DB) error {
+		return addMissingColumns(tx, map[interface{}][]string{
+			&maxFlowUsage{}: {"MaxFlow"},
+		})
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropExistingColumns(tx, map[interface{}][]string{
+			&maxFlowUsage{}: {"MaxFlow"},
+		})
+	},
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type messageKeyNotification struct {
+	ID         uint   `gorm:"primaryKey"`
+	MessageKey string `gorm:"size:100"`
+}
+
+func (messageKeyNotification) TableName() string { return "notifications" }
+
+var addNotificationMessageKey = Migration{
+	Version: 13,
+	Name:    "add_notification_message_key",
+	Up: func(tx *gorm.DB) error {
+		return addMissingColumns(tx, map[interface{}][]string{
+			&messageKeyNotification{}: {"MessageKey"},
+		})
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropExistingColumns(tx, map[interface{}][]string{
+			&messageKeyNotification{}: {"MessageKey"},
+		})
+	},
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// addMissingColumns adds the given fields of each snapshot model unless the
+// column already exists, e.g. because an older AutoMigrate created it.
+func addMissingColumns(tx *gorm.DB, columns map[interface{}][]string) error {
+	m := tx.Migrator()
+	for model, fields := range columns {
+		for _, field := range fields {
+			if m.HasColumn(model, field) {
+				continue
+			}
+			if err := m.AddColumn(model, field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func dropExistingColumns(tx *gorm.DB, columns map[interface{}][]string) error {
+	m := tx.Migrator()
+	for model, fields := range columns {
+		for _, field := range fields {
+			if !m.HasColumn(model, field) {
+				continue
+			}
+			if err := m.DropColumn(model, field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
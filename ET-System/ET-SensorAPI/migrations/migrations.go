@@ -0,0 +1,203 @@
+// Package migrations holds the versioned schema changes of the API. Applied
+// versions are recorded in schema_migrations; new migrations are appended to
+// the list in All and must never be edited once released.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+type SchemaMigration struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string { return "schema_migrations" }
+
+type Status struct {
+	Migration Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// All lists every migration in version order.
+var All = []Migration{
+	createCoreTables,
+	addTimezones,
+	createUsageRollups,
+	addRetention,
+	addJobRuns,
+	addQueueJobs,
+	addUserLanguage,
+	addOneTimeCodes,
+	addSessions,
+	addTwoFactor,
+	addRateLimitBuckets,
+	addWaterUsageMaxFlow,
+	addNotificationMessageKey,
+}
+
+func ensureTable(db *gorm.DB) error {
+	return db.AutoMigrate(&SchemaMigration{})
+}
+
+func applied(db *gorm.DB) (map[uint]SchemaMigration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	result := make(map[uint]SchemaMigration, len(rows))
+	for _, row := range rows {
+		result[row.Version] = row
+	}
+	return result, nil
+}
+
+// Up applies every pending migration, each in its own transaction, and
+// returns the ones that ran.
+func Up(db *gorm.DB) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range All {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Down rolls back the most recently applied migrations, newest first.
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]Migration, len(All))
+	for _, m := range All {
+		byVersion[m.Version] = m
+	}
+	versions := make([]uint, 0, len(done))
+	for v := range done {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	var reverted []Migration
+	for _, v := range versions {
+		if len(reverted) == steps {
+			break
+		}
+		m, ok := byVersion[v]
+		if !ok {
+			return reverted, fmt.Errorf("migration %d is applied but unknown to this binary", v)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("rollback of %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+func GetStatus(db *gorm.DB) ([]Status, error) {
+	done, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Status, len(All))
+	for i, m := range All {
+		row, ok := done[m.Version]
+		result[i] = Status{Migration: m, Applied: ok, AppliedAt: row.AppliedAt}
+	}
+	return result, nil
+}
+
+// ErrNotMigrated is returned by Pending for databases without
+// schema_migrations, i.e. that were never migrated.
+var ErrNotMigrated = errors.New("database has no schema_migrations table (run `migrate up`)")
+
+// Pending returns the migrations known to this binary that the database
+// has not applied yet. Unlike Up and GetStatus it only reads, so it is safe
+// for probes and replicas that must not change the schema.
+func Pending(db *gorm.DB) ([]Migration, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return nil, ErrNotMigrated
+	}
+	var versions []uint
+	if err := db.Model(&SchemaMigration{}).Pluck("version", &versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	done := make(map[uint]bool, len(versions))
+	for _, v := range versions {
+		done[v] = true
+	}
+	known := make(map[uint]bool, len(All))
+	var pending []Migration
+	for _, m := range All {
+		known[m.Version] = true
+		if !done[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	for _, v := range versions {
+		if !known[v] {
+			return nil, fmt.Errorf("database has migration %d applied which this binary does not know; deploy a newer version", v)
+		}
+	}
+	return pending, nil
+}
+
+// EnsureCurrent returns an error unless the database has exactly the
+// migrations known to this binary applied. It never changes the schema.
+func EnsureCurrent(db *gorm.DB) error {
+	pending, err := Pending(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		names := make([]string, len(pending))
+		for i, m := range pending {
+			names[i] = fmt.Sprintf("%d_%s", m.Version, m.Name)
+		}
+		return fmt.Errorf("database schema is out of date, pending migrations: %v (run `migrate up`)", names)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TimescaleOptions configures the optional TimescaleDB storage mode.
+type TimescaleOptions struct {
+	// ChunkInterval is the hypertable chunk size, e.g. "7 days".
+	ChunkInterval string
+	// CompressAfterDays compresses chunks older than this; 0 disables
+	// compression. Keep it past the retention job's downsampling horizon,
+	// since rewriting compressed chunks needs TimescaleDB 2.11+ and is slow.
+	CompressAfterDays int
+	// Timezone sets the day boundary of the water_usage_daily aggregate.
+	// The view keeps the timezone it was created with; drop it to change it.
+	Timezone string
+}
+
+// EnableTimescale turns water_usages into a hypertable on recorded_at and sets
+// up the water_usage_hourly and water_usage_daily continuous aggregates and
+// chunk compression. Every step is skipped when already done, so it is safe
+// to run on each start. Usage series read the aggregates where their buckets
+// line up; the app's own hourly_usages and daily_usages rollups are kept for
+// notifications and reports.
+func EnableTimescale(db *gorm.DB, opts TimescaleOptions) error {
+	if db.Dialector.Name() != "postgres" {
+		return fmt.Errorf("timescale mode requires postgres, not %s", db.Dialector.Name())
+	}
+	if _, err := time.LoadLocation(opts.Timezone); err != nil || opts.Timezone == "" {
+		return fmt.Errorf("invalid timescale timezone: %q", opts.Timezone)
+	}
+
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb").Error; err != nil {
+		return fmt.Errorf("timescaledb extension is not available: %w", err)
+	}
+
+	var isHypertable bool
+	if err := db.Raw(`SELECT EXISTS (
+		SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'water_usages'
+	)`).Scan(&isHypertable).Error; err != nil {
+		return fmt.Errorf("failed to inspect hypertables: %w", err)
+	}
+	if !isHypertable {
+		if err := createUsageHypertable(db, opts.ChunkInterval); err != nil {
+			return err
+		}
+	}
+
+	if err := createUsageAggregates(db, opts.Timezone); err != nil {
+		return err
+	}
+
+	if opts.CompressAfterDays > 0 {
+		if err := enableUsageCompression(db, opts.CompressAfterDays); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createUsageHypertable converts water_usages in place. Unique constraints on
+// a hypertable must include the partitioning column, so the primary key
+// becomes (id, recorded_at).
+func createUsageHypertable(db *gorm.DB, chunkInterval string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE water_usages DROP CONSTRAINT IF EXISTS water_usages_pkey").Error; err != nil {
+			return fmt.Errorf("failed to drop water_usages primary key: %w", err)
+		}
+		if err := tx.Exec("ALTER TABLE water_usages ADD PRIMARY KEY (id, recorded_at)").Error; err != nil {
+			return fmt.Errorf("failed to add water_usages primary key: %w", err)
+		}
+		if err := tx.Exec(
+			"SELECT create_hypertable('water_usages', 'recorded_at', chunk_time_interval => CAST(? AS interval), migrate_data => true)",
+			chunkInterval,
+		).Error; err != nil {
+			return fmt.Errorf("failed to create hypertable: %w", err)
+		}
+		return nil
+	})
+}
+
+func createUsageAggregates(db *gorm.DB, timezone string) error {
+	// Bind parameters are not allowed in view definitions, so the already
+	// validated timezone is quoted inline.
+	tz := "'" + strings.ReplaceAll(timezone, "'", "''") + "'"
+
+	views := []struct {
+		name, bucket, startOffset, endOffset, schedule string
+	}{
+		{"water_usage_hourly", "time_bucket(INTERVAL '1 hour', recorded_at)", "3 days", "1 hour", "30 minutes"},
+		{"water_usage_daily", "time_bucket(INTERVAL '1 day', recorded_at, " + tz + ")", "7 days", "1 hour", "1 hour"},
+	}
+	for _, v := range views {
+		// Downsampled rows keep their peak in max_flow; raw ones in flow_rate.
+		if err := db.Exec(`
+			CREATE MATERIALIZED VIEW IF NOT EXISTS ` + v.name + `
+			WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+			SELECT device_id, ` + v.bucket + ` AS bucket,
+				SUM(total_usage) AS total_usage,
+				SUM(flow_rate * samples) AS flow_sum,
+				MAX(COALESCE(max_flow, flow_rate)) AS max_flow,
+				SUM(samples) AS samples
+			FROM water_usages
+			GROUP BY device_id, bucket
+			WITH NO DATA`,
+		).Error; err != nil {
+			return fmt.Errorf("failed to create %s: %w", v.name, err)
+		}
+
+		if err := db.Exec(`
+			SELECT add_continuous_aggregate_policy(?,
+				start_offset => CAST(? AS interval),
+				end_offset => CAST(? AS interval),
+				schedule_interval => CAST(? AS interval),
+				if_not_exists => true)`,
+			v.name, v.startOffset, v.endOffset, v.schedule,
+		).Error; err != nil {
+			return fmt.Errorf("failed to schedule refresh of %s: %w", v.name, err)
+		}
+	}
+	return nil
+}
+
+func enableUsageCompression(db *gorm.DB, afterDays int) error {
+	var enabled bool
+	if err := db.Raw(`SELECT compression_enabled FROM timescaledb_information.hypertables
+		WHERE hypertable_name = 'water_usages'`).Scan(&enabled).Error; err != nil {
+		return fmt.Errorf("failed to inspect compression: %w", err)
+	}
+
+	// The settings cannot be changed once chunks are compressed.
+	if !enabled {
+		if err := db.Exec(`ALTER TABLE water_usages SET (
+			timescaledb.compress,
+			timescaledb.compress_segmentby = 'device_id',
+			timescaledb.compress_orderby = 'recorded_at DESC'
+		)`).Error; err != nil {
+			return fmt.Errorf("failed to enable compression: %w", err)
+		}
+	}
+
+	if err := db.Exec(
+		"SELECT add_compression_policy('water_usages', compress_after => CAST(? AS interval), if_not_exists => true)",
+		fmt.Sprintf("%d days", afterDays),
+	).Error; err != nil {
+		return fmt.Errorf("failed to add compression policy: %w", err)
+	}
+	return nil
+}
@@ -7,20 +7,27 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
+// User is an account. TOTPSecret is set by a pending or enabled
+// authenticator app and TOTPEnabledAt marks it enabled; TOTPLastStep is the
+// last time step accepted, so a code cannot be replayed.
 type User struct {
-	ID           uint              `gorm:"primaryKey" json:"id"`
-	Email        string            `gorm:"unique" json:"email"`
-	Password     string            `json:"-"`
-	DisplayName  string            `json:"displayname"`
-	RefreshToken string            `json:"refresh_token,omitempty"`
-	Verified     bool              `gorm:"default:false" json:"verified"`
-	VerifyToken  string            `gorm:"default:null" json:"verify_token"`
-	Provider     string            `json:"provider"`
-	ProviderID   string            `json:"provider_id"`
-	CreatedAt    time.Time         `json:"created_at"`
-	Memberships  []UserGroupMember `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"` // Fixed
+	ID            uint              `gorm:"primaryKey" json:"id"`
+	Email         string            `gorm:"unique" json:"email"`
+	Password      string            `json:"-"`
+	DisplayName   string            `json:"displayname"`
+	Verified      bool              `gorm:"default:false" json:"verified"`
+	Provider      string            `json:"provider"`
+	ProviderID    string            `json:"provider_id"`
+	Timezone      string            `json:"timezone"`
+	Language      string            `json:"language"`
+	TOTPSecret    string            `json:"-"`
+	TOTPEnabledAt *time.Time        `json:"totp_enabled_at"`
+	TOTPLastStep  int64             `gorm:"not null;default:0" json:"-"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Memberships   []UserGroupMember `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"` // Fixed
 }
 
 type UserGroup struct {
@@ -28,7 +35,8 @@ type UserGroup struct {
 	Name      string            `gorm:"unique" json:"name"`
 	CreatedAt time.Time         `json:"created_at"`
 	Devices   []Device          `gorm:"foreignKey:UserGroupID;constraint:OnDelete:CASCADE"`
-	Location  JSONArray         `gorm:"type:jsonb" json:"location"`
+	Location  JSONArray         `json:"location"`
+	Timezone  string            `json:"timezone"`
 	Members   []UserGroupMember `gorm:"foreignKey:UserGroupID;constraint:OnDelete:CASCADE"` // Fixed
 }
 
@@ -60,6 +68,14 @@ type Device struct {
 	WaterUsages []WaterUsage `gorm:"foreignKey:DeviceID"`
 }
 
+// Resolutions of rows in water_usages. Raw readings are downsampled into
+// minute and then hour rows by the retention job.
+const (
+	ResolutionRaw    = "raw"
+	ResolutionMinute = "minute"
+	ResolutionHour   = "hour"
+)
+
 type WaterUsage struct {
 	ID         uint      `gorm:"primaryKey"`
 	DeviceID   string    `gorm:"index" json:"device_id"`
@@ -67,43 +83,286 @@ type WaterUsage struct {
 	FlowRate   float64   `json:"flow_rate"`
 	TotalUsage float64   `json:"total_usage"`
 	RecordedAt time.Time `gorm:"index" json:"recorded_at"`
+	Resolution string    `gorm:"size:10;default:raw" json:"-"`
+	Samples    int64     `gorm:"default:1" json:"-"`
+	// MaxFlow is the peak flow of a downsampled row. Raw readings leave it
+	// nil; their peak is FlowRate.
+	MaxFlow *float64 `json:"-"`
+}
+
+// PeakFlow is the highest flow rate the row stands for.
+func (u WaterUsage) PeakFlow() float64 {
+	if u.MaxFlow != nil {
+		return *u.MaxFlow
+	}
+	return u.FlowRate
+}
+
+// RetentionPolicy overrides the default retention for one group. Nil
+// fields inherit the server-wide default; 0 disables that stage.
+type RetentionPolicy struct {
+	UserGroupID uint      `gorm:"primaryKey" json:"user_group_id"`
+	UserGroup   UserGroup `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	RawDays     *int      `json:"raw_days"`
+	MinuteDays  *int      `json:"minute_days"`
+	MaxAgeDays  *int      `json:"max_age_days"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// JobRun records one execution of a scheduled job. ScheduledAt is the cron
+// tick a run was started for and is nil for manual runs; it is unique per
+// job so a tick runs at most once across replicas.
+type JobRun struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Job         string     `gorm:"size:100;not null;uniqueIndex:idx_job_runs_tick,priority:1;index:idx_job_runs_job_started,priority:1" json:"job"`
+	Trigger     string     `gorm:"size:20;not null" json:"trigger"`
+	ScheduledAt *time.Time `gorm:"uniqueIndex:idx_job_runs_tick,priority:2" json:"scheduled_at"`
+	StartedAt   time.Time  `gorm:"not null;index:idx_job_runs_job_started,priority:2" json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	Status      string     `gorm:"size:20;not null" json:"status"`
+	Error       string     `gorm:"type:text" json:"error"`
+	Instance    string     `gorm:"size:255" json:"instance"`
+}
+
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// QueueJob is a unit of background work. Queue is the prefix of Kind before
+// the first dot; workers claim due pending jobs per queue and retry failures
+// until they are dead.
+type QueueJob struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Queue      string     `gorm:"size:50;not null;index:idx_queue_jobs_claim,priority:1" json:"queue"`
+	Kind       string     `gorm:"size:100;not null" json:"kind"`
+	Payload    string     `gorm:"type:text;not null" json:"payload"`
+	Status     string     `gorm:"size:20;not null;index:idx_queue_jobs_claim,priority:2" json:"status"`
+	Attempts   int        `gorm:"not null;default:0" json:"attempts"`
+	RunAt      time.Time  `gorm:"not null;index:idx_queue_jobs_claim,priority:3" json:"run_at"`
+	LockedAt   *time.Time `json:"locked_at"`
+	LockedBy   string     `gorm:"size:255" json:"locked_by"`
+	LastError  string     `gorm:"type:text" json:"last_error"`
+	Result     string     `gorm:"type:text" json:"result"`
+	RequestID  string     `gorm:"size:64" json:"request_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+const (
+	QueuePending   = "pending"
+	QueueRunning   = "running"
+	QueueSucceeded = "succeeded"
+	QueueDead      = "dead"
+)
+
+// Session is one signed-in device of a user. Its refresh token carries the
+// current Generation; every refresh bumps it, so presenting an older token
+// means it was stolen or replayed and the session is revoked.
+type Session struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	User         User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	DeviceName   string     `gorm:"size:100" json:"device_name"`
+	IP           string     `gorm:"size:64" json:"ip"`
+	UserAgent    string     `gorm:"size:255" json:"user_agent"`
+	Generation   int        `gorm:"not null;default:0" json:"generation"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   time.Time  `gorm:"not null" json:"last_used_at"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	RevokeReason string     `gorm:"size:30" json:"revoke_reason"`
+}
+
+// Active reports whether s can still be used at now.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
 }
 
+// Reasons a session was revoked.
+const (
+	RevokedLogout        = "logout"
+	RevokedByUser        = "revoked"
+	RevokedEverywhere    = "logout_everywhere"
+	RevokedPasswordReset = "password_reset"
+	RevokedReuse         = "refresh_token_reuse"
+)
+
+// OneTimeCode is the outstanding code of one purpose for a user. Only an
+// HMAC of the code is stored. Issuing a new code overwrites the row, so
+// Attempts starts over while the resend bookkeeping (SentAt, WindowStart,
+// Sends) carries across codes.
+type OneTimeCode struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;uniqueIndex:idx_one_time_codes_user_purpose,priority:1" json:"user_id"`
+	User        User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Purpose     string     `gorm:"size:20;not null;uniqueIndex:idx_one_time_codes_user_purpose,priority:2" json:"purpose"`
+	CodeHash    string     `gorm:"size:64;not null" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	ConsumedAt  *time.Time `json:"consumed_at"`
+	SentAt      time.Time  `gorm:"not null" json:"sent_at"`
+	WindowStart time.Time  `gorm:"not null" json:"window_start"`
+	Sends       int        `gorm:"not null;default:0" json:"sends"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Purposes of one-time codes. A code only verifies for the purpose it was
+// issued for. CodeResetToken is not mailed: it is the token handed out in
+// exchange for a verified CodeReset.
+const (
+	CodeSignup      = "signup"
+	CodeLogin       = "login"
+	CodeReset       = "reset"
+	CodeEmailChange = "email_change"
+	CodeResetToken  = "reset_token"
+)
+
+// LoginChallenge is a password login waiting for its second step. The
+// challenge ID handed out is "<ID>.<secret>"; only a hash of the secret is
+// stored.
+type LoginChallenge struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	User        User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	SecretHash  string     `gorm:"size:64;not null" json:"-"`
+	DeviceName  string     `gorm:"size:100" json:"device_name"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TrustedDevice is a device that skips the second login step until
+// ExpiresAt. Like challenges, its token is "<ID>.<secret>".
+type TrustedDevice struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"not null;index" json:"user_id"`
+	User       User      `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	TokenHash  string    `gorm:"size:64;not null" json:"-"`
+	DeviceName string    `gorm:"size:100" json:"device_name"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `gorm:"not null" json:"last_used_at"`
+	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
+}
+
+// RecoveryCode completes a login in place of an authenticator app code, once.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	User      User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RateLimitBucket is a token bucket shared by every replica when rate limits
+// are kept in the database. Version guards concurrent updates; once FullAt
+// has passed the bucket is back to its capacity and the row can be dropped.
+type RateLimitBucket struct {
+	Key        string    `gorm:"primaryKey;size:300" json:"key"`
+	Tokens     float64   `gorm:"not null" json:"tokens"`
+	RefilledAt time.Time `gorm:"not null" json:"refilled_at"`
+	FullAt     time.Time `gorm:"not null;index" json:"full_at"`
+	Version    int       `gorm:"not null;default:0" json:"version"`
+}
+
+// Methods of completing a login challenge. Users with an authenticator app
+// use TOTP or a recovery code; everyone else gets an emailed CodeLogin.
+const (
+	TwoFactorEmail        = "email"
+	TwoFactorTOTP         = "totp"
+	TwoFactorRecoveryCode = "recovery_code"
+)
+
 type Notification struct {
-	ID        uint   `gorm:"primaryKey"`
-	DeviceID  string `gorm:"index"`
-	Device    Device `gorm:"foreignKey:DeviceID;references:ID"`
-	Message   string
-	Threshold float64
-	CreatedAt time.Time
+	ID       uint   `gorm:"primaryKey"`
+	DeviceID string `gorm:"index"`
+	Device   Device `gorm:"foreignKey:DeviceID;references:ID"`
+	// MessageKey is the i18n key of the message, rendered with Threshold in
+	// the reader's language. Message holds the text of rows written before
+	// keys were stored.
+	MessageKey string `gorm:"size:100"`
+	Message    string
+	Threshold  float64
+	CreatedAt  time.Time
+}
+
+// HourlyUsage is the per-device rollup of water_usages for one UTC-aligned
+// hour. FlowSum / Samples gives the average flow rate.
+type HourlyUsage struct {
+	DeviceID   string    `gorm:"primaryKey" json:"device_id"`
+	Device     Device    `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Hour       time.Time `gorm:"primaryKey" json:"hour"`
+	TotalUsage float64   `json:"total_usage"`
+	FlowSum    float64   `json:"flow_sum"`
+	MaxFlow    float64   `json:"max_flow"`
+	Samples    int64     `json:"samples"`
 }
 
+func (h HourlyUsage) AvgFlow() float64 {
+	if h.Samples == 0 {
+		return 0
+	}
+	return h.FlowSum / float64(h.Samples)
+}
+
+// DailyUsage is the per-device rollup for one calendar day in the device's
+// group timezone.
 type DailyUsage struct {
 	ID         uint      `gorm:"primaryKey"`
-	DeviceID   string    `gorm:"foreignKey:DeviceID;references:ID;constraint:OnDelete:CASCADE"`
-	Date       time.Time `gorm:"type:date"`
+	DeviceID   string    `gorm:"uniqueIndex:idx_daily_usages_device_date"`
+	Device     Device    `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Date       time.Time `gorm:"type:date;uniqueIndex:idx_daily_usages_device_date"`
 	TotalUsage float64
+	FlowSum    float64
+	MaxFlow    float64
+	Samples    int64
 	Notified   bool `gorm:"default:false"`
 }
 
+func (d DailyUsage) AvgFlow() float64 {
+	if d.Samples == 0 {
+		return 0
+	}
+	return d.FlowSum / float64(d.Samples)
+}
+
 type JSONArray []string
 
+// GormDBDataType stores the array as jsonb on Postgres and as plain JSON
+// text elsewhere.
+func (JSONArray) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "jsonb"
+	}
+	return "text"
+}
+
 func (j *JSONArray) Scan(value interface{}) error {
-	if value == nil {
+	switch v := value.(type) {
+	case nil:
 		*j = JSONArray{}
 		return nil
-	}
-
-	bytes, ok := value.([]byte)
-	if !ok {
+	case []byte:
+		return json.Unmarshal(v, j)
+	case string:
+		return json.Unmarshal([]byte(v), j)
+	default:
 		return fmt.Errorf("invalid type assertion")
 	}
-	return json.Unmarshal(bytes, j)
 }
 
 func (j JSONArray) Value() (driver.Value, error) {
 	if j == nil {
 		return "[]", nil
 	}
-	return json.Marshal(j)
+	b, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
 }
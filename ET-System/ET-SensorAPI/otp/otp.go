@@ -0,0 +1,220 @@
+// Package otp issues and checks the one-time codes mailed to users. Codes
+// are bound to a user and a purpose, stored as an HMAC, expire after
+// OTPConfig.TTL and lock after OTPConfig.MaxAttempts wrong guesses. Sending
+// is throttled per user and purpose. The package also checks the codes of
+// authenticator apps (TOTP) and the recovery codes that stand in for them.
+package otp
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	codeLength = 6
+	codeChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var (
+	ErrInvalid = errors.New("invalid or expired code")
+	ErrLocked  = errors.New("too many wrong attempts, please request a new code")
+	// ErrInvalidToken is returned by VerifyToken for unknown, used, locked
+	// or expired tokens.
+	ErrInvalidToken = errors.New("invalid or expired token")
+)
+
+// ThrottledError is returned by Issue when a code was sent too recently or
+// too often.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("please wait %s before requesting another code", e.RetryAfter.Round(time.Second))
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+// Issue replaces the user's code for purpose with a fresh one and returns
+// it for mailing. Call it in the transaction that queues the mail.
+func Issue(ctx context.Context, cfg *config.Config, codes repository.OneTimeCodeRepo, userID uint, purpose string) (string, error) {
+	t := now().UTC()
+	row, err := codes.Get(ctx, userID, purpose)
+	if errors.Is(err, repository.ErrNotFound) {
+		row = &models.OneTimeCode{UserID: userID, Purpose: purpose, WindowStart: t}
+	} else if err != nil {
+		return "", err
+	}
+
+	if row.Sends > 0 {
+		if wait := row.SentAt.Add(cfg.OTP.ResendInterval).Sub(t); wait > 0 {
+			return "", &ThrottledError{RetryAfter: wait}
+		}
+	}
+	if windowEnd := row.WindowStart.Add(time.Hour); !t.Before(windowEnd) {
+		row.WindowStart = t
+		row.Sends = 0
+	} else if row.Sends >= cfg.OTP.MaxSendsPerHour {
+		return "", &ThrottledError{RetryAfter: windowEnd.Sub(t)}
+	}
+
+	code, err := generate()
+	if err != nil {
+		return "", err
+	}
+	row.CodeHash = hash(cfg.Auth.JWTSecret, userID, purpose, code)
+	row.ExpiresAt = t.Add(cfg.OTP.TTL)
+	row.Attempts = 0
+	row.ConsumedAt = nil
+	row.SentAt = t
+	row.Sends++
+	if err := codes.Save(ctx, row); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Verify consumes the user's code if it matches an outstanding code of one
+// of purposes and returns that purpose. A wrong code counts as an attempt
+// against every outstanding candidate; ErrLocked is returned once they are
+// all used up. Do not run it inside a transaction that rolls back on
+// failure, or wrong guesses would not be counted.
+func Verify(ctx context.Context, cfg *config.Config, codes repository.OneTimeCodeRepo, userID uint, code string, purposes ...string) (string, error) {
+	t := now().UTC()
+	var candidates []*models.OneTimeCode
+	locked := false
+	for _, purpose := range purposes {
+		row, err := codes.Get(ctx, userID, purpose)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if row.ConsumedAt != nil || !t.Before(row.ExpiresAt) {
+			continue
+		}
+		if row.Attempts >= cfg.OTP.MaxAttempts {
+			locked = true
+			continue
+		}
+
+		if hmac.Equal([]byte(row.CodeHash), []byte(hash(cfg.Auth.JWTSecret, userID, purpose, code))) {
+			ok, err := codes.Consume(ctx, row.ID, t)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "", ErrInvalid
+			}
+			return purpose, nil
+		}
+		candidates = append(candidates, row)
+	}
+
+	open := false
+	for _, row := range candidates {
+		if err := codes.RecordFailure(ctx, row.ID); err != nil {
+			return "", err
+		}
+		if row.Attempts+1 < cfg.OTP.MaxAttempts {
+			open = true
+		} else {
+			locked = true
+		}
+	}
+	if locked && !open {
+		return "", ErrLocked
+	}
+	return "", ErrInvalid
+}
+
+// IssueToken replaces the user's token for purpose with a random one that
+// is valid for ttl. Tokens are returned to the caller rather than mailed, so
+// they are not throttled; they embed the user ID for VerifyToken.
+func IssueToken(ctx context.Context, cfg *config.Config, codes repository.OneTimeCodeRepo, userID uint, purpose string, ttl time.Duration) (string, time.Time, error) {
+	t := now().UTC()
+	row, err := codes.Get(ctx, userID, purpose)
+	if errors.Is(err, repository.ErrNotFound) {
+		row = &models.OneTimeCode{UserID: userID, Purpose: purpose}
+	} else if err != nil {
+		return "", time.Time{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	row.CodeHash = hash(cfg.Auth.JWTSecret, userID, purpose, token)
+	row.ExpiresAt = t.Add(ttl)
+	row.Attempts = 0
+	row.ConsumedAt = nil
+	row.SentAt = t
+	row.WindowStart = t
+	row.Sends = 1
+	if err := codes.Save(ctx, row); err != nil {
+		return "", time.Time{}, err
+	}
+	return strconv.FormatUint(uint64(userID), 10) + "." + token, row.ExpiresAt, nil
+}
+
+// VerifyToken consumes a token from IssueToken and returns its user.
+func VerifyToken(ctx context.Context, cfg *config.Config, codes repository.OneTimeCodeRepo, token, purpose string) (uint, error) {
+	id, secret, ok := strings.Cut(token, ".")
+	userID, err := strconv.ParseUint(id, 10, 0)
+	if !ok || err != nil || secret == "" {
+		return 0, ErrInvalidToken
+	}
+	if _, err := Verify(ctx, cfg, codes, uint(userID), secret, purpose); err != nil {
+		if errors.Is(err, ErrInvalid) || errors.Is(err, ErrLocked) {
+			return 0, ErrInvalidToken
+		}
+		return 0, err
+	}
+	return uint(userID), nil
+}
+
+// generate returns a random code of codeLength letters and digits.
+func generate() (string, error) {
+	code := make([]byte, codeLength)
+	for i := range code {
+		n, err := randIndex(len(codeChars))
+		if err != nil {
+			return "", err
+		}
+		code[i] = codeChars[n]
+	}
+	return string(code), nil
+}
+
+// randIndex returns a uniformly random index below n.
+func randIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+// hash binds code to its user and purpose so a stored hash cannot be
+// replayed for another account or flow.
+func hash(secret string, userID uint, purpose, code string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatUint(uint64(userID), 10) + "|" + purpose + "|" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
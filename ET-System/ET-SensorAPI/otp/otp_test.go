@@ -0,0 +1,145 @@
+package otp
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memoryCodes is an in-memory OneTimeCodeRepo.
+type memoryCodes struct {
+	rows []models.OneTimeCode
+}
+
+func (m *memoryCodes) Get(_ context.Context, userID uint, purpose string) (*models.OneTimeCode, error) {
+	for _, row := range m.rows {
+		if row.UserID == userID && row.Purpose == purpose {
+			return &row, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (m *memoryCodes) Save(_ context.Context, code *models.OneTimeCode) error {
+	if code.ID == 0 {
+		code.ID = uint(len(m.rows) + 1)
+		m.rows = append(m.rows, *code)
+		return nil
+	}
+	m.rows[code.ID-1] = *code
+	return nil
+}
+
+func (m *memoryCodes) RecordFailure(_ context.Context, id uint) error {
+	m.rows[id-1].Attempts++
+	return nil
+}
+
+func (m *memoryCodes) Consume(_ context.Context, id uint, now time.Time) (bool, error) {
+	if m.rows[id-1].ConsumedAt != nil {
+		return false, nil
+	}
+	m.rows[id-1].ConsumedAt = &now
+	return true, nil
+}
+
+func (m *memoryCodes) Delete(context.Context, uint, ...string) error {
+	return nil
+}
+
+func setup(t *testing.T) (*config.Config, *memoryCodes, *time.Time) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "otp-test"
+	clock := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	t.Cleanup(func() { now = time.Now })
+	return cfg, &memoryCodes{}, &clock
+}
+
+func TestVerifyConsumesOnce(t *testing.T) {
+	cfg, codes, _ := setup(t)
+	ctx := context.Background()
+
+	code, err := Issue(ctx, cfg, codes, 1, models.CodeSignup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes.rows[0].CodeHash == code {
+		t.Fatal("the code must not be stored in plain text")
+	}
+	if _, err := Verify(ctx, cfg, codes, 2, code, models.CodeSignup); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("another user's code should not verify, got %v", err)
+	}
+	if _, err := Verify(ctx, cfg, codes, 1, code, models.CodeLogin, models.CodeReset); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("a signup code should not verify a login, got %v", err)
+	}
+	purpose, err := Verify(ctx, cfg, codes, 1, code, models.CodeLogin, models.CodeSignup)
+	if err != nil || purpose != models.CodeSignup {
+		t.Fatalf("expected the signup code to verify, got %q, %v", purpose, err)
+	}
+	if _, err := Verify(ctx, cfg, codes, 1, code, models.CodeSignup); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("a used code should not verify again, got %v", err)
+	}
+}
+
+func TestVerifyExpiresAndLocks(t *testing.T) {
+	cfg, codes, clock := setup(t)
+	ctx := context.Background()
+
+	code, _ := Issue(ctx, cfg, codes, 1, models.CodeLogin)
+	*clock = clock.Add(cfg.OTP.TTL)
+	if _, err := Verify(ctx, cfg, codes, 1, code, models.CodeLogin); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("an expired code should not verify, got %v", err)
+	}
+
+	*clock = clock.Add(cfg.OTP.ResendInterval)
+	code, _ = Issue(ctx, cfg, codes, 1, models.CodeLogin)
+	for i := 1; i <= cfg.OTP.MaxAttempts; i++ {
+		want := ErrInvalid
+		if i == cfg.OTP.MaxAttempts {
+			want = ErrLocked
+		}
+		if _, err := Verify(ctx, cfg, codes, 1, "wrong!", models.CodeLogin); !errors.Is(err, want) {
+			t.Fatalf("attempt %d: expected %v, got %v", i, want, err)
+		}
+	}
+	if _, err := Verify(ctx, cfg, codes, 1, code, models.CodeLogin); !errors.Is(err, ErrLocked) {
+		t.Fatalf("the right code should not verify once locked, got %v", err)
+	}
+}
+
+func TestIssueThrottles(t *testing.T) {
+	cfg, codes, clock := setup(t)
+	ctx := context.Background()
+
+	if _, err := Issue(ctx, cfg, codes, 1, models.CodeReset); err != nil {
+		t.Fatal(err)
+	}
+	var throttled *ThrottledError
+	if _, err := Issue(ctx, cfg, codes, 1, models.CodeReset); !errors.As(err, &throttled) || throttled.RetryAfter != cfg.OTP.ResendInterval {
+		t.Fatalf("expected to wait %s, got %v", cfg.OTP.ResendInterval, err)
+	}
+	if _, err := Issue(ctx, cfg, codes, 1, models.CodeLogin); err != nil {
+		t.Fatalf("other purposes are throttled separately, got %v", err)
+	}
+
+	for i := 1; i < cfg.OTP.MaxSendsPerHour; i++ {
+		*clock = clock.Add(cfg.OTP.ResendInterval)
+		if _, err := Issue(ctx, cfg, codes, 1, models.CodeReset); err != nil {
+			t.Fatalf("send %d: %v", i+1, err)
+		}
+	}
+	*clock = clock.Add(cfg.OTP.ResendInterval)
+	if _, err := Issue(ctx, cfg, codes, 1, models.CodeReset); !errors.As(err, &throttled) {
+		t.Fatalf("expected the hourly limit, got %v", err)
+	}
+
+	*clock = clock.Add(time.Hour)
+	if _, err := Issue(ctx, cfg, codes, 1, models.CodeReset); err != nil {
+		t.Fatalf("the limit should reset after an hour, got %v", err)
+	}
+}
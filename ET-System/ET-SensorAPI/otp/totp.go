@@ -0,0 +1,123 @@
+package otp
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/repository"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP codes follow RFC 6238 with the parameters every authenticator app
+// defaults to: HMAC-SHA1, six digits and 30 second steps.
+const (
+	totpDigits = 6
+	totpStep   = 30
+	// totpSkew is how many steps a code may be off to allow for clock drift.
+	totpSkew = 1
+
+	recoveryCodeGroup = 5
+	recoveryChars     = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryPurpose   = "recovery"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret returns a random base32 secret for an authenticator app.
+func NewTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps scan.
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{"secret": {secret}, "issuer": {issuer}}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// GenerateTOTP returns the code an authenticator app shows for secret at t.
+func GenerateTOTP(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, t.Unix()/totpStep), nil
+}
+
+// ValidateTOTP reports whether code is valid for secret at t and returns the
+// time step it belongs to, so callers can refuse to accept a step twice.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	code = strings.ReplaceAll(code, " ", "")
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := t.Unix() / totpStep
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode is the RFC 4226 HOTP value of key for counter step.
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// IssueRecoveryCodes replaces the user's recovery codes with
+// TwoFactorConfig.RecoveryCodes new ones and returns them for display; only
+// their HMACs are kept.
+func IssueRecoveryCodes(ctx context.Context, cfg *config.Config, store repository.TwoFactorRepo, userID uint) ([]string, error) {
+	codes := make([]string, cfg.TwoFactor.RecoveryCodes)
+	hashes := make([]string, len(codes))
+	for i := range codes {
+		raw := make([]byte, 2*recoveryCodeGroup)
+		for j := range raw {
+			n, err := randIndex(len(recoveryChars))
+			if err != nil {
+				return nil, err
+			}
+			raw[j] = recoveryChars[n]
+		}
+		codes[i] = string(raw[:recoveryCodeGroup]) + "-" + string(raw[recoveryCodeGroup:])
+		hashes[i] = hash(cfg.Auth.JWTSecret, userID, recoveryPurpose, string(raw))
+	}
+	if err := store.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes, ignoring case
+// and separators. It returns ErrInvalid for unknown or used codes.
+func UseRecoveryCode(ctx context.Context, cfg *config.Config, store repository.TwoFactorRepo, userID uint, code string) error {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	ok, err := store.UseRecoveryCode(ctx, userID, hash(cfg.Auth.JWTSecret, userID, recoveryPurpose, normalized), now().UTC())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalid
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package otp
+
+import (
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		at := time.Unix(tc.unix, 0)
+		if code, _ := GenerateTOTP(rfcSecret, at); code != tc.code {
+			t.Errorf("%d: expected %s, generated %s", tc.unix, tc.code, code)
+		}
+		step, ok := ValidateTOTP(rfcSecret, tc.code, at)
+		if !ok || step != tc.unix/30 {
+			t.Errorf("%d: expected %s to be valid for step %d, got %d, %v", tc.unix, tc.code, tc.unix/30, step, ok)
+		}
+		if _, ok := ValidateTOTP(rfcSecret, tc.code, at.Add(2*time.Minute)); ok {
+			t.Errorf("%d: a code should not be valid two minutes later", tc.unix)
+		}
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "28708", time.Unix(59, 0)); ok {
+		t.Error("a short code should not be valid")
+	}
+	if _, ok := ValidateTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("a broken secret should not validate anything")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("EcoTrack", "ana@ecotrack.test", "ABC")
+	if uri != "otpauth://totp/EcoTrack:ana@ecotrack.test?issuer=EcoTrack&secret=ABC" {
+		t.Fatalf("unexpected URI %s", uri)
+	}
+}
+
+// memoryRecovery is an in-memory TwoFactorRepo that only keeps recovery
+// codes.
+type memoryRecovery struct {
+	repository.TwoFactorRepo
+	codes []models.RecoveryCode
+}
+
+func (m *memoryRecovery) ReplaceRecoveryCodes(_ context.Context, userID uint, hashes []string) error {
+	m.codes = nil
+	for _, h := range hashes {
+		m.codes = append(m.codes, models.RecoveryCode{UserID: userID, CodeHash: h})
+	}
+	return nil
+}
+
+func (m *memoryRecovery) UseRecoveryCode(_ context.Context, userID uint, hash string, now time.Time) (bool, error) {
+	for i, code := range m.codes {
+		if code.UserID == userID && code.CodeHash == hash && code.UsedAt == nil {
+			m.codes[i].UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	cfg, _, _ := setup(t)
+	ctx := context.Background()
+	store := &memoryRecovery{}
+
+	codes, err := IssueRecoveryCodes(ctx, cfg, store, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != cfg.TwoFactor.RecoveryCodes || len(store.codes) != len(codes) {
+		t.Fatalf("expected %d codes, got %d", cfg.TwoFactor.RecoveryCodes, len(codes))
+	}
+	if err := UseRecoveryCode(ctx, cfg, store, 2, codes[0]); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("another user's code should not work, got %v", err)
+	}
+	if err := UseRecoveryCode(ctx, cfg, store, 1, " "+strings.ToUpper(codes[0])); err != nil {
+		t.Fatalf("codes should be accepted regardless of case and spacing, got %v", err)
+	}
+	if err := UseRecoveryCode(ctx, cfg, store, 1, codes[0]); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("a used code should not work again, got %v", err)
+	}
+}
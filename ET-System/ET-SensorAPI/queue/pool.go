@@ -0,0 +1,327 @@
+package queue
+
+import (
+	"ET-SensorAPI/logging"
+	"ET-SensorAPI/metrics"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Options struct {
+	// Concurrency is the number of workers per queue. Queues missing here
+	// are not worked on by Start, only by Drain.
+	Concurrency  map[string]int
+	PollInterval time.Duration
+	// MaxAttempts is how often a job is tried before it is dead.
+	MaxAttempts int
+	// RetryBase is the delay after the first failure; it doubles with every
+	// further attempt up to RetryMax.
+	RetryBase time.Duration
+	RetryMax  time.Duration
+	// LockTimeout bounds one attempt. A job still running after it, say
+	// because its worker died, is claimed again.
+	LockTimeout time.Duration
+}
+
+// Scrubber rewrites the payload of a job once it succeeded or died, e.g. to
+// drop secrets that are only needed while the job may still run.
+type Scrubber func(payload []byte) ([]byte, error)
+
+type Pool struct {
+	repo      repository.QueueRepo
+	opts      Options
+	handlers  map[string]Handler
+	scrubbers map[string]Scrubber
+	instance  string
+	now       func() time.Time
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+	wg         sync.WaitGroup
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	exited  []string
+}
+
+func NewPool(repo repository.QueueRepo, opts Options) *Pool {
+	host, _ := os.Hostname()
+	p := &Pool{
+		repo:      repo,
+		opts:      opts,
+		handlers:  map[string]Handler{},
+		scrubbers: map[string]Scrubber{},
+		instance:  fmt.Sprintf("%s:%d", host, os.Getpid()),
+		now:       time.Now,
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.jobsCtx, p.cancelJobs = context.WithCancel(context.Background())
+	return p
+}
+
+// Register sets the handler for jobs of kind. It must be called before
+// Start.
+func (p *Pool) Register(kind string, h Handler) {
+	p.handlers[kind] = h
+}
+
+// Scrub sets the scrubber applied to jobs of kind once they are finished.
+// It must be called before Start.
+func (p *Pool) Scrub(kind string, s Scrubber) {
+	p.scrubbers[kind] = s
+}
+
+// Start launches the workers of every queue in Options.Concurrency. They
+// stop claiming jobs when ctx is cancelled or Stop is called.
+func (p *Pool) Start(ctx context.Context) {
+	p.mu.Lock()
+	p.started = true
+	p.mu.Unlock()
+	context.AfterFunc(ctx, p.cancel)
+
+	for _, queue := range p.queues() {
+		for i := 0; i < p.opts.Concurrency[queue]; i++ {
+			p.wg.Add(1)
+			go p.work(queue, fmt.Sprintf("%s/%s-%d", p.instance, queue, i))
+		}
+	}
+}
+
+func (p *Pool) queues() []string {
+	queues := make([]string, 0, len(p.opts.Concurrency))
+	for queue := range p.opts.Concurrency {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+func (p *Pool) work(queue, worker string) {
+	defer p.wg.Done()
+	defer func() {
+		p.mu.Lock()
+		p.exited = append(p.exited, worker)
+		p.mu.Unlock()
+	}()
+
+	for p.ctx.Err() == nil {
+		worked, err := p.process(p.ctx, queue, worker)
+		if err != nil && p.ctx.Err() == nil {
+			slog.Error("failed to claim queue job", "queue", queue, "error", err)
+		}
+		if worked && err == nil {
+			continue
+		}
+
+		timer := time.NewTimer(p.opts.PollInterval)
+		select {
+		case <-p.ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Drain runs every job that is due on any queue with a registered handler,
+// one at a time, until none is left, and returns how many it ran. Jobs
+// retried into the future are left alone. It is meant for tests and
+// one-off commands; servers use Start.
+func (p *Pool) Drain(ctx context.Context) (int, error) {
+	seen := map[string]bool{}
+	var queues []string
+	for kind := range p.handlers {
+		if queue := QueueOf(kind); !seen[queue] {
+			seen[queue] = true
+			queues = append(queues, queue)
+		}
+	}
+	sort.Strings(queues)
+
+	ran := 0
+	for {
+		progress := false
+		for _, queue := range queues {
+			worked, err := p.process(ctx, queue, p.instance+"/drain")
+			if err != nil {
+				return ran, err
+			}
+			if worked {
+				ran++
+				progress = true
+			}
+		}
+		if !progress {
+			return ran, nil
+		}
+	}
+}
+
+// process claims and runs one job of queue and reports whether there was
+// one.
+func (p *Pool) process(ctx context.Context, queue, worker string) (bool, error) {
+	now := p.now().UTC()
+	job, err := p.repo.Claim(ctx, queue, worker, now, now.Add(-p.opts.LockTimeout))
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	p.run(job)
+	return true, nil
+}
+
+// run executes one attempt of job and stores the outcome. Attempts are not
+// tied to the worker's context so that Stop lets them finish; Stop cancels
+// them only once its own deadline passes.
+func (p *Pool) run(job *models.QueueJob) {
+	ctx := p.jobsCtx
+	if job.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, job.RequestID)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.opts.LockTimeout)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "queue "+job.Kind, trace.WithAttributes(
+		attribute.Int64("queue.job_id", int64(job.ID)),
+		attribute.Int("queue.attempt", job.Attempts),
+	))
+
+	start := p.now()
+	result, err := p.call(ctx, job)
+	tracing.End(span, err)
+
+	finished := p.now().UTC()
+	worker, attempt := job.LockedBy, job.Attempts
+	outcome := models.QueueSucceeded
+	switch {
+	case err == nil:
+		job.Status = models.QueueSucceeded
+		job.Result = result
+		job.LastError = ""
+		job.FinishedAt = &finished
+	case errors.Is(err, ErrNoHandler) || job.Attempts >= p.opts.MaxAttempts:
+		outcome = models.QueueDead
+		job.Status = models.QueueDead
+		job.LastError = err.Error()
+		job.FinishedAt = &finished
+		slog.ErrorContext(ctx, "queue job dead", "job_id", job.ID, "kind", job.Kind, "attempts", job.Attempts, "error", err)
+	default:
+		outcome = "retried"
+		job.Status = models.QueuePending
+		job.LastError = err.Error()
+		job.RunAt = finished.Add(p.backoff(job.Attempts))
+		slog.WarnContext(ctx, "queue job failed, retrying", "job_id", job.ID, "kind", job.Kind,
+			"attempts", job.Attempts, "retry_at", job.RunAt, "error", err)
+	}
+	job.LockedAt = nil
+	job.LockedBy = ""
+	if job.Status != models.QueuePending {
+		p.scrub(ctx, job)
+	}
+	metrics.ObserveQueueJob(job.Queue, job.Kind, outcome, start)
+
+	stored, err := p.repo.Complete(context.WithoutCancel(ctx), job, worker, attempt)
+	switch {
+	case err != nil:
+		slog.ErrorContext(ctx, "failed to record queue job", "job_id", job.ID, "kind", job.Kind, "error", err)
+	case !stored:
+		// The lock timed out and another worker owns the job now; its
+		// outcome is the one that counts.
+		slog.WarnContext(ctx, "queue job was claimed again, dropping outcome", "job_id", job.ID, "kind", job.Kind,
+			"attempts", attempt, "outcome", outcome)
+	}
+}
+
+// call runs the handler of job, turning a panic into an error.
+func (p *Pool) call(ctx context.Context, job *models.QueueJob) (result string, err error) {
+	handler, ok := p.handlers[job.Kind]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNoHandler, job.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, []byte(job.Payload))
+}
+
+// scrub applies the scrubber of job's kind to its payload. A payload that
+// cannot be scrubbed is dropped altogether.
+func (p *Pool) scrub(ctx context.Context, job *models.QueueJob) {
+	scrubber, ok := p.scrubbers[job.Kind]
+	if !ok {
+		return
+	}
+	payload, err := scrubber([]byte(job.Payload))
+	if err != nil {
+		slog.WarnContext(ctx, "failed to scrub queue job payload", "job_id", job.ID, "kind", job.Kind, "error", err)
+		payload = []byte("{}")
+	}
+	job.Payload = string(payload)
+}
+
+// backoff is the delay before attempt+1: RetryBase doubled per attempt
+// after the first, capped at RetryMax.
+func (p *Pool) backoff(attempt int) time.Duration {
+	delay := p.opts.RetryBase
+	for i := 1; i < attempt && delay < p.opts.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, p.opts.RetryMax)
+}
+
+// Stop stops claiming jobs and waits for running attempts to finish. When
+// ctx expires first the attempts are cancelled, which schedules a retry.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.cancelJobs()
+		return fmt.Errorf("queue jobs still running: %w", ctx.Err())
+	}
+}
+
+// Alive reports an error when the pool was never started, has been
+// stopped, or a worker has exited.
+func (p *Pool) Alive() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case p.stopped:
+		return errors.New("queue stopped")
+	case !p.started:
+		return errors.New("queue not started")
+	case len(p.exited) > 0:
+		return fmt.Errorf("queue worker %s is not running", p.exited[0])
+	}
+	return nil
+}
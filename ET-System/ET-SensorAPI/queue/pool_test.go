@@ -0,0 +1,265 @@
+package queue
+
+import (
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryQueue is an in-memory QueueRepo.
+type memoryQueue struct {
+	mu   sync.Mutex
+	jobs []models.QueueJob
+}
+
+func (m *memoryQueue) Enqueue(_ context.Context, job *models.QueueJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.ID = uint(len(m.jobs) + 1)
+	m.jobs = append(m.jobs, *job)
+	return nil
+}
+
+func (m *memoryQueue) Claim(_ context.Context, queue, worker string, now, staleBefore time.Time) (*models.QueueJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.jobs {
+		job := &m.jobs[i]
+		due := job.Status == models.QueuePending && !job.RunAt.After(now)
+		stale := job.Status == models.QueueRunning && job.LockedAt.Before(staleBefore)
+		if job.Queue == queue && (due || stale) {
+			job.Status = models.QueueRunning
+			job.Attempts++
+			job.LockedAt = &now
+			job.LockedBy = worker
+			claimed := *job
+			return &claimed, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (m *memoryQueue) Save(_ context.Context, job *models.QueueJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID-1] = *job
+	return nil
+}
+
+func (m *memoryQueue) Complete(_ context.Context, job *models.QueueJob, worker string, attempt int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.jobs[job.ID-1]
+	if current.Status != models.QueueRunning || current.LockedBy != worker || current.Attempts != attempt {
+		return false, nil
+	}
+	m.jobs[job.ID-1] = *job
+	return true, nil
+}
+
+func (m *memoryQueue) GetByID(_ context.Context, id uint) (*models.QueueJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == 0 || int(id) > len(m.jobs) {
+		return nil, repository.ErrNotFound
+	}
+	job := m.jobs[id-1]
+	return &job, nil
+}
+
+func (m *memoryQueue) List(context.Context, string, string, int) ([]models.QueueJob, error) {
+	return nil, nil
+}
+
+func (m *memoryQueue) PurgeFinished(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func testPool(repo *memoryQueue, clock *time.Time) *Pool {
+	p := NewPool(repo, Options{
+		Concurrency:  map[string]int{"email": 1},
+		PollInterval: 5 * time.Millisecond,
+		MaxAttempts:  3,
+		RetryBase:    time.Second,
+		RetryMax:     90 * time.Second,
+		LockTimeout:  time.Minute,
+	})
+	p.now = func() time.Time { return *clock }
+	return p
+}
+
+func TestEnqueueDerivesQueueFromKind(t *testing.T) {
+	repo := &memoryQueue{}
+	job, err := Enqueue(context.Background(), repo, "email.invitation", map[string]string{"to": "a@b.c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Queue != "email" || job.Status != models.QueuePending || job.Payload != `{"to":"a@b.c"}` {
+		t.Fatalf("unexpected job %+v", job)
+	}
+}
+
+func TestFailingJobIsRetriedWithBackoffUntilDead(t *testing.T) {
+	repo := &memoryQueue{}
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := testPool(repo, &clock)
+	calls := 0
+	p.Register("email.flaky", func(context.Context, []byte) (string, error) {
+		calls++
+		return "", errors.New("smtp down")
+	})
+	job, _ := Enqueue(context.Background(), repo, "email.flaky", nil)
+	job.RunAt = clock
+	repo.Save(context.Background(), job)
+
+	for attempt, wantDelay := range []time.Duration{time.Second, 2 * time.Second} {
+		if ran, err := p.Drain(context.Background()); err != nil || ran != 1 {
+			t.Fatalf("attempt %d: ran %d, %v", attempt+1, ran, err)
+		}
+		got, _ := repo.GetByID(context.Background(), job.ID)
+		if got.Status != models.QueuePending || got.LastError != "smtp down" || !got.RunAt.Equal(clock.Add(wantDelay)) {
+			t.Fatalf("attempt %d: unexpected job %+v", attempt+1, got)
+		}
+		if ran, _ := p.Drain(context.Background()); ran != 0 {
+			t.Fatalf("attempt %d: job ran again before its backoff", attempt+1)
+		}
+		clock = got.RunAt
+	}
+
+	p.Drain(context.Background())
+	got, _ := repo.GetByID(context.Background(), job.ID)
+	if got.Status != models.QueueDead || got.Attempts != 3 || got.FinishedAt == nil || calls != 3 {
+		t.Fatalf("expected the job to be dead after 3 attempts, got %+v (%d calls)", got, calls)
+	}
+
+	if _, err := Retry(context.Background(), repo, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = repo.GetByID(context.Background(), job.ID)
+	if got.Status != models.QueuePending || got.Attempts != 0 {
+		t.Fatalf("retry should reset the job, got %+v", got)
+	}
+	if _, err := Retry(context.Background(), repo, job.ID); !errors.Is(err, ErrNotDead) {
+		t.Fatalf("expected ErrNotDead, got %v", err)
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	clock := time.Now()
+	p := testPool(&memoryQueue{}, &clock)
+	for attempt, want := range map[int]time.Duration{1: time.Second, 4: 8 * time.Second, 7: 64 * time.Second, 8: 90 * time.Second, 40: 90 * time.Second} {
+		if got := p.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestJobWithoutHandlerIsDead(t *testing.T) {
+	repo := &memoryQueue{}
+	clock := time.Now()
+	p := testPool(repo, &clock)
+	p.Register("email.known", func(context.Context, []byte) (string, error) { return "", nil })
+	job, _ := Enqueue(context.Background(), repo, "email.unknown", nil)
+	job.RunAt = clock
+	repo.Save(context.Background(), job)
+
+	p.Drain(context.Background())
+	if got, _ := repo.GetByID(context.Background(), job.ID); got.Status != models.QueueDead || got.Attempts != 1 {
+		t.Fatalf("expected a dead job after one attempt, got %+v", got)
+	}
+}
+
+func TestOutcomeOfReclaimedJobIsDropped(t *testing.T) {
+	repo := &memoryQueue{}
+	clock := time.Now()
+	p := testPool(repo, &clock)
+	p.Register("email.slow", func(context.Context, []byte) (string, error) {
+		// The attempt outlives its lock and another worker claims the job.
+		clock = clock.Add(2 * time.Minute)
+		if _, err := repo.Claim(context.Background(), "email", "other", clock, clock.Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		return "late", nil
+	})
+	job, _ := Enqueue(context.Background(), repo, "email.slow", nil)
+	job.RunAt = clock
+	repo.Save(context.Background(), job)
+
+	p.Drain(context.Background())
+	got, _ := repo.GetByID(context.Background(), job.ID)
+	if got.Status != models.QueueRunning || got.LockedBy != "other" || got.Attempts != 2 || got.Result != "" {
+		t.Fatalf("expected the job to stay with the other worker, got %+v", got)
+	}
+}
+
+func TestFinishedJobsAreScrubbed(t *testing.T) {
+	repo := &memoryQueue{}
+	clock := time.Now()
+	p := testPool(repo, &clock)
+	fail := true
+	p.Register("email.code", func(context.Context, []byte) (string, error) {
+		if fail {
+			return "", errors.New("smtp down")
+		}
+		return "", nil
+	})
+	p.Scrub("email.code", func([]byte) ([]byte, error) { return []byte(`{"token":""}`), nil })
+	job, _ := Enqueue(context.Background(), repo, "email.code", map[string]string{"token": "123456"})
+
+	p.Drain(context.Background())
+	if got, _ := repo.GetByID(context.Background(), job.ID); got.Payload != `{"token":"123456"}` {
+		t.Fatalf("expected a job awaiting retry to keep its payload, got %q", got.Payload)
+	}
+
+	fail = false
+	clock = clock.Add(time.Hour)
+	p.Drain(context.Background())
+	if got, _ := repo.GetByID(context.Background(), job.ID); got.Status != models.QueueSucceeded || got.Payload != `{"token":""}` {
+		t.Fatalf("expected a scrubbed succeeded job, got %+v", got)
+	}
+}
+
+func TestWorkersRunJobsAndStop(t *testing.T) {
+	repo := &memoryQueue{}
+	p := NewPool(repo, Options{
+		Concurrency:  map[string]int{"email": 2},
+		PollInterval: 5 * time.Millisecond,
+		MaxAttempts:  3,
+		RetryBase:    time.Second,
+		RetryMax:     time.Minute,
+		LockTimeout:  time.Minute,
+	})
+	done := make(chan string, 1)
+	p.Register("email.welcome", func(_ context.Context, payload []byte) (string, error) {
+		done <- string(payload)
+		return "sent", nil
+	})
+
+	p.Start(context.Background())
+	if err := p.Alive(); err != nil {
+		t.Fatal(err)
+	}
+	job, _ := Enqueue(context.Background(), repo, "email.welcome", "hi")
+	select {
+	case payload := <-done:
+		if payload != `"hi"` {
+			t.Fatalf("unexpected payload %s", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job was not picked up")
+	}
+
+	if err := p.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := repo.GetByID(context.Background(), job.ID); got.Status != models.QueueSucceeded || got.Result != "sent" {
+		t.Fatalf("unexpected job %+v", got)
+	}
+	if err := p.Alive(); err == nil {
+		t.Fatal("stopped pool should not be alive")
+	}
+}
@@ -0,0 +1,76 @@
+// Package queue runs durable background work stored in the queue_jobs
+// table. Jobs are enqueued through a QueueRepo, inside the caller's
+// transaction when there is one, and executed by a Pool of workers that
+// retry failures with exponential backoff until a job is dead.
+package queue
+
+import (
+	"ET-SensorAPI/logging"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoHandler = errors.New("no handler registered for job kind")
+	ErrNotDead   = errors.New("only dead jobs can be retried")
+)
+
+// Handler executes one attempt of a job. The returned result is stored on
+// the job when it succeeds.
+type Handler func(ctx context.Context, payload []byte) (result string, err error)
+
+// QueueOf returns the queue a job kind runs on: the part of kind before
+// the first dot, so "email.invitation" runs on "email".
+func QueueOf(kind string) string {
+	queue, _, _ := strings.Cut(kind, ".")
+	return queue
+}
+
+// Enqueue stores a pending job of kind with payload encoded as JSON. The
+// request ID of ctx is kept so the worker's logs can be correlated.
+func Enqueue(ctx context.Context, repo repository.QueueRepo, kind string, payload any) (*models.QueueJob, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.QueueJob{
+		Queue:     QueueOf(kind),
+		Kind:      kind,
+		Payload:   string(data),
+		Status:    models.QueuePending,
+		RunAt:     time.Now().UTC(),
+		RequestID: logging.RequestID(ctx),
+	}
+	if err := repo.Enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Retry moves a dead job back to pending with a fresh attempt budget.
+func Retry(ctx context.Context, repo repository.QueueRepo, id uint) (*models.QueueJob, error) {
+	job, err := repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.QueueDead {
+		return nil, ErrNotDead
+	}
+
+	job.Status = models.QueuePending
+	job.Attempts = 0
+	job.RunAt = time.Now().UTC()
+	job.LockedAt = nil
+	job.LockedBy = ""
+	job.FinishedAt = nil
+	if err := repo.Save(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
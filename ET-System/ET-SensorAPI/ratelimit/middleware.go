@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"ET-SensorAPI/config"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc picks the bucket of a request; an empty key skips the rule.
+type KeyFunc func(c *gin.Context) string
+
+// Rule limits the requests sharing a key to Rate. Rate points into the
+// config so that changes apply to the next request.
+type Rule struct {
+	Name string
+	Rate *config.Rate
+	Key  KeyFunc
+}
+
+// Middleware rejects requests over any of rules with 429 Too Many Requests
+// and a Retry-After header.
+func (l *Limiter) Middleware(rules ...Rule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checks := make([]Check, 0, len(rules))
+		for _, rule := range rules {
+			checks = append(checks, Check{Rule: rule.Name, Rate: *rule.Rate, Key: rule.Key(c)})
+		}
+		var limited *LimitedError
+		if err := l.Check(c.Request.Context(), checks...); errors.As(err, &limited) {
+			seconds := RetryAfterSeconds(limited.RetryAfter)
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": limited.Error(), "retry_after": seconds})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ByIP keys requests by client IP.
+func ByIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// maxPeekedBody bounds how much of a request body ByJSONField reads.
+const maxPeekedBody = 1 << 20
+
+// ByJSONField keys requests by a string field of their JSON body, trimmed
+// and lowercased. The body is left in place for the handler.
+func ByJSONField(field string) KeyFunc {
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekedBody))
+		if err != nil {
+			return ""
+		}
+		c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+		var fields map[string]json.RawMessage
+		var value string
+		if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields[field], &value) != nil {
+			return ""
+		}
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+}
@@ -0,0 +1,125 @@
+// Package ratelimit throttles requests with token buckets. A bucket holds up
+// to Rate.Count tokens and regains them evenly over Rate.Period; every
+// request takes one, and an empty bucket rejects it until a token is back.
+// Buckets live in a Store, in memory or in the database for replicas that
+// must share them. Limits are enforced on gin routes with Middleware and on
+// GraphQL operations through Check.
+package ratelimit
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/metrics"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// Store takes tokens from the buckets it keeps.
+type Store interface {
+	// Take removes a token from the bucket key at now. When the bucket is
+	// empty nothing is taken and retryAfter is the wait for the next token.
+	Take(ctx context.Context, key string, rate config.Rate, now time.Time) (retryAfter time.Duration, err error)
+}
+
+// LimitedError rejects a request whose bucket of Rule is empty.
+type LimitedError struct {
+	Rule       string
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("too many requests, try again in %d seconds", RetryAfterSeconds(e.RetryAfter))
+}
+
+// RetryAfterSeconds rounds d up to the whole seconds of a Retry-After
+// header, at least one.
+func RetryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// Check is one bucket to take a token from: the bucket of Key under Rule,
+// refilling at Rate. A check without a key or rate is skipped.
+type Check struct {
+	Rule string
+	Rate config.Rate
+	Key  string
+}
+
+// Limiter enforces rate limits against a Store while cfg.Enabled is set.
+type Limiter struct {
+	cfg   *config.RateLimitConfig
+	store Store
+	now   func() time.Time
+}
+
+func New(cfg *config.RateLimitConfig, store Store) *Limiter {
+	return &Limiter{cfg: cfg, store: store, now: time.Now}
+}
+
+// Config returns the settings l was created with; they are read on every
+// request.
+func (l *Limiter) Config() *config.RateLimitConfig {
+	return l.cfg
+}
+
+// Check takes a token for every check in order and returns a *LimitedError
+// for the first empty bucket. Store failures are logged and let the request
+// through rather than locking everyone out.
+func (l *Limiter) Check(ctx context.Context, checks ...Check) error {
+	if !l.cfg.Enabled {
+		return nil
+	}
+	now := l.now()
+	for _, check := range checks {
+		if check.Key == "" || !check.Rate.Limited() {
+			continue
+		}
+		retryAfter, err := l.store.Take(ctx, check.Rule+":"+check.Key, check.Rate, now)
+		if err != nil {
+			slog.ErrorContext(ctx, "rate limit store failed", "rule", check.Rule, "error", err)
+			continue
+		}
+		if retryAfter > 0 {
+			metrics.RateLimited.WithLabelValues(check.Rule).Inc()
+			slog.WarnContext(ctx, "rate limited", "rule", check.Rule, "retry_after", retryAfter)
+			return &LimitedError{Rule: check.Rule, RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// bucket is the state of a token bucket as of refilledAt.
+type bucket struct {
+	tokens     float64
+	refilledAt time.Time
+}
+
+// take refills b up to now and removes a token, or returns the wait for the
+// next one. A zero bucket starts full. Clocks of different replicas may
+// disagree slightly, so b never moves back in time.
+func (b *bucket) take(rate config.Rate, now time.Time) time.Duration {
+	interval := rate.Period / time.Duration(rate.Count)
+	capacity := float64(rate.Count)
+	switch {
+	case b.refilledAt.IsZero():
+		b.tokens = capacity
+		b.refilledAt = now
+	case now.After(b.refilledAt):
+		b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.refilledAt))/float64(interval))
+		b.refilledAt = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(interval))
+}
+
+// fullAt is when b is back to its capacity.
+func (b *bucket) fullAt(rate config.Rate) time.Time {
+	interval := rate.Period / time.Duration(rate.Count)
+	missing := float64(rate.Count) - b.tokens
+	return b.refilledAt.Add(time.Duration(missing * float64(interval)))
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/migrations"
+	"ET-SensorAPI/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+var fivePerMinute = config.Rate{Count: 5, Period: time.Minute}
+
+func TestBucketRefillsEvenly(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var b bucket
+	for i := 0; i < 5; i++ {
+		if wait := b.take(fivePerMinute, now); wait != 0 {
+			t.Fatalf("take %d: the burst should pass, got a wait of %s", i+1, wait)
+		}
+	}
+	if wait := b.take(fivePerMinute, now.Add(3*time.Second)); wait != 9*time.Second {
+		t.Fatalf("expected the next token in 9s, got %s", wait)
+	}
+	if wait := b.take(fivePerMinute, now.Add(12*time.Second)); wait != 0 {
+		t.Fatalf("a token should be back after 12s, got a wait of %s", wait)
+	}
+	if wait := b.take(fivePerMinute, now.Add(time.Second)); wait == 0 {
+		t.Fatal("an earlier clock should not refill the bucket")
+	}
+	if full := b.fullAt(fivePerMinute); !full.Equal(now.Add(72 * time.Second)) {
+		t.Fatalf("expected the bucket to be full at +72s, got %s", full.Sub(now))
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		if wait, err := store.Take(ctx, "ip:a", fivePerMinute, now); err != nil || wait != 0 {
+			t.Fatalf("take %d: wait %s, err %v", i+1, wait, err)
+		}
+	}
+	if wait, err := store.Take(ctx, "ip:a", fivePerMinute, now); err != nil || wait != 12*time.Second {
+		t.Fatalf("expected a wait of 12s, got %s, err %v", wait, err)
+	}
+	if wait, _ := store.Take(ctx, "ip:b", fivePerMinute, now); wait != 0 {
+		t.Fatal("buckets should be independent")
+	}
+	if wait, _ := store.Take(ctx, "ip:a", fivePerMinute, now.Add(2*time.Hour)); wait != 0 {
+		t.Fatal("a refilled bucket should let requests through again")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestDatabaseStore(t *testing.T) {
+	db, err := config.ConnectDB(config.DatabaseConfig{Driver: "sqlite", Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Logger = logger.Discard
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewGormRateLimitRepo(db)
+	testStore(t, NewDatabaseStore(repo))
+
+	if _, err := repo.Get(context.Background(), "ip:b"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("the sweep should have dropped the refilled bucket, got %v", err)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, config.Rate, time.Time) (time.Duration, error) {
+	return 0, errors.New("database is down")
+}
+
+func TestLimiterChecks(t *testing.T) {
+	cfg := &config.RateLimitConfig{Enabled: true}
+	limiter := New(cfg, NewMemoryStore())
+	ctx := context.Background()
+	one := config.Rate{Count: 1, Period: time.Hour}
+
+	check := []Check{{Rule: "ip", Rate: fivePerMinute, Key: "a"}, {Rule: "account", Rate: one, Key: "x"}, {Rule: "device", Rate: one}}
+	if err := limiter.Check(ctx, check...); err != nil {
+		t.Fatal(err)
+	}
+	var limited *LimitedError
+	if err := limiter.Check(ctx, check...); !errors.As(err, &limited) || limited.Rule != "account" {
+		t.Fatalf("expected the account rule to reject, got %v", err)
+	}
+	if RetryAfterSeconds(limited.RetryAfter) != 3600 {
+		t.Fatalf("unexpected retry after %s", limited.RetryAfter)
+	}
+
+	cfg.Enabled = false
+	if err := limiter.Check(ctx, check...); err != nil {
+		t.Fatalf("a disabled limiter should not reject, got %v", err)
+	}
+	cfg.Enabled = true
+	if err := New(cfg, failingStore{}).Check(ctx, check...); err != nil {
+		t.Fatalf("store failures should let requests through, got %v", err)
+	}
+}
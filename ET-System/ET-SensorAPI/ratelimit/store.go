@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often a store drops the buckets that refilled, which
+// behave exactly like missing ones.
+const sweepInterval = time.Minute
+
+// NewMemoryStore returns a Store that keeps buckets in this process; every
+// replica limits on its own.
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: map[string]*memoryBucket{}}
+}
+
+type memoryBucket struct {
+	bucket
+	fullAt time.Time
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+func (s *memoryStore) Take(_ context.Context, key string, rate config.Rate, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, b := range s.buckets {
+			if !now.Before(b.fullAt) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		s.buckets[key] = b
+	}
+	retryAfter := b.take(rate, now)
+	b.fullAt = b.bucket.fullAt(rate)
+	return retryAfter, nil
+}
+
+// maxConflicts bounds the retries of a database bucket update that keeps
+// losing to concurrent requests.
+const maxConflicts = 5
+
+var errContended = errors.New("rate limit bucket is too contended")
+
+// NewDatabaseStore returns a Store that keeps buckets in the database, so
+// every replica sharing it enforces the same limits. Buckets are updated
+// optimistically and retried on conflicts.
+func NewDatabaseStore(repo repository.RateLimitRepo) Store {
+	return &databaseStore{repo: repo}
+}
+
+type databaseStore struct {
+	repo repository.RateLimitRepo
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func (s *databaseStore) Take(ctx context.Context, key string, rate config.Rate, now time.Time) (time.Duration, error) {
+	s.sweep(ctx, now)
+
+	for range maxConflicts {
+		row, err := s.repo.Get(ctx, key)
+		if errors.Is(err, repository.ErrNotFound) {
+			var b bucket
+			retryAfter := b.take(rate, now)
+			created, err := s.repo.Create(ctx, &models.RateLimitBucket{
+				Key: key, Tokens: b.tokens, RefilledAt: b.refilledAt, FullAt: b.fullAt(rate),
+			})
+			if err != nil {
+				return 0, err
+			}
+			if created {
+				return retryAfter, nil
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		b := bucket{tokens: row.Tokens, refilledAt: row.RefilledAt}
+		retryAfter := b.take(rate, now)
+		if retryAfter > 0 {
+			return retryAfter, nil
+		}
+		row.Tokens, row.RefilledAt, row.FullAt = b.tokens, b.refilledAt, b.fullAt(rate)
+		updated, err := s.repo.Update(ctx, row, row.Version)
+		if err != nil {
+			return 0, err
+		}
+		if updated {
+			return 0, nil
+		}
+	}
+	return 0, errContended
+}
+
+// sweep drops refilled buckets at most once per sweepInterval per process.
+func (s *databaseStore) sweep(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	due := now.Sub(s.lastSweep) >= sweepInterval
+	if due {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+	if _, err := s.repo.DeleteFull(ctx, now); err != nil {
+		slog.ErrorContext(ctx, "failed to drop refilled rate limit buckets", "error", err)
+	}
+}
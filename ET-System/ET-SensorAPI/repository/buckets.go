@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"sort"
+	"time"
+)
+
+// The helpers below aggregate readings in Go for databases without
+// date_trunc or time zone support, such as SQLite.
+
+type usageBucket struct {
+	Start      time.Time
+	TotalUsage float64
+	FlowSum    float64
+	MaxFlow    float64
+	Samples    int64
+}
+
+func (b usageBucket) avgFlow() float64 {
+	if b.Samples == 0 {
+		return 0
+	}
+	return b.FlowSum / float64(b.Samples)
+}
+
+// truncateTo returns the start of the unit ("minute", "hour", "day", "week"
+// or "month") containing t, on the wall clock of loc. Weeks start on Monday
+// like date_trunc.
+func truncateTo(t time.Time, unit string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch unit {
+	case "minute":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	case "hour":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// bucketUsages sums readings into the buckets returned by startOf, ordered
+// by bucket start.
+func bucketUsages(usages []models.WaterUsage, startOf func(time.Time) time.Time) []usageBucket {
+	byStart := make(map[time.Time]*usageBucket)
+	for _, u := range usages {
+		start := startOf(u.RecordedAt)
+		b, ok := byStart[start]
+		if !ok {
+			b = &usageBucket{Start: start, MaxFlow: u.PeakFlow()}
+			byStart[start] = b
+		}
+		b.TotalUsage += u.TotalUsage
+		b.FlowSum += u.FlowRate * float64(u.Samples)
+		if peak := u.PeakFlow(); peak > b.MaxFlow {
+			b.MaxFlow = peak
+		}
+		b.Samples += u.Samples
+	}
+
+	buckets := make([]usageBucket, 0, len(byStart))
+	for _, b := range byStart {
+		buckets = append(buckets, *b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets
+}
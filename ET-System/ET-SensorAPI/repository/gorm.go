@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// NewGorm returns repositories backed by db. Usage aggregation switches to
+// TimescaleDB's time_bucket and continuous aggregates once water_usages is a
+// hypertable; dailyTimezone is the day boundary of the daily aggregate.
+func NewGorm(db *gorm.DB, dailyTimezone string) *Repositories {
+	return newGorm(db, HasTimescale(db), dailyTimezone)
+}
+
+func newGorm(db *gorm.DB, timeBucket bool, dailyTimezone string) *Repositories {
+	return New(
+		NewGormUserRepo(db),
+		NewGormGroupRepo(db),
+		NewGormDeviceRepo(db),
+		NewGormUsageRepo(db, timeBucket, dailyTimezone),
+		NewGormNotificationRepo(db),
+		NewGormJobRunRepo(db),
+		NewGormQueueRepo(db),
+		NewGormOneTimeCodeRepo(db),
+		NewGormSessionRepo(db),
+		NewGormTwoFactorRepo(db),
+		NewGormRateLimitRepo(db),
+		func(ctx context.Context, fn func(tx *Repositories) error) error {
+			return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return fn(newGorm(tx, timeBucket, dailyTimezone))
+			})
+		},
+	)
+}
+
+// HasTimescale reports whether water_usages is a TimescaleDB hypertable, as
+// DB_TIMESCALE sets it up. The extension alone is not enough: it may be
+// installed for other databases on the same server.
+func HasTimescale(db *gorm.DB) bool {
+	if db.Dialector.Name() != "postgres" {
+		return false
+	}
+	var installed bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").Scan(&installed).Error; err != nil || !installed {
+		return false
+	}
+	var isHypertable bool
+	if err := db.Raw(`SELECT EXISTS (
+		SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'water_usages'
+	)`).Scan(&isHypertable).Error; err != nil {
+		return false
+	}
+	return isHypertable
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
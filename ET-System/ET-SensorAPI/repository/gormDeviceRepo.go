@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type gormDeviceRepo struct {
+	db *gorm.DB
+}
+
+func NewGormDeviceRepo(db *gorm.DB) DeviceRepo {
+	return &gormDeviceRepo{db: db}
+}
+
+func (r *gormDeviceRepo) query(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Preload("UserGroup")
+}
+
+func (r *gormDeviceRepo) GetByID(ctx context.Context, id string) (*models.Device, error) {
+	var device models.Device
+	if err := r.query(ctx).Where("id = ?", id).First(&device).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepo) GetInGroup(ctx context.Context, groupID uint, id string) (*models.Device, error) {
+	var device models.Device
+	if err := r.query(ctx).Where("id = ? AND user_group_id = ?", id, groupID).First(&device).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &device, nil
+}
+
+func (r *gormDeviceRepo) List(ctx context.Context) ([]models.Device, error) {
+	var devices []models.Device
+	err := r.query(ctx).Find(&devices).Error
+	return devices, err
+}
+
+func (r *gormDeviceRepo) ListWithUsage(ctx context.Context) ([]models.Device, error) {
+	var devices []models.Device
+	err := r.query(ctx).Preload("WaterUsages").Find(&devices).Error
+	return devices, err
+}
+
+func (r *gormDeviceRepo) ListByGroup(ctx context.Context, groupID uint) ([]models.Device, error) {
+	var devices []models.Device
+	err := r.query(ctx).Where("user_group_id = ?", groupID).Find(&devices).Error
+	return devices, err
+}
+
+func (r *gormDeviceRepo) ListByGroups(ctx context.Context, groupIDs []uint) ([]models.Device, error) {
+	var devices []models.Device
+	if len(groupIDs) == 0 {
+		return devices, nil
+	}
+	err := r.query(ctx).Where("user_group_id IN ?", groupIDs).Find(&devices).Error
+	return devices, err
+}
+
+func (r *gormDeviceRepo) ListByLocation(ctx context.Context, groupID uint, location string) ([]models.Device, error) {
+	var devices []models.Device
+	err := r.query(ctx).Where("user_group_id = ? AND location = ?", groupID, location).Find(&devices).Error
+	return devices, err
+}
+
+func (r *gormDeviceRepo) Create(ctx context.Context, device *models.Device) error {
+	return r.db.WithContext(ctx).Omit("UserGroup").Create(device).Error
+}
+
+func (r *gormDeviceRepo) Delete(ctx context.Context, id string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, history := range []interface{}{&models.WaterUsage{}, &models.HourlyUsage{}, &models.DailyUsage{}} {
+			if err := tx.Where("device_id = ?", id).Delete(history).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("id = ?", id).Delete(&models.Device{}).Error
+	})
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormGroupRepo struct {
+	db *gorm.DB
+}
+
+func NewGormGroupRepo(db *gorm.DB) GroupRepo {
+	return &gormGroupRepo{db: db}
+}
+
+func (r *gormGroupRepo) GetByID(ctx context.Context, id uint) (*models.UserGroup, error) {
+	var group models.UserGroup
+	if err := r.db.WithContext(ctx).First(&group, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroupRepo) GetWithDevices(ctx context.Context, id uint) (*models.UserGroup, error) {
+	var group models.UserGroup
+	if err := r.db.WithContext(ctx).Preload("Devices").First(&group, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &group, nil
+}
+
+func (r *gormGroupRepo) ListWithDevices(ctx context.Context) ([]models.UserGroup, error) {
+	var groups []models.UserGroup
+	err := r.db.WithContext(ctx).Preload("Devices").Find(&groups).Error
+	return groups, err
+}
+
+func (r *gormGroupRepo) ListWithMembersAndUsage(ctx context.Context) ([]models.UserGroup, error) {
+	var groups []models.UserGroup
+	err := r.db.WithContext(ctx).
+		Preload("Members.User").
+		Preload("Members.UserGroup").
+		Preload("Devices.WaterUsages").
+		Find(&groups).Error
+	return groups, err
+}
+
+func (r *gormGroupRepo) ListByUser(ctx context.Context, userID uint) ([]models.UserGroup, error) {
+	var groups []models.UserGroup
+	err := r.db.WithContext(ctx).
+		Joins("JOIN user_group_members ON user_group_members.user_group_id = user_groups.id").
+		Where("user_group_members.user_id = ?", userID).
+		Find(&groups).Error
+	return groups, err
+}
+
+func (r *gormGroupRepo) Create(ctx context.Context, group *models.UserGroup) error {
+	return r.db.WithContext(ctx).Create(group).Error
+}
+
+func (r *gormGroupRepo) Save(ctx context.Context, group *models.UserGroup) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(group).Error
+}
+
+func (r *gormGroupRepo) AddLocation(ctx context.Context, groupID uint, location string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var group models.UserGroup
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&group, groupID).Error; err != nil {
+			return notFound(err)
+		}
+		return tx.Model(&group).Update("location", append(group.Location, location)).Error
+	})
+}
+
+func (r *gormGroupRepo) Members(ctx context.Context, groupID uint) ([]models.UserGroupMember, error) {
+	var members []models.UserGroupMember
+	err := r.db.WithContext(ctx).
+		Preload("User").
+		Preload("UserGroup").
+		Where("user_group_id = ?", groupID).
+		Find(&members).Error
+	return members, err
+}
+
+func (r *gormGroupRepo) MembershipsOfUser(ctx context.Context, userID uint) ([]models.UserGroupMember, error) {
+	var members []models.UserGroupMember
+	err := r.db.WithContext(ctx).
+		Preload("User").
+		Preload("UserGroup").
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&members).Error
+	return members, err
+}
+
+func (r *gormGroupRepo) ListMembers(ctx context.Context) ([]models.UserGroupMember, error) {
+	var members []models.UserGroupMember
+	err := r.db.WithContext(ctx).Preload("User").Find(&members).Error
+	return members, err
+}
+
+func (r *gormGroupRepo) CountMembers(ctx context.Context, groupID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.UserGroupMember{}).
+		Where("user_group_id = ?", groupID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormGroupRepo) GetMember(ctx context.Context, groupID, userID uint) (*models.UserGroupMember, error) {
+	var member models.UserGroupMember
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND user_group_id = ?", userID, groupID).
+		First(&member).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &member, nil
+}
+
+func (r *gormGroupRepo) AddMember(ctx context.Context, member *models.UserGroupMember) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Create(member).Error
+}
+
+func (r *gormGroupRepo) SaveMember(ctx context.Context, member *models.UserGroupMember) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(member).Error
+}
+
+func (r *gormGroupRepo) RemoveMember(ctx context.Context, member *models.UserGroupMember) error {
+	return r.db.WithContext(ctx).Delete(member).Error
+}
+
+func (r *gormGroupRepo) GetRetentionPolicy(ctx context.Context, groupID uint) (*models.RetentionPolicy, error) {
+	var policy models.RetentionPolicy
+	if err := r.db.WithContext(ctx).Where("user_group_id = ?", groupID).First(&policy).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &policy, nil
+}
+
+func (r *gormGroupRepo) ListRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	err := r.db.WithContext(ctx).Find(&policies).Error
+	return policies, err
+}
+
+func (r *gormGroupRepo) SaveRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(policy).Error
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormJobRunRepo struct {
+	db *gorm.DB
+}
+
+func NewGormJobRunRepo(db *gorm.DB) JobRunRepo {
+	return &gormJobRunRepo{db: db}
+}
+
+func (r *gormJobRunRepo) Create(ctx context.Context, run *models.JobRun) error {
+	return r.db.WithContext(ctx).Create(run).Error
+}
+
+func (r *gormJobRunRepo) Save(ctx context.Context, run *models.JobRun) error {
+	return r.db.WithContext(ctx).Save(run).Error
+}
+
+func (r *gormJobRunRepo) HasTickRun(ctx context.Context, job string, at time.Time) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.JobRun{}).
+		Where("job = ? AND scheduled_at = ?", job, at).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormJobRunRepo) Recent(ctx context.Context, job string, limit int) ([]models.JobRun, error) {
+	var runs []models.JobRun
+	query := r.db.WithContext(ctx).Order("started_at DESC, id DESC").Limit(limit)
+	if job != "" {
+		query = query.Where("job = ?", job)
+	}
+	err := query.Find(&runs).Error
+	return runs, err
+}
+
+func (r *gormJobRunRepo) Latest(ctx context.Context) (map[string]models.JobRun, error) {
+	var runs []models.JobRun
+	err := r.db.WithContext(ctx).
+		Where("id IN (?)", r.db.Model(&models.JobRun{}).Select("MAX(id)").Group("job")).
+		Find(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]models.JobRun, len(runs))
+	for _, run := range runs {
+		latest[run.Job] = run
+	}
+	return latest, nil
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type gormNotificationRepo struct {
+	db *gorm.DB
+}
+
+func NewGormNotificationRepo(db *gorm.DB) NotificationRepo {
+	return &gormNotificationRepo{db: db}
+}
+
+func (r *gormNotificationRepo) Create(ctx context.Context, notification *models.Notification) error {
+	return r.db.WithContext(ctx).Omit("Device").Create(notification).Error
+}
+
+func (r *gormNotificationRepo) Recent(ctx context.Context, deviceIDs []string, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := r.db.WithContext(ctx).
+		Where("device_id IN ?", deviceIDs).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
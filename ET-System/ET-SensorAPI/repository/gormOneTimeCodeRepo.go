@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormOneTimeCodeRepo struct {
+	db *gorm.DB
+}
+
+func NewGormOneTimeCodeRepo(db *gorm.DB) OneTimeCodeRepo {
+	return &gormOneTimeCodeRepo{db: db}
+}
+
+func (r *gormOneTimeCodeRepo) Get(ctx context.Context, userID uint, purpose string) (*models.OneTimeCode, error) {
+	var code models.OneTimeCode
+	err := r.db.WithContext(ctx).Where("user_id = ? AND purpose = ?", userID, purpose).First(&code).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &code, nil
+}
+
+func (r *gormOneTimeCodeRepo) Save(ctx context.Context, code *models.OneTimeCode) error {
+	return r.db.WithContext(ctx).Save(code).Error
+}
+
+func (r *gormOneTimeCodeRepo) RecordFailure(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.OneTimeCode{}).
+		Where("id = ?", id).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+func (r *gormOneTimeCodeRepo) Consume(ctx context.Context, id uint, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.OneTimeCode{}).
+		Where("id = ? AND consumed_at IS NULL", id).
+		UpdateColumn("consumed_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *gormOneTimeCodeRepo) Delete(ctx context.Context, userID uint, purposes ...string) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ? AND purpose IN ?", userID, purposes).
+		Delete(&models.OneTimeCode{}).Error
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormQueueRepo struct {
+	db *gorm.DB
+}
+
+func NewGormQueueRepo(db *gorm.DB) QueueRepo {
+	return &gormQueueRepo{db: db}
+}
+
+func (r *gormQueueRepo) Enqueue(ctx context.Context, job *models.QueueJob) error {
+	return r.db.WithContext(ctx).Create(job).Error
+}
+
+// Claim relies on SKIP LOCKED so that concurrent workers on Postgres each
+// get a different job; SQLite serializes the transaction instead.
+func (r *gormQueueRepo) Claim(ctx context.Context, queue, worker string, now, staleBefore time.Time) (*models.QueueJob, error) {
+	var job models.QueueJob
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("queue = ?", queue).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_at < ?)",
+				models.QueuePending, now, models.QueueRunning, staleBefore).
+			Order("run_at, id").
+			First(&job).Error
+		if err != nil {
+			return notFound(err)
+		}
+
+		job.Status = models.QueueRunning
+		job.Attempts++
+		job.LockedAt = &now
+		job.LockedBy = worker
+		return tx.Save(&job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *gormQueueRepo) Save(ctx context.Context, job *models.QueueJob) error {
+	return r.db.WithContext(ctx).Save(job).Error
+}
+
+func (r *gormQueueRepo) Complete(ctx context.Context, job *models.QueueJob, worker string, attempt int) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.QueueJob{}).
+		Where("id = ? AND status = ? AND locked_by = ? AND attempts = ?", job.ID, models.QueueRunning, worker, attempt).
+		Updates(map[string]interface{}{
+			"payload":     job.Payload,
+			"status":      job.Status,
+			"run_at":      job.RunAt,
+			"locked_at":   job.LockedAt,
+			"locked_by":   job.LockedBy,
+			"last_error":  job.LastError,
+			"result":      job.Result,
+			"finished_at": job.FinishedAt,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (r *gormQueueRepo) GetByID(ctx context.Context, id uint) (*models.QueueJob, error) {
+	var job models.QueueJob
+	if err := r.db.WithContext(ctx).First(&job, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &job, nil
+}
+
+func (r *gormQueueRepo) List(ctx context.Context, queue, status string, limit int) ([]models.QueueJob, error) {
+	var jobs []models.QueueJob
+	query := r.db.WithContext(ctx).Order("id DESC").Limit(limit)
+	if queue != "" {
+		query = query.Where("queue = ?", queue)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *gormQueueRepo) PurgeFinished(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("status IN ? AND finished_at < ?", []string{models.QueueSucceeded, models.QueueDead}, before).
+		Delete(&models.QueueJob{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormRateLimitRepo struct {
+	db *gorm.DB
+}
+
+func NewGormRateLimitRepo(db *gorm.DB) RateLimitRepo {
+	return &gormRateLimitRepo{db: db}
+}
+
+func (r *gormRateLimitRepo) Get(ctx context.Context, key string) (*models.RateLimitBucket, error) {
+	var bucket models.RateLimitBucket
+	if err := r.db.WithContext(ctx).Where("key = ?", key).First(&bucket).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &bucket, nil
+}
+
+func (r *gormRateLimitRepo) Create(ctx context.Context, bucket *models.RateLimitBucket) (bool, error) {
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(bucket)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *gormRateLimitRepo) Update(ctx context.Context, bucket *models.RateLimitBucket, version int) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.RateLimitBucket{}).
+		Where("key = ? AND version = ?", bucket.Key, version).
+		Updates(map[string]interface{}{
+			"tokens":      bucket.Tokens,
+			"refilled_at": bucket.RefilledAt,
+			"full_at":     bucket.FullAt,
+			"version":     version + 1,
+		})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	bucket.Version = version + 1
+	return true, nil
+}
+
+func (r *gormRateLimitRepo) DeleteFull(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("full_at <= ?", now).Delete(&models.RateLimitBucket{})
+	return res.RowsAffected, res.Error
+}
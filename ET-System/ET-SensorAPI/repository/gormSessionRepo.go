@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormSessionRepo struct {
+	db *gorm.DB
+}
+
+func NewGormSessionRepo(db *gorm.DB) SessionRepo {
+	return &gormSessionRepo{db: db}
+}
+
+func (r *gormSessionRepo) Create(ctx context.Context, session *models.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *gormSessionRepo) GetByID(ctx context.Context, id uint) (*models.Session, error) {
+	var session models.Session
+	if err := r.db.WithContext(ctx).First(&session, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepo) ListActive(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC, id DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *gormSessionRepo) Rotate(ctx context.Context, session *models.Session, generation int, now, expiresAt time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND generation = ? AND revoked_at IS NULL", session.ID, generation).
+		Updates(map[string]interface{}{
+			"generation":   generation + 1,
+			"ip":           session.IP,
+			"user_agent":   session.UserAgent,
+			"last_used_at": now,
+			"expires_at":   expiresAt,
+		})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	session.Generation = generation + 1
+	session.LastUsedAt = now
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
+func (r *gormSessionRepo) Revoke(ctx context.Context, userID, id uint, reason string, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *gormSessionRepo) RevokeAll(ctx context.Context, userID uint, reason string, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason})
+	return res.RowsAffected, res.Error
+}
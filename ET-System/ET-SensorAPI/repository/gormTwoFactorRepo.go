@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormTwoFactorRepo struct {
+	db *gorm.DB
+}
+
+func NewGormTwoFactorRepo(db *gorm.DB) TwoFactorRepo {
+	return &gormTwoFactorRepo{db: db}
+}
+
+func (r *gormTwoFactorRepo) CreateChallenge(ctx context.Context, challenge *models.LoginChallenge) error {
+	return r.db.WithContext(ctx).Create(challenge).Error
+}
+
+func (r *gormTwoFactorRepo) GetChallenge(ctx context.Context, id uint) (*models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	if err := r.db.WithContext(ctx).First(&challenge, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &challenge, nil
+}
+
+func (r *gormTwoFactorRepo) RecordChallengeFailure(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.LoginChallenge{}).
+		Where("id = ?", id).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+}
+
+func (r *gormTwoFactorRepo) CompleteChallenge(ctx context.Context, id uint, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.LoginChallenge{}).
+		Where("id = ? AND completed_at IS NULL", id).
+		UpdateColumn("completed_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *gormTwoFactorRepo) CreateTrustedDevice(ctx context.Context, device *models.TrustedDevice) error {
+	return r.db.WithContext(ctx).Create(device).Error
+}
+
+func (r *gormTwoFactorRepo) GetTrustedDevice(ctx context.Context, id uint) (*models.TrustedDevice, error) {
+	var device models.TrustedDevice
+	if err := r.db.WithContext(ctx).First(&device, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &device, nil
+}
+
+func (r *gormTwoFactorRepo) TouchTrustedDevice(ctx context.Context, id uint, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.TrustedDevice{}).
+		Where("id = ?", id).
+		UpdateColumn("last_used_at", now).Error
+}
+
+func (r *gormTwoFactorRepo) ListTrustedDevices(ctx context.Context, userID uint, now time.Time) ([]models.TrustedDevice, error) {
+	var devices []models.TrustedDevice
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND expires_at > ?", userID, now).
+		Order("last_used_at DESC, id DESC").
+		Find(&devices).Error
+	return devices, err
+}
+
+func (r *gormTwoFactorRepo) DeleteTrustedDevice(ctx context.Context, userID, id uint) (bool, error) {
+	res := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.TrustedDevice{})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *gormTwoFactorRepo) DeleteTrustedDevices(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.TrustedDevice{}).Error
+}
+
+func (r *gormTwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userID uint, hashes []string) error {
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+	codes := make([]models.RecoveryCode, len(hashes))
+	for i, hash := range hashes {
+		codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+	}
+	return r.db.WithContext(ctx).Create(&codes).Error
+}
+
+func (r *gormTwoFactorRepo) UseRecoveryCode(ctx context.Context, userID uint, hash string, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		UpdateColumn("used_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *gormTwoFactorRepo) CountRecoveryCodes(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormTwoFactorRepo) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		UpdateColumn("totp_last_step", step)
+	return res.RowsAffected == 1, res.Error
+}
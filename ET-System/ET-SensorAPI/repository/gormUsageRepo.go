@@ -0,0 +1,586 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormUsageRepo struct {
+	db         *gorm.DB
+	timeBucket bool
+	// dailyTimezone is the day boundary of the water_usage_daily aggregate.
+	dailyTimezone string
+	// sqlBuckets is false on databases without date_trunc and time zones,
+	// where readings are bucketed in Go instead.
+	sqlBuckets bool
+}
+
+// NewGormUsageRepo returns a UsageRepo on db. With timeBucket set the
+// aggregation queries use TimescaleDB's time_bucket instead of date_trunc,
+// and series read the continuous aggregates where their buckets line up.
+func NewGormUsageRepo(db *gorm.DB, timeBucket bool, dailyTimezone string) UsageRepo {
+	return &gormUsageRepo{
+		db:            db,
+		timeBucket:    timeBucket,
+		dailyTimezone: dailyTimezone,
+		sqlBuckets:    db.Dialector.Name() == "postgres",
+	}
+}
+
+// localBucket truncates recorded_at to unit and yields the wall clock of the
+// bucket start in loc.
+func (r *gormUsageRepo) localBucket(unit string, loc *time.Location) (string, []interface{}) {
+	if r.timeBucket {
+		return "time_bucket(CAST(? AS interval), recorded_at, ?) AT TIME ZONE ?",
+			[]interface{}{"1 " + unit, loc.String(), loc.String()}
+	}
+	return "date_trunc(?, recorded_at AT TIME ZONE ?)", []interface{}{unit, loc.String()}
+}
+
+// utcBucket truncates recorded_at to unit, aligned to UTC.
+func (r *gormUsageRepo) utcBucket(unit string) (string, []interface{}) {
+	if r.timeBucket {
+		return "time_bucket(CAST(? AS interval), recorded_at)", []interface{}{"1 " + unit}
+	}
+	return "date_trunc(?, recorded_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'", []interface{}{unit}
+}
+
+// seriesAggregate returns the continuous aggregate that holds the buckets of
+// a series by unit in loc over [from, to), if there is one. The hourly
+// aggregate is aligned to UTC, so it serves zones that stay a whole number
+// of hours off UTC; the daily one serves days in its own timezone.
+func (r *gormUsageRepo) seriesAggregate(unit string, from, to time.Time, loc *time.Location) (string, bool) {
+	if !r.timeBucket || !truncateTo(from, unit, loc).Equal(from) || !truncateTo(to, unit, loc).Equal(to) {
+		return "", false
+	}
+	switch {
+	case unit == "hour" && wholeHourOffsets(from, to, loc):
+		return "water_usage_hourly", true
+	case unit == "day" && loc.String() == r.dailyTimezone:
+		return "water_usage_daily", true
+	}
+	return "", false
+}
+
+// wholeHourOffsets reports whether loc is a whole number of hours off UTC
+// throughout [from, to).
+func wholeHourOffsets(from, to time.Time, loc *time.Location) bool {
+	for t := from.In(loc); t.Before(to); {
+		if _, offset := t.Zone(); offset%3600 != 0 {
+			return false
+		}
+		_, end := t.ZoneBounds()
+		if end.IsZero() {
+			break
+		}
+		t = end
+	}
+	return true
+}
+
+// RollupDate converts t to the calendar day it falls on in loc, stored as
+// midnight UTC so the date column round-trips without timezone shifts.
+func RollupDate(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (r *gormUsageRepo) Create(ctx context.Context, usage *models.WaterUsage) error {
+	return r.db.WithContext(ctx).Omit("Device").Create(usage).Error
+}
+
+func (r *gormUsageRepo) AddToRollups(ctx context.Context, usage models.WaterUsage, loc *time.Location) error {
+	db := r.db.WithContext(ctx)
+
+	hourly := models.HourlyUsage{
+		DeviceID:   usage.DeviceID,
+		Hour:       usage.RecordedAt.UTC().Truncate(time.Hour),
+		TotalUsage: usage.TotalUsage,
+		FlowSum:    usage.FlowRate,
+		MaxFlow:    usage.FlowRate,
+		Samples:    1,
+	}
+	if err := db.Omit("Device").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}, {Name: "hour"}},
+		DoUpdates: rollupAssignments("hourly_usages"),
+	}).Create(&hourly).Error; err != nil {
+		return fmt.Errorf("failed to update hourly rollup: %w", err)
+	}
+
+	daily := models.DailyUsage{
+		DeviceID:   usage.DeviceID,
+		Date:       RollupDate(usage.RecordedAt, loc),
+		TotalUsage: usage.TotalUsage,
+		FlowSum:    usage.FlowRate,
+		MaxFlow:    usage.FlowRate,
+		Samples:    1,
+	}
+	if err := db.Omit("Device").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}, {Name: "date"}},
+		DoUpdates: rollupAssignments("daily_usages"),
+	}).Create(&daily).Error; err != nil {
+		return fmt.Errorf("failed to update daily rollup: %w", err)
+	}
+
+	return nil
+}
+
+func rollupAssignments(table string) clause.Set {
+	return clause.Assignments(map[string]interface{}{
+		"total_usage": gorm.Expr(table + ".total_usage + excluded.total_usage"),
+		"flow_sum":    gorm.Expr(table + ".flow_sum + excluded.flow_sum"),
+		"max_flow":    gorm.Expr("CASE WHEN excluded.max_flow > " + table + ".max_flow THEN excluded.max_flow ELSE " + table + ".max_flow END"),
+		"samples":     gorm.Expr(table + ".samples + excluded.samples"),
+	})
+}
+
+func (r *gormUsageRepo) List(ctx context.Context) ([]models.WaterUsage, error) {
+	var usages []models.WaterUsage
+	err := r.db.WithContext(ctx).Preload("Device.UserGroup").Find(&usages).Error
+	return usages, err
+}
+
+func (r *gormUsageRepo) ListSince(ctx context.Context, since time.Time, deviceIDs []string) ([]models.WaterUsage, error) {
+	var usages []models.WaterUsage
+	query := r.db.WithContext(ctx).Where("recorded_at >= ?", since)
+	if deviceIDs != nil {
+		if len(deviceIDs) == 0 {
+			return usages, nil
+		}
+		query = query.Where("device_id IN ?", deviceIDs)
+	}
+	err := query.Find(&usages).Error
+	return usages, err
+}
+
+func (r *gormUsageRepo) GroupLogs(ctx context.Context, groupID uint) ([]UsageLog, error) {
+	var logs []UsageLog
+	err := r.db.WithContext(ctx).Table("water_usages").
+		Joins("JOIN devices ON devices.id = water_usages.device_id").
+		Where("devices.user_group_id = ?", groupID).
+		Order("water_usages.recorded_at DESC").
+		Select("devices.name AS device_name, water_usages.flow_rate, water_usages.recorded_at").
+		Scan(&logs).Error
+	return logs, err
+}
+
+func (r *gormUsageRepo) Series(ctx context.Context, deviceIDs []string, from, to time.Time, unit string, loc *time.Location) ([]UsageBucketRow, error) {
+	var rows []UsageBucketRow
+	if len(deviceIDs) == 0 {
+		return rows, nil
+	}
+	if !r.sqlBuckets {
+		var usages []models.WaterUsage
+		if err := r.db.WithContext(ctx).
+			Where("device_id IN ? AND recorded_at >= ? AND recorded_at < ?", deviceIDs, from, to).
+			Find(&usages).Error; err != nil {
+			return nil, err
+		}
+		buckets := bucketUsages(usages, func(t time.Time) time.Time { return truncateTo(t, unit, loc) })
+		for _, b := range buckets {
+			rows = append(rows, UsageBucketRow{
+				Bucket:     b.Start,
+				TotalUsage: b.TotalUsage,
+				AvgFlow:    b.avgFlow(),
+				MaxFlow:    b.MaxFlow,
+				Samples:    b.Samples,
+			})
+		}
+		return rows, nil
+	}
+	if view, ok := r.seriesAggregate(unit, from, to, loc); ok {
+		err := r.db.WithContext(ctx).Raw(`
+			SELECT bucket AT TIME ZONE ? AS bucket,
+				COALESCE(SUM(total_usage), 0) AS total_usage,
+				COALESCE(SUM(flow_sum) / SUM(samples), 0) AS avg_flow,
+				COALESCE(MAX(max_flow), 0) AS max_flow,
+				COALESCE(SUM(samples), 0) AS samples
+			FROM `+view+`
+			WHERE device_id IN ? AND bucket >= ? AND bucket < ?
+			GROUP BY 1
+			ORDER BY 1`,
+			loc.String(), deviceIDs, from, to,
+		).Scan(&rows).Error
+		return rows, err
+	}
+	bucket, args := r.localBucket(unit, loc)
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT `+bucket+` AS bucket,
+			COALESCE(SUM(total_usage), 0) AS total_usage,
+			COALESCE(SUM(flow_rate * samples) / SUM(samples), 0) AS avg_flow,
+			COALESCE(MAX(COALESCE(max_flow, flow_rate)), 0) AS max_flow,
+			COALESCE(SUM(samples), 0) AS samples
+		FROM water_usages
+		WHERE device_id IN ? AND recorded_at >= ? AND recorded_at < ?
+		GROUP BY 1
+		ORDER BY 1`,
+		append(args, deviceIDs, from, to)...,
+	).Scan(&rows).Error
+	return rows, err
+}
+
+func (r *gormUsageRepo) SumByWindows(ctx context.Context, deviceIDs []string, current, previous, lastYear UsageWindow) ([]DeviceWindowTotals, error) {
+	var rows []DeviceWindowTotals
+	if len(deviceIDs) == 0 {
+		return rows, nil
+	}
+	err := r.db.WithContext(ctx).Raw(`
+		SELECT device_id,
+			COALESCE(SUM(CASE WHEN recorded_at >= ? AND recorded_at < ? THEN total_usage END), 0) AS current_usage,
+			COALESCE(SUM(CASE WHEN recorded_at >= ? AND recorded_at < ? THEN total_usage END), 0) AS previous_usage,
+			COALESCE(SUM(CASE WHEN recorded_at >= ? AND recorded_at < ? THEN total_usage END), 0) AS last_year_usage
+		FROM water_usages
+		WHERE device_id IN ?
+			AND ((recorded_at >= ? AND recorded_at < ?)
+				OR (recorded_at >= ? AND recorded_at < ?)
+				OR (recorded_at >= ? AND recorded_at < ?))
+		GROUP BY device_id`,
+		current.Start, current.End,
+		previous.Start, previous.End,
+		lastYear.Start, lastYear.End,
+		deviceIDs,
+		current.Start, current.End,
+		previous.Start, previous.End,
+		lastYear.Start, lastYear.End,
+	).Scan(&rows).Error
+	return rows, err
+}
+
+func (r *gormUsageRepo) Hourly(ctx context.Context, deviceID string, start, end time.Time) ([]models.HourlyUsage, error) {
+	var rows []models.HourlyUsage
+	err := r.db.WithContext(ctx).
+		Where("device_id = ? AND hour >= ? AND hour < ?", deviceID, start, end).
+		Order("hour").
+		Find(&rows).Error
+	return rows, err
+}
+
+func (r *gormUsageRepo) SumUsage(ctx context.Context, deviceID string, start, end time.Time) (float64, error) {
+	first := start.UTC().Truncate(time.Hour)
+	if first.Before(start) {
+		first = first.Add(time.Hour)
+	}
+	last := end.UTC().Truncate(time.Hour)
+	if !first.Before(last) {
+		return r.sumReadings(ctx, deviceID, start, end)
+	}
+
+	var total float64
+	if err := r.db.WithContext(ctx).Model(&models.HourlyUsage{}).
+		Select("COALESCE(SUM(total_usage), 0)").
+		Where("device_id = ? AND hour >= ? AND hour < ?", deviceID, first, last).
+		Scan(&total).Error; err != nil {
+		return 0, err
+	}
+	head, err := r.sumReadings(ctx, deviceID, start, first)
+	if err != nil {
+		return 0, err
+	}
+	tail, err := r.sumReadings(ctx, deviceID, last, end)
+	if err != nil {
+		return 0, err
+	}
+	return total + head + tail, nil
+}
+
+func (r *gormUsageRepo) sumReadings(ctx context.Context, deviceID string, start, end time.Time) (float64, error) {
+	var total float64
+	if !start.Before(end) {
+		return 0, nil
+	}
+	err := r.db.WithContext(ctx).Model(&models.WaterUsage{}).
+		Select("COALESCE(SUM(total_usage), 0)").
+		Where("device_id = ? AND recorded_at >= ? AND recorded_at < ?", deviceID, start, end).
+		Scan(&total).Error
+	return total, err
+}
+
+func (r *gormUsageRepo) DeviceTotal(ctx context.Context, deviceID string) (float64, error) {
+	var total float64
+	err := r.db.WithContext(ctx).Model(&models.DailyUsage{}).
+		Select("COALESCE(SUM(total_usage), 0)").
+		Where("device_id = ?", deviceID).
+		Scan(&total).Error
+	return total, err
+}
+
+func (r *gormUsageRepo) CountActiveDevices(ctx context.Context, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.WaterUsage{}).
+		Where("recorded_at >= ?", since).
+		Distinct("device_id").
+		Count(&count).Error
+	return count, err
+}
+
+func (r *gormUsageRepo) GroupDeviceTotals(ctx context.Context, groupID uint) (map[string]float64, error) {
+	var rows []struct {
+		DeviceID   string
+		TotalUsage float64
+	}
+	if err := r.db.WithContext(ctx).Model(&models.DailyUsage{}).
+		Select("daily_usages.device_id, SUM(daily_usages.total_usage) AS total_usage").
+		Joins("JOIN devices ON devices.id = daily_usages.device_id").
+		Where("devices.user_group_id = ?", groupID).
+		Group("daily_usages.device_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		totals[row.DeviceID] = row.TotalUsage
+	}
+	return totals, nil
+}
+
+func (r *gormUsageRepo) GetDaily(ctx context.Context, deviceID string, date time.Time) (*models.DailyUsage, error) {
+	var daily models.DailyUsage
+	if err := r.db.WithContext(ctx).Where("device_id = ? AND date = ?", deviceID, date).First(&daily).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &daily, nil
+}
+
+func (r *gormUsageRepo) MarkNotified(ctx context.Context, daily *models.DailyUsage) error {
+	return r.db.WithContext(ctx).Model(daily).Update("notified", true).Error
+}
+
+func (r *gormUsageRepo) ReadingRange(ctx context.Context, deviceID string) (*time.Time, *time.Time, error) {
+	first, err := r.firstReading(ctx, "recorded_at", "device_id = ?", deviceID)
+	if err != nil || first == nil {
+		return nil, nil, err
+	}
+	last, err := r.firstReading(ctx, "recorded_at DESC", "device_id = ?", deviceID)
+	return first, last, err
+}
+
+// firstReading returns recorded_at of the first matching reading in order,
+// or nil. Unlike MIN(recorded_at), the column keeps its type on SQLite.
+func (r *gormUsageRepo) firstReading(ctx context.Context, order string, query string, args ...interface{}) (*time.Time, error) {
+	var usages []models.WaterUsage
+	if err := r.db.WithContext(ctx).Select("recorded_at").
+		Where(query, args...).
+		Order(order).
+		Limit(1).
+		Find(&usages).Error; err != nil || len(usages) == 0 {
+		return nil, err
+	}
+	return &usages[0].RecordedAt, nil
+}
+
+func (r *gormUsageRepo) RebuildRollups(ctx context.Context, deviceID string, start, end time.Time, loc *time.Location) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("device_id = ? AND hour >= ? AND hour < ?", deviceID, start, end).
+			Delete(&models.HourlyUsage{}).Error; err != nil {
+			return fmt.Errorf("failed to clear hourly rollups: %w", err)
+		}
+
+		days := func() *gorm.DB {
+			return tx.Model(&models.DailyUsage{}).
+				Where("device_id = ? AND date >= ? AND date < ?", deviceID, RollupDate(start, loc), RollupDate(end, loc))
+		}
+		var notified []models.DailyUsage
+		if err := days().Select("date").Where("notified = ?", true).Find(&notified).Error; err != nil {
+			return fmt.Errorf("failed to read notified days: %w", err)
+		}
+		if err := days().Delete(&models.DailyUsage{}).Error; err != nil {
+			return fmt.Errorf("failed to clear daily rollups: %w", err)
+		}
+
+		if err := r.rebuildRollups(tx, deviceID, start, end, loc); err != nil {
+			return err
+		}
+
+		// The daily rows were recreated; carry their notified flags over so
+		// that a rebuild does not send the same notification again.
+		for _, day := range notified {
+			if err := tx.Model(&models.DailyUsage{}).
+				Where("device_id = ? AND date = ?", deviceID, day.Date).
+				Update("notified", true).Error; err != nil {
+				return fmt.Errorf("failed to restore notified days: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *gormUsageRepo) rebuildRollups(tx *gorm.DB, deviceID string, start, end time.Time, loc *time.Location) error {
+	if !r.sqlBuckets {
+		return rebuildRollupsInGo(tx, deviceID, start, end, loc)
+	}
+
+	hour, args := r.utcBucket("hour")
+	if err := tx.Exec(`
+		INSERT INTO hourly_usages (device_id, hour, total_usage, flow_sum, max_flow, samples)
+		SELECT device_id, `+hour+`,
+			SUM(total_usage), SUM(flow_rate * samples), MAX(COALESCE(max_flow, flow_rate)), SUM(samples)
+		FROM water_usages
+		WHERE device_id = ? AND recorded_at >= ? AND recorded_at < ?
+		GROUP BY 1, 2`,
+		append(args, deviceID, start, end)...,
+	).Error; err != nil {
+		return fmt.Errorf("failed to rebuild hourly rollups: %w", err)
+	}
+
+	if err := tx.Exec(`
+		INSERT INTO daily_usages (device_id, date, total_usage, flow_sum, max_flow, samples, notified)
+		SELECT device_id, (recorded_at AT TIME ZONE ?)::date,
+			SUM(total_usage), SUM(flow_rate * samples), MAX(COALESCE(max_flow, flow_rate)), SUM(samples), false
+		FROM water_usages
+		WHERE device_id = ? AND recorded_at >= ? AND recorded_at < ?
+		GROUP BY 1, 2`,
+		loc.String(), deviceID, start, end,
+	).Error; err != nil {
+		return fmt.Errorf("failed to rebuild daily rollups: %w", err)
+	}
+	return nil
+}
+
+func (r *gormUsageRepo) CountRetention(ctx context.Context, deviceID string, cutoffs RetentionCutoffs) (RetentionCounts, error) {
+	var counts RetentionCounts
+	base := func() *gorm.DB {
+		return r.db.WithContext(ctx).Model(&models.WaterUsage{}).Where("device_id = ?", deviceID)
+	}
+
+	if !cutoffs.MaxAge.IsZero() {
+		if err := base().Where("recorded_at < ?", cutoffs.MaxAge).Count(&counts.Purged).Error; err != nil {
+			return counts, err
+		}
+	}
+	if !cutoffs.Minute.IsZero() {
+		q := base().Where("recorded_at < ? AND resolution <> ?", cutoffs.Minute, models.ResolutionHour)
+		if !cutoffs.MaxAge.IsZero() {
+			q = q.Where("recorded_at >= ?", cutoffs.MaxAge)
+		}
+		if err := q.Count(&counts.ToHour).Error; err != nil {
+			return counts, err
+		}
+	}
+	if !cutoffs.Raw.IsZero() {
+		q := base().Where("recorded_at < ? AND resolution = ?", cutoffs.Raw, models.ResolutionRaw)
+		if !cutoffs.Minute.IsZero() {
+			q = q.Where("recorded_at >= ?", cutoffs.Minute)
+		} else if !cutoffs.MaxAge.IsZero() {
+			q = q.Where("recorded_at >= ?", cutoffs.MaxAge)
+		}
+		if err := q.Count(&counts.ToMinute).Error; err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+func (r *gormUsageRepo) PurgeBefore(ctx context.Context, deviceID string, before time.Time, batch int) (int64, error) {
+	result := r.db.WithContext(ctx).Exec(`
+		DELETE FROM water_usages WHERE id IN (
+			SELECT id FROM water_usages WHERE device_id = ? AND recorded_at < ? LIMIT ?
+		)`, deviceID, before, batch)
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormUsageRepo) FirstReadingBefore(ctx context.Context, deviceID string, before time.Time, resolutions []string) (*time.Time, error) {
+	return r.firstReading(ctx, "recorded_at",
+		"device_id = ? AND recorded_at < ? AND resolution IN ?", deviceID, before, resolutions)
+}
+
+func (r *gormUsageRepo) Downsample(ctx context.Context, deviceID string, start, end time.Time, unit, resolution string, finer []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		insert := r.downsampleInSQL
+		if !r.sqlBuckets {
+			insert = downsampleInGo
+		}
+		if err := insert(tx, deviceID, start, end, unit, resolution, finer); err != nil {
+			return err
+		}
+		return tx.Where("device_id = ? AND recorded_at >= ? AND recorded_at < ? AND resolution IN ?", deviceID, start, end, finer).
+			Delete(&models.WaterUsage{}).Error
+	})
+}
+
+func (r *gormUsageRepo) downsampleInSQL(tx *gorm.DB, deviceID string, start, end time.Time, unit, resolution string, finer []string) error {
+	bucket, args := r.utcBucket(unit)
+	return tx.Exec(`
+		INSERT INTO water_usages (device_id, flow_rate, max_flow, total_usage, recorded_at, resolution, samples)
+		SELECT device_id, SUM(flow_rate * samples) / SUM(samples), MAX(COALESCE(max_flow, flow_rate)),
+			SUM(total_usage), `+bucket+`, ?, SUM(samples)
+		FROM water_usages
+		WHERE device_id = ? AND recorded_at >= ? AND recorded_at < ? AND resolution IN ?
+		GROUP BY device_id, 5`,
+		append(args, resolution, deviceID, start, end, finer)...,
+	).Error
+}
+
+func downsampleInGo(tx *gorm.DB, deviceID string, start, end time.Time, unit, resolution string, finer []string) error {
+	var usages []models.WaterUsage
+	if err := tx.Where("device_id = ? AND recorded_at >= ? AND recorded_at < ? AND resolution IN ?", deviceID, start, end, finer).
+		Find(&usages).Error; err != nil {
+		return err
+	}
+	buckets := bucketUsages(usages, func(t time.Time) time.Time { return truncateTo(t, unit, time.UTC) })
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	rows := make([]models.WaterUsage, len(buckets))
+	for i, b := range buckets {
+		maxFlow := b.MaxFlow
+		rows[i] = models.WaterUsage{
+			DeviceID:   deviceID,
+			FlowRate:   b.avgFlow(),
+			MaxFlow:    &maxFlow,
+			TotalUsage: b.TotalUsage,
+			RecordedAt: b.Start,
+			Resolution: resolution,
+			Samples:    b.Samples,
+		}
+	}
+	return tx.Omit("Device").CreateInBatches(rows, 500).Error
+}
+
+func rebuildRollupsInGo(tx *gorm.DB, deviceID string, start, end time.Time, loc *time.Location) error {
+	var usages []models.WaterUsage
+	if err := tx.Where("device_id = ? AND recorded_at >= ? AND recorded_at < ?", deviceID, start, end).
+		Find(&usages).Error; err != nil {
+		return err
+	}
+	if len(usages) == 0 {
+		return nil
+	}
+
+	var hourly []models.HourlyUsage
+	for _, b := range bucketUsages(usages, func(t time.Time) time.Time { return truncateTo(t, "hour", time.UTC) }) {
+		hourly = append(hourly, models.HourlyUsage{
+			DeviceID:   deviceID,
+			Hour:       b.Start,
+			TotalUsage: b.TotalUsage,
+			FlowSum:    b.FlowSum,
+			MaxFlow:    b.MaxFlow,
+			Samples:    b.Samples,
+		})
+	}
+	if err := tx.Omit("Device").CreateInBatches(hourly, 500).Error; err != nil {
+		return fmt.Errorf("failed to rebuild hourly rollups: %w", err)
+	}
+
+	var daily []models.DailyUsage
+	for _, b := range bucketUsages(usages, func(t time.Time) time.Time { return RollupDate(t, loc) }) {
+		daily = append(daily, models.DailyUsage{
+			DeviceID:   deviceID,
+			Date:       b.Start,
+			TotalUsage: b.TotalUsage,
+			FlowSum:    b.FlowSum,
+			MaxFlow:    b.MaxFlow,
+			Samples:    b.Samples,
+		})
+	}
+	if err := tx.Omit("Device").CreateInBatches(daily, 500).Error; err != nil {
+		return fmt.Errorf("failed to rebuild daily rollups: %w", err)
+	}
+	return nil
+}
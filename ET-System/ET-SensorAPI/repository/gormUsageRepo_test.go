@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeriesAggregateMatchesBuckets(t *testing.T) {
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	lordHowe, _ := time.LoadLocation("Australia/Lord_Howe")
+	repo := &gormUsageRepo{timeBucket: true, dailyTimezone: "Asia/Jakarta"}
+	day := func(loc *time.Location) time.Time { return time.Date(2026, 3, 10, 0, 0, 0, 0, loc) }
+
+	for _, tc := range []struct {
+		name     string
+		unit     string
+		from, to time.Time
+		loc      *time.Location
+		want     string
+	}{
+		{"UTC hours", "hour", day(time.UTC), day(time.UTC).Add(6 * time.Hour), time.UTC, "water_usage_hourly"},
+		{"whole-hour zone", "hour", day(jakarta), day(jakarta).Add(6 * time.Hour), jakarta, "water_usage_hourly"},
+		{"half-hour zone", "hour", day(kolkata), day(kolkata).Add(6 * time.Hour), kolkata, ""},
+		// Lord Howe moves its clocks by half an hour on April 5, 2026.
+		{"half-hour DST change", "hour", day(lordHowe), day(lordHowe).AddDate(0, 1, 0), lordHowe, ""},
+		{"unaligned range", "hour", day(time.UTC).Add(time.Minute), day(time.UTC).Add(time.Hour), time.UTC, ""},
+		{"days in the aggregate's timezone", "day", day(jakarta), day(jakarta).AddDate(0, 0, 7), jakarta, "water_usage_daily"},
+		{"days elsewhere", "day", day(time.UTC), day(time.UTC).AddDate(0, 0, 7), time.UTC, ""},
+		{"weeks", "week", day(jakarta).AddDate(0, 0, -1), day(jakarta).AddDate(0, 0, 6), jakarta, ""},
+	} {
+		got, ok := repo.seriesAggregate(tc.unit, tc.from, tc.to, tc.loc)
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("%s: got %q, %v, want %q", tc.name, got, ok, tc.want)
+		}
+	}
+
+	plain := &gormUsageRepo{dailyTimezone: "Asia/Jakarta"}
+	if _, ok := plain.seriesAggregate("hour", day(time.UTC), day(time.UTC).Add(time.Hour), time.UTC); ok {
+		t.Error("expected no aggregate without a hypertable")
+	}
+}
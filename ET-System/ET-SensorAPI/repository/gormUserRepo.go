@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type gormUserRepo struct {
+	db *gorm.DB
+}
+
+func NewGormUserRepo(db *gorm.DB) UserRepo {
+	return &gormUserRepo{db: db}
+}
+
+func (r *gormUserRepo) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepo) GetByProvider(ctx context.Context, provider, providerID string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).
+		Where("provider = ? AND provider_id = ?", provider, providerID).
+		First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepo) List(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepo) ListWithMemberships(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).Preload("Memberships.UserGroup").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepo) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *gormUserRepo) Save(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Save(user).Error
+}
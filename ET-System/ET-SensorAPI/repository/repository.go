@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by lookups that match no row.
+var ErrNotFound = errors.New("record not found")
+
+type UserRepo interface {
+	GetByID(ctx context.Context, id uint) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByProvider(ctx context.Context, provider, providerID string) (*models.User, error)
+	List(ctx context.Context) ([]models.User, error)
+	// ListWithMemberships also loads each user's memberships and their groups.
+	ListWithMemberships(ctx context.Context) ([]models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	Save(ctx context.Context, user *models.User) error
+}
+
+type GroupRepo interface {
+	GetByID(ctx context.Context, id uint) (*models.UserGroup, error)
+	// GetWithDevices also loads the group's devices.
+	GetWithDevices(ctx context.Context, id uint) (*models.UserGroup, error)
+	ListWithDevices(ctx context.Context) ([]models.UserGroup, error)
+	// ListWithMembersAndUsage loads members and every device with its readings.
+	ListWithMembersAndUsage(ctx context.Context) ([]models.UserGroup, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.UserGroup, error)
+	Create(ctx context.Context, group *models.UserGroup) error
+	Save(ctx context.Context, group *models.UserGroup) error
+	AddLocation(ctx context.Context, groupID uint, location string) error
+
+	// Members returns the memberships of a group with users and group loaded.
+	Members(ctx context.Context, groupID uint) ([]models.UserGroupMember, error)
+	// MembershipsOfUser returns a user's memberships, oldest first.
+	MembershipsOfUser(ctx context.Context, userID uint) ([]models.UserGroupMember, error)
+	ListMembers(ctx context.Context) ([]models.UserGroupMember, error)
+	CountMembers(ctx context.Context, groupID uint) (int64, error)
+	GetMember(ctx context.Context, groupID, userID uint) (*models.UserGroupMember, error)
+	AddMember(ctx context.Context, member *models.UserGroupMember) error
+	SaveMember(ctx context.Context, member *models.UserGroupMember) error
+	RemoveMember(ctx context.Context, member *models.UserGroupMember) error
+
+	GetRetentionPolicy(ctx context.Context, groupID uint) (*models.RetentionPolicy, error)
+	ListRetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error)
+	SaveRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error
+}
+
+// DeviceRepo lookups preload the device's UserGroup so callers can resolve
+// its timezone.
+type DeviceRepo interface {
+	GetByID(ctx context.Context, id string) (*models.Device, error)
+	GetInGroup(ctx context.Context, groupID uint, id string) (*models.Device, error)
+	List(ctx context.Context) ([]models.Device, error)
+	// ListWithUsage also loads every reading of each device.
+	ListWithUsage(ctx context.Context) ([]models.Device, error)
+	ListByGroup(ctx context.Context, groupID uint) ([]models.Device, error)
+	ListByGroups(ctx context.Context, groupIDs []uint) ([]models.Device, error)
+	ListByLocation(ctx context.Context, groupID uint, location string) ([]models.Device, error)
+	Create(ctx context.Context, device *models.Device) error
+	// Delete removes a device together with its readings and rollups.
+	Delete(ctx context.Context, id string) error
+}
+
+// UsageWindow is a half-open [Start, End) time range.
+type UsageWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+type DeviceWindowTotals struct {
+	DeviceID      string
+	CurrentUsage  float64
+	PreviousUsage float64
+	LastYearUsage float64
+}
+
+// UsageBucketRow is one aggregated bucket of a usage series. Bucket holds the
+// wall clock of the bucket start in the requested timezone.
+type UsageBucketRow struct {
+	Bucket     time.Time
+	TotalUsage float64
+	AvgFlow    float64
+	MaxFlow    float64
+	Samples    int64
+}
+
+type UsageLog struct {
+	DeviceName string    `json:"device_name"`
+	FlowRate   float64   `json:"flow_rate"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// RetentionCutoffs are the boundaries of one device's retention run. A zero
+// time disables that stage.
+type RetentionCutoffs struct {
+	Raw    time.Time
+	Minute time.Time
+	MaxAge time.Time
+}
+
+type RetentionCounts struct {
+	ToMinute int64
+	ToHour   int64
+	Purged   int64
+}
+
+type UsageRepo interface {
+	Create(ctx context.Context, usage *models.WaterUsage) error
+	// AddToRollups folds a new reading into the hourly and daily rollups,
+	// using loc for the day boundary.
+	AddToRollups(ctx context.Context, usage models.WaterUsage, loc *time.Location) error
+	List(ctx context.Context) ([]models.WaterUsage, error)
+	// ListSince returns readings recorded at or after since. A nil deviceIDs
+	// means every device.
+	ListSince(ctx context.Context, since time.Time, deviceIDs []string) ([]models.WaterUsage, error)
+	GroupLogs(ctx context.Context, groupID uint) ([]UsageLog, error)
+
+	Series(ctx context.Context, deviceIDs []string, from, to time.Time, unit string, loc *time.Location) ([]UsageBucketRow, error)
+	SumByWindows(ctx context.Context, deviceIDs []string, current, previous, lastYear UsageWindow) ([]DeviceWindowTotals, error)
+
+	Hourly(ctx context.Context, deviceID string, start, end time.Time) ([]models.HourlyUsage, error)
+	// SumUsage totals the usage of a device in [start, end). Whole hours
+	// come from the hourly rollups and partial hours at either end, which
+	// days in zones with non-whole-hour offsets have, from the readings.
+	SumUsage(ctx context.Context, deviceID string, start, end time.Time) (float64, error)
+	DeviceTotal(ctx context.Context, deviceID string) (float64, error)
+	// CountActiveDevices counts the devices with a reading at or after since.
+	CountActiveDevices(ctx context.Context, since time.Time) (int64, error)
+	GroupDeviceTotals(ctx context.Context, groupID uint) (map[string]float64, error)
+	GetDaily(ctx context.Context, deviceID string, date time.Time) (*models.DailyUsage, error)
+	MarkNotified(ctx context.Context, daily *models.DailyUsage) error
+
+	// ReadingRange returns the first and last reading of a device, or nils
+	// when it has none.
+	ReadingRange(ctx context.Context, deviceID string) (first, last *time.Time, err error)
+	// RebuildRollups recomputes the rollups of a device in [start, end),
+	// with days in loc. Days that were already notified stay notified.
+	RebuildRollups(ctx context.Context, deviceID string, start, end time.Time, loc *time.Location) error
+
+	CountRetention(ctx context.Context, deviceID string, cutoffs RetentionCutoffs) (RetentionCounts, error)
+	PurgeBefore(ctx context.Context, deviceID string, before time.Time, batch int) (int64, error)
+	FirstReadingBefore(ctx context.Context, deviceID string, before time.Time, resolutions []string) (*time.Time, error)
+	// Downsample replaces the rows of the given resolutions in [start, end)
+	// with one row per unit ("minute" or "hour") tagged with resolution.
+	Downsample(ctx context.Context, deviceID string, start, end time.Time, unit, resolution string, finer []string) error
+}
+
+type JobRunRepo interface {
+	Create(ctx context.Context, run *models.JobRun) error
+	Save(ctx context.Context, run *models.JobRun) error
+	// HasTickRun reports whether job already has a run for the cron tick at.
+	HasTickRun(ctx context.Context, job string, at time.Time) (bool, error)
+	// Recent returns the latest runs of job, newest first; an empty job
+	// means every job.
+	Recent(ctx context.Context, job string, limit int) ([]models.JobRun, error)
+	// Latest returns the newest run of each job that has run.
+	Latest(ctx context.Context) (map[string]models.JobRun, error)
+}
+
+type QueueRepo interface {
+	Enqueue(ctx context.Context, job *models.QueueJob) error
+	// Claim marks the next job of queue that is due at now, or whose lock
+	// is older than staleBefore, as running for worker. It returns
+	// ErrNotFound when there is nothing to do.
+	Claim(ctx context.Context, queue, worker string, now, staleBefore time.Time) (*models.QueueJob, error)
+	Save(ctx context.Context, job *models.QueueJob) error
+	// Complete stores the outcome of attempt of job while worker still holds
+	// its lock. It reports false, storing nothing, when the job was claimed
+	// again in the meantime, e.g. because the attempt outlived its lock.
+	Complete(ctx context.Context, job *models.QueueJob, worker string, attempt int) (bool, error)
+	GetByID(ctx context.Context, id uint) (*models.QueueJob, error)
+	// List returns the newest jobs, filtered by queue and status when they
+	// are not empty.
+	List(ctx context.Context, queue, status string, limit int) ([]models.QueueJob, error)
+	// PurgeFinished deletes succeeded and dead jobs finished before before.
+	PurgeFinished(ctx context.Context, before time.Time) (int64, error)
+}
+
+// OneTimeCodeRepo keeps at most one code per user and purpose.
+type OneTimeCodeRepo interface {
+	Get(ctx context.Context, userID uint, purpose string) (*models.OneTimeCode, error)
+	Save(ctx context.Context, code *models.OneTimeCode) error
+	// RecordFailure counts a wrong guess against the code.
+	RecordFailure(ctx context.Context, id uint) error
+	// Consume marks the code used at now. It reports false when the code was
+	// already consumed, e.g. by a concurrent request.
+	Consume(ctx context.Context, id uint, now time.Time) (bool, error)
+	// Delete drops the codes of the given purposes.
+	Delete(ctx context.Context, userID uint, purposes ...string) error
+}
+
+type SessionRepo interface {
+	Create(ctx context.Context, session *models.Session) error
+	GetByID(ctx context.Context, id uint) (*models.Session, error)
+	// ListActive returns the user's unrevoked, unexpired sessions, most
+	// recently used first.
+	ListActive(ctx context.Context, userID uint, now time.Time) ([]models.Session, error)
+	// Rotate moves an active session from generation to generation+1,
+	// recording the client and extending it to expiresAt. It reports false
+	// when the session is no longer at generation.
+	Rotate(ctx context.Context, session *models.Session, generation int, now, expiresAt time.Time) (bool, error)
+	// Revoke revokes one of the user's sessions; it reports false when there
+	// was no such active session.
+	Revoke(ctx context.Context, userID, id uint, reason string, now time.Time) (bool, error)
+	// RevokeAll revokes every active session of the user and returns how many.
+	RevokeAll(ctx context.Context, userID uint, reason string, now time.Time) (int64, error)
+}
+
+// TwoFactorRepo keeps the state of the second login step: pending login
+// challenges, remembered devices, recovery codes and the last accepted TOTP
+// time step.
+type TwoFactorRepo interface {
+	CreateChallenge(ctx context.Context, challenge *models.LoginChallenge) error
+	GetChallenge(ctx context.Context, id uint) (*models.LoginChallenge, error)
+	// RecordChallengeFailure counts a wrong code against the challenge.
+	RecordChallengeFailure(ctx context.Context, id uint) error
+	// CompleteChallenge marks the challenge completed at now. It reports
+	// false when it already was, e.g. by a concurrent request.
+	CompleteChallenge(ctx context.Context, id uint, now time.Time) (bool, error)
+
+	CreateTrustedDevice(ctx context.Context, device *models.TrustedDevice) error
+	GetTrustedDevice(ctx context.Context, id uint) (*models.TrustedDevice, error)
+	TouchTrustedDevice(ctx context.Context, id uint, now time.Time) error
+	// ListTrustedDevices returns the user's unexpired trusted devices, most
+	// recently used first.
+	ListTrustedDevices(ctx context.Context, userID uint, now time.Time) ([]models.TrustedDevice, error)
+	// DeleteTrustedDevice reports false when the user has no such device.
+	DeleteTrustedDevice(ctx context.Context, userID, id uint) (bool, error)
+	DeleteTrustedDevices(ctx context.Context, userID uint) error
+
+	// ReplaceRecoveryCodes drops the user's recovery codes and stores hashes
+	// as the new ones; no hashes leaves the user without any.
+	ReplaceRecoveryCodes(ctx context.Context, userID uint, hashes []string) error
+	// UseRecoveryCode marks the user's unused code with hash used at now and
+	// reports whether there was one.
+	UseRecoveryCode(ctx context.Context, userID uint, hash string, now time.Time) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID uint) (int64, error)
+
+	// UseTOTPStep records step as the user's last accepted TOTP time step. It
+	// reports false unless step is later than the one recorded before.
+	UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error)
+}
+
+// RateLimitRepo stores the token buckets of the database rate limit store.
+type RateLimitRepo interface {
+	Get(ctx context.Context, key string) (*models.RateLimitBucket, error)
+	// Create reports false when the bucket already exists, e.g. because a
+	// concurrent request created it.
+	Create(ctx context.Context, bucket *models.RateLimitBucket) (bool, error)
+	// Update stores bucket if it is still at version and bumps its version;
+	// it reports false when another update came first.
+	Update(ctx context.Context, bucket *models.RateLimitBucket, version int) (bool, error)
+	// DeleteFull drops the buckets that are full at now.
+	DeleteFull(ctx context.Context, now time.Time) (int64, error)
+}
+
+type NotificationRepo interface {
+	Create(ctx context.Context, notification *models.Notification) error
+	// Recent returns the latest notifications of the devices, newest first.
+	Recent(ctx context.Context, deviceIDs []string, limit int) ([]models.Notification, error)
+}
+
+// Repositories bundles the repositories handed to controllers, resolvers and
+// services.
+type Repositories struct {
+	Users         UserRepo
+	Groups        GroupRepo
+	Devices       DeviceRepo
+	Usage         UsageRepo
+	Notifications NotificationRepo
+	JobRuns       JobRunRepo
+	Queue         QueueRepo
+	OneTimeCodes  OneTimeCodeRepo
+	Sessions      SessionRepo
+	TwoFactor     TwoFactorRepo
+	RateLimits    RateLimitRepo
+
+	transact func(ctx context.Context, fn func(tx *Repositories) error) error
+}
+
+// New bundles repositories. transact runs fn with repositories bound to a
+// single transaction; when nil, fn simply runs against r itself.
+func New(users UserRepo, groups GroupRepo, devices DeviceRepo, usage UsageRepo, notifications NotificationRepo, jobRuns JobRunRepo,
+	queue QueueRepo, codes OneTimeCodeRepo, sessions SessionRepo, twoFactor TwoFactorRepo, rateLimits RateLimitRepo, transact func(ctx context.Context, fn func(tx *Repositories) error) error) *Repositories {
+	return &Repositories{
+		Users:         users,
+		Groups:        groups,
+		Devices:       devices,
+		Usage:         usage,
+		Notifications: notifications,
+		JobRuns:       jobRuns,
+		Queue:         queue,
+		OneTimeCodes:  codes,
+		Sessions:      sessions,
+		TwoFactor:     twoFactor,
+		RateLimits:    rateLimits,
+		transact:      transact,
+	}
+}
+
+// Transaction runs fn atomically; returning an error rolls everything back.
+func (r *Repositories) Transaction(ctx context.Context, fn func(tx *Repositories) error) error {
+	if r.transact == nil {
+		return fn(r)
+	}
+	return r.transact(ctx, fn)
+}
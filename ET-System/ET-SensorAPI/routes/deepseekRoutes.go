@@ -1,17 +1,21 @@
 package routes
 
 import (
+	"ET-SensorAPI/ai"
 	"ET-SensorAPI/config"
 	"ET-SensorAPI/controllers"
+	"ET-SensorAPI/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupDeepSeekRoutes(router *gin.Engine) {
+func SetupDeepSeekRoutes(router *gin.Engine, cfg *config.Config, repos *repository.Repositories, llm ai.Provider) {
+	deepSeekController := controllers.NewDeepSeekController(cfg, repos.Usage, llm)
+
 	deepseekGroup := router.Group("/deepseek")
 	{
 		deepseekGroup.GET("/analysis", func(c *gin.Context) {
-			controllers.GetUsageAnalysis(config.DB, c.Writer, c.Request)
+			deepSeekController.GetUsageAnalysis(c.Writer, c.Request)
 		})
 	}
 }
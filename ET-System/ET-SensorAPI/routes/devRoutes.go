@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/controllers"
+	"ET-SensorAPI/mail"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupDevRoutes mounts /dev/mail when DEV_ROUTES is set and mails are
+// captured in memory. Anyone who can reach it reads every sign-in and reset
+// code, so it is never mounted by the transport alone.
+func SetupDevRoutes(r *gin.Engine, cfg *config.Config, mailer mail.Sender) {
+	if !cfg.DevRoutes {
+		return
+	}
+	capture, ok := mailer.(*mail.Capture)
+	if !ok {
+		return
+	}
+	slog.Warn("DEV_ROUTES is on: /dev/mail serves every captured email without authentication; never enable it in production")
+	devMailController := controllers.NewDevMailController(capture)
+
+	dev := r.Group("/dev")
+	{
+		dev.GET("/mail", devMailController.ListMails)
+		dev.GET("/mail/:id", devMailController.ShowMail)
+		dev.DELETE("/mail", devMailController.ClearMails)
+	}
+}
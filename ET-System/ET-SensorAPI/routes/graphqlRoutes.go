@@ -1,8 +1,19 @@
 package routes
 
 import (
+	"ET-SensorAPI/ai"
+	"ET-SensorAPI/auth"
 	"ET-SensorAPI/config"
 	"ET-SensorAPI/graph"
+	"ET-SensorAPI/metrics"
+	"ET-SensorAPI/ratelimit"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/scheduler"
+	"ET-SensorAPI/tracing"
+	"context"
+	"errors"
+	"log/slog"
+	"runtime/debug"
 
 	"github.com/vektah/gqlparser/v2/ast"
 
@@ -14,8 +25,11 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func graphqlHandler() gin.HandlerFunc {
-	h := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{DB: config.DB}}))
+func graphqlHandler(cfg *config.Config, repos *repository.Repositories, jobs *scheduler.Scheduler, llm ai.Provider, limiter *ratelimit.Limiter) gin.HandlerFunc {
+	h := handler.New(graph.NewExecutableSchema(graph.Config{
+		Resolvers:  graph.NewResolver(cfg, repos, jobs, llm),
+		Directives: graph.DirectiveRoot{RateLimit: graph.RateLimitDirective(limiter)},
+	}))
 
 	h.AddTransport(transport.Options{})
 	h.AddTransport(transport.GET{})
@@ -23,6 +37,13 @@ func graphqlHandler() gin.HandlerFunc {
 
 	h.SetQueryCache(lru.New[*ast.QueryDocument](1000))
 
+	h.SetRecoverFunc(func(ctx context.Context, err any) error {
+		slog.ErrorContext(ctx, "graphql panic recovered", "panic", err, "stack", string(debug.Stack()))
+		return errors.New("internal server error")
+	})
+
+	h.Use(metrics.GraphQL{})
+	h.Use(tracing.GraphQL{})
 	h.Use(extension.Introspection{})
 	h.Use(extension.AutomaticPersistedQuery{
 		Cache: lru.New[string](100),
@@ -41,7 +62,7 @@ func playgroundHandler() gin.HandlerFunc {
 	}
 }
 
-func SetupGraphQLRoutes(r *gin.Engine) {
-	r.POST("/graphql/query", graphqlHandler())
+func SetupGraphQLRoutes(r *gin.Engine, cfg *config.Config, repos *repository.Repositories, jobs *scheduler.Scheduler, llm ai.Provider, limiter *ratelimit.Limiter) {
+	r.POST("/graphql/query", auth.Middleware(cfg.Auth), graphqlHandler(cfg, repos, jobs, llm, limiter))
 	r.GET("/graphql", playgroundHandler())
 }
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"ET-SensorAPI/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupHealthRoutes(r *gin.Engine, checker *health.Checker) {
+	r.GET("/healthz", checker.Live)
+	r.GET("/readyz", checker.Ready)
+}
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/metrics"
+	"ET-SensorAPI/repository"
+	"database/sql"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupMetricsRoutes(r *gin.Engine, cfg *config.Config, db *sql.DB, repos *repository.Repositories) {
+	window := time.Duration(cfg.Metrics.ActiveDeviceMinutes) * time.Minute
+	r.GET("/metrics", metrics.NewHandler(db, repos.Usage, window))
+}
@@ -1,55 +1,77 @@
 package routes
 
 import (
+	"ET-SensorAPI/auth"
+	"ET-SensorAPI/config"
 	"ET-SensorAPI/controllers"
+	"ET-SensorAPI/ratelimit"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(r *gin.Engine) {
-	api := r.Group("/api/v1")
+func SetupRouter(r *gin.Engine, cfg *config.Config, repos *repository.Repositories, limiter *ratelimit.Limiter) {
+	authController := controllers.NewAuthController(cfg, repos)
+	userController := controllers.NewUserController(repos.Users, repos.Groups)
+	userGroupController := controllers.NewUserGroupController(repos.Groups)
+	deviceController := controllers.NewDeviceController(repos.Devices, repos.Usage)
+	waterUsageController := controllers.NewWaterUsageController(repos)
+
+	authLimit := limiter.Middleware(
+		ratelimit.Rule{Name: services.RuleAuthIP, Rate: &cfg.RateLimit.AuthPerIP, Key: ratelimit.ByIP},
+		ratelimit.Rule{Name: services.RuleAuthAccount, Rate: &cfg.RateLimit.AuthPerAccount, Key: ratelimit.ByJSONField("email")},
+	)
+	ingestLimit := limiter.Middleware(
+		ratelimit.Rule{Name: services.RuleIngestDevice, Rate: &cfg.RateLimit.IngestPerDevice, Key: ratelimit.ByJSONField("device_id")},
+		ratelimit.Rule{Name: services.RuleIngestIP, Rate: &cfg.RateLimit.IngestPerIP, Key: ratelimit.ByIP},
+	)
+
+	api := r.Group("/api/v1", auth.Middleware(cfg.Auth))
 	{
 
 		userGroup := api.Group("/user-groups")
 		{
-			userGroup.POST("/", controllers.CreateUserGroup)
-			userGroup.GET("/", controllers.GetDeviceGroups)
-			userGroup.PUT("/:user_id/group", controllers.AssignUserToGroup)
-			userGroup.GET("/:uid/groups", controllers.GetUserGroupsByUserID)
+			userGroup.POST("/", userGroupController.CreateUserGroup)
+			userGroup.GET("/", userGroupController.GetDeviceGroups)
+			userGroup.PUT("/:user_id/group", userController.AssignUserToGroup)
+			userGroup.GET("/:uid/groups", userGroupController.GetUserGroupsByUserID)
 		}
 
-		authGroup := api.Group("/auth")
+		authGroup := api.Group("/auth", authLimit)
 		{
-			authGroup.POST("/register", controllers.Register)
-			authGroup.POST("/verify", controllers.VerifyEmail)
-			authGroup.POST("/login", controllers.Login)
+			authGroup.POST("/register", authController.Register)
+			authGroup.POST("/verify", authController.VerifyEmail)
+			authGroup.POST("/login", authController.Login)
+			authGroup.POST("/login/complete", authController.CompleteLogin)
+			authGroup.POST("/refresh", authController.RefreshToken)
 		}
 
 		users := api.Group("/users")
 		{
-			users.POST("/", controllers.CreateUser)
-			users.GET("/", controllers.GetUsers)
-			users.POST("/data", controllers.GetUserData)
-			users.POST("/members", controllers.AddUserToGroup)
+			users.POST("/", userController.CreateUser)
+			users.GET("/", userController.GetUsers)
+			users.POST("/data", userController.GetUserData)
+			users.POST("/members", userGroupController.AddUserToGroup)
 		}
 
 		deviceGroup := api.Group("/devices")
 		{
-			deviceGroup.POST("/", controllers.CreateDevice)
-			deviceGroup.GET("/", controllers.GetDevices)
-			deviceGroup.GET("/group/:group_id", controllers.GetDevicesByGroup)
+			deviceGroup.POST("/", deviceController.CreateDevice)
+			deviceGroup.GET("/", deviceController.GetDevices)
+			deviceGroup.GET("/group/:group_id", deviceController.GetDevicesByGroup)
 		}
 
 		waterGroup := api.Group("/water-usage")
 		{
-			waterGroup.POST("/", controllers.CreateWaterUsage)
-			waterGroup.GET("/", controllers.GetWaterUsage)
-			waterGroup.GET("/device/:device_id", controllers.GetDeviceWaterUsage)
+			waterGroup.POST("/", ingestLimit, waterUsageController.CreateWaterUsage)
+			waterGroup.GET("/", waterUsageController.GetWaterUsage)
+			waterGroup.GET("/device/:device_id", waterUsageController.GetDeviceWaterUsage)
 		}
 
 		logsGroup := api.Group("/device-logs")
 		{
-			logsGroup.GET("/group/:group_id", controllers.GetDeviceLogs)
+			logsGroup.GET("/group/:group_id", deviceController.GetDeviceLogs)
 		}
 	}
 }
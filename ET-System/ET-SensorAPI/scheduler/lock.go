@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+)
+
+// Locker hands out per-job locks. TryLock never blocks: ok is false when
+// the job is already locked, and release must be called once the job is
+// done.
+type Locker interface {
+	TryLock(ctx context.Context, job string) (release func(), ok bool, err error)
+}
+
+// NewLocalLocker returns a Locker that only guards jobs within this
+// process; it suits SQLite and single-replica deployments.
+func NewLocalLocker() Locker {
+	return &localLocker{held: map[string]bool{}}
+}
+
+type localLocker struct {
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+func (l *localLocker) TryLock(_ context.Context, job string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held[job] {
+		return nil, false, nil
+	}
+	l.held[job] = true
+	return func() {
+		l.mu.Lock()
+		delete(l.held, job)
+		l.mu.Unlock()
+	}, true, nil
+}
+
+// NewPostgresLocker returns a Locker backed by Postgres session advisory
+// locks, so only one replica sharing the database runs a job at a time.
+// Each held lock pins one connection from db until it is released.
+func NewPostgresLocker(db *sql.DB) Locker {
+	return &postgresLocker{db: db}
+}
+
+type postgresLocker struct {
+	db *sql.DB
+}
+
+func (l *postgresLocker) TryLock(ctx context.Context, job string) (func(), bool, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := lockKey(job)
+	var ok bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		// Session locks outlive a cancelled job, so unlock on a fresh context.
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			slog.Error("failed to release job lock", "job", job, "error", err)
+			// Discard the connection rather than pool it with the lock held.
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
+
+func lockKey(job string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("scheduler:" + job))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,346 @@
+// Package scheduler runs the background jobs of the API on cron schedules,
+// records every run in the job_runs table and makes sure only one replica
+// runs a given job at a time.
+package scheduler
+
+import (
+	"ET-SensorAPI/metrics"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	ErrJobBusy    = errors.New("job is already running")
+	ErrStopped    = errors.New("scheduler stopped")
+)
+
+// Job is a task run on a cron Schedule ("0 20 * * *", "@daily", ...)
+// evaluated in Timezone; an empty Timezone means UTC.
+type Job struct {
+	Name     string
+	Schedule string
+	Timezone string
+	Run      func(ctx context.Context) error
+}
+
+// JobInfo describes a registered job and when it fires next.
+type JobInfo struct {
+	Name     string
+	Schedule string
+	Timezone string
+	NextRun  time.Time
+}
+
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+	location *time.Location
+}
+
+type Scheduler struct {
+	entries  []entry
+	runs     repository.JobRunRepo
+	locker   Locker
+	instance string
+	now      func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	exited  map[string]bool
+}
+
+// New validates the job schedules. Runs are recorded in runs and guarded by
+// locker, see NewPostgresLocker and NewLocalLocker.
+func New(runs repository.JobRunRepo, locker Locker, jobs ...Job) (*Scheduler, error) {
+	s := &Scheduler{
+		runs:     runs,
+		locker:   locker,
+		instance: instanceName(),
+		now:      time.Now,
+		exited:   map[string]bool{},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	seen := map[string]bool{}
+	for _, job := range jobs {
+		if seen[job.Name] {
+			return nil, fmt.Errorf("job %s registered twice", job.Name)
+		}
+		seen[job.Name] = true
+
+		schedule, err := ParseSchedule(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", job.Name, err)
+		}
+		location := time.UTC
+		if job.Timezone != "" {
+			if location, err = time.LoadLocation(job.Timezone); err != nil {
+				return nil, fmt.Errorf("job %s: invalid timezone %q: %w", job.Name, job.Timezone, err)
+			}
+		}
+		s.entries = append(s.entries, entry{job: job, schedule: schedule, location: location})
+	}
+	return s, nil
+}
+
+// ParseSchedule parses a standard five-field cron expression or a
+// descriptor such as "@daily".
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+func instanceName() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Start launches one goroutine per job. They run until ctx is cancelled or
+// Stop is called.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.started = true
+	s.mu.Unlock()
+	context.AfterFunc(ctx, s.cancel)
+
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go s.loop(e)
+	}
+}
+
+func (s *Scheduler) loop(e entry) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		s.exited[e.job.Name] = true
+		s.mu.Unlock()
+	}()
+
+	for {
+		next := e.schedule.Next(s.now().In(e.location))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.runTick(s.ctx, e, next)
+		}
+	}
+}
+
+// runTick runs the scheduled pass of e due at tick unless another replica
+// holds the job's lock or has already recorded a run for that tick.
+func (s *Scheduler) runTick(ctx context.Context, e entry, tick time.Time) {
+	release, ok, err := s.locker.TryLock(ctx, e.job.Name)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to lock job", "job", e.job.Name, "error", err)
+		return
+	}
+	if !ok {
+		slog.DebugContext(ctx, "job locked by another instance", "job", e.job.Name)
+		return
+	}
+	defer release()
+
+	tick = tick.UTC()
+	done, err := s.runs.HasTickRun(ctx, e.job.Name, tick)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check job runs", "job", e.job.Name, "error", err)
+		return
+	}
+	if done {
+		return
+	}
+
+	run, err := s.begin(ctx, e.job.Name, TriggerSchedule, &tick)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record job run", "job", e.job.Name, "error", err)
+		return
+	}
+	s.execute(ctx, e.job, run)
+}
+
+// Trigger starts a manual run of the named job in the background and
+// returns its run record. It fails with ErrJobBusy when the job is running
+// here or on another replica.
+func (s *Scheduler) Trigger(ctx context.Context, name string) (*models.JobRun, error) {
+	e, ok := s.entry(name)
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil, ErrStopped
+	}
+
+	release, ok, err := s.locker.TryLock(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrJobBusy
+	}
+
+	run, err := s.begin(ctx, name, TriggerManual, nil)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	snapshot := *run
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer release()
+		s.execute(s.ctx, e.job, run)
+	}()
+	return &snapshot, nil
+}
+
+func (s *Scheduler) begin(ctx context.Context, name, trigger string, tick *time.Time) (*models.JobRun, error) {
+	run := &models.JobRun{
+		Job:         name,
+		Trigger:     trigger,
+		ScheduledAt: tick,
+		StartedAt:   s.now().UTC(),
+		Status:      models.JobRunning,
+		Instance:    s.instance,
+	}
+	if err := s.runs.Create(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// execute runs job, turning a panic into an error so that one bad run does
+// not kill the loop, and stores the outcome on run.
+func (s *Scheduler) execute(ctx context.Context, job Job, run *models.JobRun) {
+	ctx, span := tracing.Start(ctx, "job "+job.Name, trace.WithAttributes(
+		attribute.String("job.trigger", run.Trigger),
+		attribute.Int64("job.run_id", int64(run.ID)),
+	))
+	slog.InfoContext(ctx, "job started", "job", job.Name, "trigger", run.Trigger, "run_id", run.ID)
+	err := metrics.ObserveJob(job.Name, func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return job.Run(ctx)
+	})
+	tracing.End(span, err)
+
+	finished := s.now().UTC()
+	run.FinishedAt = &finished
+	run.Status = models.JobSucceeded
+	if err != nil {
+		run.Status = models.JobFailed
+		run.Error = err.Error()
+		if !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(ctx, "job failed", "job", job.Name, "run_id", run.ID, "error", err)
+		}
+	} else {
+		slog.InfoContext(ctx, "job finished", "job", job.Name, "run_id", run.ID,
+			"duration", finished.Sub(run.StartedAt))
+	}
+
+	// The run is recorded even when shutdown cancelled the job.
+	if err := s.runs.Save(context.WithoutCancel(ctx), run); err != nil {
+		slog.ErrorContext(ctx, "failed to record job run", "job", job.Name, "run_id", run.ID, "error", err)
+	}
+}
+
+func (s *Scheduler) entry(name string) (entry, bool) {
+	for _, e := range s.entries {
+		if e.job.Name == name {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// Jobs lists the registered jobs in registration order.
+func (s *Scheduler) Jobs() []JobInfo {
+	now := s.now()
+	infos := make([]JobInfo, 0, len(s.entries))
+	for _, e := range s.entries {
+		infos = append(infos, JobInfo{
+			Name:     e.job.Name,
+			Schedule: e.job.Schedule,
+			Timezone: e.location.String(),
+			NextRun:  e.schedule.Next(now.In(e.location)),
+		})
+	}
+	return infos
+}
+
+// Stop cancels the jobs and waits for running passes to finish, or for ctx
+// to expire.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("jobs still running: %w", ctx.Err())
+	}
+}
+
+// Alive reports an error when the scheduler was never started, has been
+// stopped, or a job loop has exited.
+func (s *Scheduler) Alive() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.stopped:
+		return ErrStopped
+	case !s.started:
+		return errors.New("scheduler not started")
+	}
+	for _, e := range s.entries {
+		if s.exited[e.job.Name] {
+			return fmt.Errorf("job %s is not running", e.job.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package scheduler
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryRuns is an in-memory JobRunRepo.
+type memoryRuns struct {
+	mu   sync.Mutex
+	runs []models.JobRun
+}
+
+func (m *memoryRuns) Create(_ context.Context, run *models.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run.ID = uint(len(m.runs) + 1)
+	m.runs = append(m.runs, *run)
+	return nil
+}
+
+func (m *memoryRuns) Save(_ context.Context, run *models.JobRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[run.ID-1] = *run
+	return nil
+}
+
+func (m *memoryRuns) HasTickRun(_ context.Context, job string, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, run := range m.runs {
+		if run.Job == job && run.ScheduledAt != nil && run.ScheduledAt.Equal(at) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryRuns) Recent(_ context.Context, job string, limit int) ([]models.JobRun, error) {
+	return nil, nil
+}
+
+func (m *memoryRuns) Latest(context.Context) (map[string]models.JobRun, error) {
+	return nil, nil
+}
+
+func (m *memoryRuns) get(id uint) models.JobRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.runs[id-1]
+}
+
+func newTestScheduler(t *testing.T, runs *memoryRuns, locker Locker, jobs ...Job) *Scheduler {
+	t.Helper()
+	s, err := New(runs, locker, jobs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop(context.Background()) })
+	return s
+}
+
+func waitFinished(t *testing.T, runs *memoryRuns, id uint) models.JobRun {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if run := runs.get(id); run.FinishedAt != nil {
+			return run
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("run %d did not finish", id)
+	return models.JobRun{}
+}
+
+func TestNewRejectsInvalidSchedules(t *testing.T) {
+	for _, job := range []Job{
+		{Name: "bad", Schedule: "every night"},
+		{Name: "bad", Schedule: "@daily", Timezone: "Mars/Olympus"},
+	} {
+		if _, err := New(&memoryRuns{}, NewLocalLocker(), job); err == nil {
+			t.Errorf("expected %+v to be rejected", job)
+		}
+	}
+}
+
+func TestJobsReportNextRunInTimezone(t *testing.T) {
+	s := newTestScheduler(t, &memoryRuns{}, NewLocalLocker(),
+		Job{Name: "nightly", Schedule: "0 20 * * *", Timezone: "Asia/Jakarta"})
+	s.now = func() time.Time { return time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+	jobs := s.Jobs()
+	want := time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC)
+	if len(jobs) != 1 || jobs[0].Timezone != "Asia/Jakarta" || !jobs[0].NextRun.Equal(want) {
+		t.Fatalf("expected the next run at 20:00 WIB (%s), got %+v", want, jobs)
+	}
+}
+
+func TestTriggerRecordsOutcome(t *testing.T) {
+	runs := &memoryRuns{}
+	s := newTestScheduler(t, runs, NewLocalLocker(),
+		Job{Name: "ok", Schedule: "@daily", Run: func(context.Context) error { return nil }},
+		Job{Name: "failing", Schedule: "@daily", Run: func(context.Context) error { return errors.New("smtp down") }},
+		Job{Name: "panicking", Schedule: "@daily", Run: func(context.Context) error { panic("boom") }},
+	)
+
+	for name, want := range map[string]struct{ status, err string }{
+		"ok":        {models.JobSucceeded, ""},
+		"failing":   {models.JobFailed, "smtp down"},
+		"panicking": {models.JobFailed, "panic: boom"},
+	} {
+		run, err := s.Trigger(context.Background(), name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if run.Trigger != TriggerManual || run.Status != models.JobRunning || run.ScheduledAt != nil {
+			t.Fatalf("%s: unexpected run %+v", name, run)
+		}
+		got := waitFinished(t, runs, run.ID)
+		if got.Status != want.status || got.Error != want.err {
+			t.Errorf("%s: got %s %q, want %s %q", name, got.Status, got.Error, want.status, want.err)
+		}
+	}
+
+	if _, err := s.Trigger(context.Background(), "missing"); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("expected ErrUnknownJob, got %v", err)
+	}
+}
+
+func TestTriggerRejectsRunningJobAndStopWaits(t *testing.T) {
+	started := make(chan struct{})
+	var finished atomic.Bool
+	runs := &memoryRuns{}
+	s := newTestScheduler(t, runs, NewLocalLocker(), Job{
+		Name:     "slow",
+		Schedule: "@daily",
+		Run: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			finished.Store(true)
+			return ctx.Err()
+		},
+	})
+
+	run, err := s.Trigger(context.Background(), "slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := s.Trigger(context.Background(), "slow"); !errors.Is(err, ErrJobBusy) {
+		t.Fatalf("expected ErrJobBusy, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !finished.Load() {
+		t.Fatal("Stop returned before the job finished")
+	}
+	if got := runs.get(run.ID); got.Status != models.JobFailed || got.FinishedAt == nil {
+		t.Fatalf("a cancelled run should still be recorded, got %+v", got)
+	}
+	if _, err := s.Trigger(context.Background(), "slow"); !errors.Is(err, ErrStopped) {
+		t.Fatalf("expected ErrStopped, got %v", err)
+	}
+}
+
+func TestTickRunsOnceAcrossInstances(t *testing.T) {
+	var count atomic.Int32
+	runs := &memoryRuns{}
+	locker := NewLocalLocker()
+	job := Job{Name: "nightly", Schedule: "0 20 * * *", Run: func(context.Context) error {
+		count.Add(1)
+		return nil
+	}}
+	a := newTestScheduler(t, runs, locker, job)
+	b := newTestScheduler(t, runs, locker, job)
+
+	tick := time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC)
+	a.runTick(context.Background(), a.entries[0], tick)
+	b.runTick(context.Background(), b.entries[0], tick)
+
+	if count.Load() != 1 {
+		t.Fatalf("expected one run for the tick, got %d", count.Load())
+	}
+	if run := runs.get(1); run.Trigger != TriggerSchedule || run.ScheduledAt == nil || !run.ScheduledAt.Equal(tick) {
+		t.Fatalf("unexpected run %+v", run)
+	}
+}
+
+func TestAliveFollowsLifecycle(t *testing.T) {
+	s := newTestScheduler(t, &memoryRuns{}, NewLocalLocker(), Job{Name: "nightly", Schedule: "@daily"})
+	if err := s.Alive(); err == nil {
+		t.Fatal("scheduler should not be alive before Start")
+	}
+	s.Start(context.Background())
+	if err := s.Alive(); err != nil {
+		t.Fatalf("expected alive, got %v", err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Alive(); err == nil {
+		t.Fatal("stopped scheduler should not be alive")
+	}
+}
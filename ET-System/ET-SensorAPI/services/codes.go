@@ -0,0 +1,37 @@
+package services
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/otp"
+	"ET-SensorAPI/repository"
+	"context"
+	"errors"
+)
+
+// SendCode issues user's one-time code for purpose and queues the mail
+// carrying it. Run it in the transaction of the change that needs the code;
+// it fails with an *otp.ThrottledError when the user asked too often.
+func SendCode(ctx context.Context, cfg *config.Config, tx *repository.Repositories, user *models.User, purpose string) error {
+	code, err := otp.Issue(ctx, cfg, tx.OneTimeCodes, user.ID, purpose)
+	if err != nil {
+		return err
+	}
+	return EnqueueVerificationEmail(ctx, tx.Queue, user, purpose, code)
+}
+
+// EmailCodePurposes are the codes that confirm an address: the signup
+// code, or the code mailed to a changed address. Login codes complete a login
+// challenge and reset codes are exchanged for a reset token instead.
+func EmailCodePurposes() []string {
+	return []string{models.CodeSignup, models.CodeEmailChange}
+}
+
+// IsCodeError reports whether err is a one-time code, login challenge or
+// authenticator app error that is safe to show the user.
+func IsCodeError(err error) bool {
+	var throttled *otp.ThrottledError
+	return errors.As(err, &throttled) || errors.Is(err, otp.ErrInvalid) || errors.Is(err, otp.ErrLocked) ||
+		errors.Is(err, otp.ErrInvalidToken) || errors.Is(err, ErrInvalidChallenge) || errors.Is(err, ErrTwoFactorMethod) ||
+		errors.Is(err, ErrTOTPEnabled) || errors.Is(err, ErrTOTPNotEnabled) || errors.Is(err, ErrTOTPNotSetUp)
+}
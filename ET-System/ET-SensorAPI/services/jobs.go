@@ -0,0 +1,66 @@
+package services
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/scheduler"
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// ScheduledJobs are the background jobs of the API with their schedules
+// from cfg.
+func ScheduledJobs(cfg *config.Config, repos *repository.Repositories) []scheduler.Job {
+	notifier := NewNotificationService(repos)
+	retention := NewRetentionService(repos.Devices, repos.Groups, repos.Usage, DefaultRetentionSettings(cfg.Retention))
+
+	return []scheduler.Job{
+		{
+			Name:     "usage_notifications",
+			Schedule: cfg.Jobs.UsageNotifications.Schedule,
+			Timezone: cfg.JobTimezone(cfg.Jobs.UsageNotifications),
+			Run: func(ctx context.Context) error {
+				queued, err := notifier.EnqueueUsageChecks(ctx)
+				if err != nil {
+					return err
+				}
+				slog.InfoContext(ctx, "usage checks queued", "devices", queued)
+				return nil
+			},
+		},
+		{
+			Name:     "retention",
+			Schedule: cfg.Jobs.Retention.Schedule,
+			Timezone: cfg.JobTimezone(cfg.Jobs.Retention),
+			Run: func(ctx context.Context) error {
+				reports, err := retention.ApplyRetention(ctx, time.Now(), 0, false)
+				if err != nil {
+					return err
+				}
+				slog.InfoContext(ctx, "retention applied", "devices", len(reports))
+
+				if cfg.Queue.Retention > 0 {
+					purged, err := repos.Queue.PurgeFinished(ctx, time.Now().UTC().Add(-cfg.Queue.Retention))
+					if err != nil {
+						return err
+					}
+					slog.InfoContext(ctx, "finished queue jobs purged", "jobs", purged)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// NewScheduler builds the scheduler for the jobs of the API. On Postgres
+// replicas coordinate through advisory locks; SQLite is single-process, so
+// an in-process lock suffices.
+func NewScheduler(cfg *config.Config, repos *repository.Repositories, sqlDB *sql.DB) (*scheduler.Scheduler, error) {
+	locker := scheduler.NewLocalLocker()
+	if cfg.Database.Driver == "postgres" {
+		locker = scheduler.NewPostgresLocker(sqlDB)
+	}
+	return scheduler.New(repos.JobRuns, locker, ScheduledJobs(cfg, repos)...)
+}
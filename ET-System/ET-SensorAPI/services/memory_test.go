@@ -0,0 +1,399 @@
+package services
+
+import (
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/utils"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The in-memory repositories below implement what the services use. They
+// embed their interface, so calling anything else panics.
+
+type memoryGroups struct {
+	repository.GroupRepo
+	mu       sync.Mutex
+	groups   map[uint]models.UserGroup
+	policies map[uint]models.RetentionPolicy
+}
+
+func newMemoryGroups(groups ...models.UserGroup) *memoryGroups {
+	m := &memoryGroups{groups: map[uint]models.UserGroup{}, policies: map[uint]models.RetentionPolicy{}}
+	for _, group := range groups {
+		m.groups[group.ID] = group
+	}
+	return m
+}
+
+func (m *memoryGroups) GetByID(_ context.Context, id uint) (*models.UserGroup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	group, ok := m.groups[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &group, nil
+}
+
+func (m *memoryGroups) GetRetentionPolicy(_ context.Context, groupID uint) (*models.RetentionPolicy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	policy, ok := m.policies[groupID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &policy, nil
+}
+
+func (m *memoryGroups) ListRetentionPolicies(context.Context) ([]models.RetentionPolicy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	policies := make([]models.RetentionPolicy, 0, len(m.policies))
+	for _, policy := range m.policies {
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func (m *memoryGroups) SaveRetentionPolicy(_ context.Context, policy *models.RetentionPolicy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policies[policy.UserGroupID] = *policy
+	return nil
+}
+
+// memoryDevices preloads UserGroup from groups, like the gorm repository.
+type memoryDevices struct {
+	repository.DeviceRepo
+	groups  *memoryGroups
+	mu      sync.Mutex
+	devices []models.Device
+}
+
+func (m *memoryDevices) Create(_ context.Context, device *models.Device) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.devices = append(m.devices, *device)
+	return nil
+}
+
+func (m *memoryDevices) withGroup(device models.Device) models.Device {
+	if group, err := m.groups.GetByID(context.Background(), device.UserGroupID); err == nil {
+		device.UserGroup = *group
+	}
+	return device
+}
+
+func (m *memoryDevices) GetByID(_ context.Context, id string) (*models.Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, device := range m.devices {
+		if device.ID == id {
+			device = m.withGroup(device)
+			return &device, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (m *memoryDevices) List(context.Context) ([]models.Device, error) {
+	return m.filter(func(models.Device) bool { return true }), nil
+}
+
+func (m *memoryDevices) ListByGroup(_ context.Context, groupID uint) ([]models.Device, error) {
+	return m.filter(func(d models.Device) bool { return d.UserGroupID == groupID }), nil
+}
+
+func (m *memoryDevices) filter(keep func(models.Device) bool) []models.Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var devices []models.Device
+	for _, device := range m.devices {
+		if keep(device) {
+			devices = append(devices, m.withGroup(device))
+		}
+	}
+	return devices
+}
+
+type rollupKey struct {
+	deviceID string
+	date     time.Time
+}
+
+// memoryUsage keeps readings and rollups. Rollups are maintained by
+// AddToRollups and RebuildRollups only, as in the database.
+type memoryUsage struct {
+	repository.UsageRepo
+	mu       sync.Mutex
+	readings []models.WaterUsage
+	hourly   map[rollupKey]models.HourlyUsage
+	daily    map[rollupKey]models.DailyUsage
+	nextID   uint
+}
+
+func newMemoryUsage() *memoryUsage {
+	return &memoryUsage{hourly: map[rollupKey]models.HourlyUsage{}, daily: map[rollupKey]models.DailyUsage{}}
+}
+
+func (m *memoryUsage) Create(_ context.Context, usage *models.WaterUsage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if usage.Resolution == "" {
+		usage.Resolution = models.ResolutionRaw
+	}
+	if usage.Samples == 0 {
+		usage.Samples = 1
+	}
+	m.readings = append(m.readings, *usage)
+	return nil
+}
+
+func (m *memoryUsage) AddToRollups(_ context.Context, usage models.WaterUsage, loc *time.Location) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addToRollups(usage, loc)
+	return nil
+}
+
+func (m *memoryUsage) addToRollups(usage models.WaterUsage, loc *time.Location) {
+	hour := rollupKey{usage.DeviceID, usage.RecordedAt.UTC().Truncate(time.Hour)}
+	h := m.hourly[hour]
+	h.DeviceID, h.Hour = hour.deviceID, hour.date
+	h.TotalUsage += usage.TotalUsage
+	h.FlowSum += usage.FlowRate * float64(usage.Samples)
+	h.MaxFlow = max(h.MaxFlow, usage.FlowRate)
+	h.Samples += usage.Samples
+	m.hourly[hour] = h
+
+	day := rollupKey{usage.DeviceID, repository.RollupDate(usage.RecordedAt, loc)}
+	d, ok := m.daily[day]
+	if !ok {
+		m.nextID++
+		d = models.DailyUsage{ID: m.nextID, DeviceID: day.deviceID, Date: day.date}
+	}
+	d.TotalUsage += usage.TotalUsage
+	d.FlowSum += usage.FlowRate * float64(usage.Samples)
+	d.MaxFlow = max(d.MaxFlow, usage.FlowRate)
+	d.Samples += usage.Samples
+	m.daily[day] = d
+}
+
+func (m *memoryUsage) GetDaily(_ context.Context, deviceID string, date time.Time) (*models.DailyUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	daily, ok := m.daily[rollupKey{deviceID, date}]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &daily, nil
+}
+
+func (m *memoryUsage) MarkNotified(_ context.Context, daily *models.DailyUsage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := rollupKey{daily.DeviceID, daily.Date}
+	d := m.daily[key]
+	d.Notified = true
+	m.daily[key] = d
+	return nil
+}
+
+func (m *memoryUsage) ReadingRange(_ context.Context, deviceID string) (*time.Time, *time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var first, last *time.Time
+	for _, r := range m.readings {
+		if r.DeviceID != deviceID {
+			continue
+		}
+		at := r.RecordedAt
+		if first == nil || at.Before(*first) {
+			first = &at
+		}
+		if last == nil || at.After(*last) {
+			last = &at
+		}
+	}
+	return first, last, nil
+}
+
+func (m *memoryUsage) RebuildRollups(_ context.Context, deviceID string, start, end time.Time, loc *time.Location) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.hourly {
+		if key.deviceID == deviceID && !key.date.Before(start) && key.date.Before(end) {
+			delete(m.hourly, key)
+		}
+	}
+	notified := map[time.Time]bool{}
+	from, to := repository.RollupDate(start, loc), repository.RollupDate(end, loc)
+	for key, daily := range m.daily {
+		if key.deviceID == deviceID && !key.date.Before(from) && key.date.Before(to) {
+			notified[key.date] = daily.Notified
+			delete(m.daily, key)
+		}
+	}
+	for _, r := range m.readings {
+		if r.DeviceID == deviceID && !r.RecordedAt.Before(start) && r.RecordedAt.Before(end) {
+			m.addToRollups(r, loc)
+		}
+	}
+	for date, was := range notified {
+		if d, ok := m.daily[rollupKey{deviceID, date}]; ok && was {
+			d.Notified = true
+			m.daily[rollupKey{deviceID, date}] = d
+		}
+	}
+	return nil
+}
+
+func (m *memoryUsage) deviceReadings(deviceID string) []models.WaterUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var readings []models.WaterUsage
+	for _, r := range m.readings {
+		if r.DeviceID == deviceID {
+			readings = append(readings, r)
+		}
+	}
+	sort.Slice(readings, func(i, j int) bool { return readings[i].RecordedAt.Before(readings[j].RecordedAt) })
+	return readings
+}
+
+func (m *memoryUsage) CountRetention(_ context.Context, deviceID string, cutoffs repository.RetentionCutoffs) (repository.RetentionCounts, error) {
+	var counts repository.RetentionCounts
+	for _, r := range m.deviceReadings(deviceID) {
+		switch {
+		case !cutoffs.MaxAge.IsZero() && r.RecordedAt.Before(cutoffs.MaxAge):
+			counts.Purged++
+		case !cutoffs.Minute.IsZero() && r.RecordedAt.Before(cutoffs.Minute) && r.Resolution != models.ResolutionHour:
+			counts.ToHour++
+		case !cutoffs.Raw.IsZero() && r.RecordedAt.Before(cutoffs.Raw) && r.Resolution == models.ResolutionRaw:
+			counts.ToMinute++
+		}
+	}
+	return counts, nil
+}
+
+func (m *memoryUsage) PurgeBefore(_ context.Context, deviceID string, before time.Time, batch int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	kept := m.readings[:0]
+	for _, r := range m.readings {
+		if r.DeviceID == deviceID && r.RecordedAt.Before(before) && deleted < int64(batch) {
+			deleted++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	m.readings = kept
+	return deleted, nil
+}
+
+func (m *memoryUsage) FirstReadingBefore(_ context.Context, deviceID string, before time.Time, resolutions []string) (*time.Time, error) {
+	for _, r := range m.deviceReadings(deviceID) {
+		if r.RecordedAt.Before(before) && contains(resolutions, r.Resolution) {
+			return &r.RecordedAt, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryUsage) Downsample(_ context.Context, deviceID string, start, end time.Time, unit, resolution string, finer []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	step := time.Minute
+	if unit == "hour" {
+		step = time.Hour
+	}
+	merged := map[time.Time]*models.WaterUsage{}
+	kept := m.readings[:0]
+	for _, r := range m.readings {
+		if r.DeviceID != deviceID || r.RecordedAt.Before(start) || !r.RecordedAt.Before(end) || !contains(finer, r.Resolution) {
+			kept = append(kept, r)
+			continue
+		}
+		bucket := r.RecordedAt.UTC().Truncate(step)
+		row, ok := merged[bucket]
+		if !ok {
+			row = &models.WaterUsage{DeviceID: deviceID, RecordedAt: bucket, Resolution: resolution}
+			merged[bucket] = row
+		}
+		row.FlowRate = (row.FlowRate*float64(row.Samples) + r.FlowRate*float64(r.Samples)) / float64(row.Samples+r.Samples)
+		peak := max(row.PeakFlow(), r.PeakFlow())
+		row.MaxFlow = &peak
+		row.TotalUsage += r.TotalUsage
+		row.Samples += r.Samples
+	}
+	for _, row := range merged {
+		kept = append(kept, *row)
+	}
+	m.readings = kept
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryNotifications struct {
+	repository.NotificationRepo
+	mu            sync.Mutex
+	notifications []models.Notification
+}
+
+func (m *memoryNotifications) Create(_ context.Context, notification *models.Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifications = append(m.notifications, *notification)
+	return nil
+}
+
+// memoryRepos wires the in-memory repositories into a Repositories whose
+// transactions simply run in place.
+type memoryRepos struct {
+	groups        *memoryGroups
+	devices       *memoryDevices
+	usage         *memoryUsage
+	notifications *memoryNotifications
+}
+
+func newMemoryRepos(groups ...models.UserGroup) *memoryRepos {
+	g := newMemoryGroups(groups...)
+	return &memoryRepos{
+		groups:        g,
+		devices:       &memoryDevices{groups: g},
+		usage:         newMemoryUsage(),
+		notifications: &memoryNotifications{},
+	}
+}
+
+func (m *memoryRepos) repositories() *repository.Repositories {
+	return repository.New(nil, m.groups, m.devices, m.usage, m.notifications, nil, nil, nil, nil, nil, nil, nil)
+}
+
+// addReadings stores readings of deviceID and folds them into the rollups
+// in the device's timezone.
+func (m *memoryRepos) addReadings(deviceID string, readings ...models.WaterUsage) {
+	ctx := context.Background()
+	device, err := m.devices.GetByID(ctx, deviceID)
+	if err != nil {
+		panic(err)
+	}
+	loc := utils.ResolveLocation(nil, &device.UserGroup)
+	for _, r := range readings {
+		r.DeviceID = deviceID
+		m.usage.Create(ctx, &r)
+		m.usage.AddToRollups(ctx, r, loc)
+	}
+}
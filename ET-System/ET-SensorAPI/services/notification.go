@@ -1,50 +1,97 @@
-// services/notification_service.go
 package services
 
 import (
-	"ET-SensorAPI/config"
 	"ET-SensorAPI/models"
-	"fmt"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/utils"
+	"context"
+	"errors"
 	"time"
 )
 
-func CheckUsageNotifications() {
-	today := time.Now().UTC().Truncate(24 * time.Hour)
-	yesterday := today.AddDate(0, 0, -1)
+// NotificationService stores usage notifications. They belong to a device
+// rather than a person, so they keep a message key that each reader renders
+// in their own language.
+type NotificationService struct {
+	repos *repository.Repositories
+}
 
-	var devices []models.Device
-	config.DB.Preload("WaterUsages").Find(&devices)
+func NewNotificationService(repos *repository.Repositories) *NotificationService {
+	return &NotificationService{repos: repos}
+}
 
-	for _, device := range devices {
-		var todayUsage float64
-		for _, usage := range device.WaterUsages {
-			if usage.RecordedAt.After(today) {
-				todayUsage += usage.TotalUsage
-			}
-		}
+// EnqueueUsageChecks queues a usage check for every device and returns how
+// many it queued.
+func (s *NotificationService) EnqueueUsageChecks(ctx context.Context) (int, error) {
+	devices, err := s.repos.Devices.List(ctx)
+	if err != nil {
+		return 0, err
+	}
 
-		var dailyUsage models.DailyUsage
-		config.DB.Where("device_id = ? AND date = ?", device.ID, yesterday).First(&dailyUsage)
-
-		if dailyUsage.TotalUsage > 0 {
-			increase := ((todayUsage - dailyUsage.TotalUsage) / dailyUsage.TotalUsage) * 100
-			if increase > 0 {
-
-				message := fmt.Sprintf("Water usage increased by %.2f%% compared to yesterday", increase)
-				notification := models.Notification{
-					DeviceID:  device.ID,
-					Message:   message,
-					Threshold: increase,
-					CreatedAt: time.Now(),
-				}
-				config.DB.Create(&notification)
+	err = s.repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		for _, device := range devices {
+			if err := EnqueueUsageCheck(ctx, tx.Queue, device.ID); err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(devices), nil
+}
 
-		config.DB.Save(&models.DailyUsage{
-			DeviceID:   device.ID,
-			Date:       today,
-			TotalUsage: todayUsage,
-		})
+// CheckDevice notifies when the device used more water today than
+// yesterday, at most once per day.
+func (s *NotificationService) CheckDevice(ctx context.Context, deviceID string) error {
+	device, err := s.repos.Devices.GetByID(ctx, deviceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
+
+	loc := utils.ResolveLocation(nil, &device.UserGroup)
+	today := repository.RollupDate(time.Now(), loc)
+	yesterday := today.AddDate(0, 0, -1)
+
+	todayUsage, err := s.repos.Usage.GetDaily(ctx, device.ID, today)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dailyUsage, err := s.repos.Usage.GetDaily(ctx, device.ID, yesterday)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if dailyUsage.TotalUsage <= 0 || todayUsage.Notified {
+		return nil
+	}
+	increase := ((todayUsage.TotalUsage - dailyUsage.TotalUsage) / dailyUsage.TotalUsage) * 100
+	if increase <= 0 {
+		return nil
+	}
+
+	notification := models.Notification{
+		DeviceID:   device.ID,
+		MessageKey: "notification.usage.increased_short",
+		Threshold:  increase,
+		CreatedAt:  time.Now(),
+	}
+	// Retries must not notify twice, so the flag is set with the row.
+	return s.repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.Notifications.Create(ctx, &notification); err != nil {
+			return err
+		}
+		return tx.Usage.MarkNotified(ctx, todayUsage)
+	})
 }
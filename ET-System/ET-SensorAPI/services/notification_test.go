@@ -0,0 +1,85 @@
+package services
+
+import (
+	"ET-SensorAPI/i18n"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/utils"
+	"context"
+	"testing"
+	"time"
+)
+
+// seedUsage adds yesterday's and today's usage of a Jakarta device.
+func seedUsage(t *testing.T, yesterday, today float64) *memoryRepos {
+	t.Helper()
+	repos := newMemoryRepos(models.UserGroup{ID: 1, Name: "Household", Timezone: "Asia/Jakarta"})
+	repos.devices.Create(context.Background(), &models.Device{ID: "ET-0001", UserGroupID: 1})
+
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	start := utils.StartOfDay(time.Now(), loc)
+	if yesterday > 0 {
+		repos.addReadings("ET-0001", models.WaterUsage{FlowRate: 1, TotalUsage: yesterday, RecordedAt: start.Add(-12 * time.Hour)})
+	}
+	if today > 0 {
+		repos.addReadings("ET-0001", models.WaterUsage{FlowRate: 1, TotalUsage: today, RecordedAt: start.Add(time.Minute)})
+	}
+	return repos
+}
+
+func TestCheckDeviceNotifiesOncePerDay(t *testing.T) {
+	repos := seedUsage(t, 10, 15)
+	notifier := NewNotificationService(repos.repositories())
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := notifier.CheckDevice(ctx, "ET-0001"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(repos.notifications.notifications) != 1 {
+		t.Fatalf("expected one notification, got %+v", repos.notifications.notifications)
+	}
+	n := repos.notifications.notifications[0]
+	if n.DeviceID != "ET-0001" || n.Threshold != 50 {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+	for lang, want := range map[string]string{
+		i18n.English:    "Water usage increased by 50.00% compared to yesterday",
+		i18n.Indonesian: "Penggunaan air meningkat sebesar 50.00% dibandingkan kemarin",
+	} {
+		if got := utils.NotificationMessage(n, lang); got != want {
+			t.Errorf("%s message: got %q, want %q", lang, got, want)
+		}
+	}
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	today, err := repos.usage.GetDaily(ctx, "ET-0001", repository.RollupDate(time.Now(), loc))
+	if err != nil || !today.Notified {
+		t.Fatalf("expected today to be marked notified, got %+v, %v", today, err)
+	}
+}
+
+func TestCheckDeviceStaysQuiet(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		yesterday, today float64
+		device           string
+	}{
+		{"usage fell", 15, 10, "ET-0001"},
+		{"no usage yesterday", 0, 10, "ET-0001"},
+		{"no usage today", 10, 0, "ET-0001"},
+		{"unknown device", 10, 15, "ET-ffff"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repos := seedUsage(t, tc.yesterday, tc.today)
+			notifier := NewNotificationService(repos.repositories())
+			if err := notifier.CheckDevice(context.Background(), tc.device); err != nil {
+				t.Fatal(err)
+			}
+			if len(repos.notifications.notifications) != 0 {
+				t.Fatalf("expected no notification, got %+v", repos.notifications.notifications)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/ratelimit"
+	"ET-SensorAPI/repository"
+)
+
+// Rate limit rules; the name prefixes the bucket keys and labels rejections.
+const (
+	RuleAuthIP       = "auth_ip"
+	RuleAuthAccount  = "auth_account"
+	RuleIngestDevice = "ingest_device"
+	RuleIngestIP     = "ingest_ip"
+)
+
+// NewRateLimiter builds the rate limiter of the API, keeping its buckets
+// where cfg.RateLimit.Store says.
+func NewRateLimiter(cfg *config.Config, repos *repository.Repositories) *ratelimit.Limiter {
+	store := ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == config.RateLimitStoreDatabase {
+		store = ratelimit.NewDatabaseStore(repos.RateLimits)
+	}
+	return ratelimit.New(&cfg.RateLimit, store)
+}
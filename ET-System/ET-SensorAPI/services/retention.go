@@ -0,0 +1,236 @@
+package services
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// retentionBatchSize bounds how many rows a single purge statement deletes so
+// that no statement holds row locks on a large part of water_usages.
+const retentionBatchSize = 5000
+
+// RetentionSettings is the effective policy for a group, in days. Readings
+// older than RawDays are merged into minute rows, older than MinuteDays into
+// hour rows, and anything older than MaxAgeDays is deleted. 0 disables a
+// stage.
+type RetentionSettings struct {
+	RawDays    int
+	MinuteDays int
+	MaxAgeDays int
+}
+
+type DeviceRetentionReport struct {
+	DeviceID    string
+	UserGroupID uint
+	ToMinute    int64
+	ToHour      int64
+	Purged      int64
+}
+
+// DefaultRetentionSettings is the server-wide policy from the config.
+func DefaultRetentionSettings(cfg config.RetentionConfig) RetentionSettings {
+	return RetentionSettings{
+		RawDays:    cfg.RawDays,
+		MinuteDays: cfg.MinuteDays,
+		MaxAgeDays: cfg.MaxAgeDays,
+	}
+}
+
+// Merge applies a group's overrides on top of s.
+func (s RetentionSettings) Merge(policy *models.RetentionPolicy) RetentionSettings {
+	if policy == nil {
+		return s
+	}
+	if policy.RawDays != nil {
+		s.RawDays = *policy.RawDays
+	}
+	if policy.MinuteDays != nil {
+		s.MinuteDays = *policy.MinuteDays
+	}
+	if policy.MaxAgeDays != nil {
+		s.MaxAgeDays = *policy.MaxAgeDays
+	}
+	return s
+}
+
+func (s RetentionSettings) Validate() error {
+	if s.RawDays < 0 || s.MinuteDays < 0 || s.MaxAgeDays < 0 {
+		return fmt.Errorf("retention days must not be negative")
+	}
+	if s.RawDays > 0 && s.MinuteDays > 0 && s.MinuteDays < s.RawDays {
+		return fmt.Errorf("minute retention must not be shorter than raw retention")
+	}
+	for _, keep := range []int{s.RawDays, s.MinuteDays} {
+		if keep > 0 && s.MaxAgeDays > 0 && s.MaxAgeDays < keep {
+			return fmt.Errorf("maximum age must not be shorter than raw or minute retention")
+		}
+	}
+	return nil
+}
+
+func cutoff(now time.Time, days int) time.Time {
+	if days == 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+type RetentionService struct {
+	devices  repository.DeviceRepo
+	groups   repository.GroupRepo
+	usage    repository.UsageRepo
+	defaults RetentionSettings
+}
+
+func NewRetentionService(devices repository.DeviceRepo, groups repository.GroupRepo, usage repository.UsageRepo, defaults RetentionSettings) *RetentionService {
+	return &RetentionService{devices: devices, groups: groups, usage: usage, defaults: defaults}
+}
+
+// Defaults returns the policy of groups without overrides.
+func (s *RetentionService) Defaults() RetentionSettings {
+	return s.defaults
+}
+
+// ApplyRetention runs the retention policy of every device, or only the
+// devices of groupID when it is non-zero. With dryRun set nothing is changed
+// and the report lists the rows that would be downsampled or purged.
+func (s *RetentionService) ApplyRetention(ctx context.Context, now time.Time, groupID uint, dryRun bool) ([]DeviceRetentionReport, error) {
+	var devices []models.Device
+	var err error
+	if groupID != 0 {
+		devices, err = s.devices.ListByGroup(ctx, groupID)
+	} else {
+		devices, err = s.devices.List(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch devices: %w", err)
+	}
+
+	policies, err := s.groups.ListRetentionPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch retention policies: %w", err)
+	}
+	policyByGroup := make(map[uint]*models.RetentionPolicy, len(policies))
+	for i := range policies {
+		policyByGroup[policies[i].UserGroupID] = &policies[i]
+	}
+
+	defaults := s.defaults
+	reports := make([]DeviceRetentionReport, 0, len(devices))
+	for _, device := range devices {
+		settings := defaults.Merge(policyByGroup[device.UserGroupID])
+		if err := settings.Validate(); err != nil {
+			return nil, fmt.Errorf("group %d: %w", device.UserGroupID, err)
+		}
+
+		report, err := s.applyDeviceRetention(ctx, device, settings, now, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("device %s: %w", device.ID, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func (s *RetentionService) applyDeviceRetention(ctx context.Context, device models.Device, settings RetentionSettings, now time.Time, dryRun bool) (DeviceRetentionReport, error) {
+	report := DeviceRetentionReport{DeviceID: device.ID, UserGroupID: device.UserGroupID}
+	cutoffs := repository.RetentionCutoffs{
+		Raw:    cutoff(now, settings.RawDays),
+		Minute: cutoff(now, settings.MinuteDays),
+		MaxAge: cutoff(now, settings.MaxAgeDays),
+	}
+
+	counts, err := s.usage.CountRetention(ctx, device.ID, cutoffs)
+	if err != nil {
+		return report, err
+	}
+	report.ToMinute, report.ToHour, report.Purged = counts.ToMinute, counts.ToHour, counts.Purged
+
+	if dryRun {
+		return report, nil
+	}
+
+	if report.Purged > 0 {
+		if err := s.purgeReadings(ctx, device.ID, cutoffs.MaxAge); err != nil {
+			return report, err
+		}
+	}
+	if report.ToHour > 0 {
+		if err := s.downsampleReadings(ctx, device.ID, models.ResolutionHour, cutoffs.Minute, 24*time.Hour); err != nil {
+			return report, err
+		}
+	}
+	if report.ToMinute > 0 {
+		if err := s.downsampleReadings(ctx, device.ID, models.ResolutionMinute, cutoffs.Raw, 6*time.Hour); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (s *RetentionService) purgeReadings(ctx context.Context, deviceID string, before time.Time) error {
+	for {
+		deleted, err := s.usage.PurgeBefore(ctx, deviceID, before, retentionBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to purge readings: %w", err)
+		}
+		if deleted < retentionBatchSize {
+			return nil
+		}
+	}
+}
+
+// downsampleReadings merges finer rows older than before into one row per
+// minute or hour. Each window is rewritten in its own short transaction.
+func (s *RetentionService) downsampleReadings(ctx context.Context, deviceID, resolution string, before time.Time, window time.Duration) error {
+	finer := []string{models.ResolutionRaw}
+	unit := "minute"
+	if resolution == models.ResolutionHour {
+		finer = append(finer, models.ResolutionMinute)
+		unit = "hour"
+	}
+
+	first, err := s.usage.FirstReadingBefore(ctx, deviceID, before, finer)
+	if err != nil {
+		return fmt.Errorf("failed to find readings to downsample: %w", err)
+	}
+	if first == nil {
+		return nil
+	}
+
+	for start := first.UTC().Truncate(window); start.Before(before); start = start.Add(window) {
+		end := start.Add(window)
+		if end.After(before) {
+			// Never split a bucket across the cutoff.
+			end = before.UTC().Truncate(time.Hour)
+			if resolution == models.ResolutionMinute {
+				end = before.UTC().Truncate(time.Minute)
+			}
+			if !end.After(start) {
+				break
+			}
+		}
+
+		if err := s.usage.Downsample(ctx, deviceID, start, end, unit, resolution, finer); err != nil {
+			return fmt.Errorf("failed to downsample readings to %s: %w", resolution, err)
+		}
+	}
+	return nil
+}
+
+// GroupRetentionSettings returns the effective policy of a group.
+func (s *RetentionService) GroupRetentionSettings(ctx context.Context, groupID uint) (RetentionSettings, error) {
+	policy, err := s.groups.GetRetentionPolicy(ctx, groupID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return s.defaults, nil
+	}
+	if err != nil {
+		return RetentionSettings{}, err
+	}
+	return s.defaults.Merge(policy), nil
+}
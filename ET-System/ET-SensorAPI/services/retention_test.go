@@ -0,0 +1,141 @@
+package services
+
+import (
+	"ET-SensorAPI/models"
+	"context"
+	"testing"
+	"time"
+)
+
+func days(n int) *int { return &n }
+
+// seedRetention gives one device in each of two groups the same readings:
+// one past the maximum age, two in one minute past raw retention and two
+// in one hour past minute retention, besides a fresh one.
+func seedRetention(now time.Time) *memoryRepos {
+	repos := newMemoryRepos(models.UserGroup{ID: 1, Timezone: "UTC"}, models.UserGroup{ID: 2, Timezone: "UTC"})
+	ctx := context.Background()
+	for i, id := range []string{"ET-0001", "ET-0002"} {
+		repos.devices.Create(ctx, &models.Device{ID: id, UserGroupID: uint(i + 1)})
+		hourAgo := now.AddDate(0, 0, -60).Truncate(time.Hour)
+		minuteAgo := now.AddDate(0, 0, -10).Truncate(time.Minute)
+		for _, r := range []models.WaterUsage{
+			{RecordedAt: now.AddDate(0, 0, -400), FlowRate: 1, TotalUsage: 1},
+			{RecordedAt: hourAgo.Add(5 * time.Minute), FlowRate: 1, TotalUsage: 1},
+			{RecordedAt: hourAgo.Add(50 * time.Minute), FlowRate: 3, TotalUsage: 2},
+			{RecordedAt: minuteAgo.Add(10 * time.Second), FlowRate: 2, TotalUsage: 1},
+			{RecordedAt: minuteAgo.Add(40 * time.Second), FlowRate: 4, TotalUsage: 1},
+			{RecordedAt: now.AddDate(0, 0, -3), FlowRate: 1, TotalUsage: 1},
+		} {
+			r.DeviceID = id
+			repos.usage.Create(ctx, &r)
+		}
+	}
+	return repos
+}
+
+func countByResolution(readings []models.WaterUsage) map[string]int {
+	counts := map[string]int{}
+	for _, r := range readings {
+		counts[r.Resolution]++
+	}
+	return counts
+}
+
+func TestApplyRetentionFollowsGroupPolicies(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	repos := seedRetention(now)
+	ctx := context.Background()
+	repos.groups.SaveRetentionPolicy(ctx, &models.RetentionPolicy{UserGroupID: 2, RawDays: days(1)})
+	retention := NewRetentionService(repos.devices, repos.groups, repos.usage,
+		RetentionSettings{RawDays: 7, MinuteDays: 30, MaxAgeDays: 365})
+
+	reports, err := retention.ApplyRetention(ctx, now, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]DeviceRetentionReport{
+		"ET-0001": {DeviceID: "ET-0001", UserGroupID: 1, ToMinute: 2, ToHour: 2, Purged: 1},
+		"ET-0002": {DeviceID: "ET-0002", UserGroupID: 2, ToMinute: 3, ToHour: 2, Purged: 1},
+	}
+	for _, report := range reports {
+		if report != want[report.DeviceID] {
+			t.Errorf("got report %+v, want %+v", report, want[report.DeviceID])
+		}
+	}
+
+	first := countByResolution(repos.usage.deviceReadings("ET-0001"))
+	if first[models.ResolutionRaw] != 1 || first[models.ResolutionMinute] != 1 || first[models.ResolutionHour] != 1 {
+		t.Errorf("unexpected rows of the default policy: %v", first)
+	}
+	second := countByResolution(repos.usage.deviceReadings("ET-0002"))
+	if second[models.ResolutionRaw] != 0 || second[models.ResolutionMinute] != 2 || second[models.ResolutionHour] != 1 {
+		t.Errorf("unexpected rows of the overridden policy: %v", second)
+	}
+
+	for _, r := range repos.usage.deviceReadings("ET-0001") {
+		switch r.Resolution {
+		case models.ResolutionHour:
+			if r.TotalUsage != 3 || r.FlowRate != 2 || r.Samples != 2 || !r.RecordedAt.Equal(r.RecordedAt.Truncate(time.Hour)) {
+				t.Errorf("unexpected hour row %+v", r)
+			}
+		case models.ResolutionMinute:
+			if r.TotalUsage != 2 || r.FlowRate != 3 || r.Samples != 2 {
+				t.Errorf("unexpected minute row %+v", r)
+			}
+		}
+	}
+}
+
+func TestApplyRetentionDryRunChangesNothing(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	repos := seedRetention(now)
+	retention := NewRetentionService(repos.devices, repos.groups, repos.usage,
+		RetentionSettings{RawDays: 7, MinuteDays: 30, MaxAgeDays: 365})
+
+	reports, err := retention.ApplyRetention(context.Background(), now, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].DeviceID != "ET-0001" || reports[0].Purged != 1 {
+		t.Fatalf("expected a report of the group's device, got %+v", reports)
+	}
+	if n := len(repos.usage.readings); n != 12 {
+		t.Fatalf("a dry run must keep every reading, %d left", n)
+	}
+}
+
+func TestApplyRetentionRejectsInvalidPolicies(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	repos := seedRetention(now)
+	ctx := context.Background()
+	repos.groups.SaveRetentionPolicy(ctx, &models.RetentionPolicy{UserGroupID: 2, MaxAgeDays: days(3)})
+	retention := NewRetentionService(repos.devices, repos.groups, repos.usage,
+		RetentionSettings{RawDays: 7, MinuteDays: 30, MaxAgeDays: 365})
+
+	if _, err := retention.ApplyRetention(ctx, now, 2, false); err == nil {
+		t.Fatal("expected a maximum age shorter than raw retention to be rejected")
+	}
+	if n := len(repos.usage.readings); n != 12 {
+		t.Fatalf("an invalid policy must not touch readings, %d left", n)
+	}
+}
+
+func TestPurgeRunsInBatches(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	repos := newMemoryRepos(models.UserGroup{ID: 1, Timezone: "UTC"})
+	ctx := context.Background()
+	repos.devices.Create(ctx, &models.Device{ID: "ET-0001", UserGroupID: 1})
+	old := now.AddDate(-2, 0, 0)
+	for i := 0; i < retentionBatchSize+10; i++ {
+		repos.usage.Create(ctx, &models.WaterUsage{DeviceID: "ET-0001", RecordedAt: old.Add(time.Duration(i) * time.Second), TotalUsage: 1})
+	}
+	retention := NewRetentionService(repos.devices, repos.groups, repos.usage, RetentionSettings{MaxAgeDays: 365})
+
+	if _, err := retention.ApplyRetention(ctx, now, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(repos.usage.readings); n != 0 {
+		t.Fatalf("expected every old reading to be purged, %d left", n)
+	}
+}
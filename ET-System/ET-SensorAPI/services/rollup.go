@@ -0,0 +1,93 @@
+package services
+
+import (
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/utils"
+	"context"
+	"fmt"
+	"time"
+)
+
+type RollupService struct {
+	devices repository.DeviceRepo
+	usage   repository.UsageRepo
+}
+
+func NewRollupService(devices repository.DeviceRepo, usage repository.UsageRepo) *RollupService {
+	return &RollupService{devices: devices, usage: usage}
+}
+
+// RebuildRollups recomputes the hourly and daily rollups from raw readings.
+// The range is widened to whole days in each device's timezone. An empty
+// deviceID rebuilds every device; a zero from/to means all recorded data.
+func (s *RollupService) RebuildRollups(ctx context.Context, deviceID string, from, to time.Time) error {
+	var devices []models.Device
+	if deviceID != "" {
+		device, err := s.devices.GetByID(ctx, deviceID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch device %s: %w", deviceID, err)
+		}
+		devices = []models.Device{*device}
+	} else {
+		var err error
+		if devices, err = s.devices.List(ctx); err != nil {
+			return fmt.Errorf("failed to fetch devices: %w", err)
+		}
+	}
+
+	for _, device := range devices {
+		if err := s.rebuildDevice(ctx, device, from, to); err != nil {
+			return fmt.Errorf("device %s: %w", device.ID, err)
+		}
+	}
+	return nil
+}
+
+// RebuildGroup rebuilds all rollups of the devices of groupID, e.g. after
+// the group's timezone, and with it the days of its daily rollups, changed.
+func (s *RollupService) RebuildGroup(ctx context.Context, groupID uint) error {
+	devices, err := s.devices.ListByGroup(ctx, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch devices: %w", err)
+	}
+	for _, device := range devices {
+		if err := s.rebuildDevice(ctx, device, time.Time{}, time.Time{}); err != nil {
+			return fmt.Errorf("device %s: %w", device.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *RollupService) rebuildDevice(ctx context.Context, device models.Device, from, to time.Time) error {
+	full := from.IsZero() && to.IsZero()
+	if from.IsZero() || to.IsZero() {
+		first, last, err := s.usage.ReadingRange(ctx, device.ID)
+		if err != nil {
+			return fmt.Errorf("failed to find reading range: %w", err)
+		}
+		if first == nil {
+			return nil
+		}
+		if from.IsZero() {
+			from = *first
+		}
+		if to.IsZero() {
+			to = last.Add(time.Second)
+		}
+	}
+
+	loc := utils.ResolveLocation(nil, &device.UserGroup)
+	start := utils.StartOfDay(from, loc)
+	end := utils.StartOfDay(to, loc)
+	if end.Before(to) {
+		end = end.AddDate(0, 0, 1)
+	}
+	if full {
+		// Days left over from an earlier timezone may lie outside the
+		// readings' days in loc; zone offsets differ by at most 26 hours.
+		start, end = start.AddDate(0, 0, -2), end.AddDate(0, 0, 2)
+	}
+
+	return s.usage.RebuildRollups(ctx, device.ID, start, end, loc)
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRebuildRollupsUsesEachDevicesTimezone(t *testing.T) {
+	repos := newMemoryRepos(
+		models.UserGroup{ID: 1, Timezone: "Asia/Jakarta"},
+		models.UserGroup{ID: 2, Timezone: "UTC"},
+	)
+	ctx := context.Background()
+	repos.devices.Create(ctx, &models.Device{ID: "ET-0001", UserGroupID: 1})
+	repos.devices.Create(ctx, &models.Device{ID: "ET-0002", UserGroupID: 2})
+	at := time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+	for _, id := range []string{"ET-0001", "ET-0002"} {
+		repos.usage.Create(ctx, &models.WaterUsage{DeviceID: id, FlowRate: 2, TotalUsage: 5, RecordedAt: at})
+	}
+
+	if err := NewRollupService(repos.devices, repos.usage).RebuildRollups(ctx, "", time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 20:00 UTC is already March 11 in Jakarta.
+	for id, date := range map[string]time.Time{
+		"ET-0001": time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC),
+		"ET-0002": time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC),
+	} {
+		daily, err := repos.usage.GetDaily(ctx, id, date)
+		if err != nil || daily.TotalUsage != 5 || daily.Samples != 1 {
+			t.Errorf("%s: expected the reading on %s, got %+v, %v", id, date.Format(time.DateOnly), daily, err)
+		}
+	}
+	if len(repos.usage.hourly) != 2 {
+		t.Errorf("expected one hourly rollup per device, got %d", len(repos.usage.hourly))
+	}
+}
+
+func TestRebuildGroupFollowsNewTimezone(t *testing.T) {
+	repos := newMemoryRepos(
+		models.UserGroup{ID: 1, Timezone: "Asia/Jakarta"},
+		models.UserGroup{ID: 2, Timezone: "Asia/Jakarta"},
+	)
+	ctx := context.Background()
+	repos.devices.Create(ctx, &models.Device{ID: "ET-0001", UserGroupID: 1})
+	repos.devices.Create(ctx, &models.Device{ID: "ET-0002", UserGroupID: 2})
+	at := time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+	repos.addReadings("ET-0001", models.WaterUsage{FlowRate: 2, TotalUsage: 5, RecordedAt: at})
+	repos.addReadings("ET-0002", models.WaterUsage{FlowRate: 2, TotalUsage: 5, RecordedAt: at})
+
+	repos.groups.groups[1] = models.UserGroup{ID: 1, Timezone: "UTC"}
+	if err := NewRollupService(repos.devices, repos.usage).RebuildGroup(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	utcDay, jakartaDay := repository.RollupDate(at, time.UTC), repository.RollupDate(at, time.UTC).AddDate(0, 0, 1)
+	if daily, err := repos.usage.GetDaily(ctx, "ET-0001", utcDay); err != nil || daily.TotalUsage != 5 {
+		t.Errorf("expected the reading on its UTC day, got %+v, %v", daily, err)
+	}
+	if _, err := repos.usage.GetDaily(ctx, "ET-0001", jakartaDay); err == nil {
+		t.Error("expected the Jakarta day of the rebuilt group to be gone")
+	}
+	if _, err := repos.usage.GetDaily(ctx, "ET-0002", jakartaDay); err != nil {
+		t.Errorf("other groups must keep their rollups: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"ET-SensorAPI/auth"
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/utils"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, the session has been revoked; please log in again")
+)
+
+// Tokens are the access and refresh token of a session.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	Session      *models.Session
+}
+
+// StartSession signs userID in on a new session for the client of ctx.
+func StartSession(ctx context.Context, cfg *config.Config, sessions repository.SessionRepo, userID uint, deviceName string) (*Tokens, error) {
+	now := time.Now().UTC()
+	client := auth.ClientOf(ctx)
+	session := &models.Session{
+		UserID:     userID,
+		DeviceName: truncate(strings.TrimSpace(deviceName), 100),
+		IP:         truncate(client.IP, 64),
+		UserAgent:  truncate(client.UserAgent, 255),
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(cfg.Auth.RefreshTokenTTL),
+	}
+	if err := sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return signTokens(cfg, session)
+}
+
+// RefreshSession rotates the session of refreshToken and returns its new
+// tokens. A refresh token older than the session's current one revokes the
+// session, since it can only have been replayed.
+func RefreshSession(ctx context.Context, cfg *config.Config, sessions repository.SessionRepo, refreshToken string) (*Tokens, error) {
+	claims, err := utils.ValidateToken(cfg.Auth, refreshToken, utils.TokenRefresh)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	session, err := sessions.GetByID(ctx, claims.SessionID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && session.UserID != claims.UserID) {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if !session.Active(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if claims.Generation != session.Generation {
+		return nil, revokeReused(ctx, sessions, session, now)
+	}
+
+	client := auth.ClientOf(ctx)
+	session.IP = truncate(client.IP, 64)
+	session.UserAgent = truncate(client.UserAgent, 255)
+	rotated, err := sessions.Rotate(ctx, session, claims.Generation, now, now.Add(cfg.Auth.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// A concurrent refresh used the same token first.
+		return nil, revokeReused(ctx, sessions, session, now)
+	}
+	return signTokens(cfg, session)
+}
+
+// Authenticate returns the session of the caller of ctx, failing with
+// auth.ErrUnauthenticated unless it carries an access token of an active
+// session.
+func Authenticate(ctx context.Context, sessions repository.SessionRepo) (*models.Session, error) {
+	claims := auth.Claims(ctx)
+	if claims == nil {
+		return nil, auth.ErrUnauthenticated
+	}
+	session, err := sessions.GetByID(ctx, claims.SessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, auth.ErrUnauthenticated
+	} else if err != nil {
+		return nil, err
+	}
+	if session.UserID != claims.UserID || !session.Active(time.Now()) {
+		return nil, auth.ErrUnauthenticated
+	}
+	return session, nil
+}
+
+func revokeReused(ctx context.Context, sessions repository.SessionRepo, session *models.Session, now time.Time) error {
+	slog.WarnContext(ctx, "refresh token reused, revoking session", "user_id", session.UserID, "session_id", session.ID)
+	if _, err := sessions.Revoke(ctx, session.UserID, session.ID, models.RevokedReuse, now); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func signTokens(cfg *config.Config, session *models.Session) (*Tokens, error) {
+	access, refresh, err := utils.GenerateToken(cfg.Auth, session.UserID, session.ID, session.Generation)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{AccessToken: access, RefreshToken: refresh, Session: session}, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// IsSessionError reports whether err is a session error meant for the
+// caller.
+func IsSessionError(err error) bool {
+	return errors.Is(err, auth.ErrUnauthenticated) ||
+		errors.Is(err, auth.ErrForbidden) ||
+		errors.Is(err, ErrInvalidRefreshToken) ||
+		errors.Is(err, ErrRefreshTokenReused)
+}
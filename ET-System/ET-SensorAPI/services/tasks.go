@@ -0,0 +1,251 @@
+package services
+
+import (
+	"ET-SensorAPI/ai"
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/i18n"
+	"ET-SensorAPI/mail"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/queue"
+	"ET-SensorAPI/repository"
+	"ET-SensorAPI/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Kinds of queue jobs. The prefix before the dot names the queue.
+const (
+	TaskVerificationEmail = "email.verification"
+	TaskInvitationEmail   = "email.invitation"
+	TaskPasswordChanged   = "email.password_changed"
+	TaskUsageAnalysis     = "ai.usage_analysis"
+	TaskUsageCheck        = "notifications.usage_check"
+	TaskRebuildRollups    = "rollups.rebuild"
+)
+
+// Tasks carry the recipient's preferred language as stored; handlers resolve
+// it with Config.Language when they run.
+
+// VerificationEmailTask mails a one-time code. Jobs queued before codes had
+// a Purpose fall back on Verified to tell login codes from signups. Token is
+// blanked once the job is finished so that stored jobs do not keep codes.
+type VerificationEmailTask struct {
+	UserID   uint   `json:"user_id"`
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+	Purpose  string `json:"purpose,omitempty"`
+	Token    string `json:"token"`
+	Language string `json:"language,omitempty"`
+}
+
+type InvitationEmailTask struct {
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Group    string `json:"group"`
+	Language string `json:"language,omitempty"`
+}
+
+// PasswordChangedTask warns Email that its password was changed. The time
+// is shown in Timezone, or DefaultTimezone when it is empty.
+type PasswordChangedTask struct {
+	Email     string    `json:"email"`
+	ChangedAt time.Time `json:"changed_at"`
+	Timezone  string    `json:"timezone,omitempty"`
+	Language  string    `json:"language,omitempty"`
+}
+
+// UsageAnalysisTask analyzes the usage of a user's groups, or of one group
+// when GroupID is set. Without a Language a user's analysis is written in
+// their preferred language.
+type UsageAnalysisTask struct {
+	UserID   uint   `json:"user_id,omitempty"`
+	GroupID  uint   `json:"group_id,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+type UsageCheckTask struct {
+	DeviceID string `json:"device_id"`
+}
+
+type RebuildRollupsTask struct {
+	GroupID uint `json:"group_id"`
+}
+
+// EnqueueVerificationEmail queues the mail carrying user's one-time code for
+// purpose; see utils.SendVerificationEmail.
+func EnqueueVerificationEmail(ctx context.Context, q repository.QueueRepo, user *models.User, purpose, code string) error {
+	_, err := queue.Enqueue(ctx, q, TaskVerificationEmail, VerificationEmailTask{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Verified: user.Verified,
+		Purpose:  purpose,
+		Token:    code,
+		Language: user.Language,
+	})
+	return err
+}
+
+// EnqueueInvitationEmail queues the mail telling receiver that sender added
+// them to group.
+func EnqueueInvitationEmail(ctx context.Context, q repository.QueueRepo, sender string, receiver *models.User, group string) error {
+	_, err := queue.Enqueue(ctx, q, TaskInvitationEmail, InvitationEmailTask{
+		Sender:   sender,
+		Receiver: receiver.Email,
+		Group:    group,
+		Language: receiver.Language,
+	})
+	return err
+}
+
+// EnqueuePasswordChanged queues the mail telling user that their password
+// was changed at changedAt.
+func EnqueuePasswordChanged(ctx context.Context, q repository.QueueRepo, user *models.User, changedAt time.Time) error {
+	_, err := queue.Enqueue(ctx, q, TaskPasswordChanged, PasswordChangedTask{
+		Email:     user.Email,
+		ChangedAt: changedAt,
+		Timezone:  user.Timezone,
+		Language:  user.Language,
+	})
+	return err
+}
+
+func EnqueueUsageAnalysis(ctx context.Context, q repository.QueueRepo, task UsageAnalysisTask) (*models.QueueJob, error) {
+	if (task.UserID == 0) == (task.GroupID == 0) {
+		return nil, errors.New("set exactly one of userID and groupID")
+	}
+	return queue.Enqueue(ctx, q, TaskUsageAnalysis, task)
+}
+
+// EnqueueRebuildRollups queues a rebuild of the rollups of groupID's
+// devices.
+func EnqueueRebuildRollups(ctx context.Context, q repository.QueueRepo, groupID uint) error {
+	_, err := queue.Enqueue(ctx, q, TaskRebuildRollups, RebuildRollupsTask{GroupID: groupID})
+	return err
+}
+
+func EnqueueUsageCheck(ctx context.Context, q repository.QueueRepo, deviceID string) error {
+	_, err := queue.Enqueue(ctx, q, TaskUsageCheck, UsageCheckTask{DeviceID: deviceID})
+	return err
+}
+
+// AnalyzeUsage asks llm to summarize the usage selected by task.
+func AnalyzeUsage(ctx context.Context, cfg *config.Config, repos *repository.Repositories, llm ai.Provider, task UsageAnalysisTask) (string, error) {
+	var water []models.WaterUsage
+	var err error
+	if task.GroupID != 0 {
+		water, err = utils.GetGroupUsageData(ctx, repos, task.GroupID)
+	} else {
+		water, err = utils.GetUserUsageData(ctx, repos, task.UserID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	lang := task.Language
+	if lang == "" && task.UserID != 0 {
+		if user, err := repos.Users.GetByID(ctx, task.UserID); err == nil {
+			lang = user.Language
+		}
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"waterUsage": water,
+	})
+	if err != nil {
+		return "", err
+	}
+	return AnalyzeUsageData(ctx, llm, cfg.Language(lang), string(jsonData))
+}
+
+// AnalyzeUsageData asks llm for a short report on input, written in lang.
+func AnalyzeUsageData(ctx context.Context, llm ai.Provider, lang string, input string) (string, error) {
+	res, err := llm.Complete(ctx, ai.Request{Messages: []ai.Message{
+		{Role: ai.RoleUser, Content: i18n.T(lang, "ai.usage_prompt") + input},
+	}})
+	if err != nil {
+		return "", err
+	}
+	return res.Content, nil
+}
+
+// NewQueue builds the worker pool for the queue jobs of the API. Emails go
+// out through mailer and analyses are written by llm.
+func NewQueue(cfg *config.Config, repos *repository.Repositories, mailer mail.Sender, llm ai.Provider) *queue.Pool {
+	pool := queue.NewPool(repos.Queue, queue.Options{
+		Concurrency: map[string]int{
+			queue.QueueOf(TaskVerificationEmail): cfg.Queue.EmailConcurrency,
+			queue.QueueOf(TaskUsageAnalysis):     cfg.Queue.AIConcurrency,
+			queue.QueueOf(TaskUsageCheck):        cfg.Queue.NotificationsConcurrency,
+			queue.QueueOf(TaskRebuildRollups):    cfg.Queue.RollupsConcurrency,
+		},
+		PollInterval: cfg.Queue.PollInterval,
+		MaxAttempts:  cfg.Queue.MaxAttempts,
+		RetryBase:    cfg.Queue.RetryBase,
+		RetryMax:     cfg.Queue.RetryMax,
+		LockTimeout:  cfg.Queue.LockTimeout,
+	})
+	notifier := NewNotificationService(repos)
+	rollups := NewRollupService(repos.Devices, repos.Usage)
+
+	pool.Register(TaskVerificationEmail, handle(func(ctx context.Context, task VerificationEmailTask) (string, error) {
+		user := &models.User{ID: task.UserID, Email: task.Email, Verified: task.Verified}
+		purpose := task.Purpose
+		if purpose == "" {
+			purpose = models.CodeSignup
+			if task.Verified {
+				purpose = models.CodeLogin
+			}
+		}
+		if task.Token == "" {
+			// A retried job whose code was scrubbed; the user has to ask
+			// for a new one.
+			return "code no longer available", nil
+		}
+		return "", utils.SendVerificationEmail(ctx, mailer, cfg.Language(task.Language), user, purpose, task.Token, cfg.OTP.TTL)
+	}))
+	pool.Scrub(TaskVerificationEmail, func(payload []byte) ([]byte, error) {
+		var task VerificationEmailTask
+		if err := json.Unmarshal(payload, &task); err != nil {
+			return nil, err
+		}
+		task.Token = ""
+		return json.Marshal(task)
+	})
+	pool.Register(TaskInvitationEmail, handle(func(ctx context.Context, task InvitationEmailTask) (string, error) {
+		return "", utils.SendInvitationEmail(ctx, mailer, cfg.Language(task.Language), task.Sender, task.Receiver, task.Group)
+	}))
+	pool.Register(TaskPasswordChanged, handle(func(ctx context.Context, task PasswordChangedTask) (string, error) {
+		tz := task.Timezone
+		if tz == "" {
+			tz = cfg.DefaultTimezone
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			loc = time.UTC
+		}
+		return "", utils.SendPasswordChangedEmail(ctx, mailer, cfg.Language(task.Language), task.Email, task.ChangedAt, loc)
+	}))
+	pool.Register(TaskUsageAnalysis, handle(func(ctx context.Context, task UsageAnalysisTask) (string, error) {
+		return AnalyzeUsage(ctx, cfg, repos, llm, task)
+	}))
+	pool.Register(TaskUsageCheck, handle(func(ctx context.Context, task UsageCheckTask) (string, error) {
+		return "", notifier.CheckDevice(ctx, task.DeviceID)
+	}))
+	pool.Register(TaskRebuildRollups, handle(func(ctx context.Context, task RebuildRollupsTask) (string, error) {
+		return "", rollups.RebuildGroup(ctx, task.GroupID)
+	}))
+	return pool
+}
+
+// handle adapts a function taking a decoded payload to a queue.Handler.
+func handle[T any](fn func(ctx context.Context, task T) (string, error)) queue.Handler {
+	return func(ctx context.Context, payload []byte) (string, error) {
+		var task T
+		if err := json.Unmarshal(payload, &task); err != nil {
+			return "", err
+		}
+		return fn(ctx, task)
+	}
+}
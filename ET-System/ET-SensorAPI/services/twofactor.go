@@ -0,0 +1,364 @@
+package services
+
+import (
+	"ET-SensorAPI/config"
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/otp"
+	"ET-SensorAPI/repository"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidChallenge = errors.New("invalid or expired login challenge, please log in again")
+	ErrTwoFactorMethod  = errors.New("this verification method is not available for the account")
+	ErrTOTPEnabled      = errors.New("an authenticator app is already enabled")
+	ErrTOTPNotEnabled   = errors.New("no authenticator app is enabled")
+	ErrTOTPNotSetUp     = errors.New("set up an authenticator app first")
+)
+
+// LoginChallenge is a login waiting for its second step.
+type LoginChallenge struct {
+	ID        string
+	Methods   []string
+	ExpiresAt time.Time
+}
+
+// LoginResult holds the challenge of a login or, on a trusted device, the
+// tokens of its session.
+type LoginResult struct {
+	Challenge *LoginChallenge
+	Tokens    *Tokens
+}
+
+// TOTPSetup is a pending authenticator app secret and the URI to scan it.
+type TOTPSetup struct {
+	Secret string
+	URI    string
+}
+
+// TwoFactorMethods lists how user completes a login challenge, the default
+// first.
+func TwoFactorMethods(user *models.User) []string {
+	if user.TOTPEnabledAt != nil {
+		return []string{models.TwoFactorTOTP, models.TwoFactorRecoveryCode}
+	}
+	return []string{models.TwoFactorEmail}
+}
+
+// BeginLogin follows a successful password check. A valid trustedDevice
+// token of user starts a session right away; otherwise it opens a login
+// challenge and, for users without an authenticator app, mails the login
+// code.
+func BeginLogin(ctx context.Context, cfg *config.Config, repos *repository.Repositories, user *models.User, deviceName, trustedDevice string) (*LoginResult, error) {
+	now := time.Now().UTC()
+	device, err := trustedDeviceOf(ctx, repos.TwoFactor, user.ID, trustedDevice, now)
+	if err != nil {
+		return nil, err
+	}
+	if device != nil {
+		if err := repos.TwoFactor.TouchTrustedDevice(ctx, device.ID, now); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(deviceName) == "" {
+			deviceName = device.DeviceName
+		}
+		tokens, err := StartSession(ctx, cfg, repos.Sessions, user.ID, deviceName)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Tokens: tokens}, nil
+	}
+
+	secret, secretHash, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	challenge := &models.LoginChallenge{
+		UserID:     user.ID,
+		SecretHash: secretHash,
+		DeviceName: truncate(strings.TrimSpace(deviceName), 100),
+		ExpiresAt:  now.Add(cfg.TwoFactor.ChallengeTTL),
+	}
+	methods := TwoFactorMethods(user)
+	err = repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		if err := tx.TwoFactor.CreateChallenge(ctx, challenge); err != nil {
+			return err
+		}
+		if methods[0] != models.TwoFactorEmail {
+			return nil
+		}
+		// A throttled login still gets its challenge; the last code stays valid.
+		var throttled *otp.ThrottledError
+		if err := SendCode(ctx, cfg, tx, user, models.CodeLogin); err != nil && !errors.As(err, &throttled) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Challenge: &LoginChallenge{
+		ID:        joinToken(challenge.ID, secret),
+		Methods:   methods,
+		ExpiresAt: challenge.ExpiresAt,
+	}}, nil
+}
+
+// CompleteLogin checks code against the challenge and starts its session.
+// method is one of the user's TwoFactorMethods, or "" for the default, in
+// which case authenticator codes and recovery codes are told apart by their
+// shape. With remember set it also returns a trusted device token that lets
+// BeginLogin skip the challenge on this device. Wrong codes count against
+// the challenge, so do not run it inside a transaction.
+func CompleteLogin(ctx context.Context, cfg *config.Config, repos *repository.Repositories, challengeID, method, code string, remember bool) (*Tokens, string, error) {
+	now := time.Now().UTC()
+	challenge, err := openChallenge(ctx, cfg, repos.TwoFactor, challengeID, now)
+	if err != nil {
+		return nil, "", err
+	}
+	user, err := repos.Users.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := checkSecondFactor(ctx, cfg, repos, user, method, code, now); err != nil {
+		if !errors.Is(err, otp.ErrInvalid) && !errors.Is(err, otp.ErrLocked) {
+			return nil, "", err
+		}
+		if err := repos.TwoFactor.RecordChallengeFailure(ctx, challenge.ID); err != nil {
+			return nil, "", err
+		}
+		if challenge.Attempts+1 >= cfg.OTP.MaxAttempts {
+			return nil, "", ErrInvalidChallenge
+		}
+		return nil, "", err
+	}
+	completed, err := repos.TwoFactor.CompleteChallenge(ctx, challenge.ID, now)
+	if err != nil {
+		return nil, "", err
+	}
+	if !completed {
+		return nil, "", ErrInvalidChallenge
+	}
+
+	tokens, err := StartSession(ctx, cfg, repos.Sessions, user.ID, challenge.DeviceName)
+	if err != nil {
+		return nil, "", err
+	}
+	if !remember || cfg.TwoFactor.TrustedDeviceTTL == 0 {
+		return tokens, "", nil
+	}
+	secret, secretHash, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	device := &models.TrustedDevice{
+		UserID:     user.ID,
+		TokenHash:  secretHash,
+		DeviceName: challenge.DeviceName,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(cfg.TwoFactor.TrustedDeviceTTL),
+	}
+	if err := repos.TwoFactor.CreateTrustedDevice(ctx, device); err != nil {
+		return nil, "", err
+	}
+	return tokens, joinToken(device.ID, secret), nil
+}
+
+// SetupTOTP gives user a new pending authenticator app secret. Logins keep
+// using email codes until EnableTOTP confirms the app holds the secret.
+func SetupTOTP(ctx context.Context, cfg *config.Config, users repository.UserRepo, user *models.User) (*TOTPSetup, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTOTPEnabled
+	}
+	secret, err := otp.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+	if err := users.Save(ctx, user); err != nil {
+		return nil, err
+	}
+	return &TOTPSetup{Secret: secret, URI: otp.TOTPURI(cfg.TwoFactor.TOTPIssuer, user.Email, secret)}, nil
+}
+
+// EnableTOTP switches user's logins from email codes to the pending
+// authenticator app once code matches it, and returns new recovery codes.
+func EnableTOTP(ctx context.Context, cfg *config.Config, repos *repository.Repositories, user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTOTPEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotSetUp
+	}
+	now := time.Now().UTC()
+	if err := useTOTP(ctx, repos.TwoFactor, user, code, now); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		user.TOTPEnabledAt = &now
+		if err := tx.Users.Save(ctx, user); err != nil {
+			return err
+		}
+		var err error
+		codes, err = otp.IssueRecoveryCodes(ctx, cfg, tx.TwoFactor, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns user's authenticator app off after a current app or
+// recovery code; logins go back to email codes.
+func DisableTOTP(ctx context.Context, cfg *config.Config, repos *repository.Repositories, user *models.User, code string) error {
+	if user.TOTPEnabledAt == nil {
+		return ErrTOTPNotEnabled
+	}
+	if err := checkSecondFactor(ctx, cfg, repos, user, "", code, time.Now().UTC()); err != nil {
+		return err
+	}
+	return repos.Transaction(ctx, func(tx *repository.Repositories) error {
+		user.TOTPSecret = ""
+		user.TOTPEnabledAt = nil
+		if err := tx.Users.Save(ctx, user); err != nil {
+			return err
+		}
+		return tx.TwoFactor.ReplaceRecoveryCodes(ctx, user.ID, nil)
+	})
+}
+
+// RegenerateRecoveryCodes replaces user's recovery codes after a current app
+// or recovery code.
+func RegenerateRecoveryCodes(ctx context.Context, cfg *config.Config, repos *repository.Repositories, user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabledAt == nil {
+		return nil, ErrTOTPNotEnabled
+	}
+	if err := checkSecondFactor(ctx, cfg, repos, user, "", code, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return otp.IssueRecoveryCodes(ctx, cfg, repos.TwoFactor, user.ID)
+}
+
+// openChallenge returns the challenge of challengeID if it can still be
+// completed.
+func openChallenge(ctx context.Context, cfg *config.Config, store repository.TwoFactorRepo, challengeID string, now time.Time) (*models.LoginChallenge, error) {
+	id, secret, ok := splitToken(challengeID)
+	if !ok {
+		return nil, ErrInvalidChallenge
+	}
+	challenge, err := store.GetChallenge(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidChallenge
+	} else if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(challenge.SecretHash), []byte(hashSecret(secret))) ||
+		challenge.CompletedAt != nil || !now.Before(challenge.ExpiresAt) || challenge.Attempts >= cfg.OTP.MaxAttempts {
+		return nil, ErrInvalidChallenge
+	}
+	return challenge, nil
+}
+
+// checkSecondFactor verifies code for user with method, see CompleteLogin.
+func checkSecondFactor(ctx context.Context, cfg *config.Config, repos *repository.Repositories, user *models.User, method, code string, now time.Time) error {
+	methods := TwoFactorMethods(user)
+	if method == "" {
+		method = methods[0]
+		if method == models.TwoFactorTOTP && strings.ContainsFunc(code, func(r rune) bool { return (r < '0' || r > '9') && r != ' ' }) {
+			method = models.TwoFactorRecoveryCode
+		}
+	}
+	if !slices.Contains(methods, method) {
+		return ErrTwoFactorMethod
+	}
+
+	switch method {
+	case models.TwoFactorEmail:
+		_, err := otp.Verify(ctx, cfg, repos.OneTimeCodes, user.ID, code, models.CodeLogin)
+		return err
+	case models.TwoFactorTOTP:
+		return useTOTP(ctx, repos.TwoFactor, user, code, now)
+	default:
+		return otp.UseRecoveryCode(ctx, cfg, repos.TwoFactor, user.ID, code)
+	}
+}
+
+// useTOTP accepts code for user's authenticator secret once per time step.
+func useTOTP(ctx context.Context, store repository.TwoFactorRepo, user *models.User, code string, now time.Time) error {
+	step, ok := otp.ValidateTOTP(user.TOTPSecret, code, now)
+	if !ok {
+		return otp.ErrInvalid
+	}
+	fresh, err := store.UseTOTPStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return otp.ErrInvalid
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// trustedDeviceOf returns the unexpired trusted device of user that token
+// names, or nil.
+func trustedDeviceOf(ctx context.Context, store repository.TwoFactorRepo, userID uint, token string, now time.Time) (*models.TrustedDevice, error) {
+	id, secret, ok := splitToken(token)
+	if !ok {
+		return nil, nil
+	}
+	device, err := store.GetTrustedDevice(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if device.UserID != userID || !now.Before(device.ExpiresAt) ||
+		!hmac.Equal([]byte(device.TokenHash), []byte(hashSecret(secret))) {
+		return nil, nil
+	}
+	return device, nil
+}
+
+// newSecret returns a random URL-safe secret and the hash stored for it.
+func newSecret() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+	return secret, hashSecret(secret), nil
+}
+
+// hashSecret needs no key: secrets are random and too long to guess.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func joinToken(id uint, secret string) string {
+	return strconv.FormatUint(uint64(id), 10) + "." + secret
+}
+
+func splitToken(token string) (uint, string, bool) {
+	id, secret, ok := strings.Cut(token, ".")
+	n, err := strconv.ParseUint(id, 10, 0)
+	if !ok || err != nil || secret == "" {
+		return 0, "", false
+	}
+	return uint(n), secret, true
+}
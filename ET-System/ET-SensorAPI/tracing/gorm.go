@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin opens a client span around every GORM statement run with
+// WithContext under an existing trace. Statements outside a trace, such as
+// the queue's polling, are not traced so they do not each start a trace.
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", startGormSpan("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", endGormSpan),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", startGormSpan("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", endGormSpan),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", startGormSpan("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", endGormSpan),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", startGormSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", endGormSpan),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", startGormSpan("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", endGormSpan),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", startGormSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", endGormSpan),
+	)
+}
+
+func startGormSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := Start(ctx, "gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", db.Dialector.Name()),
+				attribute.String("db.sql.table", db.Statement.Table),
+			),
+		)
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endGormSpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	End(span, err)
+}
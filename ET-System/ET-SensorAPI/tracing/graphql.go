@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GraphQL is a gqlgen extension opening a span per operation and one per
+// resolver call beneath it. Trivial field reads get no span.
+type GraphQL struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.ResponseInterceptor
+	graphql.FieldInterceptor
+} = GraphQL{}
+
+func (GraphQL) ExtensionName() string {
+	return "Tracing"
+}
+
+func (GraphQL) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+func (GraphQL) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	if !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+	op := graphql.GetOperationContext(ctx)
+
+	name := op.OperationName
+	opType := ""
+	if op.Operation != nil {
+		opType = string(op.Operation.Operation)
+		if name == "" {
+			name = op.Operation.Name
+		}
+	}
+	spanName := "graphql." + opType
+	if name != "" {
+		spanName += " " + name
+	}
+
+	ctx, span := Start(ctx, spanName, trace.WithAttributes(
+		attribute.String("graphql.operation.name", name),
+		attribute.String("graphql.operation.type", opType),
+	))
+	defer span.End()
+
+	resp := next(ctx)
+	if resp != nil && len(resp.Errors) > 0 {
+		span.SetAttributes(attribute.Int("graphql.errors", len(resp.Errors)))
+		End(span, resp.Errors)
+	}
+	return resp
+}
+
+func (GraphQL) InterceptField(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := Start(ctx, "graphql.resolve "+fc.Object+"."+fc.Field.Name, trace.WithAttributes(
+		attribute.String("graphql.field.path", fc.Path().String()),
+	))
+	res, err := next(ctx)
+	End(span, err)
+	return res, err
+}
@@ -2,12 +2,9 @@ package utils
 
 import (
 	"context"
-	"crypto/rand"
 	"errors"
 	"fmt"
-	"math/big"
-	"net/smtp"
-	"os"
+	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -16,25 +13,29 @@ import (
 
 	"ET-SensorAPI/config"
 	"ET-SensorAPI/graph/model"
+	"ET-SensorAPI/mail"
 	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
 )
 
-const otpChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+// Token uses. Access tokens authenticate requests; refresh tokens only
+// renew the session they belong to.
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
 
+// Claims of the tokens of a session. Generation counts the refreshes of the
+// session so a replayed refresh token can be told from the current one.
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID     uint   `json:"user_id"`
+	SessionID  uint   `json:"sid"`
+	Generation int    `json:"gen,omitempty"`
+	Use        string `json:"use"`
 	jwt.RegisteredClaims
 }
 
-func getSecretKey() []byte {
-	key := os.Getenv("JWT_SECRET")
-	if key == "" {
-		panic("JWT_SECRET not set")
-	}
-	return []byte(key)
-}
-
-func ValidateAppleToken(token string) (map[string]interface{}, error) {
+func ValidateAppleToken(auth config.AuthConfig, token string) (map[string]interface{}, error) {
 	set, err := jwk.Fetch(context.Background(), "https://appleid.apple.com/auth/keys")
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch Apple keys: %w", err)
@@ -68,21 +69,26 @@ func ValidateAppleToken(token string) (map[string]interface{}, error) {
 		return nil, errors.New("invalid issuer")
 	}
 
-	clientID := config.GetEnv("APPLE_CLIENT_ID", "")
-	if claims["aud"] != clientID {
+	if claims["aud"] != auth.AppleClientID {
 		return nil, errors.New("invalid audience")
 	}
 
 	return claims, nil
 }
 
-func GenerateToken(userID uint) (string, string, error) {
-	secretKey := getSecretKey()
+// GenerateToken signs the access and refresh token of generation of a
+// session.
+func GenerateToken(auth config.AuthConfig, userID, sessionID uint, generation int) (string, string, error) {
+	secretKey := []byte(auth.JWTSecret)
+	now := time.Now()
 
 	accessTokenClaims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		Use:       TokenAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(auth.AccessTokenTTL)),
 		},
 	}
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
@@ -92,9 +98,13 @@ func GenerateToken(userID uint) (string, string, error) {
 	}
 
 	refreshTokenClaims := &Claims{
-		UserID: userID,
+		UserID:     userID,
+		SessionID:  sessionID,
+		Generation: generation,
+		Use:        TokenRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * 24 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(auth.RefreshTokenTTL)),
 		},
 	}
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
@@ -106,10 +116,14 @@ func GenerateToken(userID uint) (string, string, error) {
 	return accessTokenString, refreshTokenString, nil
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
-	secretKey := getSecretKey()
+// ValidateToken checks the signature and expiry of a token meant for use.
+func ValidateToken(auth config.AuthConfig, tokenString string, use string) (*Claims, error) {
+	secretKey := []byte(auth.JWTSecret)
 
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
 		return secretKey, nil
 	})
 	if err != nil {
@@ -117,26 +131,25 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	}
 
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
+	if !ok || !token.Valid || claims.Use != use || claims.SessionID == 0 {
 		return nil, errors.New("invalid token")
 	}
 
 	return claims, nil
 }
 
-func AuthenticateUser(email string, password string) (*models.User, error) {
-	var user models.User
-	result := config.DB.Where("email = ?", email).First(&user)
-	if result.Error != nil {
+func AuthenticateUser(ctx context.Context, users repository.UserRepo, email string, password string) (*models.User, error) {
+	user, err := users.GetByEmail(ctx, email)
+	if err != nil {
 		return nil, errors.New("invalid email or password")
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
 		return nil, errors.New("invalid email or password")
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func HashPassword(password string) (string, error) {
@@ -147,84 +160,30 @@ func HashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-func GenerateOTP() (string, error) {
-	otpLength := 6
-	otp := make([]byte, otpLength)
-
-	for i := range otp {
-		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(otpChars))))
-		if err != nil {
-			return "", err
-		}
-		otp[i] = otpChars[n.Int64()]
-	}
-
-	return string(otp), nil
-}
-
-func SendVerificationEmail(email, token string) error {
-	var user models.User
-	result := config.DB.Where("email = ?", email).First(&user)
-	if result.Error != nil {
-		return result.Error
-	}
-
-	from := os.Getenv("SMTP_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-	if from == "" || password == "" {
-		return errors.New("SMTP credentials are not set")
-	}
-
-	to := []string{email}
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	subjectLogin := "Subject: ECOTRACK | Login Approval Code\r\n"
-	subjectSignup := "Subject: ECOTRACK | Email Verification\r\n"
-	mime := "MIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n"
-
-	bodyTemplate := `
-	<html>
-	<body style="font-family: Arial, sans-serif; background-color: #f4f4f4; padding: 20px; text-align: center;">
-		<div style="max-width: 500px; background-color: #ffffff; padding: 20px; margin: 0 auto; border-radius: 8px; box-shadow: 0 0 10px rgba(0, 0, 0, 0.1); text-align: center;">
-		<div style="background-color: #63AF2F; padding: 20px; border-top-left-radius: 8px; border-top-right-radius: 8px;">
-			<img src="https://api2.interphaselabs.com/media/images/logo.png" alt="EcoTrack Logo" style="max-width: 300px; margin-bottom: 10px;" />
-		</div>
-		<h2 style="color: #333;">Verification Code</h2>
-		<p style="font-size: 16px; color: #555;">Hi!</p>
-		<p style="font-size: 16px; color: #555;">%s</p>
-		<div style="font-size: 32px; font-weight: bold; color: #000; letter-spacing: 5px; padding: 10px; border: 2px solid #ddd; display: inline-block; margin: 20px 0;">
-			%s
-		</div>
-		<p style="font-size: 14px; color: #555;">Please complete the account verification process in <b>15 minutes</b>.</p>
-		<p style="font-size: 14px; color: #63AF2F; font-weight: bold;">EcoTrack</p>
-		<p style="font-size: 12px; color: #888; margin-top: 20px;">This is an automated email. Please do not reply to this email.</p>
-		</div>
-	</body>
-	</html>`
-
-	var message []byte
-	if user.Verified {
-		body := fmt.Sprintf(bodyTemplate, "Here is your login verification code", token)
-		message = []byte(subjectLogin + mime + body)
-	} else {
-		body := fmt.Sprintf(bodyTemplate, "Here is your email verification code", token)
-		message = []byte(subjectSignup + mime + body)
+// SendVerificationEmail sends the one-time code for purpose to user.Email in
+// lang, telling them it expires after ttl.
+func SendVerificationEmail(ctx context.Context, mailer mail.Sender, lang string, user *models.User, purpose, code string, ttl time.Duration) error {
+	msg, err := mail.Render(lang, "verification", struct {
+		Purpose string
+		Code    string
+		Minutes int
+	}{purpose, code, int(ttl.Round(time.Minute) / time.Minute)})
+	if err != nil {
+		return err
 	}
+	msg.To = []string{user.Email}
 
-	auth := smtp.PlainAuth("", from, password, smtpHost)
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, to, message)
-	if err != nil {
+	if err := mailer.Send(ctx, msg); err != nil {
 		return err
 	}
 
-	fmt.Println("Verification Email Sent!")
+	slog.InfoContext(ctx, "verification email sent", "user_id", user.ID, "purpose", purpose, "language", lang)
 	return nil
 }
 
 func ConvertToGQLUser(u models.User) *model.User {
 	// Always return empty slice for nested memberships to prevent infinite loops
-	return &model.User{
+	gqlUser := &model.User{
 		ID:          fmt.Sprintf("%d", u.ID),
 		Email:       u.Email,
 		DisplayName: &u.DisplayName,
@@ -232,6 +191,13 @@ func ConvertToGQLUser(u models.User) *model.User {
 		CreatedAt:   u.CreatedAt,
 		Memberships: []*model.UserGroupMember{}, // Explicit empty array
 	}
+	if u.Timezone != "" {
+		gqlUser.Timezone = &u.Timezone
+	}
+	if u.Language != "" {
+		gqlUser.Language = &u.Language
+	}
+	return gqlUser
 }
 
 // For the main authenticated user (with memberships)
@@ -284,5 +250,6 @@ func ConvertToGQLGroup(g models.UserGroup) *model.UserGroup {
 		Name:      g.Name,
 		CreatedAt: g.CreatedAt,
 		Location:  g.Location,
+		Timezone:  GroupTimezoneName(g),
 	}
 }
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"ET-SensorAPI/graph/model"
+	"ET-SensorAPI/repository"
+	"context"
+	"fmt"
+	"time"
+)
+
+// ComparisonWindows returns the current, previous and same-period-last-year
+// windows for period, offset periods back from now. When the current period
+// is still running the other two windows end at the same point of their own
+// period on the calendar, e.g. the 15th at noon, and never run past it.
+func ComparisonWindows(period model.ComparisonPeriod, now time.Time, offset int, loc *time.Location) (current, previous, lastYear repository.UsageWindow, err error) {
+	if offset < 0 {
+		return current, previous, lastYear, fmt.Errorf("offset must not be negative")
+	}
+
+	var start time.Time
+	switch period {
+	case model.ComparisonPeriodDay:
+		start = TruncateToBucket(now, model.UsageBucketDay, loc)
+	case model.ComparisonPeriodWeek:
+		start = TruncateToBucket(now, model.UsageBucketWeek, loc)
+	case model.ComparisonPeriodMonth:
+		start = TruncateToBucket(now, model.UsageBucketMonth, loc)
+	case model.ComparisonPeriodYear:
+		local := now.In(loc)
+		start = time.Date(local.Year(), 1, 1, 0, 0, 0, 0, loc)
+	default:
+		return current, previous, lastYear, fmt.Errorf("unsupported period: %s", period)
+	}
+
+	start = shiftPeriod(start, period, -offset)
+	current = repository.UsageWindow{Start: start, End: shiftPeriod(start, period, 1)}
+	previous = repository.UsageWindow{Start: shiftPeriod(start, period, -1), End: start}
+	lastYear = repository.UsageWindow{Start: start.AddDate(-1, 0, 0), End: current.End.AddDate(-1, 0, 0)}
+
+	if now.Before(current.End) {
+		current.End = now
+		previous.End = sameElapsed(previous.Start, current.Start, now, period, loc)
+		lastYear.End = sameElapsed(lastYear.Start, current.Start, now, period, loc)
+	}
+
+	return current, previous, lastYear, nil
+}
+
+// sameElapsed returns the point of the period starting at start that lies
+// as far into it on the calendar as now lies into the period starting at
+// from. Counting days and wall-clock time rather than a duration keeps
+// DST changes out; days the shorter period lacks, such as the 31st in
+// February, are capped at its end so the windows never overlap.
+func sameElapsed(start, from, now time.Time, period model.ComparisonPeriod, loc *time.Location) time.Time {
+	from, now = from.In(loc), now.In(loc)
+	var months, days int
+	switch period {
+	case model.ComparisonPeriodDay, model.ComparisonPeriodWeek:
+		days = civilDays(from, now)
+	default:
+		months = (now.Year()-from.Year())*12 + int(now.Month()-from.Month())
+		days = now.Day() - from.Day()
+	}
+
+	s := start.In(loc)
+	end := time.Date(s.Year(), s.Month()+time.Month(months), s.Day()+days,
+		now.Hour(), now.Minute(), now.Second(), now.Nanosecond(), loc)
+	if limit := shiftPeriod(start, period, 1); end.After(limit) {
+		return limit
+	}
+	return end
+}
+
+// civilDays counts the calendar days from the date of a to the date of b.
+func civilDays(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+func shiftPeriod(t time.Time, period model.ComparisonPeriod, n int) time.Time {
+	switch period {
+	case model.ComparisonPeriodDay:
+		return t.AddDate(0, 0, n)
+	case model.ComparisonPeriodWeek:
+		return t.AddDate(0, 0, 7*n)
+	case model.ComparisonPeriodMonth:
+		return t.AddDate(0, n, 0)
+	default:
+		return t.AddDate(n, 0, 0)
+	}
+}
+
+// SumUsageByDevice totals each device's usage inside the three windows in a
+// single pass over water_usages. Devices without readings get zero totals.
+func SumUsageByDevice(ctx context.Context, usage repository.UsageRepo, deviceIDs []string, current, previous, lastYear repository.UsageWindow) (map[string]*repository.DeviceWindowTotals, error) {
+	totals := make(map[string]*repository.DeviceWindowTotals, len(deviceIDs))
+	for _, id := range deviceIDs {
+		totals[id] = &repository.DeviceWindowTotals{DeviceID: id}
+	}
+
+	rows, err := usage.SumByWindows(ctx, deviceIDs, current, previous, lastYear)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum usage: %w", err)
+	}
+
+	for _, row := range rows {
+		if t, ok := totals[row.DeviceID]; ok {
+			*t = row
+		}
+	}
+	return totals, nil
+}
+
+// PercentChange returns nil when there is no baseline to compare against.
+func PercentChange(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	pct := (current - previous) / previous * 100
+	return &pct
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"ET-SensorAPI/graph/model"
+	"testing"
+	"time"
+)
+
+func TestComparisonWindowsFollowTheCalendar(t *testing.T) {
+	utc := time.UTC
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(loc *time.Location, y int, m time.Month, d, h int) time.Time {
+		return time.Date(y, m, d, h, 0, 0, 0, loc)
+	}
+
+	for _, tc := range []struct {
+		name                       string
+		period                     model.ComparisonPeriod
+		now                        time.Time
+		previousStart, previousEnd time.Time
+		lastYearStart, lastYearEnd time.Time
+	}{
+		{"month on Jan 31", model.ComparisonPeriodMonth, at(utc, 2025, 1, 31, 12),
+			at(utc, 2024, 12, 1, 0), at(utc, 2024, 12, 31, 12), at(utc, 2024, 1, 1, 0), at(utc, 2024, 1, 31, 12)},
+		{"month on Feb 28", model.ComparisonPeriodMonth, at(utc, 2025, 2, 28, 12),
+			at(utc, 2025, 1, 1, 0), at(utc, 2025, 1, 28, 12), at(utc, 2024, 2, 1, 0), at(utc, 2024, 2, 28, 12)},
+		{"month on Mar 31 stops at the end of February", model.ComparisonPeriodMonth, at(utc, 2025, 3, 31, 12),
+			at(utc, 2025, 2, 1, 0), at(utc, 2025, 3, 1, 0), at(utc, 2024, 3, 1, 0), at(utc, 2024, 3, 31, 12)},
+		{"month on a leap day", model.ComparisonPeriodMonth, at(utc, 2024, 2, 29, 12),
+			at(utc, 2024, 1, 1, 0), at(utc, 2024, 1, 29, 12), at(utc, 2023, 2, 1, 0), at(utc, 2023, 3, 1, 0)},
+		{"year on Dec 31 after a leap year", model.ComparisonPeriodYear, at(utc, 2025, 12, 31, 12),
+			at(utc, 2024, 1, 1, 0), at(utc, 2024, 12, 31, 12), at(utc, 2024, 1, 1, 0), at(utc, 2024, 12, 31, 12)},
+		{"year on Dec 31 of a leap year", model.ComparisonPeriodYear, at(utc, 2024, 12, 31, 12),
+			at(utc, 2023, 1, 1, 0), at(utc, 2023, 12, 31, 12), at(utc, 2023, 1, 1, 0), at(utc, 2023, 12, 31, 12)},
+		{"week after a month change", model.ComparisonPeriodWeek, at(utc, 2025, 3, 5, 12),
+			at(utc, 2025, 2, 24, 0), at(utc, 2025, 2, 26, 12), at(utc, 2024, 3, 3, 0), at(utc, 2024, 3, 5, 12)},
+		{"day after a DST change", model.ComparisonPeriodDay, at(newYork, 2025, 3, 10, 12),
+			at(newYork, 2025, 3, 9, 0), at(newYork, 2025, 3, 9, 12), at(newYork, 2024, 3, 10, 0), at(newYork, 2024, 3, 10, 12)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			current, previous, lastYear, err := ComparisonWindows(tc.period, tc.now, 0, tc.now.Location())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !current.End.Equal(tc.now) {
+				t.Errorf("current should end now, got %s", current.End)
+			}
+			if !previous.Start.Equal(tc.previousStart) || !previous.End.Equal(tc.previousEnd) {
+				t.Errorf("previous: got %s → %s, want %s → %s", previous.Start, previous.End, tc.previousStart, tc.previousEnd)
+			}
+			if !lastYear.Start.Equal(tc.lastYearStart) || !lastYear.End.Equal(tc.lastYearEnd) {
+				t.Errorf("last year: got %s → %s, want %s → %s", lastYear.Start, lastYear.End, tc.lastYearStart, tc.lastYearEnd)
+			}
+			if previous.End.After(current.Start) {
+				t.Errorf("previous overlaps the current period")
+			}
+		})
+	}
+}
+
+func TestComparisonWindowsOfPastPeriods(t *testing.T) {
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+	current, previous, _, err := ComparisonWindows(model.ComparisonPeriodMonth, now, 1, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current.Start.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)) || !current.End.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected current window %+v", current)
+	}
+	if !previous.End.Equal(current.Start) {
+		t.Fatalf("a finished period should be compared in full, got %+v", previous)
+	}
+}
@@ -1,65 +1,136 @@
 package utils
 
 import (
-	config "ET-SensorAPI/config"
 	"ET-SensorAPI/graph/model"
 	models "ET-SensorAPI/models"
-	"errors"
-	"strconv"
-
-	"gorm.io/gorm"
+	"fmt"
 )
 
 func String(v string) *string {
 	return &v
 }
 
+// StringValue returns the value of an optional argument, or "".
+func StringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
 func Int32(v int) int32 {
 	return int32(v)
 }
 
-func FetchUserGroupIDs(userID uint) []int {
-	var memberships []models.UserGroupMember
-	config.DB.Where("user_id = ?", userID).Find(&memberships)
-	var ids []int
-	for _, m := range memberships {
-		ids = append(ids, int(m.UserGroupID))
+func DeviceIDs(devices []models.Device) []string {
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
 	}
 	return ids
 }
 
-func FetchGroupUsers(groupID uint) []*model.User {
-	var members []models.UserGroupMember
-	config.DB.Where("user_group_id = ?", groupID).Find(&members)
-	userIDs := make([]uint, 0, len(members))
-	for _, m := range members {
-		userIDs = append(userIDs, m.UserID)
-	}
-	var users []models.User
-	if len(userIDs) > 0 {
-		config.DB.Where("id IN ?", userIDs).Find(&users)
-	}
-	result := make([]*model.User, 0, len(users))
-	for _, u := range users {
-		displayName := &u.DisplayName
-		result = append(result, &model.User{
-			ID:          strconv.Itoa(int(u.ID)),
-			Email:       u.Email,
-			DisplayName: displayName,
-			Verified:    u.Verified,
-			CreatedAt:   u.CreatedAt,
-		})
-	}
-	return result
+// IntPtr converts an optional GraphQL Int argument.
+func IntPtr(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(*v)
+	return &i
+}
+
+func ConvertToGQLRetentionPolicy(groupID uint, rawDays, minuteDays, maxAgeDays int) *model.RetentionPolicy {
+	return &model.RetentionPolicy{
+		GroupID:    int32(groupID),
+		RawDays:    int32(rawDays),
+		MinuteDays: int32(minuteDays),
+		MaxAgeDays: int32(maxAgeDays),
+	}
+}
+
+func ConvertToGQLJobRun(run models.JobRun) *model.JobRun {
+	gqlRun := &model.JobRun{
+		ID:          fmt.Sprintf("%d", run.ID),
+		Job:         run.Job,
+		Trigger:     run.Trigger,
+		Status:      run.Status,
+		ScheduledAt: run.ScheduledAt,
+		StartedAt:   run.StartedAt,
+		FinishedAt:  run.FinishedAt,
+		Instance:    run.Instance,
+	}
+	if run.Error != "" {
+		gqlRun.Error = &run.Error
+	}
+	return gqlRun
+}
+
+func ConvertToGQLQueueJob(job models.QueueJob) *model.QueueJob {
+	gqlJob := &model.QueueJob{
+		ID:         fmt.Sprintf("%d", job.ID),
+		Queue:      job.Queue,
+		Kind:       job.Kind,
+		Status:     job.Status,
+		Attempts:   int32(job.Attempts),
+		RunAt:      job.RunAt,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	if job.LastError != "" {
+		gqlJob.LastError = &job.LastError
+	}
+	return gqlJob
+}
+
+// ConvertToGQLUsageAnalysis reports a dead analysis job as failed without
+// exposing the upstream error.
+func ConvertToGQLUsageAnalysis(job models.QueueJob) *model.UsageAnalysis {
+	analysis := &model.UsageAnalysis{
+		ID:         fmt.Sprintf("%d", job.ID),
+		Status:     job.Status,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+	switch job.Status {
+	case models.QueueSucceeded:
+		analysis.Analysis = &job.Result
+	case models.QueueDead:
+		analysis.Status = "failed"
+		analysis.Error = String("analysis failed")
+	}
+	return analysis
+}
+
+// ConvertToGQLSession marks the session of the caller as current.
+func ConvertToGQLSession(session models.Session, currentID uint) *model.Session {
+	gqlSession := &model.Session{
+		ID:         fmt.Sprintf("%d", session.ID),
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID == currentID,
+	}
+	if session.DeviceName != "" {
+		gqlSession.DeviceName = &session.DeviceName
+	}
+	if session.IP != "" {
+		gqlSession.IP = &session.IP
+	}
+	if session.UserAgent != "" {
+		gqlSession.UserAgent = &session.UserAgent
+	}
+	return gqlSession
 }
 
-func FetchDeviceByID(deviceID string) (*models.Device, error) {
-	var device models.Device
-	if err := config.DB.First(&device, deviceID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("device not found")
-		}
-		return nil, err
-	}
-	return &device, nil
+func ConvertToGQLTrustedDevice(device models.TrustedDevice) *model.TrustedDevice {
+	gqlDevice := &model.TrustedDevice{
+		ID:         fmt.Sprintf("%d", device.ID),
+		CreatedAt:  device.CreatedAt,
+		LastUsedAt: device.LastUsedAt,
+		ExpiresAt:  device.ExpiresAt,
+	}
+	if device.DeviceName != "" {
+		gqlDevice.DeviceName = &device.DeviceName
+	}
+	return gqlDevice
 }
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"ET-SensorAPI/i18n"
+	"ET-SensorAPI/models"
+	"fmt"
+	"strings"
+)
+
+// ValidateLanguage accepts a supported language code, or "" for the server
+// default.
+func ValidateLanguage(lang string) error {
+	if lang == "" || i18n.Supported(lang) {
+		return nil
+	}
+	return fmt.Errorf("unsupported language %q, use one of: %s", lang, strings.Join(i18n.Languages(), ", "))
+}
+
+// NotificationMessage renders a stored notification in lang. Rows written
+// before message keys were stored keep their original text.
+func NotificationMessage(n models.Notification, lang string) string {
+	if n.MessageKey == "" {
+		return n.Message
+	}
+	return i18n.T(lang, n.MessageKey, n.Threshold)
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"errors"
+	"unicode"
+)
+
+// Passwords are bcrypt hashed, which ignores everything past 72 bytes.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+// ValidatePassword enforces the password policy: 8 to 72 bytes with at
+// least one letter and one digit.
+func ValidatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return errors.New("password must be between 8 and 72 characters long")
+	}
+	var letter, digit bool
+	for _, r := range password {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+	if !letter || !digit {
+		return errors.New("password must contain at least one letter and one digit")
+	}
+	return nil
+}
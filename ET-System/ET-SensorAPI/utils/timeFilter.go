@@ -29,19 +29,21 @@ type YearlyData struct {
 	AvgFlow    float64        `json:"avgFlow"`
 }
 
-func GetTimeRange(filter string, now time.Time) (time.Time, time.Time, error) {
-	now = now.UTC()
+// GetTimeRange returns the current day, week, month or year as seen from loc.
+func GetTimeRange(filter string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
 	switch filter {
 	case "1d":
-		return now.Truncate(24 * time.Hour), now.Add(24 * time.Hour), nil
+		start := StartOfDay(now, loc)
+		return start, start.AddDate(0, 0, 1), nil
 	case "1w":
-		start := now.AddDate(0, 0, -int(now.Weekday())+1)
-		return start.Truncate(24 * time.Hour), start.AddDate(0, 0, 7), nil
+		start := TruncateToBucket(now, model.UsageBucketWeek, loc)
+		return start, start.AddDate(0, 0, 7), nil
 	case "1m":
-		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		start := TruncateToBucket(now, model.UsageBucketMonth, loc)
 		return start, start.AddDate(0, 1, 0), nil
 	case "1y":
-		start := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		local := now.In(loc)
+		start := time.Date(local.Year(), 1, 1, 0, 0, 0, 0, loc)
 		return start, start.AddDate(1, 0, 0), nil
 	default:
 		return time.Time{}, time.Time{}, fmt.Errorf("invalid time filter: %s", filter)
@@ -49,11 +51,17 @@ func GetTimeRange(filter string, now time.Time) (time.Time, time.Time, error) {
 }
 
 func ConvertToGQLDevice(d models.Device) *model.Device {
+	group := ConvertToGQLGroup(d.UserGroup)
+	if d.UserGroup.ID == 0 {
+		group.ID = fmt.Sprintf("%d", d.UserGroupID)
+	}
 	return &model.Device{
-		ID:        d.ID,
-		Name:      d.Name,
-		Location:  d.Location,
-		CreatedAt: d.CreatedAt,
+		ID:          d.ID,
+		Name:        d.Name,
+		Location:    d.Location,
+		CreatedAt:   d.CreatedAt,
+		UserGroup:   group,
+		WaterUsages: []*model.WaterUsage{},
 	}
 
 }
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"ET-SensorAPI/models"
+	"ET-SensorAPI/repository"
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultTimezone is used for groups and users that have not chosen one.
+// The sensors and most users are in Indonesia (UTC+7).
+var defaultTimezone = "Asia/Jakarta"
+
+// SetDefaultTimezone replaces the fallback timezone; main sets it from the
+// validated config at startup.
+func SetDefaultTimezone(name string) {
+	defaultTimezone = name
+}
+
+func DefaultTimezone() string {
+	return defaultTimezone
+}
+
+func DefaultLocation() *time.Location {
+	loc, err := time.LoadLocation(DefaultTimezone())
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ValidateTimezone checks that name is a known IANA timezone.
+func ValidateTimezone(name string) error {
+	if name == "" {
+		return fmt.Errorf("timezone is required")
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("invalid timezone: %s", name)
+	}
+	return nil
+}
+
+// ResolveLocation picks the user's override, then the group's timezone, then
+// the default. Either argument may be nil.
+func ResolveLocation(user *models.User, group *models.UserGroup) *time.Location {
+	for _, name := range []string{userTimezone(user), groupTimezone(group)} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return DefaultLocation()
+}
+
+func GroupLocation(ctx context.Context, groups repository.GroupRepo, groupID uint) *time.Location {
+	group, err := groups.GetByID(ctx, groupID)
+	if err != nil {
+		return DefaultLocation()
+	}
+	return ResolveLocation(nil, group)
+}
+
+func DeviceLocation(ctx context.Context, devices repository.DeviceRepo, deviceID string) *time.Location {
+	device, err := devices.GetByID(ctx, deviceID)
+	if err != nil {
+		return DefaultLocation()
+	}
+	return ResolveLocation(nil, &device.UserGroup)
+}
+
+func UserLocation(ctx context.Context, repos *repository.Repositories, userID uint) *time.Location {
+	user, err := repos.Users.GetByID(ctx, userID)
+	if err != nil {
+		return DefaultLocation()
+	}
+	if user.Timezone != "" {
+		return ResolveLocation(user, nil)
+	}
+
+	// Without an override, use the timezone of the user's first group.
+	memberships, err := repos.Groups.MembershipsOfUser(ctx, userID)
+	if err != nil || len(memberships) == 0 {
+		return DefaultLocation()
+	}
+	return ResolveLocation(nil, &memberships[0].UserGroup)
+}
+
+// GroupTimezoneName is the effective timezone shown for a group.
+func GroupTimezoneName(g models.UserGroup) string {
+	return ResolveLocation(nil, &g).String()
+}
+
+// StartOfDay returns local midnight of the day containing t in loc.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+func userTimezone(user *models.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Timezone
+}
+
+func groupTimezone(group *models.UserGroup) string {
+	if group == nil {
+		return ""
+	}
+	return group.Timezone
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"ET-SensorAPI/graph/model"
+	"ET-SensorAPI/repository"
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxSeriesBuckets caps how many zero-filled points a single usageSeries
+// request may produce, e.g. a year of MINUTE buckets.
+const maxSeriesBuckets = 10000
+
+var bucketUnits = map[model.UsageBucket]string{
+	model.UsageBucketMinute: "minute",
+	model.UsageBucketHour:   "hour",
+	model.UsageBucketDay:    "day",
+	model.UsageBucketWeek:   "week",
+	model.UsageBucketMonth:  "month",
+}
+
+// TruncateToBucket returns the start of the bucket containing t, using the
+// wall clock of loc. Weeks start on Monday like GetTimeRange's "1w".
+func TruncateToBucket(t time.Time, bucket model.UsageBucket, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch bucket {
+	case model.UsageBucketMinute:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+	case model.UsageBucketHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case model.UsageBucketWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+	case model.UsageBucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// NextBucket returns the start of the bucket following start.
+func NextBucket(start time.Time, bucket model.UsageBucket) time.Time {
+	switch bucket {
+	case model.UsageBucketMinute:
+		return start.Add(time.Minute)
+	case model.UsageBucketHour:
+		return start.Add(time.Hour)
+	case model.UsageBucketWeek:
+		return start.AddDate(0, 0, 7)
+	case model.UsageBucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// GetUsageSeries aggregates readings of the given devices in [from, to) into
+// buckets on the database and zero-fills buckets without readings.
+func GetUsageSeries(ctx context.Context, usage repository.UsageRepo, deviceIDs []string, from, to time.Time, bucket model.UsageBucket, loc *time.Location) ([]*model.UsageSeriesPoint, error) {
+	unit, ok := bucketUnits[bucket]
+	if !ok {
+		return nil, fmt.Errorf("unsupported bucket: %s", bucket)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	first := TruncateToBucket(from, bucket, loc)
+	count := 0
+	for t := first; t.Before(to); t = NextBucket(t, bucket) {
+		count++
+		if count > maxSeriesBuckets {
+			return nil, fmt.Errorf("time range too large for %s buckets (max %d points)", bucket, maxSeriesBuckets)
+		}
+	}
+
+	rows, err := usage.Series(ctx, deviceIDs, from, to, unit, loc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+
+	// Series yields the local wall clock of the bucket start, so it is
+	// re-anchored in loc before matching against the generated buckets.
+	byStart := make(map[int64]repository.UsageBucketRow, len(rows))
+	for _, row := range rows {
+		b := row.Bucket
+		start := time.Date(b.Year(), b.Month(), b.Day(), b.Hour(), b.Minute(), 0, 0, loc)
+		byStart[start.Unix()] = row
+	}
+
+	points := make([]*model.UsageSeriesPoint, 0, count)
+	for t := first; t.Before(to); t = NextBucket(t, bucket) {
+		point := &model.UsageSeriesPoint{BucketStart: t}
+		if row, ok := byStart[t.Unix()]; ok {
+			point.TotalUsage = row.TotalUsage
+			point.AvgFlow = row.AvgFlow
+			point.MaxFlow = row.MaxFlow
+			point.Samples = int32(row.Samples)
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
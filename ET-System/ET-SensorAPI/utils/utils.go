@@ -1,133 +1,102 @@
 package utils
 
 import (
-	"ET-SensorAPI/config"
+	"ET-SensorAPI/mail"
 	"ET-SensorAPI/models"
-	"errors"
-	"fmt"
-	"net/smtp"
-	"os"
+	"ET-SensorAPI/repository"
+	"context"
+	"log/slog"
 	"strings"
 	"time"
 )
 
-func GetUserUsageData(userID uint) ([]models.WaterUsage, error) {
+func GetUserUsageData(ctx context.Context, repos *repository.Repositories, userID uint) ([]models.WaterUsage, error) {
 	startTime := time.Now().AddDate(0, -3, 0)
 
-	var waterUsage []models.WaterUsage
-
-	subQuery := config.DB.
-		Table("devices").
-		Select("devices.id").
-		Joins("JOIN user_groups ON user_groups.id = devices.user_group_id").
-		Joins("JOIN user_group_members ON user_group_members.user_group_id = user_groups.id").
-		Where("user_group_members.user_id = ?", userID)
+	memberships, err := repos.Groups.MembershipsOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	groupIDs := make([]uint, len(memberships))
+	for i, m := range memberships {
+		groupIDs[i] = m.UserGroupID
+	}
 
-	err := config.DB.
-		Where("device_id IN (?) AND recorded_at >= ?", subQuery, startTime).
-		Find(&waterUsage).Error
+	devices, err := repos.Devices.ListByGroups(ctx, groupIDs)
+	if err != nil {
+		return nil, err
+	}
 
+	waterUsage, err := repos.Usage.ListSince(ctx, startTime, DeviceIDs(devices))
 	if err != nil {
 		return nil, err
 	}
 
+	localizeUsage(waterUsage, UserLocation(ctx, repos, userID))
 	return waterUsage, nil
 }
 
-func GetGroupUsageData(groupID uint) ([]models.WaterUsage, error) {
+func GetGroupUsageData(ctx context.Context, repos *repository.Repositories, groupID uint) ([]models.WaterUsage, error) {
 	startTime := time.Now().AddDate(0, -3, 0)
 
-	var waterUsage []models.WaterUsage
-
-	subQuery := config.DB.
-		Table("devices").
-		Select("devices.id").
-		Joins("JOIN user_groups ON user_groups.id = devices.user_group_id").
-		Where("user_groups.id = ?", groupID)
-
-	err := config.DB.
-		Where("device_id IN (?) AND recorded_at >= ?", subQuery, startTime).
-		Find(&waterUsage).Error
+	devices, err := repos.Devices.ListByGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
 
+	waterUsage, err := repos.Usage.ListSince(ctx, startTime, DeviceIDs(devices))
 	if err != nil {
 		return nil, err
 	}
 
+	localizeUsage(waterUsage, GroupLocation(ctx, repos.Groups, groupID))
 	return waterUsage, nil
 }
 
-func GetUserByEmail(email string) (*models.User, error) {
-	var user models.User
-	if err := config.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, err
+// localizeUsage shifts timestamps into loc so the AI summary reasons about
+// the household's local days rather than UTC.
+func localizeUsage(usages []models.WaterUsage, loc *time.Location) {
+	for i := range usages {
+		usages[i].RecordedAt = usages[i].RecordedAt.In(loc)
 	}
-	return &user, nil
 }
 
-func SendInvitationEmail(senderEmail string, receiverEmail string, groupName string) error {
-	var user models.User
-	sender := config.DB.Where("email = ?", senderEmail).First(&user)
-	if sender.Error != nil {
-		return sender.Error
+// SendInvitationEmail tells receiverEmail, in lang, that senderEmail added
+// them to groupName.
+func SendInvitationEmail(ctx context.Context, mailer mail.Sender, lang string, senderEmail string, receiverEmail string, groupName string) error {
+	msg, err := mail.Render(lang, "invitation", struct {
+		Group  string
+		Sender string
+	}{groupName, senderEmail})
+	if err != nil {
+		return err
 	}
+	msg.To = []string{receiverEmail}
 
-	from := os.Getenv("SMTP_EMAIL")
-	password := os.Getenv("SMTP_PASSWORD")
-	if from == "" || password == "" {
-		return errors.New("SMTP credentials are not set")
+	if err := mailer.Send(ctx, msg); err != nil {
+		return err
 	}
 
-	to := []string{receiverEmail}
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	subject := "Subject: ECOTRACK | You Have Been Invited To Join Group\r\n"
-	mime := "MIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n"
-
-	bodyTemplate := `
-	<html>
-	<body style="font-family: Arial, sans-serif; background-color: #f4f4f4; padding: 20px; text-align: center;">
-		<div style="max-width: 500px; background-color: #ffffff; padding: 20px; margin: 0 auto; border-radius: 8px; box-shadow: 0 0 10px rgba(0, 0, 0, 0.1); text-align: center;">
-		<div style="background-color: #63AF2F; padding: 20px; border-top-left-radius: 8px; border-top-right-radius: 8px;">
-			<img src="https://api2.interphaselabs.com/media/images/logo.png" alt="EcoTrack Logo" style="max-width: 300px; margin-bottom: 10px;" />
-		</div>
-		<h2 style="color: #333;">Group Invitation</h2>
-		<p style="font-size: 16px; color: #555;">Hi!</p>
-		<p style="font-size: 16px; color: #555;">You've been invited to join <b>%s</b> group on EcoTrack.</p>
-		
-		<div style="margin: 30px auto; width: 85%%; border-radius: 12px; overflow: hidden; box-shadow: 0 5px 15px rgba(0,0,0,0.08);">
-			<div style="background-color: #63AF2F; color: white; padding: 12px 15px; text-align: left; font-size: 16px; font-weight: bold; letter-spacing: 0.5px; border-bottom: 3px solid rgba(0,0,0,0.1);">
-				Group Details
-			</div>
-			<div style="background-color: #f9f9f9; padding: 0; border: 1px solid #eaeaea; border-top: none;">
-				<div style="padding: 15px; border-bottom: 1px solid #eaeaea; display: flex; text-align: left;">
-					<div style="width: 35%%; font-size: 15px; color: #666; font-weight: 600; padding-right: 10px;">Group:</div>
-					<div style="width: 65%%; font-size: 16px; color: #333; font-weight: 500;">%s</div>
-				</div>
-				<div style="padding: 15px; text-align: left; display: flex;">
-					<div style="width: 35%%; font-size: 15px; color: #666; font-weight: 600; padding-right: 10px;">Invited by:</div>
-					<div style="width: 65%%; font-size: 16px; color: #333; font-weight: 500;">%s</div>
-				</div>
-			</div>
-		</div>
-		
-		<p style="font-size: 14px; color: #555;">Please log in to your EcoTrack account to view group.</p>
-		<p style="font-size: 14px; color: #63AF2F; font-weight: bold;">EcoTrack</p>
-		<p style="font-size: 12px; color: #888; margin-top: 20px;">This is an automated email. Please do not reply to this email.</p>
-		</div>
-	</body>
-</html>`
-
-	body := fmt.Sprintf(bodyTemplate, groupName, groupName, senderEmail)
-	message := []byte(subject + mime + body)
-
-	auth := smtp.PlainAuth("", from, password, smtpHost)
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, to, message)
+	slog.InfoContext(ctx, "invitation email sent", "group", groupName, "language", lang)
+	return nil
+}
+
+// SendPasswordChangedEmail tells email in lang that its password was
+// changed at changedAt, shown in loc.
+func SendPasswordChangedEmail(ctx context.Context, mailer mail.Sender, lang string, email string, changedAt time.Time, loc *time.Location) error {
+	msg, err := mail.Render(lang, "password_changed", struct {
+		ChangedAt string
+	}{changedAt.In(loc).Format("2 Jan 2006 15:04 MST")})
 	if err != nil {
 		return err
 	}
+	msg.To = []string{email}
+
+	if err := mailer.Send(ctx, msg); err != nil {
+		return err
+	}
 
-	fmt.Println("Invitation Email Sent!")
+	slog.InfoContext(ctx, "password changed email sent", "language", lang)
 	return nil
 }
 